@@ -1,22 +1,62 @@
 package main
 
 import (
+	"context"
+	"database/sql"
+	"errors"
+	"net"
 	"net/http"
 	"os"
 	"os/signal"
 	"syscall"
+	"time"
+	_ "time/tzdata" // cron timezones in minimal container images
 
+	"github.com/google/uuid"
 	"github.com/gorilla/websocket"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"github.com/rs/zerolog"
 	"github.com/rs/zerolog/log"
 
+	"github.com/cypherlabdev/notification-service/internal/campaigns"
+	"github.com/cypherlabdev/notification-service/internal/capping"
+	"github.com/cypherlabdev/notification-service/internal/chatops"
+	"github.com/cypherlabdev/notification-service/internal/dedup"
+	"github.com/cypherlabdev/notification-service/internal/digest"
+	"github.com/cypherlabdev/notification-service/internal/dlq"
+	"github.com/cypherlabdev/notification-service/internal/groups"
+	"github.com/cypherlabdev/notification-service/internal/health"
+	"github.com/cypherlabdev/notification-service/internal/notify"
+	"github.com/cypherlabdev/notification-service/internal/publish"
+	"github.com/cypherlabdev/notification-service/internal/quiethours"
+	"github.com/cypherlabdev/notification-service/internal/scheduler"
+	"github.com/cypherlabdev/notification-service/internal/segments"
+	"github.com/cypherlabdev/notification-service/internal/sqlite"
+	"github.com/cypherlabdev/notification-service/internal/status"
+	"github.com/cypherlabdev/notification-service/internal/webhook"
 	ws "github.com/cypherlabdev/notification-service/internal/websocket"
 )
 
+const (
+	// drainDelay gives load balancers time to observe the failing readiness
+	// probe before the listener stops accepting new sockets
+	drainDelay      = 5 * time.Second
+	shutdownTimeout = 10 * time.Second
+	// idempotencyWindow is how long a retried request or event is suppressed
+	idempotencyWindow = 24 * time.Hour
+	// purgeInterval is how often expired rows are deleted from the database
+	purgeInterval = 10 * time.Minute
+	// webhookLogRetention is how long webhook delivery attempts stay listed
+	webhookLogRetention = 7 * 24 * time.Hour
+)
+
 var upgrader = websocket.Upgrader{
 	ReadBufferSize:  1024,
 	WriteBufferSize: 1024,
+	Subprotocols:    ws.Subprotocols,
+	// Negotiated per connection; whether a frame is compressed is decided
+	// by the hub's CompressionConfig
+	EnableCompression: true,
 	CheckOrigin: func(r *http.Request) bool {
 		return true // TODO: Implement proper origin checking
 	},
@@ -32,27 +72,200 @@ func main() {
 	log.Logger = logger
 	logger.Info().Msg("notification-service starting")
 
+	db := openDatabase(logger)
+	defer db.Close()
+	sweepCtx, stopSweeps := context.WithCancel(context.Background())
+
 	// Create WebSocket hub
-	hub := ws.NewHub(logger)
-	go hub.Run()
+	limiter := ws.NewLimiter(ws.DefaultLimitConfig())
+	// TODO: Register inbox.count and orders.snapshot once the inbox and
+	// order stores are wired in; subscriptions.list is built in
+	rpc := ws.NewRPCRouter()
+	// TODO: Back group membership with a shared store so every replica
+	// resolves the same audience
+	groupStore := groups.NewMemoryStore()
+	deadLetterStore := dlq.NewSQLStore(db)
+	migrate(logger, "dlq", deadLetterStore)
+	deadLetters := dlq.New(deadLetterStore, logger)
+	statuses := status.NewSQLStore(db)
+	migrate(logger, "status", statuses)
+	tracker := status.New(statuses, logger)
+	trackerCtx, stopTracker := context.WithCancel(context.Background())
+	trackerDone := make(chan struct{})
+	go func() {
+		tracker.Run(trackerCtx)
+		close(trackerDone)
+	}()
+	hub := ws.NewHub(logger,
+		ws.WithLimiter(limiter),
+		ws.WithCompression(ws.DefaultCompressionConfig()),
+		ws.WithRPC(rpc),
+		ws.WithGroups(groupStore),
+		ws.WithDeadLetter(deadLetters.FromHub),
+		ws.WithStatus(tracker.FromHub),
+	)
+	hubCtx, stopHub := context.WithCancel(context.Background())
+	go hub.Run(hubCtx)
+
+	idempotencyKeys := dedup.NewSQLStore(db)
+	migrate(logger, "dedup", idempotencyKeys)
+	go sweep(sweepCtx, logger, "dedup", purgeInterval, func(ctx context.Context) error {
+		_, err := idempotencyKeys.Purge(ctx)
+		return err
+	})
+	dedupStore := dedup.NewLayeredStore(dedup.NewMemoryStore(0), idempotencyKeys)
+	endpoints := webhook.NewSQLStore(db)
+	migrate(logger, "webhook", endpoints)
+	go sweep(sweepCtx, logger, "webhook", purgeInterval, func(ctx context.Context) error {
+		_, err := endpoints.PruneDeliveries(ctx, time.Now().Add(-webhookLogRetention))
+		return err
+	})
+	webhookChannel := webhook.NewChannel(endpoints, logger,
+		webhook.WithDeadLetters(deadLetters),
+		webhook.WithTracker(tracker),
+	)
+	// Digests and quiet hours apply to the channels that reach the user;
+	// webhooks and chat-ops alerts go out at once.
+	// TODO: Digests go out over the websocket until there is an email
+	// channel
+	digestStore := digest.NewSQLStore(db)
+	migrate(logger, "digest", digestStore)
+	digests := digest.New(digestStore, logger, digest.WithChannels(notify.ChannelWebSocket))
+	quietStore := quiethours.NewSQLStore(db)
+	migrate(logger, "quiethours", quietStore)
+	quietHours := quiethours.New(quietStore, logger, quiethours.WithChannels(notify.ChannelWebSocket))
+	// TODO: Cap push and SMS once those channels exist
+	capStore := capping.NewSQLStore(db)
+	migrate(logger, "capping", capStore)
+	caps := capping.New(capStore, capRules(logger), logger,
+		capping.WithDeadLetters(deadLetters),
+		capping.WithQuietHours(quietHours),
+		capping.WithTracker(tracker),
+	)
+	dispatcher := notify.NewDispatcher(logger,
+		notify.WithChannels(caps.Wrap(notify.NewWebSocketChannel(hub)), webhookChannel),
+		notify.WithChannels(chatOpsChannels(logger)...),
+		notify.WithHolders(digests, quietHours),
+		notify.WithDedup(dedupStore, idempotencyWindow),
+		notify.WithDeadLetters(deadLetters),
+		notify.WithTracker(tracker),
+	)
+	digestCtx, stopDigests := context.WithCancel(context.Background())
+	digestsDone := make(chan struct{})
+	go func() {
+		digests.Run(digestCtx, dispatcher)
+		close(digestsDone)
+	}()
+	capsCtx, stopCaps := context.WithCancel(context.Background())
+	capsDone := make(chan struct{})
+	go func() {
+		caps.Run(capsCtx)
+		close(capsDone)
+	}()
+	quietCtx, stopQuietHours := context.WithCancel(context.Background())
+	quietDone := make(chan struct{})
+	go func() {
+		quietHours.Run(quietCtx, dispatcher)
+		close(quietDone)
+	}()
+	// TODO: Fill the attributes from the account service's user-attribute
+	// feed
+	attributes := segments.NewSQLStore(db, "user_attributes")
+	migrate(logger, "segments", attributes)
+	campaignService := campaigns.NewService(attributes, dispatcher, logger)
+
+	jobs := scheduler.NewSQLStore(db)
+	migrate(logger, "scheduler", jobs)
+	sched := scheduler.New(jobs, dispatcher, logger)
+	schedCtx, stopScheduler := context.WithCancel(context.Background())
+	schedDone := make(chan struct{})
+	go func() {
+		sched.Run(schedCtx)
+		close(schedDone)
+	}()
+
+	// Health checks
+	checker := health.NewChecker(logger)
+	checker.AddLivenessCheck("hub", hub.Ping)
+	checker.AddReadinessCheck("hub", hub.Ping)
+	// Bounded by the checker's per-check timeout, so a locked or unreachable
+	// database file fails the probe rather than hanging it
+	checker.AddReadinessCheck("sqlite", db.PingContext)
 
 	// HTTP handlers
 	http.HandleFunc("/ws", func(w http.ResponseWriter, r *http.Request) {
-		serveWS(hub, w, r, logger)
+		if checker.Draining() {
+			http.Error(w, "server is shutting down", http.StatusServiceUnavailable)
+			return
+		}
+		serveWS(hub, limiter, w, r, logger)
+	})
+	http.HandleFunc("/sse", func(w http.ResponseWriter, r *http.Request) {
+		if checker.Draining() {
+			http.Error(w, "server is shutting down", http.StatusServiceUnavailable)
+			return
+		}
+		serveSSE(hub, limiter, w, r, logger)
 	})
+	http.HandleFunc("/poll", func(w http.ResponseWriter, r *http.Request) {
+		if checker.Draining() {
+			http.Error(w, "server is shutting down", http.StatusServiceUnavailable)
+			return
+		}
+		servePoll(hub, limiter, w, r, logger)
+	})
+	// TODO: Restrict the group admin API to internal callers
+	groupHandler := groups.NewHandler(groupStore, logger)
+	http.Handle("/groups/", groupHandler)
+	http.Handle("/users/", groupHandler)
+	// TODO: Authenticate the publish API with service credentials
+	publishHandler := publish.NewHandler(dispatcher, sched, logger)
+	idempotentPublish := dedup.Idempotent(dedupStore, idempotencyWindow, logger, publishHandler)
+	http.Handle("/notifications", idempotentPublish)
+	http.Handle("/notifications/", idempotentPublish)
+	// TODO: Restrict the campaign API to the marketing console
+	campaignHandler := campaigns.NewHandler(campaignService, logger)
+	idempotentCampaigns := dedup.Idempotent(dedupStore, idempotencyWindow, logger, campaignHandler)
+	http.Handle("/campaigns", idempotentCampaigns)
+	http.Handle("/campaigns/", idempotentCampaigns)
+	// TODO: Restrict the dead letter API to operators
+	dlqHandler := dlq.NewHandler(deadLetters, dispatcher, logger)
+	http.Handle("/dlq", dlqHandler)
+	http.Handle("/dlq/", dlqHandler)
+
+	// TODO: Authenticate the webhook API and scope it to the caller's account
+	webhookHandler := webhook.NewHandler(webhookChannel, logger)
+	http.Handle("/webhooks", webhookHandler)
+	http.Handle("/webhooks/", webhookHandler)
+	// TODO: Extract user ID from auth token instead of the path
+	http.Handle("/digests/", digest.NewHandler(digests, logger))
+	// TODO: Restrict the deferred view to support staff
+	http.Handle("/quiet-hours/", quiethours.NewHandler(quietHours, logger))
+	// TODO: Restrict the delivery status API to support staff
+	http.Handle("/delivery-status/", status.NewHandler(tracker, logger))
 	http.Handle("/metrics", promhttp.Handler())
+	http.Handle("/healthz", checker.LivenessHandler())
+	http.Handle("/readyz", checker.ReadinessHandler())
 
 	// Start server
+	server := &http.Server{Addr: ":8084"}
 	go func() {
 		logger.Info().Int("port", 8084).Msg("HTTP server listening")
-		if err := http.ListenAndServe(":8084", nil); err != nil {
+		if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
 			logger.Fatal().Err(err).Msg("server failed")
 		}
 	}()
 
 	// TODO: Start Kafka consumer to receive events and broadcast to clients
 	// Consumer would listen to topics: wallet-events, order-events, match-events
-	// and call hub.BroadcastToUser() for relevant notifications
+	// and call hub.BroadcastToUser() for relevant notifications, keyed with
+	// dedup.KafkaKey so redelivered records are suppressed and ws.Ordered by
+	// the entity's event version (producers partition by ws.PartitionFor so
+	// each order or wallet stays on one partition); records that fail to
+	// decode go to deadLetters.FromConsumer. It also handles the auth
+	// service's session-revoked events for hub.KickSession(). The consumer
+	// and backplane each register a readiness check with the checker
+	// (partitions assigned, connected) once they are wired in.
 
 	// Wait for interrupt
 	sigChan := make(chan os.Signal, 1)
@@ -60,21 +273,194 @@ func main() {
 	<-sigChan
 
 	logger.Info().Msg("shutting down")
+
+	checker.StartDraining()
+	time.Sleep(drainDelay)
+
+	ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	if err := server.Shutdown(ctx); err != nil {
+		logger.Error().Err(err).Msg("server shutdown failed")
+	}
+
+	stopScheduler()
+	<-schedDone
+	stopDigests()
+	<-digestsDone
+	stopQuietHours()
+	<-quietDone
+	stopCaps()
+	<-capsDone
+	campaignService.Close()
+	webhookChannel.Close()
+
+	// Hijacked WebSocket connections outlive server.Shutdown; stopping the
+	// hub sends each of them a close frame
+	stats := hub.Stats()
+	logger.Info().Int("subscribers", stats.Subscribers).Uint64("delivered", stats.Delivered).Uint64("dropped", stats.Dropped).Msg("stopping hub")
+	stopHub()
+	stopTracker()
+	<-trackerDone
+	stopSweeps()
 }
 
-func serveWS(hub *ws.Hub, w http.ResponseWriter, r *http.Request, logger zerolog.Logger) {
+func serveWS(hub *ws.Hub, limiter *ws.Limiter, w http.ResponseWriter, r *http.Request, logger zerolog.Logger) {
+	// TODO: Extract user ID from auth token
+	// userID := extractUserID(r)
+	var userID *uuid.UUID
+
+	ip := clientIP(r)
+	if err := limiter.Admit(userID, ip); err != nil {
+		logger.Warn().Str("ip", ip).Msg("connection limit reached")
+		http.Error(w, err.Error(), http.StatusTooManyRequests)
+		return
+	}
+
 	conn, err := upgrader.Upgrade(w, r, nil)
 	if err != nil {
+		limiter.Release(userID, ip)
 		logger.Error().Err(err).Msg("failed to upgrade connection")
 		return
 	}
 
+	client := ws.NewClient(hub, conn, userID, logger)
+	// TODO: Set SessionID from the auth token so sessions can be kicked
+	client.SetDevice(ws.DeviceFromRequest(r))
+	if ws.OffersCompression(r) {
+		client.EnableCompression()
+	}
+	if err := hub.Register(client); err != nil {
+		conn.Close()
+		limiter.Release(userID, ip)
+		logger.Warn().Err(err).Msg("failed to register client")
+		return
+	}
+
+	go client.WritePump()
+	go func() {
+		client.ReadPump()
+		limiter.Release(userID, ip)
+	}()
+}
+
+func serveSSE(hub *ws.Hub, limiter *ws.Limiter, w http.ResponseWriter, r *http.Request, logger zerolog.Logger) {
 	// TODO: Extract user ID from auth token
-	// userID := extractUserID(r)
+	var userID *uuid.UUID
 
-	client := ws.NewClient(hub, conn, nil, logger)
-	hub.Register() <- client
+	ip := clientIP(r)
+	if err := limiter.Admit(userID, ip); err != nil {
+		logger.Warn().Str("ip", ip).Msg("connection limit reached")
+		http.Error(w, err.Error(), http.StatusTooManyRequests)
+		return
+	}
+	defer limiter.Release(userID, ip)
 
-	go client.WritePump()
-	go client.ReadPump()
+	ws.ServeSSE(hub, w, r, userID, logger)
+}
+
+// servePoll admits a long-poll like a connection, as it holds a
+// subscription for as long as the poll waits
+func servePoll(hub *ws.Hub, limiter *ws.Limiter, w http.ResponseWriter, r *http.Request, logger zerolog.Logger) {
+	// TODO: Extract user ID from auth token
+	var userID *uuid.UUID
+
+	ip := clientIP(r)
+	if err := limiter.Admit(userID, ip); err != nil {
+		logger.Warn().Str("ip", ip).Msg("connection limit reached")
+		http.Error(w, err.Error(), http.StatusTooManyRequests)
+		return
+	}
+	defer limiter.Release(userID, ip)
+
+	ws.ServePoll(hub, w, r, userID, logger)
+}
+
+// clientIP returns the remote address of the request without its port
+func clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// openDatabase opens the SQLite database at DATABASE_PATH, or
+// notification.db in the working directory, that the durable stores share.
+// The file must be on a local disk; the stores are not shared with
+// replicas on other hosts.
+func openDatabase(logger zerolog.Logger) *sql.DB {
+	path := os.Getenv("DATABASE_PATH")
+	if path == "" {
+		path = "notification.db"
+	}
+	db, err := sqlite.Open(context.Background(), path)
+	if err != nil {
+		logger.Fatal().Err(err).Str("path", path).Msg("failed to open database")
+	}
+	return db
+}
+
+// migrate creates the tables of a durable store
+func migrate(logger zerolog.Logger, name string, store interface{ Migrate(context.Context) error }) {
+	if err := store.Migrate(context.Background()); err != nil {
+		logger.Fatal().Err(err).Str("store", name).Msg("failed to migrate database")
+	}
+}
+
+// sweep calls fn every interval until ctx is cancelled, to delete rows
+// a durable store no longer needs
+func sweep(ctx context.Context, logger zerolog.Logger, name string, interval time.Duration, fn func(context.Context) error) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			if err := fn(ctx); err != nil && ctx.Err() == nil {
+				logger.Error().Err(err).Str("store", name).Msg("failed to purge expired rows")
+			}
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// capRules reads the frequency caps from FREQUENCY_CAPS (see
+// capping.ParseRules); none are enforced if it is unset
+func capRules(logger zerolog.Logger) capping.Rules {
+	rules, err := capping.ParseRules(os.Getenv("FREQUENCY_CAPS"))
+	if err != nil {
+		logger.Fatal().Err(err).Msg("invalid FREQUENCY_CAPS")
+	}
+	return rules
+}
+
+// chatOpsChannels configures the Slack and Telegram channels for ops alerts
+// from the environment. SLACK_ROUTES and TELEGRAM_ROUTES map notification
+// types to chats (see chatops.ParseRoutes); a service without routes is
+// left out.
+func chatOpsChannels(logger zerolog.Logger) []notify.Channel {
+	var channels []notify.Channel
+	if v := os.Getenv("SLACK_ROUTES"); v != "" {
+		routes, err := chatops.ParseRoutes(v)
+		if err != nil {
+			logger.Fatal().Err(err).Msg("invalid SLACK_ROUTES")
+		}
+		slack, err := chatops.NewSlackChannel(os.Getenv("SLACK_BOT_TOKEN"), routes, logger)
+		if err != nil {
+			logger.Fatal().Err(err).Msg("invalid Slack configuration")
+		}
+		channels = append(channels, slack)
+	}
+	if v := os.Getenv("TELEGRAM_ROUTES"); v != "" {
+		routes, err := chatops.ParseRoutes(v)
+		if err != nil {
+			logger.Fatal().Err(err).Msg("invalid TELEGRAM_ROUTES")
+		}
+		telegram, err := chatops.NewTelegramChannel(os.Getenv("TELEGRAM_BOT_TOKEN"), routes, logger)
+		if err != nil {
+			logger.Fatal().Err(err).Msg("invalid Telegram configuration")
+		}
+		channels = append(channels, telegram)
+	}
+	return channels
 }
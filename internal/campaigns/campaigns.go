@@ -0,0 +1,311 @@
+// Package campaigns sends a notification to every user of an audience
+// segment, resolving the segment in batches and throttling delivery.
+package campaigns
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/rs/zerolog"
+
+	"github.com/cypherlabdev/notification-service/internal/notify"
+	"github.com/cypherlabdev/notification-service/internal/ratelimit"
+	"github.com/cypherlabdev/notification-service/internal/segments"
+)
+
+const (
+	defaultBatchSize = 500
+	defaultRate      = 200 // notifications per second
+	maxRate          = 5000
+	// sampleSize bounds the user IDs returned with a dry run
+	sampleSize = 10
+)
+
+var (
+	// ErrNotFound is returned for an unknown campaign ID
+	ErrNotFound = errors.New("campaign not found")
+	// ErrInvalid wraps validation failures of a campaign definition
+	ErrInvalid = errors.New("invalid campaign")
+)
+
+// Status is the lifecycle state of a campaign
+type Status string
+
+const (
+	StatusRunning   Status = "running"
+	StatusCompleted Status = "completed"
+	StatusCancelled Status = "cancelled"
+	StatusFailed    Status = "failed"
+)
+
+// Campaign is a notification sent to every user matching a segment
+type Campaign struct {
+	ID      uuid.UUID       `json:"id"`
+	Name    string          `json:"name"`
+	Segment string          `json:"segment"`
+	Type    string          `json:"type"`
+	Payload json.RawMessage `json:"payload,omitempty"`
+	// RatePerSecond throttles delivery; zero uses the service default
+	RatePerSecond float64 `json:"rate_per_second,omitempty"`
+
+	Status     Status     `json:"status"`
+	Matched    int        `json:"matched"`
+	Sent       int        `json:"sent"`
+	Failed     int        `json:"failed"`
+	Error      string     `json:"error,omitempty"`
+	CreatedAt  time.Time  `json:"created_at"`
+	FinishedAt *time.Time `json:"finished_at,omitempty"`
+}
+
+// Estimate is the result of a dry run
+type Estimate struct {
+	Audience int         `json:"audience"`
+	Scanned  int         `json:"scanned"`
+	Sample   []uuid.UUID `json:"sample"`
+}
+
+// Dispatcher delivers a campaign's notifications; *notify.Dispatcher implements it
+type Dispatcher interface {
+	Dispatch(ctx context.Context, n *notify.Notification) error
+}
+
+// Option configures a Service
+type Option func(*Service)
+
+// WithBatchSize sets how many users are read from the attribute store at a time
+func WithBatchSize(n int) Option {
+	return func(s *Service) {
+		if n > 0 {
+			s.batchSize = n
+		}
+	}
+}
+
+// WithDefaultRate sets the delivery rate of campaigns that do not choose one
+func WithDefaultRate(perSecond float64) Option {
+	return func(s *Service) {
+		if perSecond > 0 {
+			s.defaultRate = perSecond
+		}
+	}
+}
+
+// Service runs campaigns in the background
+type Service struct {
+	attrs       segments.Store
+	dispatcher  Dispatcher
+	batchSize   int
+	defaultRate float64
+	runs        map[uuid.UUID]*run
+	wg          sync.WaitGroup
+	logger      zerolog.Logger
+	now         func() time.Time
+	mu          sync.Mutex
+}
+
+// run is a launched campaign and the means to stop it
+type run struct {
+	campaign Campaign
+	cancel   context.CancelFunc
+}
+
+// NewService creates a campaign service resolving audiences from attrs
+func NewService(attrs segments.Store, dispatcher Dispatcher, logger zerolog.Logger, opts ...Option) *Service {
+	s := &Service{
+		attrs:       attrs,
+		dispatcher:  dispatcher,
+		batchSize:   defaultBatchSize,
+		defaultRate: defaultRate,
+		runs:        make(map[uuid.UUID]*run),
+		logger:      logger.With().Str("component", "campaigns").Logger(),
+		now:         time.Now,
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s
+}
+
+// Estimate resolves a segment without sending anything, returning the
+// audience size and a sample of matching users
+func (s *Service) Estimate(ctx context.Context, seg *segments.Segment) (Estimate, error) {
+	est := Estimate{Sample: []uuid.UUID{}}
+	scanned, err := s.resolve(ctx, seg, func(userID uuid.UUID) error {
+		est.Audience++
+		if len(est.Sample) < sampleSize {
+			est.Sample = append(est.Sample, userID)
+		}
+		return nil
+	})
+	est.Scanned = scanned
+	return est, err
+}
+
+// Launch validates a campaign and starts sending it in the background.
+// The campaign keeps running after ctx is done; stop it with Cancel.
+func (s *Service) Launch(ctx context.Context, c Campaign) (Campaign, error) {
+	if c.Name == "" || c.Type == "" {
+		return Campaign{}, fmt.Errorf("%w: name and type are required", ErrInvalid)
+	}
+	seg, err := segments.Parse(c.Segment)
+	if err != nil {
+		return Campaign{}, fmt.Errorf("%w: segment: %v", ErrInvalid, err)
+	}
+	var payload interface{}
+	if len(c.Payload) > 0 {
+		if err := json.Unmarshal(c.Payload, &payload); err != nil {
+			return Campaign{}, fmt.Errorf("%w: payload: %v", ErrInvalid, err)
+		}
+	}
+	if c.RatePerSecond < 0 || c.RatePerSecond > maxRate {
+		return Campaign{}, fmt.Errorf("%w: rate_per_second must be between 0 and %d", ErrInvalid, maxRate)
+	}
+	if c.RatePerSecond == 0 {
+		c.RatePerSecond = s.defaultRate
+	}
+
+	c.ID = uuid.New()
+	c.Status = StatusRunning
+	c.Matched, c.Sent, c.Failed, c.Error = 0, 0, 0, ""
+	c.CreatedAt = s.now()
+	c.FinishedAt = nil
+
+	runCtx, cancel := context.WithCancel(context.WithoutCancel(ctx))
+	s.mu.Lock()
+	s.runs[c.ID] = &run{campaign: c, cancel: cancel}
+	s.mu.Unlock()
+
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		defer cancel()
+		s.send(runCtx, c, seg, payload)
+	}()
+	s.logger.Info().Str("campaign_id", c.ID.String()).Str("name", c.Name).Str("segment", c.Segment).Msg("campaign launched")
+	return c, nil
+}
+
+// Get returns the current state of a campaign
+func (s *Service) Get(id uuid.UUID) (Campaign, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	r, ok := s.runs[id]
+	if !ok {
+		return Campaign{}, ErrNotFound
+	}
+	return r.campaign, nil
+}
+
+// Cancel stops a running campaign; users already notified are not affected
+func (s *Service) Cancel(id uuid.UUID) error {
+	s.mu.Lock()
+	r, ok := s.runs[id]
+	s.mu.Unlock()
+	if !ok {
+		return ErrNotFound
+	}
+	r.cancel()
+	return nil
+}
+
+// Close cancels every running campaign and waits for them to stop
+func (s *Service) Close() {
+	s.mu.Lock()
+	for _, r := range s.runs {
+		r.cancel()
+	}
+	s.mu.Unlock()
+	s.wg.Wait()
+}
+
+// send delivers the campaign to its audience at the campaign's rate
+func (s *Service) send(ctx context.Context, c Campaign, seg *segments.Segment, payload interface{}) {
+	throttle := ratelimit.NewBucket(c.RatePerSecond, 1)
+	source := "campaign:" + c.ID.String()
+
+	_, err := s.resolve(ctx, seg, func(userID uuid.UUID) error {
+		s.update(c.ID, func(c *Campaign) { c.Matched++ })
+		if err := throttle.Wait(ctx); err != nil {
+			return err
+		}
+		id := source + ":" + userID.String()
+		err := s.dispatcher.Dispatch(ctx, &notify.Notification{
+			ID:             id,
+			UserID:         userID,
+			Type:           c.Type,
+			Payload:        payload,
+			Source:         source,
+			IdempotencyKey: id,
+		})
+		if err != nil {
+			campaignSends.WithLabelValues("failed").Inc()
+			s.update(c.ID, func(c *Campaign) { c.Failed++ })
+			return nil
+		}
+		campaignSends.WithLabelValues("sent").Inc()
+		s.update(c.ID, func(c *Campaign) { c.Sent++ })
+		return nil
+	})
+
+	finished := s.now()
+	s.update(c.ID, func(c *Campaign) {
+		c.FinishedAt = &finished
+		switch {
+		case errors.Is(err, context.Canceled):
+			c.Status = StatusCancelled
+		case err != nil:
+			c.Status = StatusFailed
+			c.Error = err.Error()
+		default:
+			c.Status = StatusCompleted
+		}
+	})
+
+	final, _ := s.Get(c.ID)
+	s.logger.Info().Str("campaign_id", c.ID.String()).Str("status", string(final.Status)).
+		Int("matched", final.Matched).Int("sent", final.Sent).Int("failed", final.Failed).Msg("campaign finished")
+}
+
+func (s *Service) update(id uuid.UUID, fn func(*Campaign)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if r, ok := s.runs[id]; ok {
+		fn(&r.campaign)
+	}
+}
+
+// resolve calls fn for every user matching seg, reading the attribute store
+// one batch at a time, and returns the number of users scanned
+func (s *Service) resolve(ctx context.Context, seg *segments.Segment, fn func(userID uuid.UUID) error) (int, error) {
+	scanned := 0
+	after := uuid.Nil
+	for {
+		if err := ctx.Err(); err != nil {
+			return scanned, err
+		}
+		users, err := s.attrs.Scan(ctx, after, s.batchSize)
+		if err != nil {
+			return scanned, fmt.Errorf("scan attributes: %w", err)
+		}
+		if len(users) == 0 {
+			return scanned, nil
+		}
+
+		now := s.now()
+		for _, user := range users {
+			scanned++
+			if !seg.Match(user.Attributes, now) {
+				continue
+			}
+			if err := fn(user.ID); err != nil {
+				return scanned, err
+			}
+		}
+		after = users[len(users)-1].ID
+	}
+}
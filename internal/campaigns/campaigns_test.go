@@ -0,0 +1,183 @@
+package campaigns
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/cypherlabdev/notification-service/internal/notify"
+	"github.com/cypherlabdev/notification-service/internal/segments"
+)
+
+// fakeDispatcher records dispatched notifications and fails for chosen users
+type fakeDispatcher struct {
+	fail map[uuid.UUID]bool
+	sent []*notify.Notification
+	mu   sync.Mutex
+}
+
+func (d *fakeDispatcher) Dispatch(_ context.Context, n *notify.Notification) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.fail[n.UserID] {
+		return errors.New("channel down")
+	}
+	d.sent = append(d.sent, n)
+	return nil
+}
+
+func (d *fakeDispatcher) users() []uuid.UUID {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	ids := make([]uuid.UUID, len(d.sent))
+	for i, n := range d.sent {
+		ids[i] = n.UserID
+	}
+	return ids
+}
+
+// countingStore counts the batches read from the attribute store
+type countingStore struct {
+	*segments.MemoryStore
+	scans int
+	limit int
+}
+
+func (s *countingStore) Scan(ctx context.Context, after uuid.UUID, limit int) ([]segments.User, error) {
+	s.scans++
+	s.limit = limit
+	return s.MemoryStore.Scan(ctx, after, limit)
+}
+
+// seed stores 10 users, of whom the German ones are returned
+func seed(t *testing.T, store segments.Store) []uuid.UUID {
+	t.Helper()
+	var german []uuid.UUID
+	for i := 0; i < 10; i++ {
+		id := uuid.New()
+		country := "FR"
+		if i%2 == 0 {
+			country = "DE"
+			german = append(german, id)
+		}
+		require.NoError(t, store.Put(context.Background(), id, segments.Attributes{"country": country, "verified": true}))
+	}
+	return german
+}
+
+func waitFinished(t *testing.T, s *Service, id uuid.UUID) Campaign {
+	t.Helper()
+	var c Campaign
+	require.Eventually(t, func() bool {
+		c, _ = s.Get(id)
+		return c.Status != StatusRunning
+	}, 2*time.Second, 5*time.Millisecond)
+	return c
+}
+
+// TestService_Estimate tests that a dry run counts the audience in batches without sending
+func TestService_Estimate(t *testing.T) {
+	store := &countingStore{MemoryStore: segments.NewMemoryStore()}
+	german := seed(t, store)
+	dispatcher := &fakeDispatcher{}
+	s := NewService(store, dispatcher, zerolog.Nop(), WithBatchSize(3))
+
+	seg, err := segments.Parse(`country = "DE" AND verified = true`)
+	require.NoError(t, err)
+	est, err := s.Estimate(context.Background(), seg)
+	require.NoError(t, err)
+
+	assert.Equal(t, 5, est.Audience)
+	assert.Equal(t, 10, est.Scanned)
+	assert.ElementsMatch(t, german, est.Sample)
+	assert.Equal(t, 5, store.scans) // four batches of at most three, then an empty one
+	assert.Equal(t, 3, store.limit)
+	assert.Empty(t, dispatcher.users())
+}
+
+// TestService_Launch tests that a campaign reaches its whole audience and reports progress
+func TestService_Launch(t *testing.T) {
+	store := segments.NewMemoryStore()
+	german := seed(t, store)
+	dispatcher := &fakeDispatcher{fail: map[uuid.UUID]bool{german[0]: true}}
+	s := NewService(store, dispatcher, zerolog.Nop(), WithBatchSize(4))
+	defer s.Close()
+
+	c, err := s.Launch(context.Background(), Campaign{
+		Name:          "spring promo",
+		Segment:       `country = "DE"`,
+		Type:          "promo",
+		Payload:       []byte(`{"bonus":10}`),
+		RatePerSecond: 1000,
+	})
+	require.NoError(t, err)
+	assert.Equal(t, StatusRunning, c.Status)
+
+	c = waitFinished(t, s, c.ID)
+	assert.Equal(t, StatusCompleted, c.Status)
+	assert.Equal(t, 5, c.Matched)
+	assert.Equal(t, 4, c.Sent)
+	assert.Equal(t, 1, c.Failed)
+	assert.NotNil(t, c.FinishedAt)
+	assert.ElementsMatch(t, german[1:], dispatcher.users())
+
+	n := dispatcher.sent[0]
+	assert.Equal(t, "promo", n.Type)
+	assert.Equal(t, map[string]interface{}{"bonus": float64(10)}, n.Payload)
+	assert.Equal(t, "campaign:"+c.ID.String(), n.Source)
+}
+
+// TestService_Throttle tests that delivery is paced at the campaign's rate
+func TestService_Throttle(t *testing.T) {
+	store := segments.NewMemoryStore()
+	seed(t, store)
+	s := NewService(store, &fakeDispatcher{}, zerolog.Nop())
+	defer s.Close()
+
+	start := time.Now()
+	c, err := s.Launch(context.Background(), Campaign{Name: "n", Segment: `country = "DE"`, Type: "t", RatePerSecond: 100})
+	require.NoError(t, err)
+	waitFinished(t, s, c.ID)
+	// The first send is immediate; the other four wait 10ms each
+	assert.GreaterOrEqual(t, time.Since(start), 35*time.Millisecond)
+}
+
+// TestService_Cancel tests stopping a campaign part way through
+func TestService_Cancel(t *testing.T) {
+	store := segments.NewMemoryStore()
+	seed(t, store)
+	dispatcher := &fakeDispatcher{}
+	s := NewService(store, dispatcher, zerolog.Nop())
+	defer s.Close()
+
+	c, err := s.Launch(context.Background(), Campaign{Name: "slow", Segment: `verified = true`, Type: "t", RatePerSecond: 1})
+	require.NoError(t, err)
+	require.Eventually(t, func() bool { return len(dispatcher.users()) == 1 }, time.Second, 5*time.Millisecond)
+	require.NoError(t, s.Cancel(c.ID))
+
+	c = waitFinished(t, s, c.ID)
+	assert.Equal(t, StatusCancelled, c.Status)
+	assert.Equal(t, 1, c.Sent)
+	assert.ErrorIs(t, s.Cancel(uuid.New()), ErrNotFound)
+}
+
+// TestService_Launch_Invalid tests validation of campaign definitions
+func TestService_Launch_Invalid(t *testing.T) {
+	s := NewService(segments.NewMemoryStore(), &fakeDispatcher{}, zerolog.Nop())
+	for _, c := range []Campaign{
+		{Segment: `country = "DE"`, Type: "t"},
+		{Name: "n", Segment: `country =`, Type: "t"},
+		{Name: "n", Segment: `country = "DE"`, Type: "t", Payload: []byte(`{`)},
+		{Name: "n", Segment: `country = "DE"`, Type: "t", RatePerSecond: maxRate + 1},
+	} {
+		_, err := s.Launch(context.Background(), c)
+		assert.ErrorIs(t, err, ErrInvalid)
+	}
+}
@@ -0,0 +1,124 @@
+package campaigns
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/google/uuid"
+	"github.com/rs/zerolog"
+
+	"github.com/cypherlabdev/notification-service/internal/segments"
+)
+
+// campaignRequest is the body of POST /campaigns
+type campaignRequest struct {
+	Campaign
+	// DryRun resolves the segment and returns the audience size without sending
+	DryRun bool `json:"dry_run"`
+}
+
+// Handler serves the campaign API:
+//
+//	POST /campaigns               launches a campaign, or estimates it with "dry_run": true
+//	GET  /campaigns/{id}          reports a campaign's progress
+//	POST /campaigns/{id}/cancel   stops a running campaign
+type Handler struct {
+	service *Service
+	logger  zerolog.Logger
+	mux     *http.ServeMux
+}
+
+// NewHandler creates the campaign API backed by service
+func NewHandler(service *Service, logger zerolog.Logger) *Handler {
+	h := &Handler{
+		service: service,
+		logger:  logger.With().Str("component", "campaigns_api").Logger(),
+		mux:     http.NewServeMux(),
+	}
+	h.mux.HandleFunc("POST /campaigns", h.create)
+	h.mux.HandleFunc("GET /campaigns/{id}", h.get)
+	h.mux.HandleFunc("POST /campaigns/{id}/cancel", h.cancel)
+	return h
+}
+
+// ServeHTTP implements http.Handler
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	h.mux.ServeHTTP(w, r)
+}
+
+func (h *Handler) create(w http.ResponseWriter, r *http.Request) {
+	var req campaignRequest
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 256<<10)).Decode(&req); err != nil {
+		http.Error(w, "invalid body: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if req.DryRun {
+		seg, err := segments.Parse(req.Segment)
+		if err != nil {
+			http.Error(w, "invalid segment: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		est, err := h.service.Estimate(r.Context(), seg)
+		if err != nil {
+			h.logger.Error().Err(err).Msg("failed to estimate campaign audience")
+			http.Error(w, "internal error", http.StatusInternalServerError)
+			return
+		}
+		writeJSON(w, http.StatusOK, est)
+		return
+	}
+
+	c, err := h.service.Launch(r.Context(), req.Campaign)
+	if errors.Is(err, ErrInvalid) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		h.logger.Error().Err(err).Msg("failed to launch campaign")
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, http.StatusAccepted, c)
+}
+
+func (h *Handler) get(w http.ResponseWriter, r *http.Request) {
+	id, ok := pathID(w, r)
+	if !ok {
+		return
+	}
+	c, err := h.service.Get(id)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	writeJSON(w, http.StatusOK, c)
+}
+
+func (h *Handler) cancel(w http.ResponseWriter, r *http.Request) {
+	id, ok := pathID(w, r)
+	if !ok {
+		return
+	}
+	if err := h.service.Cancel(id); err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func pathID(w http.ResponseWriter, r *http.Request) (uuid.UUID, bool) {
+	id, err := uuid.Parse(r.PathValue("id"))
+	if err != nil {
+		http.Error(w, "invalid campaign id", http.StatusBadRequest)
+		return uuid.Nil, false
+	}
+	return id, true
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
@@ -0,0 +1,66 @@
+package campaigns
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/cypherlabdev/notification-service/internal/segments"
+)
+
+func do(h http.Handler, method, path, body string) *httptest.ResponseRecorder {
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(method, path, strings.NewReader(body)))
+	return rec
+}
+
+// TestHandler_DryRun tests that a dry run returns the audience size and sends nothing
+func TestHandler_DryRun(t *testing.T) {
+	store := segments.NewMemoryStore()
+	seed(t, store)
+	dispatcher := &fakeDispatcher{}
+	h := NewHandler(NewService(store, dispatcher, zerolog.Nop()), zerolog.Nop())
+
+	rec := do(h, http.MethodPost, "/campaigns", `{"name":"n","type":"t","segment":"country = \"DE\"","dry_run":true}`)
+	require.Equal(t, http.StatusOK, rec.Code)
+	var est Estimate
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &est))
+	assert.Equal(t, 5, est.Audience)
+	assert.Empty(t, dispatcher.users())
+
+	rec = do(h, http.MethodPost, "/campaigns", `{"segment":"country ==","dry_run":true}`)
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+}
+
+// TestHandler_Lifecycle tests launching, polling and cancelling a campaign
+func TestHandler_Lifecycle(t *testing.T) {
+	store := segments.NewMemoryStore()
+	seed(t, store)
+	service := NewService(store, &fakeDispatcher{}, zerolog.Nop())
+	defer service.Close()
+	h := NewHandler(service, zerolog.Nop())
+
+	rec := do(h, http.MethodPost, "/campaigns", `{"name":"n","type":"promo","segment":"verified = true","rate_per_second":1}`)
+	require.Equal(t, http.StatusAccepted, rec.Code)
+	var c Campaign
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &c))
+	assert.Equal(t, StatusRunning, c.Status)
+	assert.Equal(t, float64(1), c.RatePerSecond)
+
+	rec = do(h, http.MethodGet, "/campaigns/"+c.ID.String(), "")
+	require.Equal(t, http.StatusOK, rec.Code)
+
+	require.Equal(t, http.StatusNoContent, do(h, http.MethodPost, "/campaigns/"+c.ID.String()+"/cancel", "").Code)
+	assert.Equal(t, StatusCancelled, waitFinished(t, service, c.ID).Status)
+
+	assert.Equal(t, http.StatusNotFound, do(h, http.MethodGet, "/campaigns/"+uuid.New().String(), "").Code)
+	assert.Equal(t, http.StatusBadRequest, do(h, http.MethodGet, "/campaigns/nope", "").Code)
+	assert.Equal(t, http.StatusBadRequest, do(h, http.MethodPost, "/campaigns", `{"name":"n","segment":"verified = true"}`).Code)
+}
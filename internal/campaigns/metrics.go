@@ -0,0 +1,13 @@
+package campaigns
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var campaignSends = promauto.NewCounterVec(prometheus.CounterOpts{
+	Namespace: "notification",
+	Subsystem: "campaigns",
+	Name:      "notifications_total",
+	Help:      "Campaign notifications dispatched, by result.",
+}, []string{"result"})
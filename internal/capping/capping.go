@@ -0,0 +1,346 @@
+// Package capping limits how often a user gets notifications of a
+// category over a channel, such as at most three promotional pushes a day
+// and one an hour, to fight notification fatigue. Sends over a cap are
+// dropped, deferred until the cap allows them, or downgraded to a less
+// intrusive channel.
+package capping
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"slices"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/rs/zerolog"
+
+	"github.com/cypherlabdev/notification-service/internal/notify"
+)
+
+const (
+	defaultPollInterval = 30 * time.Second
+	// releaseBatch bounds the deferred sends released per poll
+	releaseBatch = 100
+	// claimTTL is how long a replica has to send an item it claimed before
+	// another one may
+	claimTTL = time.Minute
+)
+
+// QuietHours tells when a notification may reach its user, so deferred
+// sends are not released into their quiet hours; *quiethours.Deferrer
+// implements it
+type QuietHours interface {
+	ReleaseAt(ctx context.Context, n *notify.Notification, t time.Time) (time.Time, error)
+}
+
+// Option configures an Engine
+type Option func(*Engine)
+
+// WithPollInterval sets how often deferred sends are checked for release
+func WithPollInterval(interval time.Duration) Option {
+	return func(e *Engine) {
+		e.pollInterval = interval
+	}
+}
+
+// WithDeadLetters hands deferred sends that fail on release to sink
+func WithDeadLetters(sink notify.DeadLetterSink) Option {
+	return func(e *Engine) {
+		e.deadLetters = sink
+	}
+}
+
+// WithQuietHours releases deferred sends no earlier than the end of the
+// user's quiet hours
+func WithQuietHours(q QuietHours) Option {
+	return func(e *Engine) {
+		e.quietHours = q
+	}
+}
+
+// WithTracker records what becomes of deferred and downgraded sends
+func WithTracker(t notify.Tracker) Option {
+	return func(e *Engine) {
+		e.tracker = t
+	}
+}
+
+// Engine enforces caps on the channels it wraps. Sends are counted in the
+// store when they are made, so a send that then fails still counts.
+type Engine struct {
+	store        Store
+	rules        Rules
+	channels     map[string]*Channel
+	deadLetters  notify.DeadLetterSink
+	quietHours   QuietHours
+	tracker      notify.Tracker
+	pollInterval time.Duration
+	logger       zerolog.Logger
+	now          func() time.Time
+}
+
+// New creates an engine enforcing rules with counts kept in store. Wrap
+// the dispatcher's channels with it, and call Run to release deferred
+// sends.
+func New(store Store, rules Rules, logger zerolog.Logger, opts ...Option) *Engine {
+	e := &Engine{
+		store:        store,
+		rules:        rules,
+		channels:     make(map[string]*Channel),
+		pollInterval: defaultPollInterval,
+		logger:       logger.With().Str("component", "capping").Logger(),
+		now:          time.Now,
+	}
+	for _, opt := range opts {
+		opt(e)
+	}
+	return e
+}
+
+// Wrap returns ch with the engine's caps enforced. Wrap every channel of
+// the dispatcher before it is used, so downgrades can reach any of them.
+func (e *Engine) Wrap(ch notify.Channel) *Channel {
+	c := &Channel{engine: e, inner: ch}
+	e.channels[ch.Name()] = c
+	return c
+}
+
+// WrapAll wraps each of channels
+func (e *Engine) WrapAll(channels ...notify.Channel) []notify.Channel {
+	wrapped := make([]notify.Channel, len(channels))
+	for i, ch := range channels {
+		wrapped[i] = e.Wrap(ch)
+	}
+	return wrapped
+}
+
+// Channel is a notify.Channel whose sends are capped
+type Channel struct {
+	engine *Engine
+	inner  notify.Channel
+}
+
+// Name implements notify.Channel
+func (c *Channel) Name() string { return c.inner.Name() }
+
+// Queues implements notify.Queuer for a wrapped channel that queues
+func (c *Channel) Queues() bool {
+	q, ok := c.inner.(notify.Queuer)
+	return ok && q.Queues()
+}
+
+// Wants implements notify.Selective for a wrapped channel that selects
+func (c *Channel) Wants(ctx context.Context, n *notify.Notification) bool {
+	s, ok := c.inner.(notify.Selective)
+	return !ok || s.Wants(ctx, n)
+}
+
+// Send implements notify.Channel. A send over its cap returns a
+// *notify.SkipError telling what became of it.
+func (c *Channel) Send(ctx context.Context, n *notify.Notification) error {
+	return c.engine.send(ctx, c, n)
+}
+
+func (e *Engine) send(ctx context.Context, c *Channel, n *notify.Notification) error {
+	category := n.CategoryOrType()
+	rule, ok := e.rules.Match(category, c.Name())
+	if !ok {
+		return c.inner.Send(ctx, n)
+	}
+	now := e.now()
+	key := Key{UserID: n.UserID, Category: category, Channel: c.Name()}
+	allowed, retryAt, err := e.store.Take(ctx, key, now, rule.Limits)
+	if err != nil {
+		// Sending over the cap is better than not at all
+		e.logger.Warn().Err(err).Str("key", key.String()).Msg("cap store unavailable")
+		return c.inner.Send(ctx, n)
+	}
+	if allowed {
+		return c.inner.Send(ctx, n)
+	}
+
+	switch rule.Action {
+	case ActionDefer:
+		if retryAt, err = e.releaseAt(ctx, n, retryAt); err != nil {
+			return err
+		}
+		if n.Expired(retryAt) {
+			break
+		}
+		if err := e.deferSend(ctx, c.Name(), n, retryAt); err != nil {
+			return err
+		}
+		suppressed.WithLabelValues(category, c.Name(), string(ActionDefer)).Inc()
+		return &notify.SkipError{
+			State:  notify.StateQueued,
+			Reason: "deferred by frequency cap until " + retryAt.UTC().Format(time.RFC3339),
+		}
+	case ActionDowngrade:
+		suppressed.WithLabelValues(category, c.Name(), string(ActionDowngrade)).Inc()
+		if err := e.downgrade(ctx, rule.Fallback, n); err != nil {
+			return err
+		}
+		return &notify.SkipError{State: notify.StateFailed, Reason: "downgraded to " + rule.Fallback + " by frequency cap"}
+	}
+	suppressed.WithLabelValues(category, c.Name(), string(ActionDrop)).Inc()
+	return &notify.SkipError{State: notify.StateFailed, Reason: "dropped by frequency cap"}
+}
+
+// releaseAt pushes a deferred send past the user's quiet hours
+func (e *Engine) releaseAt(ctx context.Context, n *notify.Notification, t time.Time) (time.Time, error) {
+	if e.quietHours == nil {
+		return t, nil
+	}
+	return e.quietHours.ReleaseAt(ctx, n, t)
+}
+
+// downgrade sends n over the fallback channel, subject to its own caps,
+// unless the dispatcher is sending it there anyway
+func (e *Engine) downgrade(ctx context.Context, fallback string, n *notify.Notification) error {
+	ch, ok := e.channels[fallback]
+	if !ok {
+		e.logger.Warn().Str("channel", fallback).Msg("cap falls back to an unknown channel, dropping")
+		return nil
+	}
+	if len(n.Channels) == 0 || slices.Contains(n.Channels, fallback) {
+		return nil
+	}
+	if !ch.Wants(ctx, n) {
+		return nil
+	}
+	err := ch.Send(ctx, n)
+	var skip *notify.SkipError
+	if err != nil && !errors.As(err, &skip) {
+		return err
+	}
+	e.sent(n, fallback, ch.Queues(), err)
+	return nil
+}
+
+// sent records the outcome of a send the engine made itself, outside the
+// dispatcher
+func (e *Engine) sent(n *notify.Notification, channel string, queues bool, err error) {
+	if e.tracker == nil {
+		return
+	}
+	var skip *notify.SkipError
+	switch {
+	case errors.As(err, &skip):
+		e.tracker.Track(n, channel, skip.State, skip.Reason)
+	case err != nil:
+		e.tracker.Track(n, channel, notify.StateFailed, err.Error())
+	case queues:
+		e.tracker.Track(n, channel, notify.StateQueued, "")
+	default:
+		e.tracker.Track(n, channel, notify.StateSent, "")
+	}
+}
+
+func (e *Engine) deferSend(ctx context.Context, channel string, n *notify.Notification, releaseAt time.Time) error {
+	payload, err := json.Marshal(n.Payload)
+	if err != nil {
+		return err
+	}
+	return e.store.Defer(ctx, &Item{
+		ID:             uuid.NewString(),
+		Channel:        channel,
+		NotificationID: n.ID,
+		UserID:         n.UserID,
+		Type:           n.Type,
+		Category:       n.Category,
+		Payload:        payload,
+		Source:         n.Source,
+		CreatedAt:      n.CreatedAt.UTC(),
+		ExpiresAt:      n.ExpiresAt,
+		ReleaseAt:      releaseAt.UTC(),
+	})
+}
+
+// Run sends deferred notifications as their caps allow, until ctx is
+// cancelled
+func (e *Engine) Run(ctx context.Context) {
+	ticker := time.NewTicker(e.pollInterval)
+	defer ticker.Stop()
+	for {
+		e.tick(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// tick releases the deferred sends that are due
+func (e *Engine) tick(ctx context.Context) {
+	now := e.now()
+	items, err := e.store.Due(ctx, now, releaseBatch)
+	if err != nil {
+		e.logger.Error().Err(err).Msg("failed to load deferred sends")
+		return
+	}
+	for _, item := range items {
+		if ctx.Err() != nil {
+			return
+		}
+		claimed, err := e.store.Claim(ctx, item.ID, now, now.Add(claimTTL))
+		if err != nil {
+			e.logger.Error().Err(err).Str("id", item.ID).Msg("failed to claim deferred send")
+			continue
+		}
+		if claimed {
+			e.release(ctx, item, now)
+		}
+	}
+}
+
+// release sends a claimed item over its channel, where it is capped
+// again; one still over the cap is deferred anew
+func (e *Engine) release(ctx context.Context, item *Item, now time.Time) {
+	defer func() {
+		if err := e.store.Remove(ctx, item.ID); err != nil {
+			e.logger.Error().Err(err).Str("id", item.ID).Msg("failed to remove deferred send")
+		}
+	}()
+	ch, ok := e.channels[item.Channel]
+	if !ok {
+		released.WithLabelValues("failed").Inc()
+		e.logger.Error().Str("channel", item.Channel).Msg("dropping deferred send for an unknown channel")
+		return
+	}
+	n := &notify.Notification{
+		ID:        item.NotificationID,
+		UserID:    item.UserID,
+		Type:      item.Type,
+		Category:  item.Category,
+		CreatedAt: item.CreatedAt,
+		Source:    item.Source,
+		ExpiresAt: item.ExpiresAt,
+		Channels:  []string{item.Channel},
+	}
+	if len(item.Payload) > 0 {
+		if err := json.Unmarshal(item.Payload, &n.Payload); err != nil {
+			released.WithLabelValues("failed").Inc()
+			e.logger.Error().Err(err).Str("id", item.ID).Msg("dropping deferred send with invalid payload")
+			return
+		}
+	}
+	if n.Expired(now) {
+		released.WithLabelValues("expired").Inc()
+		e.sent(n, item.Channel, false, notify.ErrExpired)
+		return
+	}
+	err := ch.Send(ctx, n)
+	e.sent(n, item.Channel, ch.Queues(), err)
+	var skip *notify.SkipError
+	if err != nil && !errors.As(err, &skip) {
+		released.WithLabelValues("failed").Inc()
+		e.logger.Warn().Err(err).Str("notification_id", n.ID).Str("channel", item.Channel).Msg("failed to send deferred notification")
+		if e.deadLetters != nil {
+			e.deadLetters.DeadLetter(ctx, n, item.Channel, err)
+		}
+		return
+	}
+	released.WithLabelValues("sent").Inc()
+}
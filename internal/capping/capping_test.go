@@ -0,0 +1,207 @@
+package capping
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/cypherlabdev/notification-service/internal/notify"
+)
+
+// fakeChannel records notifications and optionally fails
+type fakeChannel struct {
+	name string
+	err  error
+	sent []*notify.Notification
+	mu   sync.Mutex
+}
+
+func (c *fakeChannel) Name() string { return c.name }
+
+func (c *fakeChannel) Send(_ context.Context, n *notify.Notification) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.err != nil {
+		return c.err
+	}
+	c.sent = append(c.sent, n)
+	return nil
+}
+
+func (c *fakeChannel) count() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.sent)
+}
+
+// failingStore fails every call
+type failingStore struct {
+	Store
+}
+
+func (failingStore) Take(context.Context, Key, time.Time, []Limit) (bool, time.Time, error) {
+	return false, time.Time{}, errors.New("database is locked")
+}
+
+// recordingSink records dead letters
+type recordingSink struct {
+	channels []string
+}
+
+func (s *recordingSink) DeadLetter(_ context.Context, _ *notify.Notification, channel string, _ error) {
+	s.channels = append(s.channels, channel)
+}
+
+// quietUntil defers everything before a fixed time
+type quietUntil time.Time
+
+func (q quietUntil) ReleaseAt(_ context.Context, _ *notify.Notification, t time.Time) (time.Time, error) {
+	if t.Before(time.Time(q)) {
+		return time.Time(q), nil
+	}
+	return t, nil
+}
+
+// newTestEngine creates an engine at a fixed time with a dispatcher over
+// capped push and websocket channels
+func newTestEngine(t *testing.T, store Store, rules string, opts ...Option) (*Engine, *notify.Dispatcher, *fakeChannel, *fakeChannel) {
+	parsed, err := ParseRules(rules)
+	require.NoError(t, err)
+	push, inApp := &fakeChannel{name: "push"}, &fakeChannel{name: notify.ChannelWebSocket}
+	e := New(store, parsed, zerolog.Nop(), opts...)
+	now := time.Now()
+	e.now = func() time.Time { return now }
+	return e, notify.NewDispatcher(zerolog.Nop(), notify.WithChannels(e.WrapAll(push, inApp)...)), push, inApp
+}
+
+func promo(userID uuid.UUID) *notify.Notification {
+	return &notify.Notification{UserID: userID, Type: "free_bet", Category: "promotions", Payload: map[string]string{"message": "Free bet"}}
+}
+
+// TestEngine_Drop tests that sends over a cap are dropped per user and
+// channel, and other categories are not capped
+func TestEngine_Drop(t *testing.T) {
+	ctx := context.Background()
+	_, d, push, inApp := newTestEngine(t, NewMemoryStore(), "promotions@push=1/1h")
+	alice, bob := uuid.New(), uuid.New()
+
+	require.NoError(t, d.Dispatch(ctx, promo(alice)))
+	require.NoError(t, d.Dispatch(ctx, promo(alice)))
+	require.NoError(t, d.Dispatch(ctx, promo(bob)))
+	require.NoError(t, d.Dispatch(ctx, &notify.Notification{UserID: alice, Type: "bet_settled"}))
+	assert.Equal(t, 3, push.count())
+	assert.Equal(t, 4, inApp.count())
+}
+
+// TestEngine_Downgrade tests falling back to a less intrusive channel
+// without sending twice over it
+func TestEngine_Downgrade(t *testing.T) {
+	ctx := context.Background()
+	_, d, push, inApp := newTestEngine(t, NewMemoryStore(), "promotions@push=1/1h:downgrade>websocket")
+	userID := uuid.New()
+
+	require.NoError(t, d.Dispatch(ctx, promo(userID)))
+	require.NoError(t, d.Dispatch(ctx, promo(userID)))
+	assert.Equal(t, 1, push.count())
+	assert.Equal(t, 2, inApp.count(), "already sent in-app")
+
+	n := promo(userID)
+	n.Channels = []string{"push"}
+	require.NoError(t, d.Dispatch(ctx, n))
+	assert.Equal(t, 1, push.count())
+	assert.Equal(t, 3, inApp.count(), "sent in-app instead")
+}
+
+// TestEngine_Defer tests that deferred sends go out over their channel
+// once the cap and the user's quiet hours allow
+func TestEngine_Defer(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemoryStore()
+	sink := &recordingSink{}
+	e, d, push, inApp := newTestEngine(t, store, "promotions@push=1/1h:defer", WithDeadLetters(sink))
+	start := e.now()
+	e.quietHours = quietUntil(start.Add(2 * time.Hour))
+	userID := uuid.New()
+
+	require.NoError(t, d.Dispatch(ctx, promo(userID)))
+	require.NoError(t, d.Dispatch(ctx, promo(userID)))
+	expiring := promo(userID)
+	expiring.ExpiresAt = start.Add(time.Minute)
+	require.NoError(t, d.Dispatch(ctx, expiring))
+	assert.Equal(t, 1, push.count())
+	assert.Equal(t, 3, inApp.count())
+
+	e.now = func() time.Time { return start.Add(time.Hour) }
+	e.tick(ctx)
+	assert.Equal(t, 1, push.count(), "quiet hours are not over")
+
+	e.now = func() time.Time { return start.Add(2 * time.Hour) }
+	e.tick(ctx)
+	require.Equal(t, 2, push.count())
+	assert.Equal(t, []string{"push"}, push.sent[1].Channels)
+	assert.Equal(t, map[string]interface{}{"message": "Free bet"}, push.sent[1].Payload)
+	assert.Equal(t, 3, inApp.count())
+	due, err := store.Due(ctx, start.Add(48*time.Hour), 10)
+	require.NoError(t, err)
+	assert.Empty(t, due, "the expiring send was dropped")
+
+	// A release that fails is dead-lettered
+	require.NoError(t, d.Dispatch(ctx, promo(userID)))
+	push.err = errors.New("token revoked")
+	e.now = func() time.Time { return start.Add(4 * time.Hour) }
+	e.tick(ctx)
+	assert.Equal(t, []string{"push"}, sink.channels)
+}
+
+// TestEngine_StoreDown tests that sends go out when the counts cannot be
+// checked
+func TestEngine_StoreDown(t *testing.T) {
+	_, d, push, _ := newTestEngine(t, failingStore{}, "promotions@push=1/1h")
+	userID := uuid.New()
+	require.NoError(t, d.Dispatch(context.Background(), promo(userID)))
+	require.NoError(t, d.Dispatch(context.Background(), promo(userID)))
+	assert.Equal(t, 2, push.count())
+}
+
+// recordingTracker records the states tracked per channel
+type recordingTracker struct {
+	states map[string][]notify.State
+}
+
+func (r *recordingTracker) Track(_ *notify.Notification, channel string, state notify.State, _ string) {
+	r.states[channel] = append(r.states[channel], state)
+}
+
+// TestEngine_Tracker tests that capped sends are reported as skips and
+// that the engine tracks the sends it makes itself
+func TestEngine_Tracker(t *testing.T) {
+	ctx := context.Background()
+	tracker := &recordingTracker{states: make(map[string][]notify.State)}
+	e, _, push, inApp := newTestEngine(t, NewMemoryStore(), "promotions@push=1/1h:defer;promotions@websocket=1/1h", WithTracker(tracker))
+	userID := uuid.New()
+	pushCh, inAppCh := e.channels["push"], e.channels[notify.ChannelWebSocket]
+
+	require.NoError(t, pushCh.Send(ctx, promo(userID)))
+	var skip *notify.SkipError
+	require.ErrorAs(t, pushCh.Send(ctx, promo(userID)), &skip)
+	assert.Equal(t, notify.StateQueued, skip.State)
+	assert.Contains(t, skip.Reason, "deferred by frequency cap until ")
+
+	require.NoError(t, inAppCh.Send(ctx, promo(userID)))
+	require.ErrorAs(t, inAppCh.Send(ctx, promo(userID)), &skip)
+	assert.Equal(t, &notify.SkipError{State: notify.StateFailed, Reason: "dropped by frequency cap"}, skip)
+	assert.Equal(t, 1, inApp.count())
+
+	start := e.now()
+	e.now = func() time.Time { return start.Add(time.Hour) }
+	e.tick(ctx)
+	assert.Equal(t, 2, push.count())
+	assert.Equal(t, []notify.State{notify.StateSent}, tracker.states["push"], "the released send is tracked")
+}
@@ -0,0 +1,22 @@
+package capping
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var (
+	suppressed = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "notification",
+		Subsystem: "capping",
+		Name:      "suppressed_total",
+		Help:      "Sends over a frequency cap, by category, channel and whether they were dropped, deferred or downgraded.",
+	}, []string{"category", "channel", "action"})
+
+	released = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "notification",
+		Subsystem: "capping",
+		Name:      "released_total",
+		Help:      "Deferred sends released, by whether they were sent (or deferred again), failed or expired first.",
+	}, []string{"result"})
+)
@@ -0,0 +1,117 @@
+package capping
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Action is what happens to a send over its cap
+type Action string
+
+const (
+	// ActionDrop suppresses the send
+	ActionDrop Action = "drop"
+	// ActionDefer sends it once the cap allows
+	ActionDefer Action = "defer"
+	// ActionDowngrade sends it over the rule's fallback channel instead,
+	// e.g. in-app rather than push
+	ActionDowngrade Action = "downgrade"
+)
+
+// Limit allows Count sends in any rolling Window
+type Limit struct {
+	Count  int
+	Window time.Duration
+}
+
+// Rule caps the sends of a category over a channel, counted per user.
+// Category and Channel may be "*" to apply to each category or channel;
+// the counts are still kept per category and channel.
+type Rule struct {
+	Category string
+	Channel  string
+	Limits   []Limit
+	Action   Action
+	// Fallback is the channel a downgraded send goes to
+	Fallback string
+}
+
+// Rules are the caps an engine enforces
+type Rules []Rule
+
+// Match returns the rule for a category and channel: an exact match
+// first, then one with a wildcard channel, then a wildcard category
+func (r Rules) Match(category, channel string) (Rule, bool) {
+	for _, want := range [][2]string{{category, channel}, {category, "*"}, {"*", channel}, {"*", "*"}} {
+		for _, rule := range r {
+			if rule.Category == want[0] && rule.Channel == want[1] {
+				return rule, true
+			}
+		}
+	}
+	return Rule{}, false
+}
+
+// ParseRules parses rules written as "category@channel=limits[:action]"
+// separated by ";". Limits are count/window pairs separated by ",", and a
+// downgrade names its fallback, e.g.
+// "promotions@push=3/24h,1/1h:downgrade>websocket;engagement@*=5/24h:defer".
+// The action defaults to drop.
+func ParseRules(s string) (Rules, error) {
+	var rules Rules
+	for _, text := range strings.Split(s, ";") {
+		text = strings.TrimSpace(text)
+		if text == "" {
+			continue
+		}
+		rule, err := parseRule(text)
+		if err != nil {
+			return nil, err
+		}
+		rules = append(rules, rule)
+	}
+	return rules, nil
+}
+
+func parseRule(text string) (Rule, error) {
+	target, spec, ok := strings.Cut(text, "=")
+	if !ok {
+		return Rule{}, fmt.Errorf("invalid cap %q", text)
+	}
+	var rule Rule
+	rule.Category, rule.Channel, ok = strings.Cut(strings.TrimSpace(target), "@")
+	if !ok || rule.Category == "" || rule.Channel == "" {
+		return Rule{}, fmt.Errorf("cap %q must name category@channel", text)
+	}
+
+	limits, action, _ := strings.Cut(spec, ":")
+	for _, l := range strings.Split(limits, ",") {
+		count, window, ok := strings.Cut(strings.TrimSpace(l), "/")
+		n, err := strconv.Atoi(count)
+		if !ok || err != nil || n < 1 {
+			return Rule{}, fmt.Errorf("cap %q has invalid limit %q", text, l)
+		}
+		d, err := time.ParseDuration(window)
+		if err != nil || d <= 0 {
+			return Rule{}, fmt.Errorf("cap %q has invalid window %q", text, window)
+		}
+		rule.Limits = append(rule.Limits, Limit{Count: n, Window: d})
+	}
+
+	action, rule.Fallback, _ = strings.Cut(strings.TrimSpace(action), ">")
+	rule.Action = Action(action)
+	switch rule.Action {
+	case "":
+		rule.Action = ActionDrop
+	case ActionDrop, ActionDefer:
+	case ActionDowngrade:
+		if rule.Fallback == "" || rule.Fallback == rule.Channel {
+			return Rule{}, fmt.Errorf("cap %q must downgrade to another channel", text)
+		}
+	default:
+		return Rule{}, fmt.Errorf("cap %q has unknown action %q", text, action)
+	}
+	return rule, nil
+}
@@ -0,0 +1,55 @@
+package capping
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestParseRules tests parsing caps from configuration
+func TestParseRules(t *testing.T) {
+	rules, err := ParseRules("promotions@push=3/24h, 1/1h:downgrade>websocket; engagement@*=5/24h:defer ;*@sms=2/24h")
+	require.NoError(t, err)
+	assert.Equal(t, Rules{
+		{Category: "promotions", Channel: "push", Limits: []Limit{{3, 24 * time.Hour}, {1, time.Hour}}, Action: ActionDowngrade, Fallback: "websocket"},
+		{Category: "engagement", Channel: "*", Limits: []Limit{{5, 24 * time.Hour}}, Action: ActionDefer},
+		{Category: "*", Channel: "sms", Limits: []Limit{{2, 24 * time.Hour}}, Action: ActionDrop},
+	}, rules)
+
+	for _, bad := range []string{
+		"promotions=3/24h",
+		"promotions@push",
+		"promotions@push=0/24h",
+		"promotions@push=3/day",
+		"promotions@push=3/24h:shout",
+		"promotions@push=3/24h:downgrade",
+		"promotions@push=3/24h:downgrade>push",
+	} {
+		_, err := ParseRules(bad)
+		assert.Error(t, err, bad)
+	}
+}
+
+// TestRules_Match tests that the most specific rule applies
+func TestRules_Match(t *testing.T) {
+	rules := Rules{
+		{Category: "*", Channel: "*", Action: "any"},
+		{Category: "*", Channel: "push", Action: "any push"},
+		{Category: "promotions", Channel: "*", Action: "promotions"},
+		{Category: "promotions", Channel: "push", Action: "promotional push"},
+	}
+	for _, tt := range []struct{ category, channel, want string }{
+		{"promotions", "push", "promotional push"},
+		{"promotions", "sms", "promotions"},
+		{"engagement", "push", "any push"},
+		{"engagement", "sms", "any"},
+	} {
+		rule, ok := rules.Match(tt.category, tt.channel)
+		require.True(t, ok)
+		assert.Equal(t, Action(tt.want), rule.Action)
+	}
+	_, ok := rules[3:].Match("engagement", "push")
+	assert.False(t, ok)
+}
@@ -0,0 +1,180 @@
+package capping
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// SQLStore is a Store in the capping_sends and capping_deferred tables,
+// shared by the processes on one host that open the same database file.
+// Its statements use SQLite syntax; open the *sql.DB with sqlite.Open,
+// whose immediate transactions serialize concurrent Takes. Times are kept
+// as Unix milliseconds, with 0 for unset.
+type SQLStore struct {
+	db *sql.DB
+}
+
+// NewSQLStore creates a store over db; call Migrate to create its tables
+func NewSQLStore(db *sql.DB) *SQLStore {
+	return &SQLStore{db: db}
+}
+
+// Migrate creates the capping tables if they do not exist
+func (s *SQLStore) Migrate(ctx context.Context) error {
+	for _, stmt := range []string{
+		`CREATE TABLE IF NOT EXISTS capping_sends (
+			key TEXT NOT NULL,
+			at  INTEGER NOT NULL
+		)`,
+		`CREATE INDEX IF NOT EXISTS capping_sends_key ON capping_sends (key, at)`,
+		`CREATE TABLE IF NOT EXISTS capping_deferred (
+			id              TEXT PRIMARY KEY,
+			channel         TEXT NOT NULL,
+			notification_id TEXT NOT NULL,
+			user_id         TEXT NOT NULL,
+			type            TEXT NOT NULL,
+			category        TEXT NOT NULL DEFAULT '',
+			payload         BLOB,
+			source          TEXT NOT NULL DEFAULT '',
+			created_at      INTEGER NOT NULL,
+			expires_at      INTEGER NOT NULL DEFAULT 0,
+			release_at      INTEGER NOT NULL,
+			claimed_until   INTEGER NOT NULL DEFAULT 0
+		)`,
+		`CREATE INDEX IF NOT EXISTS capping_deferred_release ON capping_deferred (release_at)`,
+	} {
+		if _, err := s.db.ExecContext(ctx, stmt); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Take implements Store. Sends older than the longest window are pruned
+// as the key is used.
+func (s *SQLStore) Take(ctx context.Context, key Key, now time.Time, limits []Limit) (bool, time.Time, error) {
+	var longest time.Duration
+	for _, l := range limits {
+		longest = max(longest, l.Window)
+	}
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return false, time.Time{}, err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, `DELETE FROM capping_sends WHERE key = ? AND at <= ?`,
+		key.String(), now.Add(-longest).UnixMilli()); err != nil {
+		return false, time.Time{}, err
+	}
+	rows, err := tx.QueryContext(ctx, `SELECT at FROM capping_sends WHERE key = ? ORDER BY at`, key.String())
+	if err != nil {
+		return false, time.Time{}, err
+	}
+	var sends []time.Time
+	for rows.Next() {
+		var at int64
+		if err := rows.Scan(&at); err != nil {
+			rows.Close()
+			return false, time.Time{}, err
+		}
+		sends = append(sends, time.UnixMilli(at).UTC())
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return false, time.Time{}, err
+	}
+
+	ok, retryAt := allowed(sends, now, limits)
+	if ok {
+		if _, err := tx.ExecContext(ctx, `INSERT INTO capping_sends (key, at) VALUES (?, ?)`,
+			key.String(), now.UnixMilli()); err != nil {
+			return false, time.Time{}, err
+		}
+	}
+	return ok, retryAt, tx.Commit()
+}
+
+const itemColumns = `id, channel, notification_id, user_id, type, category, payload, source, created_at, expires_at, release_at, claimed_until`
+
+// Defer implements Store
+func (s *SQLStore) Defer(ctx context.Context, item *Item) error {
+	_, err := s.db.ExecContext(ctx,
+		`INSERT INTO capping_deferred (`+itemColumns+`) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, 0)`,
+		item.ID, item.Channel, item.NotificationID, item.UserID.String(), item.Type, item.Category,
+		[]byte(item.Payload), item.Source, millis(item.CreatedAt), millis(item.ExpiresAt), millis(item.ReleaseAt))
+	return err
+}
+
+// Due implements Store
+func (s *SQLStore) Due(ctx context.Context, now time.Time, limit int) ([]*Item, error) {
+	rows, err := s.db.QueryContext(ctx,
+		`SELECT `+itemColumns+` FROM capping_deferred WHERE release_at <= ? AND claimed_until <= ?
+		 ORDER BY release_at, created_at LIMIT ?`,
+		now.UnixMilli(), now.UnixMilli(), limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var items []*Item
+	for rows.Next() {
+		var (
+			item                                          Item
+			userID                                        string
+			payload                                       []byte
+			createdAt, expiresAt, releaseAt, claimedUntil int64
+		)
+		if err := rows.Scan(&item.ID, &item.Channel, &item.NotificationID, &userID, &item.Type, &item.Category,
+			&payload, &item.Source, &createdAt, &expiresAt, &releaseAt, &claimedUntil); err != nil {
+			return nil, err
+		}
+		if item.UserID, err = uuid.Parse(userID); err != nil {
+			return nil, err
+		}
+		if len(payload) > 0 {
+			item.Payload = payload
+		}
+		item.CreatedAt = fromMillis(createdAt)
+		item.ExpiresAt = fromMillis(expiresAt)
+		item.ReleaseAt = fromMillis(releaseAt)
+		item.ClaimedUntil = fromMillis(claimedUntil)
+		items = append(items, &item)
+	}
+	return items, rows.Err()
+}
+
+// Claim implements Store
+func (s *SQLStore) Claim(ctx context.Context, id string, now, until time.Time) (bool, error) {
+	res, err := s.db.ExecContext(ctx,
+		`UPDATE capping_deferred SET claimed_until = ? WHERE id = ? AND claimed_until <= ?`,
+		until.UnixMilli(), id, now.UnixMilli())
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n > 0, err
+}
+
+// Remove implements Store
+func (s *SQLStore) Remove(ctx context.Context, id string) error {
+	_, err := s.db.ExecContext(ctx, `DELETE FROM capping_deferred WHERE id = ?`, id)
+	return err
+}
+
+func millis(t time.Time) int64 {
+	if t.IsZero() {
+		return 0
+	}
+	return t.UnixMilli()
+}
+
+func fromMillis(ms int64) time.Time {
+	if ms == 0 {
+		return time.Time{}
+	}
+	return time.UnixMilli(ms).UTC()
+}
@@ -0,0 +1,105 @@
+package capping
+
+import (
+	"context"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/cypherlabdev/notification-service/internal/sqlite"
+)
+
+// newTestSQLStore opens a store over the database at path, so that stores
+// opened on the same path act like processes on one host sharing the file
+func newTestSQLStore(t *testing.T, path string) *SQLStore {
+	db, err := sqlite.Open(context.Background(), path)
+	require.NoError(t, err)
+	t.Cleanup(func() { db.Close() })
+	store := NewSQLStore(db)
+	require.NoError(t, store.Migrate(context.Background()))
+	return store
+}
+
+// processes opens n stores over one database
+func processes(t *testing.T, n int) []*SQLStore {
+	path := filepath.Join(t.TempDir(), "capping.db")
+	var stores []*SQLStore
+	for i := 0; i < n; i++ {
+		stores = append(stores, newTestSQLStore(t, path))
+	}
+	return stores
+}
+
+// TestSQLStore_Take tests rolling windows with several limits
+func TestSQLStore_Take(t *testing.T) {
+	testTake(t, processes(t, 1)[0])
+}
+
+// TestSQLStore_Deferred tests claiming and removing deferred sends
+func TestSQLStore_Deferred(t *testing.T) {
+	testDeferred(t, processes(t, 1)[0])
+}
+
+// TestSQLStore_TakeConcurrent tests that processes sending to one user at
+// once never exceed the cap between them
+func TestSQLStore_TakeConcurrent(t *testing.T) {
+	ctx := context.Background()
+	key := Key{UserID: uuid.New(), Category: "promotions", Channel: "push"}
+	limits := []Limit{{Count: 3, Window: time.Hour}}
+	now := time.Now()
+
+	var taken atomic.Int32
+	var wg sync.WaitGroup
+	for _, s := range processes(t, 4) {
+		for i := 0; i < 5; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				ok, _, err := s.Take(ctx, key, now, limits)
+				assert.NoError(t, err)
+				if ok {
+					taken.Add(1)
+				}
+			}()
+		}
+	}
+	wg.Wait()
+	assert.Equal(t, int32(3), taken.Load())
+}
+
+// TestSQLStore_ClaimConcurrent tests that exactly one process claims a
+// deferred send
+func TestSQLStore_ClaimConcurrent(t *testing.T) {
+	ctx := context.Background()
+	now := time.Now()
+	stores := processes(t, 4)
+	require.NoError(t, stores[0].Defer(ctx, &Item{ID: "a", UserID: uuid.New(), CreatedAt: now, ReleaseAt: now}))
+
+	var claims atomic.Int32
+	var wg sync.WaitGroup
+	for _, s := range stores {
+		for i := 0; i < 5; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				claimed, err := s.Claim(ctx, "a", now, now.Add(time.Minute))
+				assert.NoError(t, err)
+				if claimed {
+					claims.Add(1)
+				}
+			}()
+		}
+	}
+	wg.Wait()
+	assert.Equal(t, int32(1), claims.Load())
+
+	claimed, err := stores[1].Claim(ctx, "a", now.Add(time.Minute), now.Add(2*time.Minute))
+	require.NoError(t, err)
+	assert.True(t, claimed, "an expired claim can be taken over")
+}
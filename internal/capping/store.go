@@ -0,0 +1,176 @@
+package capping
+
+import (
+	"context"
+	"encoding/json"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Key identifies the sends counted against a cap
+type Key struct {
+	UserID   uuid.UUID
+	Category string
+	Channel  string
+}
+
+func (k Key) String() string {
+	return k.UserID.String() + "/" + k.Category + "/" + k.Channel
+}
+
+// Item is a send deferred until its cap allows it
+type Item struct {
+	ID             string          `json:"id"`
+	Channel        string          `json:"channel"`
+	NotificationID string          `json:"notification_id"`
+	UserID         uuid.UUID       `json:"user_id"`
+	Type           string          `json:"type"`
+	Category       string          `json:"category,omitempty"`
+	Payload        json.RawMessage `json:"payload,omitempty"`
+	Source         string          `json:"source,omitempty"`
+	CreatedAt      time.Time       `json:"created_at"`
+	ExpiresAt      time.Time       `json:"expires_at,omitzero"`
+	ReleaseAt      time.Time       `json:"release_at"`
+	// ClaimedUntil is set while a replica sends the item; the item is due
+	// again if it is not removed by then
+	ClaimedUntil time.Time `json:"-"`
+}
+
+// Store keeps the send counts and deferred sends. Caps only hold across
+// the processes that share a store.
+type Store interface {
+	// Take records a send for key at now if every limit allows it. If one
+	// does not, nothing is recorded and Take returns when all will.
+	Take(ctx context.Context, key Key, now time.Time, limits []Limit) (bool, time.Time, error)
+
+	// Defer stores a deferred send
+	Defer(ctx context.Context, item *Item) error
+	// Due returns up to limit unclaimed items with ReleaseAt at or before
+	// now, earliest first
+	Due(ctx context.Context, now time.Time, limit int) ([]*Item, error)
+	// Claim marks an item as being sent until the given time, reporting
+	// false if it is gone or claimed by someone else
+	Claim(ctx context.Context, id string, now, until time.Time) (bool, error)
+	// Remove deletes an item
+	Remove(ctx context.Context, id string) error
+}
+
+// allowed checks sends, the times of earlier sends in ascending order,
+// against limits, returning when they all allow another one if not now
+func allowed(sends []time.Time, now time.Time, limits []Limit) (bool, time.Time) {
+	ok, retryAt := true, now
+	for _, l := range limits {
+		start := now.Add(-l.Window)
+		i, _ := slices.BinarySearchFunc(sends, start, func(t, start time.Time) int {
+			if t.After(start) {
+				return 1
+			}
+			return -1
+		})
+		inWindow := sends[i:]
+		if len(inWindow) < l.Count {
+			continue
+		}
+		ok = false
+		// The send that has to leave the window to make room
+		if free := inWindow[len(inWindow)-l.Count].Add(l.Window); free.After(retryAt) {
+			retryAt = free
+		}
+	}
+	return ok, retryAt
+}
+
+// MemoryStore is a Store for tests and single-instance setups; caps are
+// per process
+type MemoryStore struct {
+	sends map[Key][]time.Time
+	items map[string]Item
+	mu    sync.Mutex
+}
+
+// NewMemoryStore creates an empty in-memory store
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		sends: make(map[Key][]time.Time),
+		items: make(map[string]Item),
+	}
+}
+
+// Take implements Store
+func (s *MemoryStore) Take(_ context.Context, key Key, now time.Time, limits []Limit) (bool, time.Time, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var longest time.Duration
+	for _, l := range limits {
+		longest = max(longest, l.Window)
+	}
+	sends := s.sends[key]
+	for len(sends) > 0 && !sends[0].After(now.Add(-longest)) {
+		sends = sends[1:]
+	}
+	ok, retryAt := allowed(sends, now, limits)
+	if ok {
+		sends = append(sends, now)
+	}
+	if len(sends) == 0 {
+		delete(s.sends, key)
+	} else {
+		s.sends[key] = sends
+	}
+	return ok, retryAt, nil
+}
+
+// Defer implements Store
+func (s *MemoryStore) Defer(_ context.Context, item *Item) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.items[item.ID] = *item
+	return nil
+}
+
+// Due implements Store
+func (s *MemoryStore) Due(_ context.Context, now time.Time, limit int) ([]*Item, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var due []*Item
+	for _, item := range s.items {
+		if !item.ReleaseAt.After(now) && !item.ClaimedUntil.After(now) {
+			due = append(due, &item)
+		}
+	}
+	slices.SortFunc(due, func(a, b *Item) int {
+		if c := a.ReleaseAt.Compare(b.ReleaseAt); c != 0 {
+			return c
+		}
+		return a.CreatedAt.Compare(b.CreatedAt)
+	})
+	if len(due) > limit {
+		due = due[:limit]
+	}
+	return due, nil
+}
+
+// Claim implements Store
+func (s *MemoryStore) Claim(_ context.Context, id string, now, until time.Time) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	item, ok := s.items[id]
+	if !ok || item.ClaimedUntil.After(now) {
+		return false, nil
+	}
+	item.ClaimedUntil = until
+	s.items[id] = item
+	return true, nil
+}
+
+// Remove implements Store
+func (s *MemoryStore) Remove(_ context.Context, id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.items, id)
+	return nil
+}
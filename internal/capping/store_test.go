@@ -0,0 +1,80 @@
+package capping
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestMemoryStore_Take tests rolling windows with several limits
+func TestMemoryStore_Take(t *testing.T) {
+	testTake(t, NewMemoryStore())
+}
+
+func testTake(t *testing.T, s Store) {
+	ctx := context.Background()
+	key := Key{UserID: uuid.New(), Category: "promotions", Channel: "push"}
+	limits := []Limit{{Count: 3, Window: 24 * time.Hour}, {Count: 1, Window: time.Hour}}
+	start := time.Date(2026, 6, 10, 9, 0, 0, 0, time.UTC)
+
+	take := func(at time.Time) (bool, time.Time) {
+		ok, retryAt, err := s.Take(ctx, key, at, limits)
+		require.NoError(t, err)
+		return ok, retryAt
+	}
+	ok, _ := take(start)
+	assert.True(t, ok)
+	ok, retryAt := take(start.Add(10 * time.Minute))
+	assert.False(t, ok, "one an hour")
+	assert.Equal(t, start.Add(time.Hour), retryAt)
+
+	ok, _ = take(start.Add(time.Hour))
+	assert.True(t, ok, "a rejected send is not counted")
+	ok, _ = take(start.Add(2 * time.Hour))
+	assert.True(t, ok)
+	ok, retryAt = take(start.Add(3 * time.Hour))
+	assert.False(t, ok, "three a day")
+	assert.Equal(t, start.Add(24*time.Hour), retryAt)
+
+	ok, _ = take(start.Add(24 * time.Hour))
+	assert.True(t, ok, "the first send left the window")
+	other := Key{UserID: key.UserID, Category: "promotions", Channel: "sms"}
+	ok, _, err := s.Take(ctx, other, start.Add(3*time.Hour), limits)
+	require.NoError(t, err)
+	assert.True(t, ok, "counted per channel")
+}
+
+// TestMemoryStore_Deferred tests claiming and removing deferred sends
+func TestMemoryStore_Deferred(t *testing.T) {
+	testDeferred(t, NewMemoryStore())
+}
+
+func testDeferred(t *testing.T, s Store) {
+	ctx := context.Background()
+	now := time.Now()
+
+	require.NoError(t, s.Defer(ctx, &Item{ID: "b", ReleaseAt: now}))
+	require.NoError(t, s.Defer(ctx, &Item{ID: "a", ReleaseAt: now.Add(-time.Minute)}))
+	require.NoError(t, s.Defer(ctx, &Item{ID: "c", ReleaseAt: now.Add(time.Minute)}))
+
+	due, err := s.Due(ctx, now, 10)
+	require.NoError(t, err)
+	require.Len(t, due, 2)
+	assert.Equal(t, "a", due[0].ID)
+
+	claimed, err := s.Claim(ctx, "a", now, now.Add(time.Minute))
+	require.NoError(t, err)
+	assert.True(t, claimed)
+	claimed, err = s.Claim(ctx, "a", now, now.Add(time.Minute))
+	require.NoError(t, err)
+	assert.False(t, claimed)
+
+	require.NoError(t, s.Remove(ctx, "b"))
+	due, err = s.Due(ctx, now, 10)
+	require.NoError(t, err)
+	assert.Empty(t, due)
+}
@@ -0,0 +1,116 @@
+package chatops
+
+import (
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/cypherlabdev/notification-service/internal/notify"
+)
+
+// Severity sets how loudly an alert is shown
+type Severity string
+
+const (
+	SeverityInfo     Severity = "info"
+	SeverityWarning  Severity = "warning"
+	SeverityCritical Severity = "critical"
+)
+
+// marker returns the emoji shown before an alert's title
+func (s Severity) marker() string {
+	switch s {
+	case SeverityCritical:
+		return "🔴"
+	case SeverityWarning:
+		return "🟠"
+	default:
+		return "🔵"
+	}
+}
+
+// Field is a labelled value shown in an alert
+type Field struct {
+	Name  string
+	Value string
+}
+
+// Alert is a notification laid out for a chat message
+type Alert struct {
+	Title    string
+	Text     string
+	Severity Severity
+	Fields   []Field
+	// Footer identifies the notification, for tracing an alert back to it
+	Footer string
+}
+
+// Formatter turns a notification into an alert
+type Formatter func(n *notify.Notification) Alert
+
+// DefaultFormat titles the alert after the notification type and lays out
+// an object payload as fields. The payload's "message" or "summary" becomes
+// the text and its "severity" the alert's severity; other payloads are
+// shown as JSON.
+func DefaultFormat(n *notify.Notification) Alert {
+	a := Alert{
+		Title:    humanize(n.Type),
+		Severity: SeverityInfo,
+		Footer:   fmt.Sprintf("%s · %s", n.ID, n.CreatedAt.UTC().Format(time.RFC3339)),
+	}
+	raw, err := json.Marshal(n.Payload)
+	if err != nil || string(raw) == "null" {
+		return a
+	}
+	var fields map[string]interface{}
+	if json.Unmarshal(raw, &fields) != nil {
+		a.Text = string(raw)
+		return a
+	}
+	for _, key := range []string{"message", "summary"} {
+		if s, ok := fields[key].(string); ok && a.Text == "" {
+			a.Text = s
+			delete(fields, key)
+		}
+	}
+	if s, ok := fields["severity"].(string); ok {
+		a.Severity = Severity(strings.ToLower(s))
+		delete(fields, "severity")
+	}
+	keys := make([]string, 0, len(fields))
+	for k := range fields {
+		keys = append(keys, k)
+	}
+	slices.Sort(keys)
+	for _, k := range keys {
+		a.Fields = append(a.Fields, Field{Name: humanize(k), Value: fieldValue(fields[k])})
+	}
+	return a
+}
+
+// humanize turns "large_liability_match" into "Large liability match"
+func humanize(s string) string {
+	s = strings.NewReplacer("_", " ", ".", " ", "-", " ").Replace(s)
+	if s == "" {
+		return s
+	}
+	return strings.ToUpper(s[:1]) + s[1:]
+}
+
+func fieldValue(v interface{}) string {
+	switch v := v.(type) {
+	case string:
+		return v
+	case float64:
+		// Avoid exponents for large amounts
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case bool, nil:
+		return fmt.Sprint(v)
+	default:
+		raw, _ := json.Marshal(v)
+		return string(raw)
+	}
+}
@@ -0,0 +1,44 @@
+package chatops
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/cypherlabdev/notification-service/internal/notify"
+)
+
+// TestDefaultFormat tests laying out object and scalar payloads
+func TestDefaultFormat(t *testing.T) {
+	created := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	a := DefaultFormat(&notify.Notification{
+		ID:        "n1",
+		Type:      "large_liability_match",
+		CreatedAt: created,
+		Payload: map[string]interface{}{
+			"message":   "Liability over limit on Arsenal v Spurs",
+			"severity":  "CRITICAL",
+			"liability": 2500000,
+			"match_id":  "m-42",
+			"markets":   []string{"1x2", "btts"},
+		},
+	})
+	assert.Equal(t, "Large liability match", a.Title)
+	assert.Equal(t, "Liability over limit on Arsenal v Spurs", a.Text)
+	assert.Equal(t, SeverityCritical, a.Severity)
+	assert.Equal(t, []Field{
+		{Name: "Liability", Value: "2500000"},
+		{Name: "Markets", Value: `["1x2","btts"]`},
+		{Name: "Match id", Value: "m-42"},
+	}, a.Fields)
+	assert.Equal(t, "n1 · 2026-03-01T12:00:00Z", a.Footer)
+
+	a = DefaultFormat(&notify.Notification{Type: "withdrawal_failed", Payload: "insufficient hot wallet balance"})
+	assert.Equal(t, `"insufficient hot wallet balance"`, a.Text)
+	assert.Equal(t, SeverityInfo, a.Severity)
+	assert.Empty(t, a.Fields)
+
+	a = DefaultFormat(&notify.Notification{Type: "withdrawal_failed"})
+	assert.Empty(t, a.Text)
+}
@@ -0,0 +1,26 @@
+package chatops
+
+import (
+	"errors"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var messages = promauto.NewCounterVec(prometheus.CounterOpts{
+	Namespace: "notification",
+	Subsystem: "chatops",
+	Name:      "messages_total",
+	Help:      "Alerts posted to chat services, by service and whether they were accepted, rate limited or failed.",
+}, []string{"service", "result"})
+
+func countMessage(service string, err error) {
+	result := "ok"
+	switch {
+	case errors.Is(err, ErrRateLimited):
+		result = "rate_limited"
+	case err != nil:
+		result = "error"
+	}
+	messages.WithLabelValues(service, result).Inc()
+}
@@ -0,0 +1,107 @@
+// Package chatops posts operational alerts, such as large-liability match
+// events and failed withdrawals, to Slack and Telegram chats.
+package chatops
+
+import (
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+)
+
+// Routes maps notification types to the chats their alerts are posted to.
+// A key is an exact type, a prefix ending in "*" such as "withdrawal_*", or
+// "*" for every type. Types no key matches are not posted.
+type Routes map[string][]string
+
+// Destinations returns the chats alerts of msgType go to, without repeats
+func (r Routes) Destinations(msgType string) []string {
+	var out []string
+	for pattern, dests := range r {
+		prefix, wildcard := strings.CutSuffix(pattern, "*")
+		if pattern != msgType && !(wildcard && strings.HasPrefix(msgType, prefix)) {
+			continue
+		}
+		for _, d := range dests {
+			if !slices.Contains(out, d) {
+				out = append(out, d)
+			}
+		}
+	}
+	slices.Sort(out)
+	return out
+}
+
+// ParseRoutes parses routes written as "type=chat,chat;type=chat", e.g.
+// "large_liability_match=C0RISK;withdrawal_*=C0TREASURY,C0OPS"
+func ParseRoutes(s string) (Routes, error) {
+	routes := make(Routes)
+	for _, rule := range strings.Split(s, ";") {
+		rule = strings.TrimSpace(rule)
+		if rule == "" {
+			continue
+		}
+		pattern, dests, ok := strings.Cut(rule, "=")
+		pattern = strings.TrimSpace(pattern)
+		if !ok || pattern == "" || strings.Contains(strings.TrimSuffix(pattern, "*"), "*") {
+			return nil, fmt.Errorf("invalid route %q", rule)
+		}
+		for _, d := range strings.Split(dests, ",") {
+			if d = strings.TrimSpace(d); d != "" {
+				routes[pattern] = append(routes[pattern], d)
+			}
+		}
+		if len(routes[pattern]) == 0 {
+			return nil, fmt.Errorf("route %q has no destinations", pattern)
+		}
+	}
+	return routes, nil
+}
+
+// defaultTimeout bounds each post to a chat API
+const defaultTimeout = 5 * time.Second
+
+// config holds the settings shared by the chat channels
+type config struct {
+	client  *http.Client
+	baseURL string
+	format  Formatter
+}
+
+// Option configures a Slack or Telegram channel
+type Option func(*config)
+
+// WithHTTPClient sets the client alerts are posted with
+func WithHTTPClient(client *http.Client) Option {
+	return func(c *config) {
+		c.client = client
+	}
+}
+
+// WithBaseURL points the channel at another API root, such as a stand-in
+// server in tests
+func WithBaseURL(url string) Option {
+	return func(c *config) {
+		c.baseURL = strings.TrimSuffix(url, "/")
+	}
+}
+
+// WithFormatter sets how notifications are turned into alerts
+func WithFormatter(format Formatter) Option {
+	return func(c *config) {
+		c.format = format
+	}
+}
+
+func newConfig(baseURL string, opts []Option) config {
+	c := config{
+		client:  &http.Client{Timeout: defaultTimeout},
+		baseURL: baseURL,
+		format:  DefaultFormat,
+	}
+	for _, opt := range opts {
+		opt(&c)
+	}
+	return c
+}
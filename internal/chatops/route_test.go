@@ -0,0 +1,31 @@
+package chatops
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestParseRoutes tests parsing route rules and matching types against them
+func TestParseRoutes(t *testing.T) {
+	routes, err := ParseRoutes(" large_liability_match=C0RISK ; withdrawal_*=C0TREASURY, C0OPS;*=C0FIREHOSE;withdrawal_failed=C0OPS ")
+	require.NoError(t, err)
+
+	assert.Equal(t, []string{"C0FIREHOSE", "C0RISK"}, routes.Destinations("large_liability_match"))
+	assert.Equal(t, []string{"C0FIREHOSE", "C0OPS", "C0TREASURY"}, routes.Destinations("withdrawal_failed"))
+	assert.Equal(t, []string{"C0FIREHOSE"}, routes.Destinations("deposit_received"))
+
+	delete(routes, "*")
+	assert.Empty(t, routes.Destinations("deposit_received"))
+	assert.Empty(t, routes.Destinations("withdrawal"), "the prefix includes the underscore")
+
+	empty, err := ParseRoutes("")
+	require.NoError(t, err)
+	assert.Empty(t, empty)
+
+	for _, bad := range []string{"large_liability_match", "=C0RISK", "withdrawal_failed=", "with*drawal=C0OPS"} {
+		_, err := ParseRoutes(bad)
+		assert.Error(t, err, bad)
+	}
+}
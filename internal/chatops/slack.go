@@ -0,0 +1,223 @@
+package chatops
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/rs/zerolog"
+
+	"github.com/cypherlabdev/notification-service/internal/notify"
+)
+
+// ChannelSlack is the name of the Slack channel
+const ChannelSlack = "slack"
+
+// slackAPI is the root of the Slack Web API
+const slackAPI = "https://slack.com/api"
+
+// Slack limits
+const (
+	slackHeaderLimit = 150
+	slackTextLimit   = 3000
+	slackFieldsLimit = 10 // per section block
+)
+
+// ErrRateLimited is returned when a chat API asks us to slow down
+var ErrRateLimited = errors.New("rate limited")
+
+// SlackChannel posts alerts to Slack. A destination is either a channel ID,
+// posted to with chat.postMessage and the bot token, or an incoming webhook
+// URL, which needs no token.
+type SlackChannel struct {
+	token  string
+	routes Routes
+	config
+	logger zerolog.Logger
+}
+
+// NewSlackChannel creates a Slack channel posting alerts by routes. token
+// may be empty if every destination is an incoming webhook URL.
+func NewSlackChannel(token string, routes Routes, logger zerolog.Logger, opts ...Option) (*SlackChannel, error) {
+	if token == "" {
+		for pattern, dests := range routes {
+			for _, d := range dests {
+				if !isWebhookURL(d) {
+					return nil, fmt.Errorf("slack route %q posts to channel %s, which needs a bot token", pattern, d)
+				}
+			}
+		}
+	}
+	return &SlackChannel{
+		token:  token,
+		routes: routes,
+		config: newConfig(slackAPI, opts),
+		logger: logger.With().Str("component", "slack").Logger(),
+	}, nil
+}
+
+// Name implements notify.Channel
+func (c *SlackChannel) Name() string { return ChannelSlack }
+
+// Wants implements notify.Selective; only routed types are sent
+func (c *SlackChannel) Wants(_ context.Context, n *notify.Notification) bool {
+	return len(c.routes.Destinations(n.Type)) > 0
+}
+
+// Send implements notify.Channel, posting the alert to every destination
+// routed for the notification's type. Types without a route are skipped.
+func (c *SlackChannel) Send(ctx context.Context, n *notify.Notification) error {
+	dests := c.routes.Destinations(n.Type)
+	if len(dests) == 0 {
+		return nil
+	}
+	alert := c.format(n)
+	var errs []error
+	for _, dest := range dests {
+		err := c.post(ctx, dest, alert)
+		countMessage(ChannelSlack, err)
+		if err != nil {
+			c.logger.Warn().Err(err).Str("destination", redactWebhook(dest)).Str("notification_id", n.ID).Msg("failed to post alert")
+			errs = append(errs, fmt.Errorf("%s: %w", redactWebhook(dest), err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// slackMessage is the body of chat.postMessage and incoming webhooks
+type slackMessage struct {
+	Channel     string       `json:"channel,omitempty"`
+	Text        string       `json:"text"`
+	Blocks      []slackBlock `json:"blocks"`
+	UnfurlLinks bool         `json:"unfurl_links"`
+}
+
+type slackBlock struct {
+	Type     string       `json:"type"`
+	Text     *slackText   `json:"text,omitempty"`
+	Fields   []*slackText `json:"fields,omitempty"`
+	Elements []*slackText `json:"elements,omitempty"`
+}
+
+type slackText struct {
+	Type string `json:"type"`
+	Text string `json:"text"`
+}
+
+// slackBlocks lays an alert out as Block Kit blocks
+func slackBlocks(a Alert) []slackBlock {
+	blocks := []slackBlock{{
+		Type: "header",
+		Text: &slackText{Type: "plain_text", Text: truncate(a.Severity.marker()+" "+a.Title, slackHeaderLimit)},
+	}}
+	if a.Text != "" {
+		blocks = append(blocks, slackBlock{Type: "section", Text: mrkdwn(escapeSlack(a.Text))})
+	}
+	for i := 0; i < len(a.Fields); i += slackFieldsLimit {
+		block := slackBlock{Type: "section"}
+		for _, f := range a.Fields[i:min(i+slackFieldsLimit, len(a.Fields))] {
+			block.Fields = append(block.Fields, mrkdwn("*"+escapeSlack(f.Name)+"*\n"+escapeSlack(f.Value)))
+		}
+		blocks = append(blocks, block)
+	}
+	if a.Footer != "" {
+		blocks = append(blocks, slackBlock{Type: "context", Elements: []*slackText{mrkdwn(escapeSlack(a.Footer))}})
+	}
+	return blocks
+}
+
+func mrkdwn(text string) *slackText {
+	return &slackText{Type: "mrkdwn", Text: truncate(text, slackTextLimit)}
+}
+
+// escapeSlack escapes the characters Slack treats as markup
+func escapeSlack(s string) string {
+	return strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;").Replace(s)
+}
+
+// post sends the alert to one destination
+func (c *SlackChannel) post(ctx context.Context, dest string, a Alert) error {
+	msg := slackMessage{Text: a.Title, Blocks: slackBlocks(a)}
+	target := dest
+	if !isWebhookURL(dest) {
+		msg.Channel = dest
+		target = c.baseURL + "/chat.postMessage"
+	}
+	body, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, target, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json; charset=utf-8")
+	if msg.Channel != "" {
+		req.Header.Set("Authorization", "Bearer "+c.token)
+	}
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		// Client errors quote the URL, which for webhooks is a secret
+		var urlErr *url.Error
+		if errors.As(err, &urlErr) {
+			return fmt.Errorf("slack request failed: %w", urlErr.Err)
+		}
+		return err
+	}
+	defer resp.Body.Close()
+	respBody, _ := io.ReadAll(io.LimitReader(resp.Body, 64<<10))
+	if resp.StatusCode == http.StatusTooManyRequests {
+		return fmt.Errorf("%w, retry after %ss", ErrRateLimited, resp.Header.Get("Retry-After"))
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("slack returned %d: %s", resp.StatusCode, strings.TrimSpace(string(respBody)))
+	}
+	if msg.Channel == "" {
+		// Incoming webhooks answer a plain "ok"
+		return nil
+	}
+	// The Web API reports failures in the body of a 200
+	var result struct {
+		OK    bool   `json:"ok"`
+		Error string `json:"error"`
+	}
+	if err := json.Unmarshal(respBody, &result); err != nil {
+		return fmt.Errorf("invalid slack response: %w", err)
+	}
+	if !result.OK {
+		return fmt.Errorf("slack error: %s", result.Error)
+	}
+	return nil
+}
+
+func isWebhookURL(dest string) bool {
+	return strings.HasPrefix(dest, "https://")
+}
+
+// redactWebhook hides the secret path of an incoming webhook URL in errors
+// and logs
+func redactWebhook(dest string) string {
+	if !isWebhookURL(dest) {
+		return dest
+	}
+	if i := strings.Index(dest[len("https://"):], "/"); i >= 0 {
+		return dest[:len("https://")+i] + "/…"
+	}
+	return dest
+}
+
+// truncate shortens s to at most limit runes
+func truncate(s string, limit int) string {
+	r := []rune(s)
+	if len(r) <= limit {
+		return s
+	}
+	return string(r[:limit-1]) + "…"
+}
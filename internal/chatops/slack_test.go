@@ -0,0 +1,177 @@
+package chatops
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/cypherlabdev/notification-service/internal/notify"
+)
+
+const slackToken = "xoxb-test"
+
+// slackStandIn serves chat.postMessage under /api and an incoming webhook
+// at /services/T0/B0/secret, recording what was posted
+type slackStandIn struct {
+	srv       *httptest.Server
+	channels  []string // channels the bot is in
+	limited   bool
+	posted    []slackMessage
+	webhooked []slackMessage
+	mu        sync.Mutex
+}
+
+func newSlackStandIn(t *testing.T, channels ...string) *slackStandIn {
+	s := &slackStandIn{channels: channels}
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /api/chat.postMessage", s.postMessage)
+	mux.HandleFunc("POST /services/T0/B0/secret", s.webhook)
+	s.srv = httptest.NewTLSServer(mux)
+	t.Cleanup(s.srv.Close)
+	return s
+}
+
+func (s *slackStandIn) postMessage(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.limited {
+		w.Header().Set("Retry-After", "30")
+		w.WriteHeader(http.StatusTooManyRequests)
+		return
+	}
+	if r.Header.Get("Authorization") != "Bearer "+slackToken {
+		json.NewEncoder(w).Encode(map[string]interface{}{"ok": false, "error": "invalid_auth"})
+		return
+	}
+	var msg slackMessage
+	json.NewDecoder(r.Body).Decode(&msg)
+	for _, ch := range s.channels {
+		if ch == msg.Channel {
+			s.posted = append(s.posted, msg)
+			json.NewEncoder(w).Encode(map[string]interface{}{"ok": true, "channel": msg.Channel, "ts": "1700000000.000100"})
+			return
+		}
+	}
+	json.NewEncoder(w).Encode(map[string]interface{}{"ok": false, "error": "channel_not_found"})
+}
+
+func (s *slackStandIn) webhook(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var msg slackMessage
+	json.NewDecoder(r.Body).Decode(&msg)
+	s.webhooked = append(s.webhooked, msg)
+	w.Write([]byte("ok"))
+}
+
+func (s *slackStandIn) webhookURL() string {
+	return s.srv.URL + "/services/T0/B0/secret"
+}
+
+func (s *slackStandIn) channel(t *testing.T, routes Routes) *SlackChannel {
+	c, err := NewSlackChannel(slackToken, routes, zerolog.Nop(), WithBaseURL(s.srv.URL+"/api"), WithHTTPClient(s.srv.Client()))
+	require.NoError(t, err)
+	return c
+}
+
+func alertNotification(typ string) *notify.Notification {
+	return &notify.Notification{
+		ID:        uuid.NewString(),
+		UserID:    uuid.New(),
+		Type:      typ,
+		CreatedAt: time.Now(),
+		Payload:   map[string]interface{}{"message": "Liability <limit> & rising", "severity": "warning", "liability": 125000.5},
+	}
+}
+
+// TestSlackChannel_Send tests posting to channels and incoming webhooks by
+// route
+func TestSlackChannel_Send(t *testing.T) {
+	ctx := context.Background()
+	s := newSlackStandIn(t, "C0RISK")
+	c := s.channel(t, Routes{
+		"large_liability_match": {"C0RISK", s.webhookURL()},
+	})
+	assert.Equal(t, ChannelSlack, c.Name())
+
+	require.NoError(t, c.Send(ctx, alertNotification("deposit_received")), "unrouted types are skipped")
+	require.NoError(t, c.Send(ctx, alertNotification("large_liability_match")))
+
+	require.Len(t, s.posted, 1)
+	require.Len(t, s.webhooked, 1)
+	msg := s.posted[0]
+	assert.Equal(t, "C0RISK", msg.Channel)
+	assert.Empty(t, s.webhooked[0].Channel)
+	assert.Equal(t, "Large liability match", msg.Text)
+	require.Len(t, msg.Blocks, 4)
+	assert.Equal(t, "header", msg.Blocks[0].Type)
+	assert.Equal(t, "🟠 Large liability match", msg.Blocks[0].Text.Text)
+	assert.Equal(t, "Liability &lt;limit&gt; &amp; rising", msg.Blocks[1].Text.Text)
+	assert.Equal(t, "*Liability*\n125000.5", msg.Blocks[2].Fields[0].Text)
+	assert.Equal(t, "context", msg.Blocks[3].Type)
+}
+
+// TestSlackChannel_Errors tests that API failures are reported per
+// destination without leaking webhook URLs
+func TestSlackChannel_Errors(t *testing.T) {
+	ctx := context.Background()
+	s := newSlackStandIn(t, "C0RISK")
+	c := s.channel(t, Routes{"withdrawal_*": {"C0RISK", "C0GONE"}})
+
+	err := c.Send(ctx, alertNotification("withdrawal_failed"))
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "C0GONE: slack error: channel_not_found")
+	assert.Len(t, s.posted, 1, "the other destination still gets the alert")
+
+	s.mu.Lock()
+	s.limited = true
+	s.mu.Unlock()
+	err = c.Send(ctx, alertNotification("withdrawal_failed"))
+	assert.True(t, errors.Is(err, ErrRateLimited))
+	assert.Contains(t, err.Error(), "retry after 30s")
+
+	broken := s.srv.URL + "/services/T0/B0/other"
+	c = s.channel(t, Routes{"*": {broken}})
+	err = c.Send(ctx, alertNotification("withdrawal_failed"))
+	require.Error(t, err)
+	assert.NotContains(t, err.Error(), "/services/T0/B0/other")
+
+	s.srv.Close()
+	err = s.channel(t, Routes{"*": {s.webhookURL()}}).Send(ctx, alertNotification("withdrawal_failed"))
+	require.Error(t, err)
+	assert.False(t, strings.Contains(err.Error(), "secret"))
+}
+
+// TestNewSlackChannel tests that channel IDs need a bot token
+func TestNewSlackChannel(t *testing.T) {
+	_, err := NewSlackChannel("", Routes{"*": {"https://hooks.slack.com/services/T0/B0/secret"}}, zerolog.Nop())
+	assert.NoError(t, err)
+	_, err = NewSlackChannel("", Routes{"*": {"C0RISK"}}, zerolog.Nop())
+	assert.Error(t, err)
+}
+
+// TestSlackBlocks tests that long alerts are split and truncated within
+// Slack's limits
+func TestSlackBlocks(t *testing.T) {
+	a := Alert{Title: strings.Repeat("t", 200), Text: strings.Repeat("x", 4000)}
+	for i := 0; i < 12; i++ {
+		a.Fields = append(a.Fields, Field{Name: "f", Value: "v"})
+	}
+	blocks := slackBlocks(a)
+	require.Len(t, blocks, 4)
+	assert.Len(t, []rune(blocks[0].Text.Text), slackHeaderLimit)
+	assert.Len(t, []rune(blocks[1].Text.Text), slackTextLimit)
+	assert.Len(t, blocks[2].Fields, 10)
+	assert.Len(t, blocks[3].Fields, 2)
+}
@@ -0,0 +1,169 @@
+package chatops
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/rs/zerolog"
+
+	"github.com/cypherlabdev/notification-service/internal/notify"
+)
+
+// ChannelTelegram is the name of the Telegram channel
+const ChannelTelegram = "telegram"
+
+// telegramAPI is the root of the Telegram Bot API
+const telegramAPI = "https://api.telegram.org"
+
+// telegramTextLimit is the longest message Telegram accepts
+const telegramTextLimit = 4096
+
+// TelegramChannel posts alerts with a Telegram bot. A destination is a
+// chat ID such as "-1001234567890" or a public channel's "@username"; the
+// bot must be a member of the chat.
+type TelegramChannel struct {
+	token  string
+	routes Routes
+	config
+	logger zerolog.Logger
+}
+
+// NewTelegramChannel creates a Telegram channel posting alerts by routes
+func NewTelegramChannel(token string, routes Routes, logger zerolog.Logger, opts ...Option) (*TelegramChannel, error) {
+	if token == "" {
+		return nil, errors.New("telegram needs a bot token")
+	}
+	return &TelegramChannel{
+		token:  token,
+		routes: routes,
+		config: newConfig(telegramAPI, opts),
+		logger: logger.With().Str("component", "telegram").Logger(),
+	}, nil
+}
+
+// Name implements notify.Channel
+func (c *TelegramChannel) Name() string { return ChannelTelegram }
+
+// Wants implements notify.Selective; only routed types are sent
+func (c *TelegramChannel) Wants(_ context.Context, n *notify.Notification) bool {
+	return len(c.routes.Destinations(n.Type)) > 0
+}
+
+// Send implements notify.Channel, posting the alert to every chat routed
+// for the notification's type. Types without a route are skipped.
+func (c *TelegramChannel) Send(ctx context.Context, n *notify.Notification) error {
+	chats := c.routes.Destinations(n.Type)
+	if len(chats) == 0 {
+		return nil
+	}
+	text := telegramText(c.format(n))
+	var errs []error
+	for _, chat := range chats {
+		err := c.post(ctx, chat, text)
+		countMessage(ChannelTelegram, err)
+		if err != nil {
+			c.logger.Warn().Err(err).Str("destination", chat).Str("notification_id", n.ID).Msg("failed to post alert")
+			errs = append(errs, fmt.Errorf("%s: %w", chat, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// telegramMessage is the body of sendMessage
+type telegramMessage struct {
+	ChatID             string `json:"chat_id"`
+	Text               string `json:"text"`
+	ParseMode          string `json:"parse_mode"`
+	LinkPreviewOptions struct {
+		IsDisabled bool `json:"is_disabled"`
+	} `json:"link_preview_options"`
+}
+
+// telegramText lays an alert out as MarkdownV2
+func telegramText(a Alert) string {
+	var b strings.Builder
+	b.WriteString(a.Severity.marker() + " *" + escapeTelegram(a.Title) + "*")
+	if a.Text != "" {
+		b.WriteString("\n\n" + escapeTelegram(a.Text))
+	}
+	if len(a.Fields) > 0 {
+		b.WriteString("\n")
+		for _, f := range a.Fields {
+			b.WriteString("\n*" + escapeTelegram(f.Name) + ":* " + escapeTelegram(f.Value))
+		}
+	}
+	if a.Footer != "" {
+		b.WriteString("\n\n_" + escapeTelegram(a.Footer) + "_")
+	}
+	text := b.String()
+	if len([]rune(text)) > telegramTextLimit {
+		// Cutting the markup could split an escape or leave an entity
+		// open, so fall back to the title and a shortened text, which
+		// stays within the limit even if every character is escaped
+		text = a.Severity.marker() + " *" + escapeTelegram(truncate(a.Title, 100)) + "*\n\n" + escapeTelegram(truncate(a.Text, telegramTextLimit/3))
+	}
+	return text
+}
+
+// telegramEscaper escapes every character MarkdownV2 reserves
+var telegramEscaper = func() *strings.Replacer {
+	var pairs []string
+	for _, r := range "\\_*[]()~`>#+-=|{}.!" {
+		pairs = append(pairs, string(r), "\\"+string(r))
+	}
+	return strings.NewReplacer(pairs...)
+}()
+
+func escapeTelegram(s string) string {
+	return telegramEscaper.Replace(s)
+}
+
+// post sends text to one chat
+func (c *TelegramChannel) post(ctx context.Context, chat, text string) error {
+	msg := telegramMessage{ChatID: chat, Text: text, ParseMode: "MarkdownV2"}
+	msg.LinkPreviewOptions.IsDisabled = true
+	body, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.baseURL+"/bot"+c.token+"/sendMessage", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		// The URL holds the token, and client errors quote it
+		var urlErr *url.Error
+		if errors.As(err, &urlErr) {
+			return fmt.Errorf("telegram request failed: %w", urlErr.Err)
+		}
+		return err
+	}
+	defer resp.Body.Close()
+	var result struct {
+		OK          bool   `json:"ok"`
+		Description string `json:"description"`
+		Parameters  struct {
+			RetryAfter int `json:"retry_after"`
+		} `json:"parameters"`
+	}
+	if err := json.NewDecoder(io.LimitReader(resp.Body, 64<<10)).Decode(&result); err != nil {
+		return fmt.Errorf("telegram returned %d", resp.StatusCode)
+	}
+	if resp.StatusCode == http.StatusTooManyRequests {
+		return fmt.Errorf("%w, retry after %ds", ErrRateLimited, result.Parameters.RetryAfter)
+	}
+	if !result.OK {
+		return fmt.Errorf("telegram error %d: %s", resp.StatusCode, result.Description)
+	}
+	return nil
+}
@@ -0,0 +1,136 @@
+package chatops
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const telegramToken = "123456:test"
+
+// telegramStandIn serves the Bot API's sendMessage for one bot, recording
+// what was sent
+type telegramStandIn struct {
+	srv     *httptest.Server
+	chats   []string // chats the bot is a member of
+	limited bool
+	sent    []telegramMessage
+	mu      sync.Mutex
+}
+
+func newTelegramStandIn(t *testing.T, chats ...string) *telegramStandIn {
+	s := &telegramStandIn{chats: chats}
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /{bot}/sendMessage", s.sendMessage)
+	s.srv = httptest.NewServer(mux)
+	t.Cleanup(s.srv.Close)
+	return s
+}
+
+func (s *telegramStandIn) sendMessage(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	reply := func(status int, v map[string]interface{}) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		json.NewEncoder(w).Encode(v)
+	}
+	if r.PathValue("bot") != "bot"+telegramToken {
+		reply(http.StatusUnauthorized, map[string]interface{}{"ok": false, "error_code": 401, "description": "Unauthorized"})
+		return
+	}
+	if s.limited {
+		reply(http.StatusTooManyRequests, map[string]interface{}{
+			"ok": false, "error_code": 429, "description": "Too Many Requests: retry after 7",
+			"parameters": map[string]int{"retry_after": 7},
+		})
+		return
+	}
+	var msg telegramMessage
+	json.NewDecoder(r.Body).Decode(&msg)
+	for _, chat := range s.chats {
+		if chat == msg.ChatID {
+			s.sent = append(s.sent, msg)
+			reply(http.StatusOK, map[string]interface{}{"ok": true, "result": map[string]int{"message_id": len(s.sent)}})
+			return
+		}
+	}
+	reply(http.StatusBadRequest, map[string]interface{}{"ok": false, "error_code": 400, "description": "Bad Request: chat not found"})
+}
+
+func (s *telegramStandIn) channel(t *testing.T, token string, routes Routes) *TelegramChannel {
+	c, err := NewTelegramChannel(token, routes, zerolog.Nop(), WithBaseURL(s.srv.URL))
+	require.NoError(t, err)
+	return c
+}
+
+// TestTelegramChannel_Send tests posting MarkdownV2 alerts to routed chats
+func TestTelegramChannel_Send(t *testing.T) {
+	ctx := context.Background()
+	s := newTelegramStandIn(t, "-1001", "@treasury_ops")
+	c := s.channel(t, telegramToken, Routes{
+		"large_liability_match": {"-1001"},
+		"withdrawal_*":          {"-1001", "@treasury_ops"},
+	})
+	assert.Equal(t, ChannelTelegram, c.Name())
+
+	require.NoError(t, c.Send(ctx, alertNotification("deposit_received")))
+	require.NoError(t, c.Send(ctx, alertNotification("withdrawal_failed")))
+
+	require.Len(t, s.sent, 2)
+	assert.Equal(t, []string{"-1001", "@treasury_ops"}, []string{s.sent[0].ChatID, s.sent[1].ChatID})
+	msg := s.sent[0]
+	assert.Equal(t, "MarkdownV2", msg.ParseMode)
+	assert.True(t, msg.LinkPreviewOptions.IsDisabled)
+	assert.True(t, strings.HasPrefix(msg.Text, "🟠 *Withdrawal failed*\n\nLiability <limit\\> & rising\n\n*Liability:* 125000\\.5\n\n_"))
+}
+
+// TestTelegramChannel_Errors tests API failures, rate limits and that the
+// bot token stays out of errors
+func TestTelegramChannel_Errors(t *testing.T) {
+	ctx := context.Background()
+	s := newTelegramStandIn(t, "-1001")
+
+	err := s.channel(t, telegramToken, Routes{"*": {"-1001", "-1002"}}).Send(ctx, alertNotification("withdrawal_failed"))
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "-1002: telegram error 400: Bad Request: chat not found")
+	assert.Len(t, s.sent, 1)
+
+	err = s.channel(t, "654321:wrong", Routes{"*": {"-1001"}}).Send(ctx, alertNotification("withdrawal_failed"))
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "Unauthorized")
+
+	s.mu.Lock()
+	s.limited = true
+	s.mu.Unlock()
+	err = s.channel(t, telegramToken, Routes{"*": {"-1001"}}).Send(ctx, alertNotification("withdrawal_failed"))
+	assert.True(t, errors.Is(err, ErrRateLimited))
+	assert.Contains(t, err.Error(), "retry after 7s")
+
+	s.srv.Close()
+	err = s.channel(t, telegramToken, Routes{"*": {"-1001"}}).Send(ctx, alertNotification("withdrawal_failed"))
+	require.Error(t, err)
+	assert.NotContains(t, err.Error(), telegramToken)
+
+	_, err = NewTelegramChannel("", Routes{"*": {"-1001"}}, zerolog.Nop())
+	assert.Error(t, err)
+}
+
+// TestTelegramText tests MarkdownV2 escaping and the length limit
+func TestTelegramText(t *testing.T) {
+	assert.Equal(t, `1\.5\_x \*bold\* \[a\]\(b\) \\ \-\!`, escapeTelegram(`1.5_x *bold* [a](b) \ -!`))
+
+	long := Alert{Title: "Withdrawal failed", Text: strings.Repeat(".", 5000), Fields: []Field{{Name: "a", Value: "b"}}}
+	text := telegramText(long)
+	assert.LessOrEqual(t, len([]rune(text)), telegramTextLimit)
+	assert.NotContains(t, text, "*a:*", "fields are dropped from oversized alerts")
+}
@@ -0,0 +1,163 @@
+// Package dedup suppresses duplicate notifications caused by Kafka
+// redelivery and client retries. Ingest paths claim an idempotency key in a
+// Store before acting; a key already claimed within the window is a
+// duplicate.
+package dedup
+
+import (
+	"container/list"
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+// defaultCapacity bounds the keys a MemoryStore holds
+const defaultCapacity = 100_000
+
+// ErrNotFound is returned when updating a key that is not claimed
+var ErrNotFound = errors.New("idempotency key not found")
+
+// Store records claimed idempotency keys for a time window. Each key
+// carries an opaque value, such as the response to replay to a retried
+// HTTP request.
+type Store interface {
+	// Reserve claims key for ttl with the given value. If the key is
+	// already claimed it returns false and the stored value.
+	Reserve(ctx context.Context, key string, value []byte, ttl time.Duration) (claimed bool, existing []byte, err error)
+	// Update replaces the value of a claimed key, keeping its expiry
+	Update(ctx context.Context, key string, value []byte) error
+	// Release forgets a key so that a retry can claim it again
+	Release(ctx context.Context, key string) error
+}
+
+type memoryEntry struct {
+	key     string
+	value   []byte
+	expires time.Time
+}
+
+// MemoryStore is an LRU Store local to one instance. When full it evicts
+// the least recently claimed key, even if its window has not passed.
+type MemoryStore struct {
+	capacity int
+	entries  map[string]*list.Element
+	order    *list.List // front is the most recently claimed
+	now      func() time.Time
+	mu       sync.Mutex
+}
+
+// NewMemoryStore creates an LRU store holding up to capacity keys;
+// capacity <= 0 uses a default of 100,000
+func NewMemoryStore(capacity int) *MemoryStore {
+	if capacity <= 0 {
+		capacity = defaultCapacity
+	}
+	return &MemoryStore{
+		capacity: capacity,
+		entries:  make(map[string]*list.Element),
+		order:    list.New(),
+		now:      time.Now,
+	}
+}
+
+// Reserve implements Store
+func (s *MemoryStore) Reserve(_ context.Context, key string, value []byte, ttl time.Duration) (bool, []byte, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.now()
+	if el, ok := s.entries[key]; ok {
+		entry := el.Value.(*memoryEntry)
+		if now.Before(entry.expires) {
+			return false, entry.value, nil
+		}
+		s.order.Remove(el)
+		delete(s.entries, key)
+	}
+
+	for s.order.Len() >= s.capacity {
+		oldest := s.order.Back()
+		s.order.Remove(oldest)
+		delete(s.entries, oldest.Value.(*memoryEntry).key)
+	}
+	s.entries[key] = s.order.PushFront(&memoryEntry{key: key, value: value, expires: now.Add(ttl)})
+	return true, nil, nil
+}
+
+// Update implements Store
+func (s *MemoryStore) Update(_ context.Context, key string, value []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	el, ok := s.entries[key]
+	if !ok {
+		return ErrNotFound
+	}
+	el.Value.(*memoryEntry).value = value
+	return nil
+}
+
+// Release implements Store
+func (s *MemoryStore) Release(_ context.Context, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if el, ok := s.entries[key]; ok {
+		s.order.Remove(el)
+		delete(s.entries, key)
+	}
+	return nil
+}
+
+// Len returns the number of keys held, including expired ones not yet evicted
+func (s *MemoryStore) Len() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.entries)
+}
+
+// LayeredStore puts a local MemoryStore in front of a shared Store so that
+// redeliveries to the same instance are caught without a round trip. Keys
+// this instance claims are cached locally; keys claimed elsewhere always
+// go to the shared store, so their latest value is seen.
+type LayeredStore struct {
+	local  *MemoryStore
+	shared Store
+}
+
+// NewLayeredStore creates a store caching this instance's claims in local
+func NewLayeredStore(local *MemoryStore, shared Store) *LayeredStore {
+	return &LayeredStore{local: local, shared: shared}
+}
+
+// Reserve implements Store
+func (s *LayeredStore) Reserve(ctx context.Context, key string, value []byte, ttl time.Duration) (bool, []byte, error) {
+	s.local.mu.Lock()
+	if el, ok := s.local.entries[key]; ok {
+		entry := el.Value.(*memoryEntry)
+		if s.local.now().Before(entry.expires) {
+			s.local.mu.Unlock()
+			return false, entry.value, nil
+		}
+	}
+	s.local.mu.Unlock()
+
+	claimed, existing, err := s.shared.Reserve(ctx, key, value, ttl)
+	if err != nil || !claimed {
+		return claimed, existing, err
+	}
+	s.local.Release(ctx, key)
+	s.local.Reserve(ctx, key, value, ttl)
+	return true, nil, nil
+}
+
+// Update implements Store
+func (s *LayeredStore) Update(ctx context.Context, key string, value []byte) error {
+	s.local.Update(ctx, key, value)
+	return s.shared.Update(ctx, key, value)
+}
+
+// Release implements Store
+func (s *LayeredStore) Release(ctx context.Context, key string) error {
+	s.local.Release(ctx, key)
+	return s.shared.Release(ctx, key)
+}
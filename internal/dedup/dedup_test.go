@@ -0,0 +1,115 @@
+package dedup
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type fakeClock struct{ t time.Time }
+
+func (c *fakeClock) now() time.Time { return c.t }
+
+// TestMemoryStore_Reserve tests claiming keys within and after their window
+func TestMemoryStore_Reserve(t *testing.T) {
+	ctx := context.Background()
+	clock := &fakeClock{t: time.Unix(0, 0)}
+	s := NewMemoryStore(10)
+	s.now = clock.now
+
+	claimed, _, err := s.Reserve(ctx, "tx-1", []byte("v1"), time.Minute)
+	require.NoError(t, err)
+	assert.True(t, claimed)
+
+	claimed, existing, err := s.Reserve(ctx, "tx-1", []byte("v2"), time.Minute)
+	require.NoError(t, err)
+	assert.False(t, claimed)
+	assert.Equal(t, []byte("v1"), existing)
+
+	require.NoError(t, s.Update(ctx, "tx-1", []byte("done")))
+	_, existing, _ = s.Reserve(ctx, "tx-1", nil, time.Minute)
+	assert.Equal(t, []byte("done"), existing)
+	assert.ErrorIs(t, s.Update(ctx, "unknown", nil), ErrNotFound)
+
+	clock.t = clock.t.Add(time.Minute)
+	claimed, _, _ = s.Reserve(ctx, "tx-1", nil, time.Minute)
+	assert.True(t, claimed, "the window has passed")
+
+	require.NoError(t, s.Release(ctx, "tx-1"))
+	claimed, _, _ = s.Reserve(ctx, "tx-1", nil, time.Minute)
+	assert.True(t, claimed, "released keys can be claimed again")
+}
+
+// TestMemoryStore_Evict tests that the least recently claimed key is evicted when full
+func TestMemoryStore_Evict(t *testing.T) {
+	ctx := context.Background()
+	s := NewMemoryStore(2)
+
+	s.Reserve(ctx, "a", nil, time.Hour)
+	s.Reserve(ctx, "b", nil, time.Hour)
+	s.Reserve(ctx, "c", nil, time.Hour)
+	assert.Equal(t, 2, s.Len())
+
+	claimed, _, _ := s.Reserve(ctx, "a", nil, time.Hour)
+	assert.True(t, claimed, "a was evicted")
+	claimed, _, _ = s.Reserve(ctx, "c", nil, time.Hour)
+	assert.False(t, claimed)
+}
+
+// TestLayeredStore tests that instances sharing a backend see each other's claims
+func TestLayeredStore(t *testing.T) {
+	ctx := context.Background()
+	shared := NewMemoryStore(0)
+	a := NewLayeredStore(NewMemoryStore(0), shared)
+	b := NewLayeredStore(NewMemoryStore(0), shared)
+
+	claimed, _, err := a.Reserve(ctx, "tx-1", []byte("pending"), time.Minute)
+	require.NoError(t, err)
+	assert.True(t, claimed)
+
+	claimed, existing, err := b.Reserve(ctx, "tx-1", nil, time.Minute)
+	require.NoError(t, err)
+	assert.False(t, claimed)
+	assert.Equal(t, []byte("pending"), existing)
+
+	// b sees a's update because it does not cache keys it did not claim
+	require.NoError(t, a.Update(ctx, "tx-1", []byte("done")))
+	_, existing, _ = b.Reserve(ctx, "tx-1", nil, time.Minute)
+	assert.Equal(t, []byte("done"), existing)
+
+	// a answers from its local cache
+	_, existing, _ = a.Reserve(ctx, "tx-1", nil, time.Minute)
+	assert.Equal(t, []byte("done"), existing)
+
+	require.NoError(t, a.Release(ctx, "tx-1"))
+	claimed, _, _ = b.Reserve(ctx, "tx-1", nil, time.Minute)
+	assert.True(t, claimed)
+}
+
+// TestKafkaKey tests deriving idempotency keys from consumed records
+func TestKafkaKey(t *testing.T) {
+	headers := []KafkaHeader{{Key: "trace-id", Value: []byte("x")}, {Key: "Event-ID", Value: []byte("evt-9")}}
+	assert.Equal(t, "kafka:wallet-events:evt-9", KafkaKey("wallet-events", 0, 1, headers))
+	assert.Equal(t, "kafka:wallet-events:evt-9", KafkaKey("wallet-events", 3, 7, headers), "redelivered elsewhere")
+
+	headers = append(headers, KafkaHeader{Key: "Idempotency-Key", Value: []byte("dep-42")})
+	assert.Equal(t, "kafka:wallet-events:dep-42", KafkaKey("wallet-events", 0, 1, headers))
+
+	assert.Equal(t, "kafka:order-events@2:15", KafkaKey("order-events", 2, 15, []KafkaHeader{{Key: "event-id"}}))
+}
+
+// TestKafkaKey_SharedRecordKey tests that events sharing a record key but
+// no event ID are both delivered, and a redelivered record is not
+func TestKafkaKey_SharedRecordKey(t *testing.T) {
+	ctx := context.Background()
+	s := NewMemoryStore(0)
+	// Two events for order o-1 on one partition, then the first redelivered
+	for i, offset := range []int64{15, 16, 15} {
+		claimed, _, err := s.Reserve(ctx, KafkaKey("order-events", 2, offset, nil), nil, time.Hour)
+		require.NoError(t, err)
+		assert.Equal(t, i < 2, claimed, "offset %d", offset)
+	}
+}
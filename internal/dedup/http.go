@@ -0,0 +1,148 @@
+package dedup
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/rs/zerolog"
+)
+
+const (
+	// HeaderIdempotencyKey carries the client's idempotency key
+	HeaderIdempotencyKey = "Idempotency-Key"
+	// HeaderReplayed marks a response replayed from an earlier request
+	HeaderReplayed = "Idempotent-Replayed"
+
+	maxKeyLength = 255
+	// maxRecordedBody bounds the request and response bodies kept for replay
+	maxRecordedBody = 64 << 10
+)
+
+// httpRecord is the value stored under an HTTP idempotency key
+type httpRecord struct {
+	Fingerprint string `json:"fingerprint"`
+	Done        bool   `json:"done"`
+	Status      int    `json:"status,omitempty"`
+	ContentType string `json:"content_type,omitempty"`
+	Body        []byte `json:"body,omitempty"`
+}
+
+// Idempotent wraps an API so that a POST carrying an Idempotency-Key is
+// executed once per key within window. A retry receives the original
+// response; a retry while the first request is still running gets 409,
+// and reusing a key for a different request gets 422. Responses with a
+// 5xx status are not recorded, so the request can be retried.
+func Idempotent(store Store, window time.Duration, logger zerolog.Logger, next http.Handler) http.Handler {
+	logger = logger.With().Str("component", "idempotency").Logger()
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		key := r.Header.Get(HeaderIdempotencyKey)
+		if key == "" || r.Method != http.MethodPost {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if len(key) > maxKeyLength {
+			http.Error(w, "Idempotency-Key is too long", http.StatusBadRequest)
+			return
+		}
+
+		body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxRecordedBody))
+		if err != nil {
+			http.Error(w, "request body too large", http.StatusRequestEntityTooLarge)
+			return
+		}
+		r.Body = io.NopCloser(bytes.NewReader(body))
+		sum := sha256.Sum256(append([]byte(r.URL.Path+"\n"), body...))
+		fingerprint := hex.EncodeToString(sum[:])
+
+		storeKey := "http:" + r.URL.Path + ":" + key
+		pending, _ := json.Marshal(httpRecord{Fingerprint: fingerprint})
+		claimed, existing, err := store.Reserve(r.Context(), storeKey, pending, window)
+		if err != nil {
+			// Failing open risks a duplicate; failing closed blocks all publishing
+			logger.Error().Err(err).Msg("idempotency store unavailable")
+			next.ServeHTTP(w, r)
+			return
+		}
+		if !claimed {
+			duplicates.WithLabelValues("http").Inc()
+			replay(w, existing, fingerprint)
+			return
+		}
+
+		rec := &responseRecorder{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(rec, r)
+
+		ctx := r.Context()
+		if rec.status >= http.StatusInternalServerError || rec.overflow {
+			if err := store.Release(ctx, storeKey); err != nil {
+				logger.Warn().Err(err).Msg("failed to release idempotency key")
+			}
+			return
+		}
+		done, _ := json.Marshal(httpRecord{
+			Fingerprint: fingerprint,
+			Done:        true,
+			Status:      rec.status,
+			ContentType: rec.Header().Get("Content-Type"),
+			Body:        rec.body.Bytes(),
+		})
+		if err := store.Update(ctx, storeKey, done); err != nil {
+			logger.Warn().Err(err).Msg("failed to record idempotent response")
+		}
+	})
+}
+
+// replay answers a retried request from the stored record
+func replay(w http.ResponseWriter, stored []byte, fingerprint string) {
+	var record httpRecord
+	if err := json.Unmarshal(stored, &record); err != nil {
+		http.Error(w, "idempotency key already used", http.StatusConflict)
+		return
+	}
+	switch {
+	case record.Fingerprint != fingerprint:
+		http.Error(w, "Idempotency-Key was used for a different request", http.StatusUnprocessableEntity)
+	case !record.Done:
+		http.Error(w, "a request with this Idempotency-Key is in progress", http.StatusConflict)
+	default:
+		if record.ContentType != "" {
+			w.Header().Set("Content-Type", record.ContentType)
+		}
+		w.Header().Set(HeaderReplayed, "true")
+		w.WriteHeader(record.Status)
+		w.Write(record.Body)
+	}
+}
+
+// responseRecorder captures the response while writing it through
+type responseRecorder struct {
+	http.ResponseWriter
+	status      int
+	wroteHeader bool
+	body        bytes.Buffer
+	overflow    bool // the body was too large to record
+}
+
+func (r *responseRecorder) WriteHeader(status int) {
+	if !r.wroteHeader {
+		r.status = status
+		r.wroteHeader = true
+	}
+	r.ResponseWriter.WriteHeader(status)
+}
+
+func (r *responseRecorder) Write(p []byte) (int, error) {
+	r.wroteHeader = true
+	if r.body.Len()+len(p) > maxRecordedBody {
+		r.overflow = true
+	} else {
+		r.body.Write(p)
+	}
+	return r.ResponseWriter.Write(p)
+}
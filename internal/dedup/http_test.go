@@ -0,0 +1,87 @@
+package dedup
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func post(h http.Handler, path, key, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPost, path, strings.NewReader(body))
+	if key != "" {
+		req.Header.Set(HeaderIdempotencyKey, key)
+	}
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	return rec
+}
+
+// TestIdempotent tests that retried requests get the original response without re-executing
+func TestIdempotent(t *testing.T) {
+	var calls atomic.Int32
+	api := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := calls.Add(1)
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusAccepted)
+		w.Write([]byte(`{"call":` + string(rune('0'+n)) + `}`))
+	})
+	h := Idempotent(NewMemoryStore(0), time.Hour, zerolog.Nop(), api)
+
+	first := post(h, "/notifications", "k-1", `{"type":"deposit"}`)
+	require.Equal(t, http.StatusAccepted, first.Code)
+	assert.Equal(t, `{"call":1}`, first.Body.String())
+
+	retry := post(h, "/notifications", "k-1", `{"type":"deposit"}`)
+	assert.Equal(t, http.StatusAccepted, retry.Code)
+	assert.Equal(t, `{"call":1}`, retry.Body.String())
+	assert.Equal(t, "application/json", retry.Header().Get("Content-Type"))
+	assert.Equal(t, "true", retry.Header().Get(HeaderReplayed))
+	assert.Equal(t, int32(1), calls.Load())
+
+	// The same key with a different body is a client error
+	assert.Equal(t, http.StatusUnprocessableEntity, post(h, "/notifications", "k-1", `{"type":"withdrawal"}`).Code)
+	// Keys are scoped by path, and requests without a key always run
+	assert.Equal(t, http.StatusAccepted, post(h, "/campaigns", "k-1", `{"type":"deposit"}`).Code)
+	post(h, "/notifications", "", `{}`)
+	post(h, "/notifications", "", `{}`)
+	assert.Equal(t, int32(4), calls.Load())
+}
+
+// TestIdempotent_InFlightAndErrors tests concurrent retries and retries after server errors
+func TestIdempotent_InFlightAndErrors(t *testing.T) {
+	release := make(chan struct{})
+	started := make(chan struct{})
+	var fail atomic.Bool
+	api := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/slow" {
+			close(started)
+			<-release
+		}
+		if fail.Load() {
+			http.Error(w, "boom", http.StatusInternalServerError)
+			return
+		}
+		w.WriteHeader(http.StatusCreated)
+	})
+	h := Idempotent(NewMemoryStore(0), time.Hour, zerolog.Nop(), api)
+
+	done := make(chan int)
+	go func() { done <- post(h, "/slow", "k", "").Code }()
+	<-started
+	assert.Equal(t, http.StatusConflict, post(h, "/slow", "k", "").Code)
+	close(release)
+	assert.Equal(t, http.StatusCreated, <-done)
+
+	fail.Store(true)
+	assert.Equal(t, http.StatusInternalServerError, post(h, "/fast", "k2", "").Code)
+	fail.Store(false)
+	assert.Equal(t, http.StatusCreated, post(h, "/fast", "k2", "").Code)
+	assert.Equal(t, "true", post(h, "/fast", "k2", "").Header().Get(HeaderReplayed))
+}
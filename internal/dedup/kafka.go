@@ -0,0 +1,28 @@
+package dedup
+
+import (
+	"strconv"
+	"strings"
+)
+
+// KafkaHeader is a record header, as exposed by any Kafka client library
+type KafkaHeader struct {
+	Key   string
+	Value []byte
+}
+
+// KafkaKey returns the idempotency key of a consumed record: the value of
+// its idempotency-key or event-id header if present, otherwise its
+// partition and offset, which only catch the same record being redelivered.
+// The record key is never used, as it is a partition key that many events
+// share. Keys are scoped by topic.
+func KafkaKey(topic string, partition int32, offset int64, headers []KafkaHeader) string {
+	for _, name := range []string{"idempotency-key", "event-id"} {
+		for _, h := range headers {
+			if strings.EqualFold(h.Key, name) && len(h.Value) > 0 {
+				return "kafka:" + topic + ":" + string(h.Value)
+			}
+		}
+	}
+	return "kafka:" + topic + "@" + strconv.Itoa(int(partition)) + ":" + strconv.FormatInt(offset, 10)
+}
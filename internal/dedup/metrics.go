@@ -0,0 +1,18 @@
+package dedup
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var duplicates = promauto.NewCounterVec(prometheus.CounterOpts{
+	Namespace: "notification",
+	Subsystem: "dedup",
+	Name:      "duplicates_total",
+	Help:      "Requests and notifications suppressed as duplicates, by ingest path.",
+}, []string{"path"})
+
+// CountDuplicate records a duplicate suppressed on the given ingest path
+func CountDuplicate(path string) {
+	duplicates.WithLabelValues(path).Inc()
+}
@@ -0,0 +1,78 @@
+package dedup
+
+import (
+	"context"
+	"database/sql"
+	"time"
+)
+
+// SQLStore is a Store in the idempotency_keys table, shared by the
+// processes on one host that open the same database file. Its statements
+// use SQLite syntax; open the *sql.DB with sqlite.Open. Expired keys stay
+// until Purge deletes them.
+type SQLStore struct {
+	db  *sql.DB
+	now func() time.Time
+}
+
+// NewSQLStore creates a store over db; call Migrate to create its table
+func NewSQLStore(db *sql.DB) *SQLStore {
+	return &SQLStore{db: db, now: time.Now}
+}
+
+// Migrate creates the idempotency_keys table if it does not exist
+func (s *SQLStore) Migrate(ctx context.Context) error {
+	_, err := s.db.ExecContext(ctx, `CREATE TABLE IF NOT EXISTS idempotency_keys (
+		key        TEXT PRIMARY KEY,
+		value      BLOB,
+		expires_at INTEGER NOT NULL
+	)`)
+	return err
+}
+
+// Reserve implements Store; a key whose window has passed is claimed anew
+func (s *SQLStore) Reserve(ctx context.Context, key string, value []byte, ttl time.Duration) (bool, []byte, error) {
+	now := s.now()
+	res, err := s.db.ExecContext(ctx,
+		`INSERT INTO idempotency_keys (key, value, expires_at) VALUES (?, ?, ?)
+		 ON CONFLICT (key) DO UPDATE SET value = excluded.value, expires_at = excluded.expires_at
+		 WHERE idempotency_keys.expires_at <= ?`,
+		key, value, now.Add(ttl).UnixMilli(), now.UnixMilli())
+	if err != nil {
+		return false, nil, err
+	}
+	if n, err := res.RowsAffected(); err != nil || n > 0 {
+		return err == nil, nil, err
+	}
+
+	var existing []byte
+	err = s.db.QueryRowContext(ctx, `SELECT value FROM idempotency_keys WHERE key = ?`, key).Scan(&existing)
+	return false, existing, err
+}
+
+// Update implements Store
+func (s *SQLStore) Update(ctx context.Context, key string, value []byte) error {
+	res, err := s.db.ExecContext(ctx, `UPDATE idempotency_keys SET value = ? WHERE key = ?`, value, key)
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// Release implements Store
+func (s *SQLStore) Release(ctx context.Context, key string) error {
+	_, err := s.db.ExecContext(ctx, `DELETE FROM idempotency_keys WHERE key = ?`, key)
+	return err
+}
+
+// Purge deletes keys whose window has passed, returning how many were removed
+func (s *SQLStore) Purge(ctx context.Context) (int64, error) {
+	res, err := s.db.ExecContext(ctx, `DELETE FROM idempotency_keys WHERE expires_at <= ?`, s.now().UnixMilli())
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
@@ -0,0 +1,95 @@
+package dedup
+
+import (
+	"context"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/cypherlabdev/notification-service/internal/sqlite"
+)
+
+// newTestSQLStore opens a store over the database at path, so that stores
+// opened on the same path act like processes on one host sharing the file
+func newTestSQLStore(t *testing.T, path string) *SQLStore {
+	db, err := sqlite.Open(context.Background(), path)
+	require.NoError(t, err)
+	t.Cleanup(func() { db.Close() })
+	store := NewSQLStore(db)
+	require.NoError(t, store.Migrate(context.Background()))
+	return store
+}
+
+// TestSQLStore tests claiming, updating, releasing and purging keys
+func TestSQLStore(t *testing.T) {
+	ctx := context.Background()
+	clock := &fakeClock{t: time.Unix(1_700_000_000, 0)}
+	s := newTestSQLStore(t, filepath.Join(t.TempDir(), "dedup.db"))
+	s.now = clock.now
+
+	claimed, _, err := s.Reserve(ctx, "tx-1", []byte("v1"), time.Minute)
+	require.NoError(t, err)
+	assert.True(t, claimed)
+
+	claimed, existing, err := s.Reserve(ctx, "tx-1", []byte("v2"), time.Minute)
+	require.NoError(t, err)
+	assert.False(t, claimed)
+	assert.Equal(t, []byte("v1"), existing)
+
+	require.NoError(t, s.Update(ctx, "tx-1", []byte("done")))
+	_, existing, _ = s.Reserve(ctx, "tx-1", nil, time.Minute)
+	assert.Equal(t, []byte("done"), existing)
+	assert.ErrorIs(t, s.Update(ctx, "unknown", nil), ErrNotFound)
+
+	clock.t = clock.t.Add(time.Minute)
+	claimed, _, err = s.Reserve(ctx, "tx-1", []byte("v3"), time.Minute)
+	require.NoError(t, err)
+	assert.True(t, claimed, "the window has passed")
+
+	require.NoError(t, s.Release(ctx, "tx-1"))
+	claimed, _, _ = s.Reserve(ctx, "tx-1", nil, time.Minute)
+	assert.True(t, claimed, "released keys can be claimed again")
+
+	s.Reserve(ctx, "tx-2", nil, time.Hour)
+	clock.t = clock.t.Add(time.Minute)
+	n, err := s.Purge(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), n, "only tx-1's window has passed")
+	assert.ErrorIs(t, s.Update(ctx, "tx-1", nil), ErrNotFound)
+	claimed, _, _ = s.Reserve(ctx, "tx-2", nil, time.Hour)
+	assert.False(t, claimed)
+}
+
+// TestSQLStore_Processes tests that exactly one of several processes
+// claims a key redelivered to all of them at once
+func TestSQLStore_Processes(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "dedup.db")
+	var processes []*LayeredStore
+	for i := 0; i < 4; i++ {
+		processes = append(processes, NewLayeredStore(NewMemoryStore(0), newTestSQLStore(t, path)))
+	}
+
+	var claims atomic.Int32
+	var wg sync.WaitGroup
+	for _, r := range processes {
+		for i := 0; i < 4; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				claimed, _, err := r.Reserve(ctx, "kafka:wallet-events:evt-1", []byte("pending"), time.Minute)
+				assert.NoError(t, err)
+				if claimed {
+					claims.Add(1)
+				}
+			}()
+		}
+	}
+	wg.Wait()
+	assert.Equal(t, int32(1), claims.Load())
+}
@@ -0,0 +1,321 @@
+// Package digest batches the notifications of users who opted into
+// summaries, such as a daily digest of settled bets, and sends each batch
+// as one digest notification on the user's schedule.
+package digest
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"text/template"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/rs/zerolog"
+
+	"github.com/cypherlabdev/notification-service/internal/notify"
+)
+
+// TypeDigest is the type of the notifications digests are sent as
+const TypeDigest = "digest"
+
+const (
+	defaultPollInterval = 30 * time.Second
+	// defaultMaxItems sends a digest early once it holds this many items
+	defaultMaxItems = 50
+	// dueBatch bounds the digests sent per poll
+	dueBatch = 100
+)
+
+// Dispatcher delivers digests; *notify.Dispatcher implements it
+type Dispatcher interface {
+	Dispatch(ctx context.Context, n *notify.Notification) error
+}
+
+// Summary is the payload of a digest notification
+type Summary struct {
+	Category string `json:"category"`
+	Rendered
+	Count int           `json:"count"`
+	From  time.Time     `json:"from"`
+	To    time.Time     `json:"to"`
+	Items []SummaryItem `json:"items"`
+}
+
+// SummaryItem is one notification in a digest
+type SummaryItem struct {
+	ID        string          `json:"id"`
+	Type      string          `json:"type"`
+	CreatedAt time.Time       `json:"created_at"`
+	Payload   json.RawMessage `json:"payload,omitempty"`
+}
+
+// Option configures an Aggregator
+type Option func(*Aggregator)
+
+// WithPollInterval sets how often due digests are looked for
+func WithPollInterval(interval time.Duration) Option {
+	return func(a *Aggregator) {
+		a.pollInterval = interval
+	}
+}
+
+// WithMaxItems sends a digest as soon as it holds n items
+func WithMaxItems(n int) Option {
+	return func(a *Aggregator) {
+		a.maxItems = max(n, 1)
+	}
+}
+
+// WithTemplate renders the category's digests with t, which must define
+// "subject" and "body" templates executed with a View
+func WithTemplate(category string, t *template.Template) Option {
+	return func(a *Aggregator) {
+		a.templates[category] = t
+	}
+}
+
+// WithChannels limits digests to the named channels: notifications are
+// held for those and sent over the others at once, and digests are sent
+// over those alone
+func WithChannels(channels ...string) Option {
+	return func(a *Aggregator) {
+		a.channels = channels
+	}
+}
+
+// Aggregator holds the notifications of categories users take as digests
+// and sends each digest when it falls due or fills up. It is a
+// notify.Holder. An item is sent in exactly one digest: waiting items are
+// sealed into a batch before sending, a batch is only deleted once sent,
+// and a batch left over by a restart is sent again under the same
+// idempotency key, which the dispatcher suppresses if it already went out.
+type Aggregator struct {
+	store        Store
+	dispatcher   Dispatcher
+	templates    map[string]*template.Template
+	channels     []string
+	pollInterval time.Duration
+	maxItems     int
+	full         chan Key // digests that reached maxItems
+	logger       zerolog.Logger
+	now          func() time.Time
+}
+
+// New creates an aggregator over store. It holds notifications at once;
+// call Run to send digests.
+func New(store Store, logger zerolog.Logger, opts ...Option) *Aggregator {
+	a := &Aggregator{
+		store:        store,
+		templates:    make(map[string]*template.Template),
+		pollInterval: defaultPollInterval,
+		maxItems:     defaultMaxItems,
+		full:         make(chan Key, 64),
+		logger:       logger.With().Str("component", "digest").Logger(),
+		now:          time.Now,
+	}
+	for _, opt := range opts {
+		opt(a)
+	}
+	return a
+}
+
+// Channels implements notify.Scoped
+func (a *Aggregator) Channels() []string {
+	return a.channels
+}
+
+// Hold implements notify.Holder. It takes notifications in categories the
+// user has a digest preference for, unless they would expire before the
+// digest is sent or are aimed at specific channels, e.g. by a replay.
+func (a *Aggregator) Hold(ctx context.Context, n *notify.Notification) (bool, error) {
+	if n.Type == TypeDigest || len(n.Channels) > 0 {
+		return false, nil
+	}
+	category := n.CategoryOrType()
+	pref, err := a.store.Preference(ctx, n.UserID, category)
+	if errors.Is(err, ErrNotFound) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	due := pref.due(n.CreatedAt)
+	if !n.ExpiresAt.IsZero() && n.ExpiresAt.Before(due) {
+		return false, nil
+	}
+	payload, err := json.Marshal(n.Payload)
+	if err != nil {
+		return false, err
+	}
+	added, waiting, err := a.store.Add(ctx, &Item{
+		NotificationID: n.ID,
+		UserID:         n.UserID,
+		Category:       category,
+		Type:           n.Type,
+		Payload:        payload,
+		CreatedAt:      n.CreatedAt.UTC(),
+		Due:            due.UTC(),
+	})
+	if err != nil {
+		return false, err
+	}
+	if added {
+		held.WithLabelValues(category).Inc()
+	}
+	if waiting >= a.maxItems {
+		select {
+		case a.full <- Key{UserID: n.UserID, Category: category}:
+		default:
+			// Run is busy; the digest goes out when due instead
+		}
+	}
+	return true, nil
+}
+
+// Pending returns the items waiting in the user's digests
+func (a *Aggregator) Pending(ctx context.Context, userID uuid.UUID) ([]*Item, error) {
+	return a.store.Pending(ctx, userID)
+}
+
+// Preferences returns the user's digest preferences
+func (a *Aggregator) Preferences(ctx context.Context, userID uuid.UUID) ([]*Preference, error) {
+	return a.store.Preferences(ctx, userID)
+}
+
+// SetPreference validates and stores a preference
+func (a *Aggregator) SetPreference(ctx context.Context, p *Preference) error {
+	if err := p.validate(); err != nil {
+		return err
+	}
+	p.UpdatedAt = a.now().UTC()
+	return a.store.SetPreference(ctx, p)
+}
+
+// DeletePreference stops taking the category as a digest; items already
+// waiting are still sent when due
+func (a *Aggregator) DeletePreference(ctx context.Context, userID uuid.UUID, category string) error {
+	return a.store.DeletePreference(ctx, userID, category)
+}
+
+// Run sends digests through dispatcher as they fall due or fill up, until
+// ctx is cancelled. Batches left over from a previous run are sent first.
+func (a *Aggregator) Run(ctx context.Context, dispatcher Dispatcher) {
+	a.dispatcher = dispatcher
+	ticker := time.NewTicker(a.pollInterval)
+	defer ticker.Stop()
+
+	a.resend(ctx)
+	for {
+		a.tick(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case key := <-a.full:
+			a.flush(ctx, key)
+		case <-ticker.C:
+			a.resend(ctx)
+		}
+	}
+}
+
+// tick sends the digests that are due
+func (a *Aggregator) tick(ctx context.Context) {
+	keys, err := a.store.Due(ctx, a.now(), dueBatch)
+	if err != nil {
+		a.logger.Error().Err(err).Msg("failed to load due digests")
+		return
+	}
+	for _, key := range keys {
+		if ctx.Err() != nil {
+			return
+		}
+		a.flush(ctx, key)
+	}
+}
+
+// resend retries sealed batches that were not sent
+func (a *Aggregator) resend(ctx context.Context) {
+	batches, err := a.store.Sealed(ctx)
+	if err != nil {
+		a.logger.Error().Err(err).Msg("failed to load unsent digests")
+		return
+	}
+	for _, batch := range batches {
+		if ctx.Err() != nil {
+			return
+		}
+		a.send(ctx, batch)
+	}
+}
+
+// flush seals the digest's waiting items into a new batch and sends it
+func (a *Aggregator) flush(ctx context.Context, key Key) {
+	batch := uuid.NewString()
+	n, err := a.store.Seal(ctx, key, batch)
+	if err != nil {
+		a.logger.Error().Err(err).Str("user_id", key.UserID.String()).Str("category", key.Category).Msg("failed to seal digest")
+		return
+	}
+	if n > 0 {
+		a.send(ctx, batch)
+	}
+}
+
+// send renders and dispatches a sealed batch, deleting it once sent. A
+// batch that fails stays sealed and is retried on the next poll.
+func (a *Aggregator) send(ctx context.Context, batch string) {
+	items, err := a.store.Batch(ctx, batch)
+	if err != nil || len(items) == 0 {
+		if err != nil {
+			a.logger.Error().Err(err).Str("batch", batch).Msg("failed to load digest")
+		}
+		return
+	}
+	first := items[0]
+	loc := time.UTC
+	if pref, err := a.store.Preference(ctx, first.UserID, first.Category); err == nil {
+		loc = pref.location()
+	}
+	t, ok := a.templates[first.Category]
+	if !ok {
+		t = defaultTemplate
+	}
+	rendered, view, err := render(t, first.Category, items, loc)
+	if err != nil {
+		// A broken template would fail forever, so fall back to the
+		// default rather than hold the digest back
+		a.logger.Error().Err(err).Str("category", first.Category).Msg("failed to render digest")
+		if rendered, view, err = render(defaultTemplate, first.Category, items, loc); err != nil {
+			return
+		}
+	}
+
+	summary := Summary{Category: first.Category, Rendered: rendered, Count: len(items), From: view.From, To: view.To}
+	for _, item := range items {
+		summary.Items = append(summary.Items, SummaryItem{ID: item.NotificationID, Type: item.Type, CreatedAt: item.CreatedAt, Payload: item.Payload})
+	}
+	err = a.dispatcher.Dispatch(ctx, &notify.Notification{
+		ID:             batch,
+		UserID:         first.UserID,
+		Type:           TypeDigest,
+		Category:       first.Category,
+		Payload:        summary,
+		Source:         "digest:" + batch,
+		Channels:       a.channels,
+		IdempotencyKey: "digest:" + batch,
+	})
+	switch {
+	case errors.Is(err, notify.ErrDuplicate):
+		// Sent before a restart interrupted the cleanup
+	case err != nil:
+		digests.WithLabelValues("failed").Inc()
+		a.logger.Warn().Err(err).Str("batch", batch).Str("user_id", first.UserID.String()).Msg("failed to send digest")
+		return
+	default:
+		digests.WithLabelValues("sent").Inc()
+	}
+	if err := a.store.DeleteBatch(ctx, batch); err != nil {
+		a.logger.Error().Err(err).Str("batch", batch).Msg("failed to delete sent digest")
+	}
+}
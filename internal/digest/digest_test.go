@@ -0,0 +1,229 @@
+package digest
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/cypherlabdev/notification-service/internal/dedup"
+	"github.com/cypherlabdev/notification-service/internal/notify"
+)
+
+// fakeChannel records notifications
+type fakeChannel struct {
+	sent []*notify.Notification
+	mu   sync.Mutex
+}
+
+func (c *fakeChannel) Name() string { return "fake" }
+
+func (c *fakeChannel) Send(_ context.Context, n *notify.Notification) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.sent = append(c.sent, n)
+	return nil
+}
+
+func (c *fakeChannel) all() []*notify.Notification {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return append([]*notify.Notification(nil), c.sent...)
+}
+
+// failingDelete fails DeleteBatch, as if the replica stopped right after
+// sending a digest
+type failingDelete struct {
+	Store
+}
+
+func (s failingDelete) DeleteBatch(context.Context, string) error {
+	return errors.New("connection reset")
+}
+
+// newTestAggregator creates an aggregator and a dispatcher holding
+// notifications with it; dedup stands in for the shared dedup store
+func newTestAggregator(store Store, dedupStore dedup.Store, opts ...Option) (*Aggregator, *notify.Dispatcher, *fakeChannel) {
+	ch := &fakeChannel{}
+	a := New(store, zerolog.Nop(), opts...)
+	d := notify.NewDispatcher(zerolog.Nop(),
+		notify.WithChannels(ch),
+		notify.WithHolders(a),
+		notify.WithDedup(dedupStore, time.Hour),
+	)
+	a.dispatcher = d
+	return a, d, ch
+}
+
+func settled(userID uuid.UUID, stake int) *notify.Notification {
+	return &notify.Notification{
+		UserID:   userID,
+		Type:     "bet_settled",
+		Category: "bets",
+		Payload:  map[string]interface{}{"message": "Bet won", "stake": stake},
+	}
+}
+
+// TestAggregator_Digest tests that held notifications are sent as one
+// digest once due
+func TestAggregator_Digest(t *testing.T) {
+	ctx := context.Background()
+	a, d, ch := newTestAggregator(NewMemoryStore(), dedup.NewMemoryStore(0))
+	userID := uuid.New()
+	require.NoError(t, a.SetPreference(ctx, &Preference{UserID: userID, Category: "bets", Frequency: FrequencyDaily, Hour: 8, Timezone: "Europe/London"}))
+
+	for stake := 1; stake <= 3; stake++ {
+		require.NoError(t, d.Dispatch(ctx, settled(userID, stake)))
+	}
+	require.NoError(t, d.Dispatch(ctx, &notify.Notification{UserID: userID, Type: "deposit_received"}))
+	require.Len(t, ch.all(), 1, "other categories are sent at once")
+
+	pending, err := a.Pending(ctx, userID)
+	require.NoError(t, err)
+	require.Len(t, pending, 3)
+
+	a.tick(ctx)
+	assert.Len(t, ch.all(), 1, "not due yet")
+
+	a.now = func() time.Time { return pending[0].Due }
+	a.tick(ctx)
+	sent := ch.all()
+	require.Len(t, sent, 2)
+	digest := sent[1]
+	assert.Equal(t, TypeDigest, digest.Type)
+	assert.Equal(t, "bets", digest.Category)
+	assert.Equal(t, userID, digest.UserID)
+	summary := digest.Payload.(Summary)
+	assert.Equal(t, 3, summary.Count)
+	assert.Equal(t, "Your bets summary: 3 updates", summary.Subject)
+	require.Len(t, summary.Items, 3)
+	assert.Equal(t, pending[0].NotificationID, summary.Items[0].ID)
+
+	pending, err = a.Pending(ctx, userID)
+	require.NoError(t, err)
+	assert.Empty(t, pending)
+}
+
+// TestAggregator_Hold tests which notifications are not held
+func TestAggregator_Hold(t *testing.T) {
+	ctx := context.Background()
+	a, _, _ := newTestAggregator(NewMemoryStore(), dedup.NewMemoryStore(0))
+	userID := uuid.New()
+	require.NoError(t, a.SetPreference(ctx, &Preference{UserID: userID, Category: "bets", Frequency: FrequencyHourly}))
+
+	hold := func(n *notify.Notification) bool {
+		n.ID = uuid.NewString()
+		n.CreatedAt = time.Now()
+		held, err := a.Hold(ctx, n)
+		require.NoError(t, err)
+		return held
+	}
+	assert.True(t, hold(settled(userID, 1)))
+	assert.True(t, hold(&notify.Notification{UserID: userID, Type: "bets"}), "the type stands in for a missing category")
+	assert.False(t, hold(settled(uuid.New(), 1)), "no preference")
+
+	expiring := settled(userID, 1)
+	expiring.ExpiresAt = time.Now().Truncate(time.Hour).Add(time.Hour - time.Millisecond)
+	assert.False(t, hold(expiring), "expires before the digest")
+	replay := settled(userID, 1)
+	replay.Channels = []string{"fake"}
+	assert.False(t, hold(replay))
+	assert.False(t, hold(&notify.Notification{UserID: userID, Type: TypeDigest, Category: "bets"}))
+}
+
+// namedChannel is a fakeChannel under another name
+type namedChannel struct {
+	fakeChannel
+	name string
+}
+
+func (c *namedChannel) Name() string { return c.name }
+
+// TestAggregator_Channels tests that an aggregator limited to some
+// channels holds only their share of a notification and sends its digests
+// over them alone
+func TestAggregator_Channels(t *testing.T) {
+	ctx := context.Background()
+	ch, webhook := &fakeChannel{}, &namedChannel{name: "webhook"}
+	a := New(NewMemoryStore(), zerolog.Nop(), WithChannels("fake"))
+	a.dispatcher = notify.NewDispatcher(zerolog.Nop(), notify.WithChannels(ch, webhook), notify.WithHolders(a))
+	userID := uuid.New()
+	require.NoError(t, a.SetPreference(ctx, &Preference{UserID: userID, Category: "bets", Frequency: FrequencyHourly}))
+
+	require.NoError(t, a.dispatcher.Dispatch(ctx, settled(userID, 1)))
+	assert.Empty(t, ch.all())
+	require.Len(t, webhook.all(), 1, "the webhook is sent every notification at once")
+
+	pending, err := a.Pending(ctx, userID)
+	require.NoError(t, err)
+	require.Len(t, pending, 1)
+	a.now = func() time.Time { return pending[0].Due }
+	a.tick(ctx)
+	require.Len(t, ch.all(), 1)
+	assert.Equal(t, TypeDigest, ch.all()[0].Type)
+	assert.Len(t, webhook.all(), 1, "the webhook gets no digest")
+}
+
+// TestAggregator_MaxItems tests that a full digest is sent before it is due
+func TestAggregator_MaxItems(t *testing.T) {
+	ctx := context.Background()
+	a, d, ch := newTestAggregator(NewMemoryStore(), dedup.NewMemoryStore(0), WithMaxItems(2), WithPollInterval(time.Hour))
+	userID := uuid.New()
+	require.NoError(t, a.SetPreference(ctx, &Preference{UserID: userID, Category: "bets", Frequency: FrequencyDaily}))
+	go a.Run(t.Context(), d)
+
+	require.NoError(t, d.Dispatch(ctx, settled(userID, 1)))
+	require.NoError(t, d.Dispatch(ctx, settled(userID, 2)))
+	require.Eventually(t, func() bool { return len(ch.all()) == 1 }, time.Second, 5*time.Millisecond)
+	assert.Equal(t, 2, ch.all()[0].Payload.(Summary).Count)
+}
+
+// TestAggregator_Restart tests that a digest interrupted by a restart is
+// sent once: batches sealed but not sent are sent on start, and batches
+// sent but not deleted are suppressed as duplicates
+func TestAggregator_Restart(t *testing.T) {
+	testRestart(t, NewMemoryStore())
+}
+
+func testRestart(t *testing.T, store Store) {
+	ctx := context.Background()
+	dedupStore := dedup.NewMemoryStore(0)
+	userID := uuid.New()
+
+	first, d, ch := newTestAggregator(failingDelete{store}, dedupStore)
+	require.NoError(t, first.SetPreference(ctx, &Preference{UserID: userID, Category: "bets", Frequency: FrequencyHourly}))
+	require.NoError(t, d.Dispatch(ctx, settled(userID, 1)))
+	first.now = func() time.Time { return time.Now().Add(time.Hour) }
+	first.tick(ctx)
+	require.Len(t, ch.all(), 1)
+
+	// Stopped after sealing a second digest
+	require.NoError(t, d.Dispatch(ctx, settled(userID, 2)))
+	_, err := store.Seal(ctx, Key{UserID: userID, Category: "bets"}, "interrupted")
+	require.NoError(t, err)
+
+	second, d, ch := newTestAggregator(store, dedupStore)
+	runCtx, stop := context.WithCancel(ctx)
+	done := make(chan struct{})
+	go func() {
+		second.Run(runCtx, d)
+		close(done)
+	}()
+	require.Eventually(t, func() bool {
+		batches, _ := store.Sealed(ctx)
+		return len(batches) == 0
+	}, time.Second, 5*time.Millisecond)
+	stop()
+	<-done
+
+	sent := ch.all()
+	require.Len(t, sent, 1, "the digest sent before the restart is not sent again")
+	assert.Equal(t, "interrupted", sent[0].ID)
+	assert.Equal(t, 1, sent[0].Payload.(Summary).Count, "each item is sent in one digest")
+}
@@ -0,0 +1,136 @@
+package digest
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/google/uuid"
+	"github.com/rs/zerolog"
+)
+
+// preferenceRequest is the body of PUT /digests/{userID}/{category}
+type preferenceRequest struct {
+	Frequency Frequency `json:"frequency"`
+	Hour      int       `json:"hour"`
+	Timezone  string    `json:"timezone,omitempty"`
+}
+
+// digestsResponse lists a user's digest preferences and the items waiting
+// in their digests
+type digestsResponse struct {
+	UserID      uuid.UUID     `json:"user_id"`
+	Preferences []*Preference `json:"preferences"`
+	Pending     []*Item       `json:"pending"`
+}
+
+// Handler serves the digest preference API:
+//
+//	GET    /digests/{userID}              preferences and waiting items
+//	PUT    /digests/{userID}/{category}   {"frequency": "daily", "hour": 8, "timezone": "Europe/London"}
+//	DELETE /digests/{userID}/{category}
+type Handler struct {
+	aggregator *Aggregator
+	logger     zerolog.Logger
+	mux        *http.ServeMux
+}
+
+// NewHandler creates the digest preference API
+func NewHandler(aggregator *Aggregator, logger zerolog.Logger) *Handler {
+	h := &Handler{
+		aggregator: aggregator,
+		logger:     logger.With().Str("component", "digest_api").Logger(),
+		mux:        http.NewServeMux(),
+	}
+	h.mux.HandleFunc("GET /digests/{userID}", h.list)
+	h.mux.HandleFunc("PUT /digests/{userID}/{category}", h.set)
+	h.mux.HandleFunc("DELETE /digests/{userID}/{category}", h.remove)
+	return h
+}
+
+// ServeHTTP implements http.Handler
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	h.mux.ServeHTTP(w, r)
+}
+
+func (h *Handler) list(w http.ResponseWriter, r *http.Request) {
+	userID, ok := pathUser(w, r)
+	if !ok {
+		return
+	}
+	prefs, err := h.aggregator.Preferences(r.Context(), userID)
+	if err != nil {
+		h.storeError(w, err, "failed to list digest preferences")
+		return
+	}
+	pending, err := h.aggregator.Pending(r.Context(), userID)
+	if err != nil {
+		h.storeError(w, err, "failed to list pending digest items")
+		return
+	}
+	resp := digestsResponse{UserID: userID, Preferences: prefs, Pending: pending}
+	if resp.Preferences == nil {
+		resp.Preferences = []*Preference{}
+	}
+	if resp.Pending == nil {
+		resp.Pending = []*Item{}
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
+
+func (h *Handler) set(w http.ResponseWriter, r *http.Request) {
+	userID, ok := pathUser(w, r)
+	if !ok {
+		return
+	}
+	var req preferenceRequest
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 4<<10)).Decode(&req); err != nil {
+		http.Error(w, "invalid body: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	p := &Preference{UserID: userID, Category: r.PathValue("category"), Frequency: req.Frequency, Hour: req.Hour, Timezone: req.Timezone}
+	if err := h.aggregator.SetPreference(r.Context(), p); err != nil {
+		h.storeError(w, err, "failed to store digest preference")
+		return
+	}
+	writeJSON(w, http.StatusOK, p)
+}
+
+func (h *Handler) remove(w http.ResponseWriter, r *http.Request) {
+	userID, ok := pathUser(w, r)
+	if !ok {
+		return
+	}
+	if err := h.aggregator.DeletePreference(r.Context(), userID, r.PathValue("category")); err != nil {
+		h.storeError(w, err, "failed to delete digest preference")
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *Handler) storeError(w http.ResponseWriter, err error, msg string) {
+	switch {
+	case errors.Is(err, ErrNotFound):
+		http.Error(w, err.Error(), http.StatusNotFound)
+	case errors.Is(err, ErrInvalid):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	default:
+		h.logger.Error().Err(err).Msg(msg)
+		http.Error(w, "internal error", http.StatusInternalServerError)
+	}
+}
+
+func pathUser(w http.ResponseWriter, r *http.Request) (uuid.UUID, bool) {
+	userID, err := uuid.Parse(r.PathValue("userID"))
+	if err != nil {
+		http.Error(w, "invalid user id", http.StatusBadRequest)
+		return uuid.Nil, false
+	}
+	return userID, true
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
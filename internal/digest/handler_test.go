@@ -0,0 +1,51 @@
+package digest
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/cypherlabdev/notification-service/internal/dedup"
+)
+
+func do(h http.Handler, method, path, body string) *httptest.ResponseRecorder {
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(method, path, strings.NewReader(body)))
+	return rec
+}
+
+// TestHandler tests managing preferences and listing waiting items
+func TestHandler(t *testing.T) {
+	a, d, _ := newTestAggregator(NewMemoryStore(), dedup.NewMemoryStore(0))
+	h := NewHandler(a, zerolog.Nop())
+	userID := uuid.New()
+	path := "/digests/" + userID.String()
+
+	rec := do(h, http.MethodPut, path+"/bets", `{"frequency":"daily","hour":8,"timezone":"Europe/London"}`)
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	require.NoError(t, d.Dispatch(context.Background(), settled(userID, 5)))
+
+	rec = do(h, http.MethodGet, path, "")
+	require.Equal(t, http.StatusOK, rec.Code)
+	var resp digestsResponse
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &resp))
+	require.Len(t, resp.Preferences, 1)
+	assert.Equal(t, FrequencyDaily, resp.Preferences[0].Frequency)
+	require.Len(t, resp.Pending, 1)
+	assert.Equal(t, "bets", resp.Pending[0].Category)
+
+	assert.Equal(t, http.StatusBadRequest, do(h, http.MethodPut, path+"/bets", `{"frequency":"weekly"}`).Code)
+	assert.Equal(t, http.StatusBadRequest, do(h, http.MethodPut, path+"/bets", `{"frequency":"daily","timezone":"Nowhere"}`).Code)
+	assert.Equal(t, http.StatusBadRequest, do(h, http.MethodGet, "/digests/nope", "").Code)
+
+	assert.Equal(t, http.StatusNoContent, do(h, http.MethodDelete, path+"/bets", "").Code)
+	assert.Equal(t, http.StatusNotFound, do(h, http.MethodDelete, path+"/bets", "").Code)
+}
@@ -0,0 +1,22 @@
+package digest
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var (
+	held = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "notification",
+		Subsystem: "digest",
+		Name:      "items_held_total",
+		Help:      "Notifications held for a digest instead of being sent at once, by category.",
+	}, []string{"category"})
+
+	digests = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "notification",
+		Subsystem: "digest",
+		Name:      "sends_total",
+		Help:      "Digests dispatched, by whether they were sent or will be retried.",
+	}, []string{"result"})
+)
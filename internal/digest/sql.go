@@ -0,0 +1,252 @@
+package digest
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// SQLStore is a durable Store in the digest_items and digest_preferences
+// tables. Its statements use SQLite syntax; open the *sql.DB with
+// sqlite.Open. Times are kept as Unix milliseconds.
+type SQLStore struct {
+	db *sql.DB
+}
+
+// NewSQLStore creates a store over db; call Migrate to create its tables
+func NewSQLStore(db *sql.DB) *SQLStore {
+	return &SQLStore{db: db}
+}
+
+// Migrate creates the digest tables if they do not exist
+func (s *SQLStore) Migrate(ctx context.Context) error {
+	for _, stmt := range []string{
+		`CREATE TABLE IF NOT EXISTS digest_items (
+			user_id         TEXT NOT NULL,
+			notification_id TEXT NOT NULL,
+			category        TEXT NOT NULL,
+			type            TEXT NOT NULL,
+			payload         BLOB,
+			created_at      INTEGER NOT NULL,
+			due             INTEGER NOT NULL,
+			batch           TEXT NOT NULL DEFAULT '',
+			PRIMARY KEY (user_id, notification_id)
+		)`,
+		`CREATE INDEX IF NOT EXISTS digest_items_waiting ON digest_items (batch, due)`,
+		`CREATE INDEX IF NOT EXISTS digest_items_digest ON digest_items (user_id, category, batch)`,
+		`CREATE TABLE IF NOT EXISTS digest_preferences (
+			user_id    TEXT NOT NULL,
+			category   TEXT NOT NULL,
+			frequency  TEXT NOT NULL,
+			hour       INTEGER NOT NULL DEFAULT 0,
+			timezone   TEXT NOT NULL DEFAULT '',
+			updated_at INTEGER NOT NULL,
+			PRIMARY KEY (user_id, category)
+		)`,
+	} {
+		if _, err := s.db.ExecContext(ctx, stmt); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+const itemColumns = `user_id, notification_id, category, type, payload, created_at, due, batch`
+
+// Add implements Store
+func (s *SQLStore) Add(ctx context.Context, item *Item) (bool, int, error) {
+	res, err := s.db.ExecContext(ctx,
+		`INSERT INTO digest_items (`+itemColumns+`) VALUES (?, ?, ?, ?, ?, ?, ?, '')
+		 ON CONFLICT (user_id, notification_id) DO NOTHING`,
+		item.UserID.String(), item.NotificationID, item.Category, item.Type, []byte(item.Payload),
+		item.CreatedAt.UnixMilli(), item.Due.UnixMilli())
+	if err != nil {
+		return false, 0, err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return false, 0, err
+	}
+	var waiting int
+	err = s.db.QueryRowContext(ctx,
+		`SELECT COUNT(*) FROM digest_items WHERE user_id = ? AND category = ? AND batch = ''`,
+		item.UserID.String(), item.Category).Scan(&waiting)
+	return n > 0, waiting, err
+}
+
+// Due implements Store
+func (s *SQLStore) Due(ctx context.Context, now time.Time, limit int) ([]Key, error) {
+	rows, err := s.db.QueryContext(ctx,
+		`SELECT user_id, category FROM digest_items WHERE batch = '' AND due <= ?
+		 GROUP BY user_id, category ORDER BY MIN(due) LIMIT ?`, now.UnixMilli(), limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var keys []Key
+	for rows.Next() {
+		var userID string
+		var key Key
+		if err := rows.Scan(&userID, &key.Category); err != nil {
+			return nil, err
+		}
+		if key.UserID, err = uuid.Parse(userID); err != nil {
+			return nil, err
+		}
+		keys = append(keys, key)
+	}
+	return keys, rows.Err()
+}
+
+// Seal implements Store
+func (s *SQLStore) Seal(ctx context.Context, key Key, batch string) (int, error) {
+	res, err := s.db.ExecContext(ctx,
+		`UPDATE digest_items SET batch = ? WHERE user_id = ? AND category = ? AND batch = ''`,
+		batch, key.UserID.String(), key.Category)
+	if err != nil {
+		return 0, err
+	}
+	n, err := res.RowsAffected()
+	return int(n), err
+}
+
+// Sealed implements Store
+func (s *SQLStore) Sealed(ctx context.Context) ([]string, error) {
+	rows, err := s.db.QueryContext(ctx, `SELECT DISTINCT batch FROM digest_items WHERE batch != ''`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var batches []string
+	for rows.Next() {
+		var batch string
+		if err := rows.Scan(&batch); err != nil {
+			return nil, err
+		}
+		batches = append(batches, batch)
+	}
+	return batches, rows.Err()
+}
+
+// Batch implements Store
+func (s *SQLStore) Batch(ctx context.Context, batch string) ([]*Item, error) {
+	return s.items(ctx, `SELECT `+itemColumns+` FROM digest_items WHERE batch = ? ORDER BY created_at, rowid`, batch)
+}
+
+// DeleteBatch implements Store
+func (s *SQLStore) DeleteBatch(ctx context.Context, batch string) error {
+	_, err := s.db.ExecContext(ctx, `DELETE FROM digest_items WHERE batch = ?`, batch)
+	return err
+}
+
+// Pending implements Store
+func (s *SQLStore) Pending(ctx context.Context, userID uuid.UUID) ([]*Item, error) {
+	return s.items(ctx, `SELECT `+itemColumns+` FROM digest_items WHERE user_id = ? ORDER BY created_at, rowid`, userID.String())
+}
+
+func (s *SQLStore) items(ctx context.Context, query string, args ...interface{}) ([]*Item, error) {
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var items []*Item
+	for rows.Next() {
+		var (
+			item           Item
+			userID         string
+			payload        []byte
+			createdAt, due int64
+		)
+		if err := rows.Scan(&userID, &item.NotificationID, &item.Category, &item.Type, &payload, &createdAt, &due, &item.Batch); err != nil {
+			return nil, err
+		}
+		if item.UserID, err = uuid.Parse(userID); err != nil {
+			return nil, err
+		}
+		if len(payload) > 0 {
+			item.Payload = payload
+		}
+		item.CreatedAt = time.UnixMilli(createdAt).UTC()
+		item.Due = time.UnixMilli(due).UTC()
+		items = append(items, &item)
+	}
+	return items, rows.Err()
+}
+
+const preferenceColumns = `user_id, category, frequency, hour, timezone, updated_at`
+
+// Preference implements Store
+func (s *SQLStore) Preference(ctx context.Context, userID uuid.UUID, category string) (*Preference, error) {
+	prefs, err := s.preferences(ctx, `SELECT `+preferenceColumns+` FROM digest_preferences WHERE user_id = ? AND category = ?`, userID.String(), category)
+	if err != nil {
+		return nil, err
+	}
+	if len(prefs) == 0 {
+		return nil, ErrNotFound
+	}
+	return prefs[0], nil
+}
+
+// Preferences implements Store
+func (s *SQLStore) Preferences(ctx context.Context, userID uuid.UUID) ([]*Preference, error) {
+	return s.preferences(ctx, `SELECT `+preferenceColumns+` FROM digest_preferences WHERE user_id = ? ORDER BY category`, userID.String())
+}
+
+// SetPreference implements Store
+func (s *SQLStore) SetPreference(ctx context.Context, p *Preference) error {
+	_, err := s.db.ExecContext(ctx,
+		`INSERT INTO digest_preferences (`+preferenceColumns+`) VALUES (?, ?, ?, ?, ?, ?)
+		 ON CONFLICT (user_id, category) DO UPDATE SET
+			frequency = excluded.frequency, hour = excluded.hour,
+			timezone = excluded.timezone, updated_at = excluded.updated_at`,
+		p.UserID.String(), p.Category, string(p.Frequency), p.Hour, p.Timezone, p.UpdatedAt.UnixMilli())
+	return err
+}
+
+// DeletePreference implements Store
+func (s *SQLStore) DeletePreference(ctx context.Context, userID uuid.UUID, category string) error {
+	res, err := s.db.ExecContext(ctx, `DELETE FROM digest_preferences WHERE user_id = ? AND category = ?`, userID.String(), category)
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (s *SQLStore) preferences(ctx context.Context, query string, args ...interface{}) ([]*Preference, error) {
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var prefs []*Preference
+	for rows.Next() {
+		var (
+			p                 Preference
+			userID, frequency string
+			updatedAt         int64
+		)
+		if err := rows.Scan(&userID, &p.Category, &frequency, &p.Hour, &p.Timezone, &updatedAt); err != nil {
+			return nil, err
+		}
+		if p.UserID, err = uuid.Parse(userID); err != nil {
+			return nil, err
+		}
+		p.Frequency = Frequency(frequency)
+		p.UpdatedAt = time.UnixMilli(updatedAt).UTC()
+		prefs = append(prefs, &p)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return prefs, nil
+}
@@ -0,0 +1,80 @@
+package digest
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/cypherlabdev/notification-service/internal/dedup"
+	"github.com/cypherlabdev/notification-service/internal/sqlite"
+)
+
+// openTestSQLStore opens a store over the database at path; the database
+// is closed when the test ends or closeDB is called
+func openTestSQLStore(t *testing.T, path string) (store *SQLStore, closeDB func()) {
+	db, err := sqlite.Open(context.Background(), path)
+	require.NoError(t, err)
+	t.Cleanup(func() { db.Close() })
+	store = NewSQLStore(db)
+	require.NoError(t, store.Migrate(context.Background()))
+	return store, func() { db.Close() }
+}
+
+func newTestSQLStore(t *testing.T) *SQLStore {
+	store, _ := openTestSQLStore(t, filepath.Join(t.TempDir(), "digest.db"))
+	return store
+}
+
+// TestSQLStore_Batches tests adding, sealing and deleting items
+func TestSQLStore_Batches(t *testing.T) {
+	testBatches(t, newTestSQLStore(t))
+}
+
+// TestSQLStore_Preferences tests storing and removing preferences
+func TestSQLStore_Preferences(t *testing.T) {
+	testPreferences(t, newTestSQLStore(t))
+}
+
+// TestSQLStore_Restart tests that a digest interrupted by a restart is
+// sent once with the SQL store
+func TestSQLStore_Restart(t *testing.T) {
+	testRestart(t, newTestSQLStore(t))
+}
+
+// TestSQLStore_Reopen tests that held items and preferences survive the
+// process restarting and go out in the next digest
+func TestSQLStore_Reopen(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "digest.db")
+	dedupStore := dedup.NewMemoryStore(0)
+	userID := uuid.New()
+
+	store, closeDB := openTestSQLStore(t, path)
+	before, d, ch := newTestAggregator(store, dedupStore)
+	require.NoError(t, before.SetPreference(ctx, &Preference{UserID: userID, Category: "bets", Frequency: FrequencyHourly}))
+	require.NoError(t, d.Dispatch(ctx, settled(userID, 1)))
+	require.NoError(t, d.Dispatch(ctx, settled(userID, 2)))
+	require.Empty(t, ch.all())
+	closeDB()
+
+	store, _ = openTestSQLStore(t, path)
+	after, _, ch := newTestAggregator(store, dedupStore)
+	pending, err := after.Pending(ctx, userID)
+	require.NoError(t, err)
+	require.Len(t, pending, 2)
+	after.now = func() time.Time { return pending[0].Due }
+	after.tick(ctx)
+
+	sent := ch.all()
+	require.Len(t, sent, 1)
+	assert.Equal(t, 2, sent[0].Payload.(Summary).Count)
+	assert.Equal(t, pending[0].NotificationID, sent[0].Payload.(Summary).Items[0].ID)
+	pending, err = after.Pending(ctx, userID)
+	require.NoError(t, err)
+	assert.Empty(t, pending)
+}
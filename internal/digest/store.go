@@ -0,0 +1,305 @@
+package digest
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+var (
+	// ErrNotFound is returned for a user without a digest preference for
+	// the category
+	ErrNotFound = errors.New("digest preference not found")
+	// ErrInvalid is returned for a preference that cannot be stored
+	ErrInvalid = errors.New("invalid digest preference")
+)
+
+// Frequency is how often a digest is sent
+type Frequency string
+
+const (
+	// FrequencyHourly sends at the top of each hour in the user's timezone
+	FrequencyHourly Frequency = "hourly"
+	// FrequencyDaily sends once a day at Hour in the user's timezone
+	FrequencyDaily Frequency = "daily"
+)
+
+// Preference opts a user into digests for one category of notifications
+type Preference struct {
+	UserID    uuid.UUID `json:"user_id"`
+	Category  string    `json:"category"`
+	Frequency Frequency `json:"frequency"`
+	// Hour is the local hour daily digests are sent at, 0-23
+	Hour int `json:"hour"`
+	// Timezone is the IANA name of the user's timezone; UTC if empty
+	Timezone  string    `json:"timezone,omitempty"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+func (p *Preference) validate() error {
+	if p.UserID == uuid.Nil || p.Category == "" {
+		return fmt.Errorf("%w: user_id and category are required", ErrInvalid)
+	}
+	if p.Frequency != FrequencyHourly && p.Frequency != FrequencyDaily {
+		return fmt.Errorf("%w: frequency must be hourly or daily", ErrInvalid)
+	}
+	if p.Hour < 0 || p.Hour > 23 {
+		return fmt.Errorf("%w: hour must be between 0 and 23", ErrInvalid)
+	}
+	if _, err := time.LoadLocation(p.Timezone); err != nil {
+		return fmt.Errorf("%w: unknown timezone %q", ErrInvalid, p.Timezone)
+	}
+	return nil
+}
+
+// location returns the user's timezone, UTC if unset or unknown
+func (p *Preference) location() *time.Location {
+	if loc, err := time.LoadLocation(p.Timezone); err == nil {
+		return loc
+	}
+	return time.UTC
+}
+
+// due returns when the digest holding an item received at t is sent. Times
+// are computed on the local calendar, so a daily digest keeps its local
+// hour across DST changes; an hour skipped by a spring-forward shift
+// resolves to the first local time after it.
+func (p *Preference) due(t time.Time) time.Time {
+	lt := t.In(p.location())
+	y, m, d := lt.Date()
+	if p.Frequency == FrequencyHourly {
+		return localTime(y, m, d, lt.Hour()+1, lt.Location())
+	}
+	next := localTime(y, m, d, p.Hour, lt.Location())
+	if !next.After(lt) {
+		next = localTime(y, m, d+1, p.Hour, lt.Location())
+	}
+	return next
+}
+
+// localTime returns the start of the given local hour. time.Date places an
+// hour skipped by a DST gap before the gap, which would be early, so such
+// an hour is moved forward by the size of the gap.
+func localTime(y int, m time.Month, d, hour int, loc *time.Location) time.Time {
+	t := time.Date(y, m, d, hour, 0, 0, 0, loc)
+	if want := time.Date(y, m, d, hour, 0, 0, 0, time.UTC); t.Hour() != want.Hour() {
+		_, before := t.Zone()
+		_, after := t.Add(3 * time.Hour).Zone()
+		t = t.Add(time.Duration(after-before) * time.Second)
+	}
+	return t
+}
+
+// Item is a notification waiting to be sent in a digest
+type Item struct {
+	NotificationID string          `json:"notification_id"`
+	UserID         uuid.UUID       `json:"user_id"`
+	Category       string          `json:"category"`
+	Type           string          `json:"type"`
+	Payload        json.RawMessage `json:"payload,omitempty"`
+	CreatedAt      time.Time       `json:"created_at"`
+	// Due is when the digest the item joined is sent
+	Due time.Time `json:"due"`
+	// Batch is set once the item is sealed into a digest being sent
+	Batch string `json:"batch,omitempty"`
+}
+
+// Key identifies the digest of one user and category
+type Key struct {
+	UserID   uuid.UUID
+	Category string
+}
+
+// Store persists digest preferences and the items waiting for each digest.
+// Sealing a digest's items into a batch is atomic, so every item is sent
+// in exactly one digest however many processes flush the same store.
+type Store interface {
+	// Add stores a waiting item unless the user already has one for the
+	// notification, and returns how many items the digest now holds
+	Add(ctx context.Context, item *Item) (added bool, waiting int, err error)
+	// Due returns up to limit digests with a waiting item due by now
+	Due(ctx context.Context, now time.Time, limit int) ([]Key, error)
+	// Seal moves the digest's waiting items into batch and returns how
+	// many it moved
+	Seal(ctx context.Context, key Key, batch string) (int, error)
+	// Sealed returns the batches sealed but not yet deleted, e.g. because
+	// the replica sending them stopped
+	Sealed(ctx context.Context) ([]string, error)
+	// Batch returns a batch's items, oldest first
+	Batch(ctx context.Context, batch string) ([]*Item, error)
+	// DeleteBatch removes a sent batch
+	DeleteBatch(ctx context.Context, batch string) error
+	// Pending returns the user's waiting and sealed items, oldest first
+	Pending(ctx context.Context, userID uuid.UUID) ([]*Item, error)
+
+	Preference(ctx context.Context, userID uuid.UUID, category string) (*Preference, error)
+	Preferences(ctx context.Context, userID uuid.UUID) ([]*Preference, error)
+	SetPreference(ctx context.Context, p *Preference) error
+	// DeletePreference removes a preference, or returns ErrNotFound;
+	// items already waiting are still sent when due
+	DeletePreference(ctx context.Context, userID uuid.UUID, category string) error
+}
+
+// MemoryStore is a non-durable Store for tests and single-instance setups
+type MemoryStore struct {
+	items []*Item // in arrival order
+	prefs map[Key]*Preference
+	mu    sync.Mutex
+}
+
+// NewMemoryStore creates an empty in-memory store
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{prefs: make(map[Key]*Preference)}
+}
+
+// Add implements Store
+func (s *MemoryStore) Add(_ context.Context, item *Item) (bool, int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	added := !slices.ContainsFunc(s.items, func(i *Item) bool {
+		return i.UserID == item.UserID && i.NotificationID == item.NotificationID
+	})
+	if added {
+		copied := *item
+		s.items = append(s.items, &copied)
+	}
+	waiting := 0
+	for _, i := range s.items {
+		if i.UserID == item.UserID && i.Category == item.Category && i.Batch == "" {
+			waiting++
+		}
+	}
+	return added, waiting, nil
+}
+
+// Due implements Store
+func (s *MemoryStore) Due(_ context.Context, now time.Time, limit int) ([]Key, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var keys []Key
+	for _, i := range s.items {
+		key := Key{UserID: i.UserID, Category: i.Category}
+		if i.Batch == "" && !i.Due.After(now) && !slices.Contains(keys, key) {
+			keys = append(keys, key)
+			if len(keys) == limit {
+				break
+			}
+		}
+	}
+	return keys, nil
+}
+
+// Seal implements Store
+func (s *MemoryStore) Seal(_ context.Context, key Key, batch string) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	n := 0
+	for _, i := range s.items {
+		if i.UserID == key.UserID && i.Category == key.Category && i.Batch == "" {
+			i.Batch = batch
+			n++
+		}
+	}
+	return n, nil
+}
+
+// Sealed implements Store
+func (s *MemoryStore) Sealed(_ context.Context) ([]string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var batches []string
+	for _, i := range s.items {
+		if i.Batch != "" && !slices.Contains(batches, i.Batch) {
+			batches = append(batches, i.Batch)
+		}
+	}
+	return batches, nil
+}
+
+// Batch implements Store
+func (s *MemoryStore) Batch(_ context.Context, batch string) ([]*Item, error) {
+	return s.collect(func(i *Item) bool { return i.Batch == batch }), nil
+}
+
+// DeleteBatch implements Store
+func (s *MemoryStore) DeleteBatch(_ context.Context, batch string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.items = slices.DeleteFunc(s.items, func(i *Item) bool { return i.Batch == batch })
+	return nil
+}
+
+// Pending implements Store
+func (s *MemoryStore) Pending(_ context.Context, userID uuid.UUID) ([]*Item, error) {
+	return s.collect(func(i *Item) bool { return i.UserID == userID }), nil
+}
+
+// collect copies the items matching keep, oldest first
+func (s *MemoryStore) collect(keep func(*Item) bool) []*Item {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var out []*Item
+	for _, i := range s.items {
+		if keep(i) {
+			copied := *i
+			out = append(out, &copied)
+		}
+	}
+	slices.SortStableFunc(out, func(a, b *Item) int { return a.CreatedAt.Compare(b.CreatedAt) })
+	return out
+}
+
+// Preference implements Store
+func (s *MemoryStore) Preference(_ context.Context, userID uuid.UUID, category string) (*Preference, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	p, ok := s.prefs[Key{UserID: userID, Category: category}]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	copied := *p
+	return &copied, nil
+}
+
+// Preferences implements Store
+func (s *MemoryStore) Preferences(_ context.Context, userID uuid.UUID) ([]*Preference, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var out []*Preference
+	for key, p := range s.prefs {
+		if key.UserID == userID {
+			copied := *p
+			out = append(out, &copied)
+		}
+	}
+	slices.SortFunc(out, func(a, b *Preference) int { return strings.Compare(a.Category, b.Category) })
+	return out, nil
+}
+
+// SetPreference implements Store
+func (s *MemoryStore) SetPreference(_ context.Context, p *Preference) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	copied := *p
+	s.prefs[Key{UserID: p.UserID, Category: p.Category}] = &copied
+	return nil
+}
+
+// DeletePreference implements Store
+func (s *MemoryStore) DeletePreference(_ context.Context, userID uuid.UUID, category string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	key := Key{UserID: userID, Category: category}
+	if _, ok := s.prefs[key]; !ok {
+		return ErrNotFound
+	}
+	delete(s.prefs, key)
+	return nil
+}
@@ -0,0 +1,134 @@
+package digest
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestPreference_Due tests digest times in the user's timezone, including
+// across DST changes
+func TestPreference_Due(t *testing.T) {
+	utc := func(s string) time.Time {
+		ts, err := time.Parse(time.RFC3339, s)
+		require.NoError(t, err)
+		return ts
+	}
+	daily := &Preference{Frequency: FrequencyDaily, Hour: 8, Timezone: "America/New_York"}
+	hourly := &Preference{Frequency: FrequencyHourly, Timezone: "America/New_York"}
+
+	tests := []struct {
+		name string
+		pref *Preference
+		at   string
+		due  string
+	}{
+		{"later today", daily, "2026-06-10T10:00:00Z", "2026-06-10T12:00:00Z"},
+		{"tomorrow", daily, "2026-06-10T12:00:00Z", "2026-06-11T12:00:00Z"},
+		{"into DST", daily, "2026-03-08T01:00:00Z", "2026-03-08T12:00:00Z"},
+		{"out of DST", daily, "2026-10-31T13:00:00Z", "2026-11-01T13:00:00Z"},
+		{"skipped hour", &Preference{Frequency: FrequencyDaily, Hour: 2, Timezone: "America/New_York"}, "2026-03-08T05:00:00Z", "2026-03-08T07:00:00Z"},
+		{"hourly", hourly, "2026-06-10T10:20:00Z", "2026-06-10T11:00:00Z"},
+		{"hourly across the gap", hourly, "2026-03-08T06:30:00Z", "2026-03-08T07:00:00Z"},
+		{"utc by default", &Preference{Frequency: FrequencyDaily, Hour: 8}, "2026-06-10T10:00:00Z", "2026-06-11T08:00:00Z"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, utc(tt.due), tt.pref.due(utc(tt.at)).UTC())
+		})
+	}
+}
+
+// TestPreference_Validate tests rejecting unusable preferences
+func TestPreference_Validate(t *testing.T) {
+	valid := Preference{UserID: uuid.New(), Category: "bets", Frequency: FrequencyDaily, Hour: 8, Timezone: "Europe/London"}
+	assert.NoError(t, valid.validate())
+
+	for name, change := range map[string]func(p *Preference){
+		"no category": func(p *Preference) { p.Category = "" },
+		"frequency":   func(p *Preference) { p.Frequency = "weekly" },
+		"hour":        func(p *Preference) { p.Hour = 24 },
+		"timezone":    func(p *Preference) { p.Timezone = "Mars/Olympus" },
+	} {
+		p := valid
+		change(&p)
+		assert.ErrorIs(t, p.validate(), ErrInvalid, name)
+	}
+}
+
+// TestMemoryStore_Batches tests adding, sealing and deleting items
+func TestMemoryStore_Batches(t *testing.T) {
+	testBatches(t, NewMemoryStore())
+}
+
+func testBatches(t *testing.T, s Store) {
+	ctx := context.Background()
+	now := time.Now()
+	alice, bob := uuid.New(), uuid.New()
+
+	add := func(user uuid.UUID, id, category string, due time.Time) (bool, int) {
+		added, waiting, err := s.Add(ctx, &Item{NotificationID: id, UserID: user, Category: category, CreatedAt: now, Due: due})
+		require.NoError(t, err)
+		return added, waiting
+	}
+	added, waiting := add(alice, "n1", "bets", now)
+	assert.True(t, added)
+	assert.Equal(t, 1, waiting)
+	added, waiting = add(alice, "n1", "bets", now)
+	assert.False(t, added, "the same notification is held once")
+	assert.Equal(t, 1, waiting)
+	_, waiting = add(alice, "n2", "bets", now.Add(time.Hour))
+	assert.Equal(t, 2, waiting)
+	add(alice, "n3", "promotions", now.Add(time.Hour))
+	add(bob, "n1", "bets", now.Add(-time.Minute))
+
+	due, err := s.Due(ctx, now, 10)
+	require.NoError(t, err)
+	assert.ElementsMatch(t, []Key{{UserID: alice, Category: "bets"}, {UserID: bob, Category: "bets"}}, due)
+
+	sealed, err := s.Seal(ctx, Key{UserID: alice, Category: "bets"}, "b1")
+	require.NoError(t, err)
+	assert.Equal(t, 2, sealed)
+	_, waiting = add(alice, "n4", "bets", now)
+	assert.Equal(t, 1, waiting, "sealed items are not waiting")
+
+	batches, err := s.Sealed(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"b1"}, batches)
+	items, err := s.Batch(ctx, "b1")
+	require.NoError(t, err)
+	assert.Len(t, items, 2)
+
+	require.NoError(t, s.DeleteBatch(ctx, "b1"))
+	pending, err := s.Pending(ctx, alice)
+	require.NoError(t, err)
+	require.Len(t, pending, 2)
+	assert.Equal(t, []string{"n3", "n4"}, []string{pending[0].NotificationID, pending[1].NotificationID})
+}
+
+// TestMemoryStore_Preferences tests storing and removing preferences
+func TestMemoryStore_Preferences(t *testing.T) {
+	testPreferences(t, NewMemoryStore())
+}
+
+func testPreferences(t *testing.T, s Store) {
+	ctx := context.Background()
+	userID := uuid.New()
+
+	_, err := s.Preference(ctx, userID, "bets")
+	assert.ErrorIs(t, err, ErrNotFound)
+
+	require.NoError(t, s.SetPreference(ctx, &Preference{UserID: userID, Category: "promotions", Frequency: FrequencyDaily}))
+	require.NoError(t, s.SetPreference(ctx, &Preference{UserID: userID, Category: "bets", Frequency: FrequencyHourly}))
+	prefs, err := s.Preferences(ctx, userID)
+	require.NoError(t, err)
+	require.Len(t, prefs, 2)
+	assert.Equal(t, "bets", prefs[0].Category)
+
+	require.NoError(t, s.DeletePreference(ctx, userID, "bets"))
+	assert.ErrorIs(t, s.DeletePreference(ctx, userID, "bets"), ErrNotFound)
+}
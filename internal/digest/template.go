@@ -0,0 +1,89 @@
+package digest
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// View is the data a digest template is executed with. Times are in the
+// user's timezone.
+type View struct {
+	Category string
+	// Title is the category made readable, e.g. "Bets"
+	Title string
+	Count int
+	Items []ViewItem
+	// From and To are when the first and last items arrived
+	From, To time.Time
+}
+
+// ViewItem is one notification in a digest
+type ViewItem struct {
+	ID    string
+	Type  string
+	Title string
+	// Summary is the payload's "message" or "summary", if it has one
+	Summary string
+	At      time.Time
+	Payload interface{}
+}
+
+// defaultTemplate renders a plain-text digest listing each item
+var defaultTemplate = template.Must(template.New("digest").Funcs(template.FuncMap{
+	"lower": strings.ToLower,
+}).Parse(`
+{{- define "subject"}}Your {{lower .Title}} summary: {{.Count}} update{{if ne .Count 1}}s{{end}}{{end}}
+{{- define "body"}}{{.Count}} update{{if ne .Count 1}}s{{end}} in {{lower .Title}} since {{.From.Format "Mon Jan 2 15:04"}}:
+{{range .Items}}
+- {{.At.Format "Jan 2 15:04"}} {{.Title}}{{with .Summary}}: {{.}}{{end}}
+{{- end}}
+{{end}}`))
+
+// Rendered is a digest's subject and body
+type Rendered struct {
+	Subject string `json:"subject"`
+	Body    string `json:"body"`
+}
+
+// render executes t's "subject" and "body" templates for the items
+func render(t *template.Template, category string, items []*Item, loc *time.Location) (Rendered, View, error) {
+	view := View{Category: category, Title: humanize(category), Count: len(items)}
+	for _, item := range items {
+		vi := ViewItem{ID: item.NotificationID, Type: item.Type, Title: humanize(item.Type), At: item.CreatedAt.In(loc)}
+		if len(item.Payload) > 0 {
+			json.Unmarshal(item.Payload, &vi.Payload)
+		}
+		if fields, ok := vi.Payload.(map[string]interface{}); ok {
+			for _, key := range []string{"message", "summary"} {
+				if s, ok := fields[key].(string); ok && vi.Summary == "" {
+					vi.Summary = s
+				}
+			}
+		}
+		view.Items = append(view.Items, vi)
+	}
+	if len(view.Items) > 0 {
+		view.From, view.To = view.Items[0].At, view.Items[len(view.Items)-1].At
+	}
+
+	var subject, body bytes.Buffer
+	if err := t.ExecuteTemplate(&subject, "subject", view); err != nil {
+		return Rendered{}, view, err
+	}
+	if err := t.ExecuteTemplate(&body, "body", view); err != nil {
+		return Rendered{}, view, err
+	}
+	return Rendered{Subject: strings.TrimSpace(subject.String()), Body: body.String()}, view, nil
+}
+
+// humanize turns "bet_settled" into "Bet settled"
+func humanize(s string) string {
+	s = strings.NewReplacer("_", " ", ".", " ", "-", " ").Replace(s)
+	if s == "" {
+		return s
+	}
+	return strings.ToUpper(s[:1]) + s[1:]
+}
@@ -0,0 +1,48 @@
+package digest
+
+import (
+	"testing"
+	"text/template"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestRender tests the default digest text in the user's timezone
+func TestRender(t *testing.T) {
+	at := time.Date(2026, 6, 10, 17, 30, 0, 0, time.UTC)
+	items := []*Item{
+		{NotificationID: "n1", Type: "bet_settled", CreatedAt: at, Payload: []byte(`{"message":"Bet won","stake":5}`)},
+		{NotificationID: "n2", Type: "bet_void", CreatedAt: at.Add(time.Hour)},
+	}
+	loc, err := time.LoadLocation("Europe/London")
+	require.NoError(t, err)
+
+	rendered, view, err := render(defaultTemplate, "bets", items, loc)
+	require.NoError(t, err)
+	assert.Equal(t, "Your bets summary: 2 updates", rendered.Subject)
+	assert.Equal(t, "2 updates in bets since Wed Jun 10 18:30:\n\n- Jun 10 18:30 Bet settled: Bet won\n- Jun 10 19:30 Bet void\n", rendered.Body)
+	assert.Equal(t, "Bet won", view.Items[0].Summary)
+	assert.Equal(t, at.Add(time.Hour).In(loc), view.To)
+
+	rendered, _, err = render(defaultTemplate, "bets", items[:1], loc)
+	require.NoError(t, err)
+	assert.Equal(t, "Your bets summary: 1 update", rendered.Subject)
+}
+
+// TestRender_Template tests rendering with a category's own template
+func TestRender_Template(t *testing.T) {
+	custom := template.Must(template.New("bets").Parse(
+		`{{define "subject"}}{{.Count}} bets settled{{end}}{{define "body"}}{{range .Items}}{{.Payload.stake}} {{end}}{{end}}`))
+	items := []*Item{
+		{NotificationID: "n1", Type: "bet_settled", Payload: []byte(`{"stake":5}`)},
+		{NotificationID: "n2", Type: "bet_settled", Payload: []byte(`{"stake":7}`)},
+	}
+	rendered, _, err := render(custom, "bets", items, time.UTC)
+	require.NoError(t, err)
+	assert.Equal(t, Rendered{Subject: "2 bets settled", Body: "5 7 "}, rendered)
+
+	_, _, err = render(template.Must(template.New("empty").Parse(`{{define "subject"}}x{{end}}`)), "bets", items, time.UTC)
+	assert.Error(t, err, "a template without a body")
+}
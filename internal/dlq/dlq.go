@@ -0,0 +1,222 @@
+// Package dlq keeps notifications that could not be delivered, with why
+// and how often delivery was tried, so operators can inspect, fix and
+// replay them instead of losing them.
+package dlq
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/cypherlabdev/notification-service/internal/notify"
+)
+
+var (
+	// ErrNotFound is returned for an unknown entry
+	ErrNotFound = errors.New("dead letter not found")
+	// ErrInvalid is returned for an entry or edit that cannot be replayed
+	ErrInvalid = errors.New("invalid dead letter")
+)
+
+// Status is the state of an entry
+type Status string
+
+const (
+	StatusPending  Status = "pending"
+	StatusReplayed Status = "replayed"
+)
+
+// Sources of dead letters; channel and consumer sources are suffixed with
+// the channel name or topic, e.g. "channel:email" or "consumer:wallet-events"
+const (
+	SourceHub      = "hub"
+	SourceChannel  = "channel"
+	SourceConsumer = "consumer"
+)
+
+// Reasons an entry was dead-lettered
+const (
+	ReasonEncodeFailed   = "encode_failed"
+	ReasonDeliveryFailed = "delivery_failed"
+	ReasonDecodeFailed   = "decode_failed"
+)
+
+// Entry is a notification that could not be delivered
+type Entry struct {
+	ID     string `json:"id"`
+	Source string `json:"source"`
+	Reason string `json:"reason"`
+	// NotificationID is the ID of the original notification, if it had one
+	NotificationID string    `json:"notification_id,omitempty"`
+	UserID         uuid.UUID `json:"user_id,omitzero"`
+	Type           string    `json:"type,omitempty"`
+	// Payload is the original payload; Raw holds input that is not valid
+	// JSON, such as an undecodable Kafka record, and must be edited into a
+	// Payload before the entry can be replayed
+	Payload   json.RawMessage  `json:"payload,omitempty"`
+	Raw       []byte           `json:"raw,omitempty"`
+	ExpiresAt time.Time        `json:"expires_at,omitzero"`
+	Attempts  []notify.Attempt `json:"attempts"`
+	Status    Status           `json:"status"`
+	CreatedAt time.Time        `json:"created_at"`
+	UpdatedAt time.Time        `json:"updated_at"`
+}
+
+// channel returns the channel a delivery failure happened on, if any
+func (e *Entry) channel() string {
+	name, ok := strings.CutPrefix(e.Source, SourceChannel+":")
+	if !ok {
+		return ""
+	}
+	return name
+}
+
+// Filter selects entries; zero fields match everything
+type Filter struct {
+	Source string
+	Reason string
+	Type   string
+	UserID uuid.UUID
+	Status Status
+	// Before matches entries created before it
+	Before time.Time
+	// After is the ID of the last entry of the previous page
+	After string
+	Limit int
+}
+
+// Match reports whether e is selected by the filter, ignoring paging
+func (f *Filter) Match(e *Entry) bool {
+	return (f.Source == "" || e.Source == f.Source) &&
+		(f.Reason == "" || e.Reason == f.Reason) &&
+		(f.Type == "" || e.Type == f.Type) &&
+		(f.UserID == uuid.Nil || e.UserID == f.UserID) &&
+		(f.Status == "" || e.Status == f.Status) &&
+		(f.Before.IsZero() || e.CreatedAt.Before(f.Before))
+}
+
+// Store persists dead letters. Entry IDs are time-ordered, and List returns
+// entries oldest first.
+type Store interface {
+	Add(ctx context.Context, e *Entry) error
+	Get(ctx context.Context, id string) (*Entry, error)
+	// Update overwrites a stored entry, or returns ErrNotFound
+	Update(ctx context.Context, e *Entry) error
+	List(ctx context.Context, f Filter) ([]*Entry, error)
+	// Delete removes an entry, or returns ErrNotFound
+	Delete(ctx context.Context, id string) error
+	// Purge removes every entry matching f and returns how many it removed
+	Purge(ctx context.Context, f Filter) (int, error)
+	// Count returns how many entries have the given status
+	Count(ctx context.Context, status Status) (int, error)
+}
+
+// MemoryStore is an in-process Store
+type MemoryStore struct {
+	entries map[string]*Entry
+	mu      sync.Mutex
+}
+
+// NewMemoryStore creates an empty in-memory store
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{entries: make(map[string]*Entry)}
+}
+
+// Add implements Store
+func (s *MemoryStore) Add(_ context.Context, e *Entry) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.entries[e.ID] = clone(e)
+	return nil
+}
+
+// Get implements Store
+func (s *MemoryStore) Get(_ context.Context, id string) (*Entry, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	e, ok := s.entries[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return clone(e), nil
+}
+
+// Update implements Store
+func (s *MemoryStore) Update(_ context.Context, e *Entry) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.entries[e.ID]; !ok {
+		return ErrNotFound
+	}
+	s.entries[e.ID] = clone(e)
+	return nil
+}
+
+// List implements Store
+func (s *MemoryStore) List(_ context.Context, f Filter) ([]*Entry, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var out []*Entry
+	for _, e := range s.entries {
+		if e.ID > f.After && f.Match(e) {
+			out = append(out, clone(e))
+		}
+	}
+	slices.SortFunc(out, func(a, b *Entry) int { return strings.Compare(a.ID, b.ID) })
+	if f.Limit > 0 && len(out) > f.Limit {
+		out = out[:f.Limit]
+	}
+	return out, nil
+}
+
+// Delete implements Store
+func (s *MemoryStore) Delete(_ context.Context, id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.entries[id]; !ok {
+		return ErrNotFound
+	}
+	delete(s.entries, id)
+	return nil
+}
+
+// Purge implements Store
+func (s *MemoryStore) Purge(_ context.Context, f Filter) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	n := 0
+	for id, e := range s.entries {
+		if f.Match(e) {
+			delete(s.entries, id)
+			n++
+		}
+	}
+	return n, nil
+}
+
+// Count implements Store
+func (s *MemoryStore) Count(_ context.Context, status Status) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	n := 0
+	for _, e := range s.entries {
+		if e.Status == status {
+			n++
+		}
+	}
+	return n, nil
+}
+
+func clone(e *Entry) *Entry {
+	c := *e
+	c.Payload = slices.Clone(e.Payload)
+	c.Raw = slices.Clone(e.Raw)
+	c.Attempts = slices.Clone(e.Attempts)
+	return &c
+}
@@ -0,0 +1,73 @@
+package dlq
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/cypherlabdev/notification-service/internal/notify"
+)
+
+// TestMemoryStore tests filtering, paging and purging entries
+func TestMemoryStore(t *testing.T) {
+	testStore(t, NewMemoryStore())
+}
+
+func testStore(t *testing.T, s Store) {
+	ctx := context.Background()
+	userID := uuid.New()
+	base := time.Now()
+
+	for i, source := range []string{"channel:email", "channel:sms", "channel:email", SourceHub} {
+		id, _ := uuid.NewV7()
+		require.NoError(t, s.Add(ctx, &Entry{
+			ID:        id.String(),
+			Source:    source,
+			Reason:    ReasonDeliveryFailed,
+			UserID:    userID,
+			Status:    StatusPending,
+			CreatedAt: base.Add(time.Duration(i) * time.Minute),
+		}))
+	}
+
+	all, err := s.List(ctx, Filter{})
+	require.NoError(t, err)
+	require.Len(t, all, 4)
+	for i := 1; i < len(all); i++ {
+		assert.Less(t, all[i-1].ID, all[i].ID, "oldest first")
+	}
+
+	email, _ := s.List(ctx, Filter{Source: "channel:email"})
+	assert.Len(t, email, 2)
+
+	page, _ := s.List(ctx, Filter{After: all[0].ID, Limit: 2})
+	assert.Equal(t, []string{all[1].ID, all[2].ID}, []string{page[0].ID, page[1].ID})
+
+	all[3].Status = StatusReplayed
+	require.NoError(t, s.Update(ctx, all[3]))
+	replayed, _ := s.List(ctx, Filter{Status: StatusReplayed, UserID: userID})
+	require.Len(t, replayed, 1)
+	assert.Equal(t, SourceHub, replayed[0].Source)
+	mine, _ := s.List(ctx, Filter{UserID: uuid.New()})
+	assert.Empty(t, mine)
+	assert.ErrorIs(t, s.Update(ctx, &Entry{ID: "missing"}), ErrNotFound)
+
+	// Entries are copied in and out
+	all[0].Attempts = append(all[0].Attempts, notify.Attempt{Error: "changed"})
+	stored, _ := s.Get(ctx, all[0].ID)
+	assert.Empty(t, stored.Attempts)
+
+	n, err := s.Purge(ctx, Filter{Before: base.Add(90 * time.Second)})
+	require.NoError(t, err)
+	assert.Equal(t, 2, n)
+	count, _ := s.Count(ctx, StatusPending)
+	assert.Equal(t, 1, count)
+
+	assert.ErrorIs(t, s.Delete(ctx, all[0].ID), ErrNotFound)
+	_, err = s.Get(ctx, "missing")
+	assert.ErrorIs(t, err, ErrNotFound)
+}
@@ -0,0 +1,227 @@
+package dlq
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/rs/zerolog"
+
+	"github.com/cypherlabdev/notification-service/internal/notify"
+)
+
+const (
+	defaultPageSize = 100
+	maxPageSize     = 1000
+)
+
+// listResponse is a page of entries; Next is passed as ?after= for the next page
+type listResponse struct {
+	Entries []*Entry `json:"entries"`
+	Next    string   `json:"next,omitempty"`
+}
+
+// purgeResponse reports how many entries a purge removed
+type purgeResponse struct {
+	Purged int `json:"purged"`
+}
+
+// Handler serves the dead letter admin API:
+//
+//	GET    /dlq                 lists entries, filtered by source, reason, type,
+//	                            user_id, status and before, paged by after and limit
+//	GET    /dlq/{id}            returns an entry with its attempt history
+//	PATCH  /dlq/{id}            edits user_id, type, payload or expires_at
+//	POST   /dlq/{id}/replay     replays an entry, applying an optional edit first
+//	DELETE /dlq/{id}            removes an entry
+//	POST   /dlq/purge           removes the entries matching the list filters;
+//	                            purging without a filter requires ?all=true
+type Handler struct {
+	queue      *Queue
+	dispatcher Dispatcher
+	logger     zerolog.Logger
+	mux        *http.ServeMux
+}
+
+// NewHandler creates the admin API backed by queue, replaying entries
+// through dispatcher
+func NewHandler(queue *Queue, dispatcher Dispatcher, logger zerolog.Logger) *Handler {
+	h := &Handler{
+		queue:      queue,
+		dispatcher: dispatcher,
+		logger:     logger.With().Str("component", "dlq_api").Logger(),
+		mux:        http.NewServeMux(),
+	}
+	h.mux.HandleFunc("GET /dlq", h.list)
+	h.mux.HandleFunc("GET /dlq/{id}", h.get)
+	h.mux.HandleFunc("PATCH /dlq/{id}", h.edit)
+	h.mux.HandleFunc("POST /dlq/{id}/replay", h.replay)
+	h.mux.HandleFunc("DELETE /dlq/{id}", h.delete)
+	h.mux.HandleFunc("POST /dlq/purge", h.purge)
+	return h
+}
+
+// ServeHTTP implements http.Handler
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	h.mux.ServeHTTP(w, r)
+}
+
+func (h *Handler) list(w http.ResponseWriter, r *http.Request) {
+	f, err := parseFilter(r.URL.Query())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	entries, err := h.queue.List(r.Context(), f)
+	if err != nil {
+		h.storeError(w, err, "failed to list dead letters")
+		return
+	}
+	resp := listResponse{Entries: entries}
+	if resp.Entries == nil {
+		resp.Entries = []*Entry{}
+	}
+	if len(entries) == f.Limit {
+		resp.Next = entries[len(entries)-1].ID
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
+
+func (h *Handler) get(w http.ResponseWriter, r *http.Request) {
+	e, err := h.queue.Get(r.Context(), r.PathValue("id"))
+	if err != nil {
+		h.storeError(w, err, "failed to load dead letter")
+		return
+	}
+	writeJSON(w, http.StatusOK, e)
+}
+
+func (h *Handler) edit(w http.ResponseWriter, r *http.Request) {
+	var edit Edit
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 256<<10)).Decode(&edit); err != nil {
+		http.Error(w, "invalid body: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	e, err := h.queue.Edit(r.Context(), r.PathValue("id"), edit)
+	if err != nil {
+		h.storeError(w, err, "failed to edit dead letter")
+		return
+	}
+	writeJSON(w, http.StatusOK, e)
+}
+
+func (h *Handler) replay(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	var edit Edit
+	err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 256<<10)).Decode(&edit)
+	switch {
+	case errors.Is(err, io.EOF):
+		// Replay as is
+	case err != nil:
+		http.Error(w, "invalid body: "+err.Error(), http.StatusBadRequest)
+		return
+	default:
+		if _, err := h.queue.Edit(r.Context(), id, edit); err != nil {
+			h.storeError(w, err, "failed to edit dead letter")
+			return
+		}
+	}
+
+	e, err := h.queue.Replay(r.Context(), h.dispatcher, id)
+	switch {
+	case errors.Is(err, notify.ErrExpired):
+		http.Error(w, "entry expired; set a later expires_at to replay it", http.StatusUnprocessableEntity)
+	case e != nil && err != nil:
+		// The failed attempt was recorded on the entry
+		writeJSON(w, http.StatusBadGateway, e)
+	case err != nil:
+		h.storeError(w, err, "failed to replay dead letter")
+	default:
+		writeJSON(w, http.StatusOK, e)
+	}
+}
+
+func (h *Handler) delete(w http.ResponseWriter, r *http.Request) {
+	if err := h.queue.Delete(r.Context(), r.PathValue("id")); err != nil {
+		h.storeError(w, err, "failed to delete dead letter")
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *Handler) purge(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	f, err := parseFilter(query)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	f.After, f.Limit = "", 0
+	if f == (Filter{}) && query.Get("all") != "true" {
+		http.Error(w, "set a filter, or all=true to purge every entry", http.StatusBadRequest)
+		return
+	}
+	n, err := h.queue.Purge(r.Context(), f)
+	if err != nil {
+		h.storeError(w, err, "failed to purge dead letters")
+		return
+	}
+	writeJSON(w, http.StatusOK, purgeResponse{Purged: n})
+}
+
+func (h *Handler) storeError(w http.ResponseWriter, err error, msg string) {
+	switch {
+	case errors.Is(err, ErrNotFound):
+		http.Error(w, err.Error(), http.StatusNotFound)
+	case errors.Is(err, ErrInvalid):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	default:
+		h.logger.Error().Err(err).Msg(msg)
+		http.Error(w, "internal error", http.StatusInternalServerError)
+	}
+}
+
+// parseFilter reads the list filters from the query string
+func parseFilter(q url.Values) (Filter, error) {
+	f := Filter{
+		Source: q.Get("source"),
+		Reason: q.Get("reason"),
+		Type:   q.Get("type"),
+		Status: Status(q.Get("status")),
+		After:  q.Get("after"),
+		Limit:  defaultPageSize,
+	}
+	if v := q.Get("user_id"); v != "" {
+		id, err := uuid.Parse(v)
+		if err != nil {
+			return Filter{}, errors.New("invalid user_id")
+		}
+		f.UserID = id
+	}
+	if v := q.Get("before"); v != "" {
+		t, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			return Filter{}, errors.New("invalid before: use RFC 3339")
+		}
+		f.Before = t
+	}
+	if v := q.Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 {
+			return Filter{}, errors.New("invalid limit")
+		}
+		f.Limit = min(n, maxPageSize)
+	}
+	return f, nil
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
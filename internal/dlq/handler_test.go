@@ -0,0 +1,86 @@
+package dlq
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/cypherlabdev/notification-service/internal/notify"
+)
+
+func do(h http.Handler, method, path, body string) *httptest.ResponseRecorder {
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(method, path, strings.NewReader(body)))
+	return rec
+}
+
+// TestHandler tests inspecting, editing, replaying and purging entries
+func TestHandler(t *testing.T) {
+	ctx := context.Background()
+	push := &fakeChannel{name: "push", err: errors.New("token revoked")}
+	q, d := newTestQueue(push)
+	h := NewHandler(q, d, zerolog.Nop())
+
+	userID := uuid.New()
+	for _, typ := range []string{"deposit_received", "withdrawal_sent", "deposit_received"} {
+		d.Dispatch(ctx, &notify.Notification{UserID: userID, Type: typ, Payload: map[string]int{"amount": 1}})
+	}
+
+	rec := do(h, http.MethodGet, "/dlq?type=deposit_received&limit=1", "")
+	require.Equal(t, http.StatusOK, rec.Code)
+	var page listResponse
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &page))
+	require.Len(t, page.Entries, 1)
+	require.NotEmpty(t, page.Next)
+	first := page.Entries[0]
+	assert.Equal(t, "channel:push", first.Source)
+
+	rec = do(h, http.MethodGet, "/dlq?type=deposit_received&limit=1&after="+page.Next, "")
+	var next listResponse
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &next))
+	require.Len(t, next.Entries, 1)
+	assert.NotEqual(t, first.ID, next.Entries[0].ID)
+
+	assert.Equal(t, http.StatusBadRequest, do(h, http.MethodGet, "/dlq?user_id=nope", "").Code)
+	assert.Equal(t, http.StatusNotFound, do(h, http.MethodGet, "/dlq/missing", "").Code)
+
+	// A failed replay reports the recorded attempt
+	rec = do(h, http.MethodPost, "/dlq/"+first.ID+"/replay", "")
+	require.Equal(t, http.StatusBadGateway, rec.Code)
+	var e Entry
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &e))
+	assert.Len(t, e.Attempts, 2)
+
+	// Edit and replay in one call
+	push.setErr(nil)
+	rec = do(h, http.MethodPost, "/dlq/"+first.ID+"/replay", `{"payload":{"amount":2}}`)
+	require.Equal(t, http.StatusOK, rec.Code)
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &e))
+	assert.Equal(t, StatusReplayed, e.Status)
+	assert.Equal(t, map[string]interface{}{"amount": float64(2)}, push.sent[0].Payload)
+
+	assert.Equal(t, http.StatusBadRequest, do(h, http.MethodPatch, "/dlq/"+first.ID, `{"type":"x"}`).Code, "replayed entries are read-only")
+
+	assert.Equal(t, http.StatusBadRequest, do(h, http.MethodPost, "/dlq/purge", "").Code)
+	rec = do(h, http.MethodPost, "/dlq/purge?status=replayed", "")
+	require.Equal(t, http.StatusOK, rec.Code)
+	assert.JSONEq(t, `{"purged":1}`, rec.Body.String())
+
+	rec = do(h, http.MethodGet, "/dlq?type=withdrawal_sent", "")
+	var withdrawals listResponse
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &withdrawals))
+	require.Len(t, withdrawals.Entries, 1)
+	assert.Equal(t, http.StatusNoContent, do(h, http.MethodDelete, "/dlq/"+withdrawals.Entries[0].ID, "").Code)
+
+	rec = do(h, http.MethodPost, "/dlq/purge?all=true", "")
+	assert.JSONEq(t, `{"purged":1}`, rec.Body.String())
+}
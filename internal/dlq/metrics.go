@@ -0,0 +1,31 @@
+package dlq
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var (
+	// pending is the queue depth; alert when it keeps growing, e.g.
+	// delta(notification_dlq_pending_entries[15m]) > 0
+	pending = promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: "notification",
+		Subsystem: "dlq",
+		Name:      "pending_entries",
+		Help:      "Dead-lettered notifications waiting to be replayed or purged.",
+	})
+
+	added = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "notification",
+		Subsystem: "dlq",
+		Name:      "entries_added_total",
+		Help:      "Notifications dead-lettered, by source and reason.",
+	}, []string{"source", "reason"})
+
+	replays = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "notification",
+		Subsystem: "dlq",
+		Name:      "replays_total",
+		Help:      "Dead letter replays, by result.",
+	}, []string{"result"})
+)
@@ -0,0 +1,359 @@
+package dlq
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/rs/zerolog"
+
+	"github.com/cypherlabdev/notification-service/internal/notify"
+	ws "github.com/cypherlabdev/notification-service/internal/websocket"
+)
+
+// replaySource prefixes the Source of notifications sent by Replay, as
+// "dlq:<entry id>"; their failures are recorded on that entry rather than
+// dead-lettered again
+const replaySource = "dlq:"
+
+// hubTimeout bounds storing a dead letter reported by the hub
+const hubTimeout = 5 * time.Second
+
+// Dispatcher replays notifications; *notify.Dispatcher implements it
+type Dispatcher interface {
+	Dispatch(ctx context.Context, n *notify.Notification) error
+}
+
+// Edit changes an entry before it is replayed; nil fields are kept
+type Edit struct {
+	UserID    *uuid.UUID      `json:"user_id,omitempty"`
+	Type      *string         `json:"type,omitempty"`
+	Payload   json.RawMessage `json:"payload,omitempty"`
+	ExpiresAt *time.Time      `json:"expires_at,omitempty"`
+}
+
+// Queue records dead letters from the hub, the dispatcher's channels and
+// the event consumer, and replays them on request
+type Queue struct {
+	store  Store
+	logger zerolog.Logger
+	now    func() time.Time
+	mu     sync.Mutex // serialises read-modify-write of entries
+}
+
+// New creates a queue over store
+func New(store Store, logger zerolog.Logger) *Queue {
+	return &Queue{
+		store:  store,
+		logger: logger.With().Str("component", "dlq").Logger(),
+		now:    time.Now,
+	}
+}
+
+// Add stores a new entry, assigning its ID, status and timestamps
+func (q *Queue) Add(ctx context.Context, e *Entry) error {
+	id, err := uuid.NewV7()
+	if err != nil {
+		return err
+	}
+	now := q.now()
+	e.ID = id.String()
+	e.Status = StatusPending
+	e.CreatedAt = now
+	e.UpdatedAt = now
+	if e.Attempts == nil {
+		e.Attempts = []notify.Attempt{}
+	}
+	if err := q.store.Add(ctx, e); err != nil {
+		return err
+	}
+	added.WithLabelValues(e.Source, e.Reason).Inc()
+	q.refresh(ctx)
+	q.logger.Warn().Str("entry_id", e.ID).Str("source", e.Source).Str("reason", e.Reason).Str("type", e.Type).Msg("notification dead-lettered")
+	return nil
+}
+
+// DeadLetter implements notify.DeadLetterSink. A failed replay, reported
+// synchronously or later by a channel that delivers in the background, is
+// added to the history of the entry it replayed.
+func (q *Queue) DeadLetter(ctx context.Context, n *notify.Notification, channel string, err error) {
+	ctx = context.WithoutCancel(ctx)
+	attempts := failedAttempts(err, q.now())
+	if id, ok := strings.CutPrefix(n.Source, replaySource); ok {
+		if err := q.replayFailed(ctx, id, attempts); err != nil {
+			q.logger.Error().Err(err).Str("entry_id", id).Msg("failed to record replay failure")
+		}
+		return
+	}
+
+	e := &Entry{
+		Source:         SourceChannel + ":" + channel,
+		Reason:         ReasonDeliveryFailed,
+		NotificationID: n.ID,
+		UserID:         n.UserID,
+		Type:           n.Type,
+		ExpiresAt:      n.ExpiresAt,
+		Attempts:       attempts,
+	}
+	e.setPayload(n.Payload)
+	if err := q.Add(ctx, e); err != nil {
+		q.logger.Error().Err(err).Str("notification_id", n.ID).Msg("failed to dead-letter notification")
+	}
+}
+
+// failedAttempts returns the attempt history carried by err, or err as a
+// single attempt
+func failedAttempts(err error, now time.Time) []notify.Attempt {
+	var retry *notify.RetryError
+	if errors.As(err, &retry) {
+		return retry.Attempts
+	}
+	return []notify.Attempt{{At: now, Error: err.Error()}}
+}
+
+// FromHub is a websocket.DeadLetterFunc recording messages that failed to
+// encode. The entry is stored in the background.
+func (q *Queue) FromHub(msg *ws.Message, err error) {
+	e := &Entry{
+		Source:         SourceHub,
+		Reason:         ReasonEncodeFailed,
+		NotificationID: msg.ID,
+		Type:           msg.Type,
+		ExpiresAt:      msg.ExpiresAt,
+		Attempts:       []notify.Attempt{{At: q.now(), Error: err.Error()}},
+	}
+	if msg.UserID != nil {
+		e.UserID = *msg.UserID
+	}
+	e.setPayload(msg.Payload)
+
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), hubTimeout)
+		defer cancel()
+		if err := q.Add(ctx, e); err != nil {
+			q.logger.Error().Err(err).Str("type", e.Type).Msg("failed to dead-letter hub message")
+		}
+	}()
+}
+
+// FromConsumer records an event that could not be decoded, keeping the
+// record as it was received
+func (q *Queue) FromConsumer(ctx context.Context, topic string, record []byte, err error) error {
+	return q.Add(ctx, &Entry{
+		Source:   SourceConsumer + ":" + topic,
+		Reason:   ReasonDecodeFailed,
+		Raw:      record,
+		Attempts: []notify.Attempt{{At: q.now(), Error: err.Error()}},
+	})
+}
+
+// Get returns an entry
+func (q *Queue) Get(ctx context.Context, id string) (*Entry, error) {
+	return q.store.Get(ctx, id)
+}
+
+// List returns the entries matching f, oldest first
+func (q *Queue) List(ctx context.Context, f Filter) ([]*Entry, error) {
+	return q.store.List(ctx, f)
+}
+
+// Edit applies edit to a pending entry
+func (q *Queue) Edit(ctx context.Context, id string, edit Edit) (*Entry, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	e, err := q.store.Get(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if err := e.apply(edit); err != nil {
+		return nil, err
+	}
+	e.UpdatedAt = q.now()
+	if err := q.store.Update(ctx, e); err != nil {
+		return nil, err
+	}
+	return e, nil
+}
+
+// Replay sends a pending entry through dispatcher again, over the channel
+// it failed on if it failed on one, and marks it replayed. If delivery
+// fails, now or later for channels that deliver in the background, the
+// failure is added to the entry's history and it is pending again. An
+// entry past its expiry fails with notify.ErrExpired until it is edited
+// with a later expires_at.
+func (q *Queue) Replay(ctx context.Context, dispatcher Dispatcher, id string) (*Entry, error) {
+	q.mu.Lock()
+	e, err := q.store.Get(ctx, id)
+	if err != nil {
+		q.mu.Unlock()
+		return nil, err
+	}
+	n, err := e.notification()
+	if err != nil {
+		q.mu.Unlock()
+		return nil, err
+	}
+	if e.expired(q.now()) {
+		q.mu.Unlock()
+		replays.WithLabelValues("expired").Inc()
+		return nil, notify.ErrExpired
+	}
+	// Marked before sending so a failure reported meanwhile is not overwritten
+	e.Status = StatusReplayed
+	e.UpdatedAt = q.now()
+	err = q.store.Update(ctx, e)
+	q.mu.Unlock()
+	if err != nil {
+		return nil, err
+	}
+
+	err = dispatcher.Dispatch(ctx, n)
+	if err != nil {
+		// Recorded by DeadLetter if the dispatcher reports to this queue
+		if rerr := q.replayFailed(ctx, id, failedAttempts(err, q.now())); rerr != nil {
+			return nil, rerr
+		}
+		replays.WithLabelValues("failed").Inc()
+		e, gerr := q.store.Get(ctx, id)
+		if gerr != nil {
+			return nil, gerr
+		}
+		return e, fmt.Errorf("replay failed: %w", err)
+	}
+	q.refresh(ctx)
+	replays.WithLabelValues("ok").Inc()
+	q.logger.Info().Str("entry_id", e.ID).Str("notification_id", n.ID).Msg("dead letter replayed")
+	return e, nil
+}
+
+// replayFailed returns a replayed entry to pending with the failed attempts
+// added, unless that was already done for this replay
+func (q *Queue) replayFailed(ctx context.Context, id string, attempts []notify.Attempt) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	e, err := q.store.Get(ctx, id)
+	if err != nil {
+		return err
+	}
+	if e.Status != StatusReplayed {
+		return nil
+	}
+	e.Status = StatusPending
+	e.Attempts = append(e.Attempts, attempts...)
+	e.UpdatedAt = q.now()
+	if err := q.store.Update(ctx, e); err != nil {
+		return err
+	}
+	q.refresh(ctx)
+	return nil
+}
+
+// Delete removes an entry
+func (q *Queue) Delete(ctx context.Context, id string) error {
+	if err := q.store.Delete(ctx, id); err != nil {
+		return err
+	}
+	q.refresh(ctx)
+	return nil
+}
+
+// Purge removes the entries matching f and returns how many were removed
+func (q *Queue) Purge(ctx context.Context, f Filter) (int, error) {
+	n, err := q.store.Purge(ctx, f)
+	if err != nil {
+		return 0, err
+	}
+	q.refresh(ctx)
+	q.logger.Info().Int("entries", n).Msg("dead letters purged")
+	return n, nil
+}
+
+// refresh updates the pending entries gauge
+func (q *Queue) refresh(ctx context.Context) {
+	n, err := q.store.Count(ctx, StatusPending)
+	if err != nil {
+		q.logger.Warn().Err(err).Msg("failed to count dead letters")
+		return
+	}
+	pending.Set(float64(n))
+}
+
+// setPayload keeps payload as JSON, or its Go representation if it cannot
+// be marshalled
+func (e *Entry) setPayload(payload interface{}) {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		e.Raw = []byte(fmt.Sprintf("%+v", payload))
+		return
+	}
+	e.Payload = data
+}
+
+func (e *Entry) apply(edit Edit) error {
+	if e.Status != StatusPending {
+		return fmt.Errorf("%w: entry already replayed", ErrInvalid)
+	}
+	if edit.Payload != nil {
+		if !json.Valid(edit.Payload) {
+			return fmt.Errorf("%w: payload is not valid JSON", ErrInvalid)
+		}
+		e.Payload = edit.Payload
+		e.Raw = nil
+	}
+	if edit.UserID != nil {
+		e.UserID = *edit.UserID
+	}
+	if edit.Type != nil {
+		e.Type = *edit.Type
+	}
+	if edit.ExpiresAt != nil {
+		e.ExpiresAt = *edit.ExpiresAt
+	}
+	return nil
+}
+
+func (e *Entry) expired(now time.Time) bool {
+	return !e.ExpiresAt.IsZero() && !now.Before(e.ExpiresAt)
+}
+
+// notification rebuilds the notification to replay
+func (e *Entry) notification() (*notify.Notification, error) {
+	switch {
+	case e.Status != StatusPending:
+		return nil, fmt.Errorf("%w: entry already replayed", ErrInvalid)
+	case e.UserID == uuid.Nil || e.Type == "":
+		return nil, fmt.Errorf("%w: set user_id and type before replaying", ErrInvalid)
+	case e.Payload == nil && e.Raw != nil:
+		return nil, fmt.Errorf("%w: replace the raw input with a payload before replaying", ErrInvalid)
+	}
+	var payload interface{}
+	if e.Payload != nil {
+		if err := json.Unmarshal(e.Payload, &payload); err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalid, err)
+		}
+	}
+
+	n := &notify.Notification{
+		ID:        e.NotificationID,
+		UserID:    e.UserID,
+		Type:      e.Type,
+		Payload:   payload,
+		ExpiresAt: e.ExpiresAt,
+		Source:    replaySource + e.ID,
+	}
+	if n.ID == "" {
+		n.ID = e.ID
+	}
+	switch {
+	case e.channel() != "":
+		n.Channels = []string{e.channel()}
+	case e.Source == SourceHub:
+		n.Channels = []string{notify.ChannelWebSocket}
+	}
+	return n, nil
+}
@@ -0,0 +1,191 @@
+package dlq
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/cypherlabdev/notification-service/internal/notify"
+	ws "github.com/cypherlabdev/notification-service/internal/websocket"
+)
+
+// fakeChannel records notifications and fails while err is set
+type fakeChannel struct {
+	name string
+	err  error
+	sent []*notify.Notification
+	mu   sync.Mutex
+}
+
+func (c *fakeChannel) Name() string { return c.name }
+
+func (c *fakeChannel) Send(_ context.Context, n *notify.Notification) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.err != nil {
+		return c.err
+	}
+	c.sent = append(c.sent, n)
+	return nil
+}
+
+func (c *fakeChannel) setErr(err error) {
+	c.mu.Lock()
+	c.err = err
+	c.mu.Unlock()
+}
+
+func (c *fakeChannel) count() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.sent)
+}
+
+// newTestQueue creates a queue and a dispatcher that dead-letters into it
+func newTestQueue(channels ...notify.Channel) (*Queue, *notify.Dispatcher) {
+	q := New(NewMemoryStore(), zerolog.Nop())
+	return q, notify.NewDispatcher(zerolog.Nop(), notify.WithChannels(channels...), notify.WithDeadLetters(q))
+}
+
+// TestQueue_ChannelFailure tests that a failed channel is dead-lettered and
+// replayed over that channel only
+func TestQueue_ChannelFailure(t *testing.T) {
+	ctx := context.Background()
+	email := &fakeChannel{name: "email"}
+	websocket := &fakeChannel{name: "websocket"}
+	q, d := newTestQueue(websocket, email)
+
+	email.setErr(&notify.RetryError{
+		Attempts: []notify.Attempt{{Error: "timeout"}, {Error: "timeout"}, {Error: "503"}},
+		Err:      errors.New("503"),
+	})
+	userID := uuid.New()
+	err := d.Dispatch(ctx, &notify.Notification{ID: "n-1", UserID: userID, Type: "deposit_received", Payload: map[string]int{"amount": 50}})
+	require.Error(t, err)
+	assert.Equal(t, 1, websocket.count())
+
+	entries, err := q.List(ctx, Filter{Source: "channel:email"})
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+	e := entries[0]
+	assert.Equal(t, ReasonDeliveryFailed, e.Reason)
+	assert.Equal(t, "n-1", e.NotificationID)
+	assert.JSONEq(t, `{"amount":50}`, string(e.Payload))
+	assert.Len(t, e.Attempts, 3)
+
+	// A failed replay is recorded on the entry, not dead-lettered again
+	_, err = q.Replay(ctx, d, e.ID)
+	require.Error(t, err)
+	e, _ = q.Get(ctx, e.ID)
+	assert.Len(t, e.Attempts, 6)
+	assert.Equal(t, StatusPending, e.Status)
+	all, _ := q.List(ctx, Filter{})
+	assert.Len(t, all, 1)
+
+	email.setErr(nil)
+	e, err = q.Replay(ctx, d, e.ID)
+	require.NoError(t, err)
+	assert.Equal(t, StatusReplayed, e.Status)
+	assert.Equal(t, 1, email.count())
+	assert.Equal(t, 1, websocket.count(), "replays only go to the failed channel")
+
+	_, err = q.Replay(ctx, d, e.ID)
+	assert.ErrorIs(t, err, ErrInvalid)
+
+	// A channel delivering in the background reports a later failure
+	q.DeadLetter(ctx, &notify.Notification{Source: "dlq:" + e.ID}, "email", errors.New("bounced"))
+	e, _ = q.Get(ctx, e.ID)
+	assert.Equal(t, StatusPending, e.Status)
+	assert.Equal(t, "bounced", e.Attempts[len(e.Attempts)-1].Error)
+}
+
+// TestQueue_ReplayExpiry tests that replays honour the notification's expiry
+func TestQueue_ReplayExpiry(t *testing.T) {
+	ctx := context.Background()
+	sms := &fakeChannel{name: "sms", err: errors.New("gateway down")}
+	q, d := newTestQueue(sms)
+
+	expiresAt := time.Now().Add(50 * time.Millisecond)
+	d.Dispatch(ctx, &notify.Notification{UserID: uuid.New(), Type: "odds_changed", ExpiresAt: expiresAt})
+	entries, _ := q.List(ctx, Filter{})
+	require.Len(t, entries, 1)
+	sms.setErr(nil)
+
+	time.Sleep(60 * time.Millisecond)
+	_, err := q.Replay(ctx, d, entries[0].ID)
+	assert.ErrorIs(t, err, notify.ErrExpired)
+	assert.Zero(t, sms.count())
+
+	later := time.Now().Add(time.Minute)
+	_, err = q.Edit(ctx, entries[0].ID, Edit{ExpiresAt: &later})
+	require.NoError(t, err)
+	_, err = q.Replay(ctx, d, entries[0].ID)
+	require.NoError(t, err)
+	assert.Equal(t, 1, sms.count())
+}
+
+// TestQueue_Consumer tests that an undecodable record must be edited before replay
+func TestQueue_Consumer(t *testing.T) {
+	ctx := context.Background()
+	websocket := &fakeChannel{name: "websocket"}
+	q, d := newTestQueue(websocket)
+
+	require.NoError(t, q.FromConsumer(ctx, "wallet-events", []byte("\x00garbage"), errors.New("unexpected byte")))
+	entries, _ := q.List(ctx, Filter{Source: "consumer:wallet-events", Reason: ReasonDecodeFailed})
+	require.Len(t, entries, 1)
+	id := entries[0].ID
+	assert.Equal(t, []byte("\x00garbage"), entries[0].Raw)
+
+	_, err := q.Replay(ctx, d, id)
+	assert.ErrorIs(t, err, ErrInvalid)
+
+	_, err = q.Edit(ctx, id, Edit{Payload: json.RawMessage(`{"amount":`)})
+	assert.ErrorIs(t, err, ErrInvalid)
+
+	userID := uuid.New()
+	typ := "deposit_received"
+	e, err := q.Edit(ctx, id, Edit{UserID: &userID, Type: &typ, Payload: json.RawMessage(`{"amount":10}`)})
+	require.NoError(t, err)
+	assert.Nil(t, e.Raw)
+
+	_, err = q.Replay(ctx, d, id)
+	require.NoError(t, err)
+	require.Equal(t, 1, websocket.count())
+	assert.Equal(t, userID, websocket.sent[0].UserID)
+	assert.Equal(t, map[string]interface{}{"amount": float64(10)}, websocket.sent[0].Payload)
+}
+
+// TestQueue_FromHub tests that messages the hub cannot encode are dead-lettered
+func TestQueue_FromHub(t *testing.T) {
+	q, _ := newTestQueue()
+	hub := ws.NewHub(zerolog.Nop(), ws.WithDeadLetter(q.FromHub))
+	go hub.Run(t.Context())
+
+	userID := uuid.New()
+	client := ws.NewClient(hub, nil, &userID, zerolog.Nop())
+	require.NoError(t, hub.Register(client))
+
+	hub.BroadcastToUser(userID, "bet_settled", map[string]interface{}{"callback": func() {}}, ws.NotificationID("n1"))
+	require.Eventually(t, func() bool {
+		entries, _ := q.List(context.Background(), Filter{Source: SourceHub})
+		return len(entries) == 1
+	}, time.Second, 10*time.Millisecond)
+
+	entries, _ := q.List(context.Background(), Filter{Source: SourceHub})
+	e := entries[0]
+	assert.Equal(t, ReasonEncodeFailed, e.Reason)
+	assert.Equal(t, "n1", e.NotificationID)
+	assert.Equal(t, userID, e.UserID)
+	assert.Equal(t, "bet_settled", e.Type)
+	assert.NotEmpty(t, e.Raw)
+	require.Len(t, e.Attempts, 1)
+	assert.Contains(t, e.Attempts[0].Error, "unsupported type")
+}
@@ -0,0 +1,192 @@
+package dlq
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"strings"
+
+	"github.com/google/uuid"
+)
+
+// SQLStore is a durable Store in the dead_letters table. Filterable fields
+// are columns; the full entry is kept as a JSON document. Its statements
+// use SQLite syntax; open the *sql.DB with sqlite.Open. Times are kept as
+// Unix milliseconds.
+type SQLStore struct {
+	db *sql.DB
+}
+
+// NewSQLStore creates a store over db; call Migrate to create its table
+func NewSQLStore(db *sql.DB) *SQLStore {
+	return &SQLStore{db: db}
+}
+
+// Migrate creates the dead_letters table if it does not exist
+func (s *SQLStore) Migrate(ctx context.Context) error {
+	for _, stmt := range []string{
+		`CREATE TABLE IF NOT EXISTS dead_letters (
+			id         TEXT PRIMARY KEY,
+			source     TEXT NOT NULL,
+			reason     TEXT NOT NULL,
+			type       TEXT NOT NULL DEFAULT '',
+			user_id    TEXT NOT NULL DEFAULT '',
+			status     TEXT NOT NULL,
+			created_at INTEGER NOT NULL,
+			entry      BLOB NOT NULL
+		)`,
+		`CREATE INDEX IF NOT EXISTS dead_letters_status ON dead_letters (status, id)`,
+	} {
+		if _, err := s.db.ExecContext(ctx, stmt); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Add implements Store
+func (s *SQLStore) Add(ctx context.Context, e *Entry) error {
+	doc, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	_, err = s.db.ExecContext(ctx,
+		`INSERT INTO dead_letters (id, source, reason, type, user_id, status, created_at, entry) VALUES (?, ?, ?, ?, ?, ?, ?, ?)`,
+		e.ID, e.Source, e.Reason, e.Type, userColumn(e.UserID), string(e.Status), e.CreatedAt.UnixMilli(), doc)
+	return err
+}
+
+// Get implements Store
+func (s *SQLStore) Get(ctx context.Context, id string) (*Entry, error) {
+	var doc []byte
+	err := s.db.QueryRowContext(ctx, `SELECT entry FROM dead_letters WHERE id = ?`, id).Scan(&doc)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	var e Entry
+	if err := json.Unmarshal(doc, &e); err != nil {
+		return nil, err
+	}
+	return &e, nil
+}
+
+// Update implements Store
+func (s *SQLStore) Update(ctx context.Context, e *Entry) error {
+	doc, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	res, err := s.db.ExecContext(ctx,
+		`UPDATE dead_letters SET type = ?, user_id = ?, status = ?, entry = ? WHERE id = ?`,
+		e.Type, userColumn(e.UserID), string(e.Status), doc, e.ID)
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// List implements Store
+func (s *SQLStore) List(ctx context.Context, f Filter) ([]*Entry, error) {
+	where, args := filterClause(f)
+	if f.After != "" {
+		where += ` AND id > ?`
+		args = append(args, f.After)
+	}
+	query := `SELECT entry FROM dead_letters WHERE ` + where + ` ORDER BY id`
+	if f.Limit > 0 {
+		query += ` LIMIT ?`
+		args = append(args, f.Limit)
+	}
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var entries []*Entry
+	for rows.Next() {
+		var doc []byte
+		if err := rows.Scan(&doc); err != nil {
+			return nil, err
+		}
+		var e Entry
+		if err := json.Unmarshal(doc, &e); err != nil {
+			return nil, err
+		}
+		entries = append(entries, &e)
+	}
+	return entries, rows.Err()
+}
+
+// Delete implements Store
+func (s *SQLStore) Delete(ctx context.Context, id string) error {
+	res, err := s.db.ExecContext(ctx, `DELETE FROM dead_letters WHERE id = ?`, id)
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// Purge implements Store
+func (s *SQLStore) Purge(ctx context.Context, f Filter) (int, error) {
+	where, args := filterClause(f)
+	res, err := s.db.ExecContext(ctx, `DELETE FROM dead_letters WHERE `+where, args...)
+	if err != nil {
+		return 0, err
+	}
+	n, err := res.RowsAffected()
+	return int(n), err
+}
+
+// Count implements Store
+func (s *SQLStore) Count(ctx context.Context, status Status) (int, error) {
+	var n int
+	err := s.db.QueryRowContext(ctx, `SELECT COUNT(*) FROM dead_letters WHERE status = ?`, string(status)).Scan(&n)
+	return n, err
+}
+
+// filterClause builds the WHERE clause matching f, ignoring paging
+func filterClause(f Filter) (string, []interface{}) {
+	conds := []string{"1 = 1"}
+	var args []interface{}
+	add := func(cond string, arg interface{}) {
+		conds = append(conds, cond)
+		args = append(args, arg)
+	}
+	if f.Source != "" {
+		add(`source = ?`, f.Source)
+	}
+	if f.Reason != "" {
+		add(`reason = ?`, f.Reason)
+	}
+	if f.Type != "" {
+		add(`type = ?`, f.Type)
+	}
+	if f.UserID != uuid.Nil {
+		add(`user_id = ?`, f.UserID.String())
+	}
+	if f.Status != "" {
+		add(`status = ?`, string(f.Status))
+	}
+	if !f.Before.IsZero() {
+		add(`created_at < ?`, f.Before.UnixMilli())
+	}
+	return strings.Join(conds, " AND "), args
+}
+
+func userColumn(id uuid.UUID) string {
+	if id == uuid.Nil {
+		return ""
+	}
+	return id.String()
+}
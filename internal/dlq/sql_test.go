@@ -0,0 +1,54 @@
+package dlq
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/cypherlabdev/notification-service/internal/notify"
+	"github.com/cypherlabdev/notification-service/internal/sqlite"
+)
+
+func newTestSQLStore(t *testing.T, path string) *SQLStore {
+	db, err := sqlite.Open(context.Background(), path)
+	require.NoError(t, err)
+	t.Cleanup(func() { db.Close() })
+	store := NewSQLStore(db)
+	require.NoError(t, store.Migrate(context.Background()))
+	return store
+}
+
+// TestSQLStore tests filtering, paging and purging entries
+func TestSQLStore(t *testing.T) {
+	testStore(t, newTestSQLStore(t, filepath.Join(t.TempDir(), "dlq.db")))
+}
+
+// TestSQLStore_Reopen tests that entries survive reopening the database
+func TestSQLStore_Reopen(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "dlq.db")
+	e := &Entry{
+		ID:             "0190a0e0-0000-7000-8000-000000000001",
+		Source:         "channel:email",
+		Reason:         ReasonDeliveryFailed,
+		NotificationID: "n1",
+		Type:           "deposit_confirmed",
+		UserID:         uuid.New(),
+		Attempts:       []notify.Attempt{{Error: "smtp: 421"}},
+		Status:         StatusPending,
+		CreatedAt:      time.Now().UTC().Truncate(time.Millisecond),
+	}
+	require.NoError(t, newTestSQLStore(t, path).Add(ctx, e))
+
+	got, err := newTestSQLStore(t, path).Get(ctx, e.ID)
+	require.NoError(t, err)
+	assert.Equal(t, e.NotificationID, got.NotificationID)
+	assert.Equal(t, e.UserID, got.UserID)
+	assert.Equal(t, e.Attempts[0].Error, got.Attempts[0].Error)
+	assert.True(t, e.CreatedAt.Equal(got.CreatedAt))
+}
@@ -0,0 +1,149 @@
+package groups
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/google/uuid"
+)
+
+// maxNameLength bounds group names such as "syndicate:8812" or "tier:vip"
+const maxNameLength = 128
+
+// ErrInvalidName is returned for empty, overlong or malformed group names
+var ErrInvalidName = errors.New("invalid group name")
+
+// Store holds server-managed group membership. Membership is looked up when
+// a group message is sent, so changes reach users who are already connected.
+type Store interface {
+	AddMembers(ctx context.Context, group string, userIDs ...uuid.UUID) error
+	RemoveMembers(ctx context.Context, group string, userIDs ...uuid.UUID) error
+	Members(ctx context.Context, group string) ([]uuid.UUID, error)
+	GroupsOf(ctx context.Context, userID uuid.UUID) ([]string, error)
+	DeleteGroup(ctx context.Context, group string) error
+}
+
+// ValidateName checks that a group name is 1-128 characters of letters,
+// digits and ":_.-"
+func ValidateName(group string) error {
+	if group == "" || len(group) > maxNameLength {
+		return fmt.Errorf("%w: must be 1-%d characters", ErrInvalidName, maxNameLength)
+	}
+	for _, r := range group {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9':
+		case r == ':' || r == '_' || r == '.' || r == '-':
+		default:
+			return fmt.Errorf("%w: unexpected character %q", ErrInvalidName, r)
+		}
+	}
+	return nil
+}
+
+// MemoryStore is a Store for a single instance
+type MemoryStore struct {
+	members map[string]map[uuid.UUID]bool
+	groups  map[uuid.UUID]map[string]bool
+	mu      sync.RWMutex
+}
+
+// NewMemoryStore creates an empty in-memory store
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		members: make(map[string]map[uuid.UUID]bool),
+		groups:  make(map[uuid.UUID]map[string]bool),
+	}
+}
+
+// AddMembers adds users to a group, creating it if needed
+func (s *MemoryStore) AddMembers(_ context.Context, group string, userIDs ...uuid.UUID) error {
+	if err := ValidateName(group); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	members := s.members[group]
+	if members == nil {
+		members = make(map[uuid.UUID]bool)
+		s.members[group] = members
+	}
+	for _, userID := range userIDs {
+		members[userID] = true
+		if s.groups[userID] == nil {
+			s.groups[userID] = make(map[string]bool)
+		}
+		s.groups[userID][group] = true
+	}
+	return nil
+}
+
+// RemoveMembers removes users from a group; removing non-members is a no-op
+func (s *MemoryStore) RemoveMembers(_ context.Context, group string, userIDs ...uuid.UUID) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, userID := range userIDs {
+		s.remove(group, userID)
+	}
+	return nil
+}
+
+// Members returns the group's members in a stable order
+func (s *MemoryStore) Members(_ context.Context, group string) ([]uuid.UUID, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	members := make([]uuid.UUID, 0, len(s.members[group]))
+	for userID := range s.members[group] {
+		members = append(members, userID)
+	}
+	sort.Slice(members, func(i, j int) bool {
+		return members[i].String() < members[j].String()
+	})
+	return members, nil
+}
+
+// GroupsOf returns the groups a user belongs to, sorted
+func (s *MemoryStore) GroupsOf(_ context.Context, userID uuid.UUID) ([]string, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	groups := make([]string, 0, len(s.groups[userID]))
+	for group := range s.groups[userID] {
+		groups = append(groups, group)
+	}
+	sort.Strings(groups)
+	return groups, nil
+}
+
+// DeleteGroup removes a group and all of its memberships
+func (s *MemoryStore) DeleteGroup(_ context.Context, group string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for userID := range s.members[group] {
+		s.remove(group, userID)
+	}
+	return nil
+}
+
+// remove must be called with s.mu held
+func (s *MemoryStore) remove(group string, userID uuid.UUID) {
+	if members := s.members[group]; members != nil {
+		delete(members, userID)
+		if len(members) == 0 {
+			delete(s.members, group)
+		}
+	}
+	if groups := s.groups[userID]; groups != nil {
+		delete(groups, group)
+		if len(groups) == 0 {
+			delete(s.groups, userID)
+		}
+	}
+}
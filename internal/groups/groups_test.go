@@ -0,0 +1,64 @@
+package groups
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestValidateName tests group name validation
+func TestValidateName(t *testing.T) {
+	for _, name := range []string{"vip", "tier:vip", "tournament:42", "staff.risk-ops", "a_b"} {
+		assert.NoError(t, ValidateName(name), name)
+	}
+	for _, name := range []string{"", "with space", "slash/name", strings.Repeat("x", 129)} {
+		assert.ErrorIs(t, ValidateName(name), ErrInvalidName, name)
+	}
+}
+
+// TestMemoryStore_Membership tests adding, listing and removing members
+func TestMemoryStore_Membership(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemoryStore()
+	alice, bob := uuid.New(), uuid.New()
+
+	require.NoError(t, store.AddMembers(ctx, "syndicate:1", alice, bob))
+	require.NoError(t, store.AddMembers(ctx, "vip", alice))
+	require.NoError(t, store.AddMembers(ctx, "vip", alice)) // idempotent
+
+	members, err := store.Members(ctx, "syndicate:1")
+	require.NoError(t, err)
+	assert.ElementsMatch(t, []uuid.UUID{alice, bob}, members)
+
+	groups, err := store.GroupsOf(ctx, alice)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"syndicate:1", "vip"}, groups)
+
+	require.NoError(t, store.RemoveMembers(ctx, "syndicate:1", bob, uuid.New()))
+	members, _ = store.Members(ctx, "syndicate:1")
+	assert.Equal(t, []uuid.UUID{alice}, members)
+	groups, _ = store.GroupsOf(ctx, bob)
+	assert.Empty(t, groups)
+
+	assert.ErrorIs(t, store.AddMembers(ctx, "bad name", alice), ErrInvalidName)
+}
+
+// TestMemoryStore_DeleteGroup tests that deleting a group drops its memberships
+func TestMemoryStore_DeleteGroup(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemoryStore()
+	alice := uuid.New()
+
+	require.NoError(t, store.AddMembers(ctx, "tournament:7", alice))
+	require.NoError(t, store.AddMembers(ctx, "vip", alice))
+	require.NoError(t, store.DeleteGroup(ctx, "tournament:7"))
+
+	members, _ := store.Members(ctx, "tournament:7")
+	assert.Empty(t, members)
+	groups, _ := store.GroupsOf(ctx, alice)
+	assert.Equal(t, []string{"vip"}, groups)
+}
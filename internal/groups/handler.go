@@ -0,0 +1,183 @@
+package groups
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/google/uuid"
+	"github.com/rs/zerolog"
+)
+
+// maxBatch bounds the users added or removed by one request
+const maxBatch = 1000
+
+// membersRequest is the body of batch membership changes
+type membersRequest struct {
+	UserIDs []uuid.UUID `json:"user_ids"`
+}
+
+// membersResponse lists a group's members
+type membersResponse struct {
+	Group   string      `json:"group"`
+	Members []uuid.UUID `json:"members"`
+}
+
+// userGroupsResponse lists the groups of a user
+type userGroupsResponse struct {
+	UserID uuid.UUID `json:"user_id"`
+	Groups []string  `json:"groups"`
+}
+
+// Handler serves the group membership API:
+//
+//	GET    /groups/{group}/members
+//	POST   /groups/{group}/members            {"user_ids": [...]} adds users
+//	POST   /groups/{group}/members/remove     {"user_ids": [...]} removes users
+//	PUT    /groups/{group}/members/{userID}
+//	DELETE /groups/{group}/members/{userID}
+//	DELETE /groups/{group}
+//	GET    /users/{userID}/groups
+type Handler struct {
+	store  Store
+	logger zerolog.Logger
+	mux    *http.ServeMux
+}
+
+// NewHandler creates the membership API backed by store
+func NewHandler(store Store, logger zerolog.Logger) *Handler {
+	h := &Handler{
+		store:  store,
+		logger: logger.With().Str("component", "groups_api").Logger(),
+		mux:    http.NewServeMux(),
+	}
+	h.mux.HandleFunc("GET /groups/{group}/members", h.listMembers)
+	h.mux.HandleFunc("POST /groups/{group}/members", h.addMembers)
+	h.mux.HandleFunc("POST /groups/{group}/members/remove", h.removeMembers)
+	h.mux.HandleFunc("PUT /groups/{group}/members/{userID}", h.addMember)
+	h.mux.HandleFunc("DELETE /groups/{group}/members/{userID}", h.removeMember)
+	h.mux.HandleFunc("DELETE /groups/{group}", h.deleteGroup)
+	h.mux.HandleFunc("GET /users/{userID}/groups", h.userGroups)
+	return h
+}
+
+// ServeHTTP implements http.Handler
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	h.mux.ServeHTTP(w, r)
+}
+
+func (h *Handler) listMembers(w http.ResponseWriter, r *http.Request) {
+	group := r.PathValue("group")
+	members, err := h.store.Members(r.Context(), group)
+	if err != nil {
+		h.storeError(w, err, "failed to list group members")
+		return
+	}
+	writeJSON(w, http.StatusOK, membersResponse{Group: group, Members: members})
+}
+
+func (h *Handler) addMembers(w http.ResponseWriter, r *http.Request) {
+	userIDs, ok := decodeMembers(w, r)
+	if !ok {
+		return
+	}
+	if err := h.store.AddMembers(r.Context(), r.PathValue("group"), userIDs...); err != nil {
+		h.storeError(w, err, "failed to add group members")
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *Handler) removeMembers(w http.ResponseWriter, r *http.Request) {
+	userIDs, ok := decodeMembers(w, r)
+	if !ok {
+		return
+	}
+	if err := h.store.RemoveMembers(r.Context(), r.PathValue("group"), userIDs...); err != nil {
+		h.storeError(w, err, "failed to remove group members")
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *Handler) addMember(w http.ResponseWriter, r *http.Request) {
+	userID, ok := pathUserID(w, r)
+	if !ok {
+		return
+	}
+	if err := h.store.AddMembers(r.Context(), r.PathValue("group"), userID); err != nil {
+		h.storeError(w, err, "failed to add group member")
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *Handler) removeMember(w http.ResponseWriter, r *http.Request) {
+	userID, ok := pathUserID(w, r)
+	if !ok {
+		return
+	}
+	if err := h.store.RemoveMembers(r.Context(), r.PathValue("group"), userID); err != nil {
+		h.storeError(w, err, "failed to remove group member")
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *Handler) deleteGroup(w http.ResponseWriter, r *http.Request) {
+	if err := h.store.DeleteGroup(r.Context(), r.PathValue("group")); err != nil {
+		h.storeError(w, err, "failed to delete group")
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *Handler) userGroups(w http.ResponseWriter, r *http.Request) {
+	userID, ok := pathUserID(w, r)
+	if !ok {
+		return
+	}
+	groups, err := h.store.GroupsOf(r.Context(), userID)
+	if err != nil {
+		h.storeError(w, err, "failed to list user groups")
+		return
+	}
+	writeJSON(w, http.StatusOK, userGroupsResponse{UserID: userID, Groups: groups})
+}
+
+func (h *Handler) storeError(w http.ResponseWriter, err error, msg string) {
+	if errors.Is(err, ErrInvalidName) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	h.logger.Error().Err(err).Msg(msg)
+	http.Error(w, "internal error", http.StatusInternalServerError)
+}
+
+func decodeMembers(w http.ResponseWriter, r *http.Request) ([]uuid.UUID, bool) {
+	var req membersRequest
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 64<<10)).Decode(&req); err != nil {
+		http.Error(w, "invalid body: "+err.Error(), http.StatusBadRequest)
+		return nil, false
+	}
+	if len(req.UserIDs) == 0 || len(req.UserIDs) > maxBatch {
+		http.Error(w, "user_ids must list 1-1000 users", http.StatusBadRequest)
+		return nil, false
+	}
+	return req.UserIDs, true
+}
+
+func pathUserID(w http.ResponseWriter, r *http.Request) (uuid.UUID, bool) {
+	userID, err := uuid.Parse(r.PathValue("userID"))
+	if err != nil {
+		http.Error(w, "invalid user id", http.StatusBadRequest)
+		return uuid.Nil, false
+	}
+	return userID, true
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
@@ -0,0 +1,70 @@
+package groups
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func do(t *testing.T, h http.Handler, method, path, body string) *httptest.ResponseRecorder {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(method, path, strings.NewReader(body)))
+	return rec
+}
+
+// TestHandler_Membership tests the membership API end to end
+func TestHandler_Membership(t *testing.T) {
+	store := NewMemoryStore()
+	h := NewHandler(store, zerolog.Nop())
+	alice, bob, carol := uuid.New(), uuid.New(), uuid.New()
+
+	rec := do(t, h, http.MethodPost, "/groups/syndicate:1/members", `{"user_ids":["`+alice.String()+`","`+bob.String()+`"]}`)
+	require.Equal(t, http.StatusNoContent, rec.Code)
+
+	rec = do(t, h, http.MethodPut, "/groups/syndicate:1/members/"+carol.String(), "")
+	require.Equal(t, http.StatusNoContent, rec.Code)
+
+	rec = do(t, h, http.MethodPost, "/groups/syndicate:1/members/remove", `{"user_ids":["`+bob.String()+`"]}`)
+	require.Equal(t, http.StatusNoContent, rec.Code)
+
+	rec = do(t, h, http.MethodGet, "/groups/syndicate:1/members", "")
+	require.Equal(t, http.StatusOK, rec.Code)
+	var members membersResponse
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &members))
+	assert.Equal(t, "syndicate:1", members.Group)
+	assert.ElementsMatch(t, []uuid.UUID{alice, carol}, members.Members)
+
+	rec = do(t, h, http.MethodDelete, "/groups/syndicate:1/members/"+carol.String(), "")
+	require.Equal(t, http.StatusNoContent, rec.Code)
+
+	rec = do(t, h, http.MethodGet, "/users/"+alice.String()+"/groups", "")
+	require.Equal(t, http.StatusOK, rec.Code)
+	var groups userGroupsResponse
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &groups))
+	assert.Equal(t, []string{"syndicate:1"}, groups.Groups)
+
+	rec = do(t, h, http.MethodDelete, "/groups/syndicate:1", "")
+	require.Equal(t, http.StatusNoContent, rec.Code)
+	got, _ := store.Members(context.Background(), "syndicate:1")
+	assert.Empty(t, got)
+}
+
+// TestHandler_BadRequests tests validation of paths and bodies
+func TestHandler_BadRequests(t *testing.T) {
+	h := NewHandler(NewMemoryStore(), zerolog.Nop())
+
+	assert.Equal(t, http.StatusBadRequest, do(t, h, http.MethodPut, "/groups/vip/members/not-a-uuid", "").Code)
+	assert.Equal(t, http.StatusBadRequest, do(t, h, http.MethodPost, "/groups/vip/members", `{"user_ids":[]}`).Code)
+	assert.Equal(t, http.StatusBadRequest, do(t, h, http.MethodPost, "/groups/vip/members", `not json`).Code)
+	assert.Equal(t, http.StatusBadRequest, do(t, h, http.MethodPut, "/groups/bad%20name/members/"+uuid.New().String(), "").Code)
+	assert.Equal(t, http.StatusMethodNotAllowed, do(t, h, http.MethodPatch, "/groups/vip/members", "").Code)
+}
@@ -0,0 +1,168 @@
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/rs/zerolog"
+)
+
+const defaultCheckTimeout = 2 * time.Second
+
+// Check reports whether a dependency is usable, returning nil when healthy
+type Check func(ctx context.Context) error
+
+type namedCheck struct {
+	name  string
+	check Check
+}
+
+// CheckResult is the outcome of a single check in the JSON detail view
+type CheckResult struct {
+	Status     string  `json:"status"`
+	Error      string  `json:"error,omitempty"`
+	DurationMS float64 `json:"duration_ms"`
+}
+
+// Report is the JSON body returned by the liveness and readiness endpoints
+type Report struct {
+	Status   string                 `json:"status"`
+	Draining bool                   `json:"draining,omitempty"`
+	Checks   map[string]CheckResult `json:"checks"`
+}
+
+// Checker aggregates liveness and readiness checks for the service
+type Checker struct {
+	liveness  []namedCheck
+	readiness []namedCheck
+	draining  atomic.Bool
+	timeout   time.Duration
+	logger    zerolog.Logger
+	mu        sync.RWMutex
+}
+
+// NewChecker creates a new health checker
+func NewChecker(logger zerolog.Logger) *Checker {
+	return &Checker{
+		timeout: defaultCheckTimeout,
+		logger:  logger.With().Str("component", "health").Logger(),
+	}
+}
+
+// AddLivenessCheck registers a check that must pass for the process to be considered alive
+func (c *Checker) AddLivenessCheck(name string, check Check) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.liveness = append(c.liveness, namedCheck{name: name, check: check})
+}
+
+// AddReadinessCheck registers a check that must pass before traffic is routed to the pod
+func (c *Checker) AddReadinessCheck(name string, check Check) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.readiness = append(c.readiness, namedCheck{name: name, check: check})
+}
+
+// StartDraining marks the service as shutting down so readiness starts failing
+func (c *Checker) StartDraining() {
+	if !c.draining.Swap(true) {
+		c.logger.Info().Msg("draining, readiness will report unavailable")
+	}
+}
+
+// Draining reports whether StartDraining has been called
+func (c *Checker) Draining() bool {
+	return c.draining.Load()
+}
+
+// Liveness runs the liveness checks
+func (c *Checker) Liveness(ctx context.Context) Report {
+	c.mu.RLock()
+	checks := c.liveness
+	c.mu.RUnlock()
+
+	return c.run(ctx, checks, false)
+}
+
+// Readiness runs the readiness checks, failing while draining
+func (c *Checker) Readiness(ctx context.Context) Report {
+	c.mu.RLock()
+	checks := c.readiness
+	c.mu.RUnlock()
+
+	return c.run(ctx, checks, c.Draining())
+}
+
+// LivenessHandler serves the liveness report
+func (c *Checker) LivenessHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		writeReport(w, c.Liveness(r.Context()))
+	})
+}
+
+// ReadinessHandler serves the readiness report
+func (c *Checker) ReadinessHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		writeReport(w, c.Readiness(r.Context()))
+	})
+}
+
+func (c *Checker) run(ctx context.Context, checks []namedCheck, draining bool) Report {
+	report := Report{
+		Status:   "ok",
+		Draining: draining,
+		Checks:   make(map[string]CheckResult, len(checks)),
+	}
+	if draining {
+		report.Status = "fail"
+	}
+
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	for _, nc := range checks {
+		wg.Add(1)
+		go func(nc namedCheck) {
+			defer wg.Done()
+
+			checkCtx, cancel := context.WithTimeout(ctx, c.timeout)
+			defer cancel()
+
+			start := time.Now()
+			err := nc.check(checkCtx)
+			result := CheckResult{
+				Status:     "ok",
+				DurationMS: float64(time.Since(start).Microseconds()) / 1000,
+			}
+			if err != nil {
+				result.Status = "fail"
+				result.Error = err.Error()
+				c.logger.Warn().Err(err).Str("check", nc.name).Msg("health check failed")
+			}
+
+			mu.Lock()
+			report.Checks[nc.name] = result
+			if err != nil {
+				report.Status = "fail"
+			}
+			mu.Unlock()
+		}(nc)
+	}
+	wg.Wait()
+
+	return report
+}
+
+func writeReport(w http.ResponseWriter, report Report) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	if report.Status != "ok" {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	} else {
+		w.WriteHeader(http.StatusOK)
+	}
+	json.NewEncoder(w).Encode(report)
+}
@@ -0,0 +1,91 @@
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func getReport(t *testing.T, h http.Handler) (int, Report) {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+
+	var report Report
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &report))
+	assert.Equal(t, "application/json", rec.Header().Get("Content-Type"))
+	return rec.Code, report
+}
+
+// TestChecker_NoChecks tests that an empty checker reports healthy
+func TestChecker_NoChecks(t *testing.T) {
+	checker := NewChecker(zerolog.Nop())
+
+	code, report := getReport(t, checker.LivenessHandler())
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, "ok", report.Status)
+
+	code, report = getReport(t, checker.ReadinessHandler())
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, "ok", report.Status)
+}
+
+// TestChecker_FailingCheck tests that a failing check is reported in the detail view
+func TestChecker_FailingCheck(t *testing.T) {
+	checker := NewChecker(zerolog.Nop())
+	checker.AddReadinessCheck("storage", func(ctx context.Context) error {
+		return errors.New("connection refused")
+	})
+	checker.AddReadinessCheck("hub", func(ctx context.Context) error {
+		return nil
+	})
+
+	code, report := getReport(t, checker.ReadinessHandler())
+	assert.Equal(t, http.StatusServiceUnavailable, code)
+	assert.Equal(t, "fail", report.Status)
+	assert.Equal(t, "fail", report.Checks["storage"].Status)
+	assert.Equal(t, "connection refused", report.Checks["storage"].Error)
+	assert.Equal(t, "ok", report.Checks["hub"].Status)
+
+	// Liveness is unaffected by readiness checks
+	code, _ = getReport(t, checker.LivenessHandler())
+	assert.Equal(t, http.StatusOK, code)
+}
+
+// TestChecker_Timeout tests that a hanging check fails once the timeout elapses
+func TestChecker_Timeout(t *testing.T) {
+	checker := NewChecker(zerolog.Nop())
+	checker.timeout = 50 * time.Millisecond
+	checker.AddLivenessCheck("hub", func(ctx context.Context) error {
+		<-ctx.Done()
+		return ctx.Err()
+	})
+
+	code, report := getReport(t, checker.LivenessHandler())
+	assert.Equal(t, http.StatusServiceUnavailable, code)
+	assert.Equal(t, context.DeadlineExceeded.Error(), report.Checks["hub"].Error)
+}
+
+// TestChecker_Draining tests that draining fails readiness but not liveness
+func TestChecker_Draining(t *testing.T) {
+	checker := NewChecker(zerolog.Nop())
+	assert.False(t, checker.Draining())
+
+	checker.StartDraining()
+	assert.True(t, checker.Draining())
+
+	code, report := getReport(t, checker.ReadinessHandler())
+	assert.Equal(t, http.StatusServiceUnavailable, code)
+	assert.True(t, report.Draining)
+
+	code, _ = getReport(t, checker.LivenessHandler())
+	assert.Equal(t, http.StatusOK, code)
+}
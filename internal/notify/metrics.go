@@ -0,0 +1,22 @@
+package notify
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var (
+	dispatched = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "notification",
+		Subsystem: "dispatch",
+		Name:      "sends_total",
+		Help:      "Notifications handed to a channel, by channel and result.",
+	}, []string{"channel", "result"})
+
+	expired = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "notification",
+		Subsystem: "dispatch",
+		Name:      "expired_total",
+		Help:      "Notifications dropped at dispatch because their expiry had passed, by type.",
+	}, []string{"type"})
+)
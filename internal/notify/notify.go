@@ -0,0 +1,367 @@
+// Package notify routes notifications to the channels that deliver them to
+// users, such as the WebSocket hub.
+package notify
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/rs/zerolog"
+
+	"github.com/cypherlabdev/notification-service/internal/dedup"
+)
+
+// Notification is a message for one user, delivered over every channel
+// configured on the dispatcher
+type Notification struct {
+	ID     string
+	UserID uuid.UUID
+	Type   string
+	// Category groups types for user preferences such as digests, e.g.
+	// "bets" for bet_settled and bet_voided; the type is used if empty
+	Category  string
+	Payload   interface{}
+	CreatedAt time.Time
+	// Source names what produced the notification, e.g. "campaign:<id>"
+	Source string
+	// ExpiresAt, if set, is when the notification becomes stale; it is
+	// dropped rather than delivered late
+	ExpiresAt time.Time
+	// IdempotencyKey, if set, suppresses repeats of the same notification
+	// within the dispatcher's dedup window, e.g. on Kafka redelivery
+	IdempotencyKey string
+	// OrderingKey and Sequence, if set, deliver the notifications of one
+	// key (e.g. "order:<id>") in Sequence order however they arrive
+	OrderingKey string
+	Sequence    uint64
+	// Channels, if set, limits delivery to the named channels, e.g. when
+	// replaying a notification that failed on one of them
+	Channels []string
+}
+
+var (
+	// ErrExpired is returned when dispatching a notification past its expiry
+	ErrExpired = errors.New("notification expired")
+	// ErrDuplicate is returned for a notification whose idempotency key was
+	// already dispatched within the dedup window
+	ErrDuplicate = errors.New("duplicate notification")
+)
+
+// Expired reports whether the notification's expiry has passed
+func (n *Notification) Expired(now time.Time) bool {
+	return !n.ExpiresAt.IsZero() && !now.Before(n.ExpiresAt)
+}
+
+// Attempt is one try at delivering a notification over a channel
+type Attempt struct {
+	At    time.Time `json:"at"`
+	Error string    `json:"error"`
+}
+
+// RetryError is returned by a channel that retries internally once it has
+// given up, with the history of its attempts
+type RetryError struct {
+	Attempts []Attempt
+	Err      error // the last attempt's error
+}
+
+func (e *RetryError) Error() string {
+	return fmt.Sprintf("gave up after %d attempts: %v", len(e.Attempts), e.Err)
+}
+
+func (e *RetryError) Unwrap() error { return e.Err }
+
+// PartialError is returned when a notification failed on some channels
+// but reached others. The failures are dead-lettered and the idempotency
+// key stays claimed, so the notification must not be retried as a whole.
+type PartialError struct {
+	// Delivered lists the channels that sent, queued or skipped it
+	Delivered []string
+	// Failed maps each failed channel to its error
+	Failed map[string]error
+	err    error // the failures, joined in channel order
+}
+
+func (e *PartialError) Error() string { return e.err.Error() }
+
+func (e *PartialError) Unwrap() error { return e.err }
+
+// DeadLetterSink receives notifications a channel failed to deliver, so
+// they can be inspected and replayed rather than lost
+type DeadLetterSink interface {
+	DeadLetter(ctx context.Context, n *Notification, channel string, err error)
+}
+
+// CategoryOrType returns the notification's category, or its type if it
+// has none
+func (n *Notification) CategoryOrType() string {
+	if n.Category != "" {
+		return n.Category
+	}
+	return n.Type
+}
+
+// Holder takes notifications out of immediate delivery, e.g. to batch them
+// into a digest or defer them past a user's quiet hours. A holder that
+// returns true owns n: it either delivers it later with Dispatcher.Resume
+// or replaces it with something else, such as a summary.
+type Holder interface {
+	Hold(ctx context.Context, n *Notification) (bool, error)
+}
+
+// Scoped is implemented by holders that apply only to some channels, such
+// as quiet hours deferring what reaches the user's device but not
+// webhooks. A notification it holds is still sent over the other channels
+// at once, without the holders after it, and is resumed over its channels
+// alone. A holder whose Channels returns none applies to every channel.
+type Scoped interface {
+	Channels() []string
+}
+
+// scope returns the channels h applies to, or nil for all of them
+func scope(h Holder) []string {
+	if s, ok := h.(Scoped); ok {
+		return s.Channels()
+	}
+	return nil
+}
+
+// Channel delivers notifications over one transport
+type Channel interface {
+	Name() string
+	Send(ctx context.Context, n *Notification) error
+}
+
+// Option configures a Dispatcher
+type Option func(*Dispatcher)
+
+// WithChannels adds channels to deliver notifications over
+func WithChannels(channels ...Channel) Option {
+	return func(d *Dispatcher) {
+		d.channels = append(d.channels, channels...)
+	}
+}
+
+// WithDedup suppresses notifications whose idempotency key was already
+// dispatched within window
+func WithDedup(store dedup.Store, window time.Duration) Option {
+	return func(d *Dispatcher) {
+		d.dedup = store
+		d.dedupWindow = window
+	}
+}
+
+// WithDeadLetters hands notifications that a channel failed to deliver to sink
+func WithDeadLetters(sink DeadLetterSink) Option {
+	return func(d *Dispatcher) {
+		d.deadLetters = sink
+	}
+}
+
+// WithTracker records the progress of every notification with t
+func WithTracker(t Tracker) Option {
+	return func(d *Dispatcher) {
+		d.tracker = t
+	}
+}
+
+// WithHolders runs notifications past holders, in order, before they
+// reach the channels
+func WithHolders(holders ...Holder) Option {
+	return func(d *Dispatcher) {
+		d.holders = append(d.holders, holders...)
+	}
+}
+
+// Dispatcher fans notifications out to its channels
+type Dispatcher struct {
+	channels    []Channel
+	holders     []Holder
+	dedup       dedup.Store
+	dedupWindow time.Duration
+	deadLetters DeadLetterSink
+	tracker     Tracker
+	logger      zerolog.Logger
+	now         func() time.Time
+}
+
+// NewDispatcher creates a dispatcher
+func NewDispatcher(logger zerolog.Logger, opts ...Option) *Dispatcher {
+	d := &Dispatcher{
+		logger: logger.With().Str("component", "dispatcher").Logger(),
+		now:    time.Now,
+	}
+	for _, opt := range opts {
+		opt(d)
+	}
+	return d
+}
+
+// Dispatch sends n over every channel. It fills in a missing ID and
+// creation time, and returns the errors of the channels that failed. A
+// notification that failed on every channel may be retried with the same
+// idempotency key.
+func (d *Dispatcher) Dispatch(ctx context.Context, n *Notification) error {
+	if n.UserID == uuid.Nil {
+		return errors.New("notification has no user")
+	}
+	if n.ID == "" {
+		n.ID = uuid.New().String()
+	}
+	now := d.now()
+	if n.CreatedAt.IsZero() {
+		n.CreatedAt = now
+	}
+	if n.Expired(now) {
+		expired.WithLabelValues(n.Type).Inc()
+		d.track(n, "", StateFailed, ErrExpired.Error())
+		return ErrExpired
+	}
+	if d.dedup != nil && n.IdempotencyKey != "" {
+		claimed, _, err := d.dedup.Reserve(ctx, n.IdempotencyKey, nil, d.dedupWindow)
+		if err != nil {
+			// Delivering twice is better than not at all
+			d.logger.Warn().Err(err).Str("idempotency_key", n.IdempotencyKey).Msg("dedup store unavailable")
+		} else if !claimed {
+			dedup.CountDuplicate("dispatch")
+			return ErrDuplicate
+		}
+	}
+	d.track(n, "", StateAccepted, "")
+	return d.deliver(ctx, n, 0)
+}
+
+// Resume continues dispatching a notification that holder held: the
+// holders after it run, then the channels. Its idempotency key is not
+// checked again.
+func (d *Dispatcher) Resume(ctx context.Context, n *Notification, holder Holder) error {
+	i := slices.Index(d.holders, holder)
+	if i < 0 {
+		return errors.New("notification resumed by an unknown holder")
+	}
+	if n.Expired(d.now()) {
+		expired.WithLabelValues(n.Type).Inc()
+		d.track(n, "", StateFailed, ErrExpired.Error())
+		return ErrExpired
+	}
+	if channels := scope(holder); len(channels) > 0 {
+		// The other channels had it when it was held
+		if len(n.Channels) == 0 {
+			n.Channels = channels
+		} else {
+			n.Channels = slices.DeleteFunc(slices.Clone(n.Channels), func(name string) bool { return !slices.Contains(channels, name) })
+		}
+	}
+	return d.deliver(ctx, n, i+1)
+}
+
+// deliver runs n past the holders from the given index on and sends it
+// over the channels unless one of them takes it
+func (d *Dispatcher) deliver(ctx context.Context, n *Notification, from int) error {
+	for _, h := range d.holders[from:] {
+		var others []string
+		if channels := scope(h); len(channels) > 0 {
+			var in []string
+			in, others = d.split(n, channels)
+			if len(in) == 0 {
+				continue
+			}
+		}
+		held, err := h.Hold(ctx, n)
+		if err != nil {
+			// Delivering now is better than losing it
+			d.logger.Warn().Err(err).Str("notification_id", n.ID).Str("type", n.Type).Msg("holder failed, delivering now")
+			continue
+		}
+		if held {
+			d.track(n, "", StateAccepted, "held for later delivery")
+			if len(others) == 0 {
+				return nil
+			}
+			rest := *n
+			rest.Channels = others
+			return d.send(ctx, &rest)
+		}
+	}
+	return d.send(ctx, n)
+}
+
+// split divides the channels n is for into those in names and the others
+func (d *Dispatcher) split(n *Notification, names []string) (in, others []string) {
+	for _, ch := range d.channels {
+		switch {
+		case len(n.Channels) > 0 && !slices.Contains(n.Channels, ch.Name()):
+		case slices.Contains(names, ch.Name()):
+			in = append(in, ch.Name())
+		default:
+			others = append(others, ch.Name())
+		}
+	}
+	return in, others
+}
+
+// send delivers n over the channels it is for
+func (d *Dispatcher) send(ctx context.Context, n *Notification) error {
+	var errs []error
+	var delivered []string
+	failed := make(map[string]error)
+	for _, ch := range d.channels {
+		if len(n.Channels) > 0 && !slices.Contains(n.Channels, ch.Name()) {
+			continue
+		}
+		if s, ok := ch.(Selective); ok && !s.Wants(ctx, n) {
+			continue
+		}
+		err := ch.Send(ctx, n)
+		var skip *SkipError
+		if errors.As(err, &skip) {
+			dispatched.WithLabelValues(ch.Name(), "skipped").Inc()
+			d.track(n, ch.Name(), skip.State, skip.Reason)
+			delivered = append(delivered, ch.Name())
+			continue
+		}
+		if err != nil {
+			dispatched.WithLabelValues(ch.Name(), "error").Inc()
+			d.track(n, ch.Name(), StateFailed, err.Error())
+			errs = append(errs, fmt.Errorf("%s: %w", ch.Name(), err))
+			failed[ch.Name()] = err
+			if d.deadLetters != nil {
+				d.deadLetters.DeadLetter(ctx, n, ch.Name(), err)
+			}
+			continue
+		}
+		dispatched.WithLabelValues(ch.Name(), "ok").Inc()
+		delivered = append(delivered, ch.Name())
+		if q, ok := ch.(Queuer); ok && q.Queues() {
+			d.track(n, ch.Name(), StateQueued, "")
+		} else {
+			d.track(n, ch.Name(), StateSent, "")
+		}
+	}
+	if len(errs) == 0 {
+		return nil
+	}
+	err := errors.Join(errs...)
+	d.logger.Warn().Err(err).Str("notification_id", n.ID).Str("type", n.Type).Msg("notification not delivered on every channel")
+	if len(delivered) > 0 {
+		return &PartialError{Delivered: delivered, Failed: failed, err: err}
+	}
+	// Nothing went out, so the notification can be retried
+	if d.dedup != nil && n.IdempotencyKey != "" {
+		if err := d.dedup.Release(ctx, n.IdempotencyKey); err != nil {
+			d.logger.Warn().Err(err).Str("idempotency_key", n.IdempotencyKey).Msg("failed to release idempotency key")
+		}
+	}
+	return err
+}
+
+// track records a step in n's delivery, if a tracker is configured
+func (d *Dispatcher) track(n *Notification, channel string, state State, reason string) {
+	if d.tracker != nil {
+		d.tracker.Track(n, channel, state, reason)
+	}
+}
@@ -0,0 +1,288 @@
+package notify
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/cypherlabdev/notification-service/internal/dedup"
+	ws "github.com/cypherlabdev/notification-service/internal/websocket"
+)
+
+// fakeChannel records notifications and optionally fails
+type fakeChannel struct {
+	name string
+	err  error
+	sent []*Notification
+	mu   sync.Mutex
+}
+
+func (c *fakeChannel) Name() string { return c.name }
+
+func (c *fakeChannel) Send(_ context.Context, n *Notification) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.err != nil {
+		return c.err
+	}
+	c.sent = append(c.sent, n)
+	return nil
+}
+
+// TestDispatcher_Dispatch tests fan-out and error reporting across channels
+func TestDispatcher_Dispatch(t *testing.T) {
+	ok := &fakeChannel{name: "ok"}
+	broken := &fakeChannel{name: "broken", err: errors.New("down")}
+	d := NewDispatcher(zerolog.Nop(), WithChannels(ok, broken))
+
+	n := &Notification{UserID: uuid.New(), Type: "bet_settled"}
+	err := d.Dispatch(context.Background(), n)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "broken: down")
+	assert.NotEmpty(t, n.ID)
+	assert.False(t, n.CreatedAt.IsZero())
+	require.Len(t, ok.sent, 1)
+	assert.Same(t, n, ok.sent[0])
+
+	assert.Error(t, d.Dispatch(context.Background(), &Notification{Type: "no_user"}))
+}
+
+// TestDispatcher_Expired tests that stale notifications reach no channel
+func TestDispatcher_Expired(t *testing.T) {
+	ch := &fakeChannel{name: "ok"}
+	d := NewDispatcher(zerolog.Nop(), WithChannels(ch))
+
+	err := d.Dispatch(context.Background(), &Notification{UserID: uuid.New(), Type: "odds", ExpiresAt: time.Now().Add(-time.Second)})
+	assert.ErrorIs(t, err, ErrExpired)
+	assert.Empty(t, ch.sent)
+
+	require.NoError(t, d.Dispatch(context.Background(), &Notification{UserID: uuid.New(), Type: "odds", ExpiresAt: time.Now().Add(time.Minute)}))
+	assert.Len(t, ch.sent, 1)
+}
+
+// TestWebSocketChannel_Send tests delivery through the hub
+func TestWebSocketChannel_Send(t *testing.T) {
+	hub := ws.NewHub(zerolog.Nop())
+	go hub.Run(t.Context())
+
+	userID := uuid.New()
+	rec := ws.NewRecorder(&userID)
+	require.NoError(t, hub.Register(rec))
+
+	d := NewDispatcher(zerolog.Nop(), WithChannels(NewWebSocketChannel(hub)))
+	require.NoError(t, d.Dispatch(context.Background(), &Notification{UserID: userID, Type: "promo", Payload: "hi"}))
+	require.True(t, rec.WaitFor(1, time.Second))
+	assert.Equal(t, []string{"promo"}, rec.Types())
+}
+
+// TestDispatcher_Dedup tests that repeats of an idempotency key are suppressed
+// and that a notification no channel accepted can be retried
+func TestDispatcher_Dedup(t *testing.T) {
+	ch := &fakeChannel{name: "ws"}
+	d := NewDispatcher(zerolog.Nop(), WithChannels(ch), WithDedup(dedup.NewMemoryStore(0), time.Hour))
+	userID := uuid.New()
+	ctx := context.Background()
+
+	deposit := func() *Notification {
+		return &Notification{UserID: userID, Type: "deposit_received", IdempotencyKey: "wallet:tx-1"}
+	}
+	require.NoError(t, d.Dispatch(ctx, deposit()))
+	assert.ErrorIs(t, d.Dispatch(ctx, deposit()), ErrDuplicate)
+	assert.Len(t, ch.sent, 1)
+
+	// Notifications without a key are never suppressed
+	require.NoError(t, d.Dispatch(ctx, &Notification{UserID: userID, Type: "t"}))
+	require.NoError(t, d.Dispatch(ctx, &Notification{UserID: userID, Type: "t"}))
+	assert.Len(t, ch.sent, 3)
+
+	ch.err = errors.New("down")
+	withdrawal := &Notification{UserID: userID, Type: "withdrawal_sent", IdempotencyKey: "wallet:tx-2"}
+	assert.Error(t, d.Dispatch(ctx, withdrawal))
+	ch.err = nil
+	require.NoError(t, d.Dispatch(ctx, withdrawal))
+	assert.Len(t, ch.sent, 4)
+}
+
+type deadLetter struct {
+	n       *Notification
+	channel string
+	err     error
+}
+
+type recordingSink struct{ letters []deadLetter }
+
+func (s *recordingSink) DeadLetter(_ context.Context, n *Notification, channel string, err error) {
+	s.letters = append(s.letters, deadLetter{n: n, channel: channel, err: err})
+}
+
+// TestDispatcher_DeadLetters tests that channel failures are handed to the
+// sink and that Channels limits delivery
+func TestDispatcher_DeadLetters(t *testing.T) {
+	email := &fakeChannel{name: "email", err: &RetryError{Attempts: make([]Attempt, 3), Err: errors.New("550")}}
+	push := &fakeChannel{name: "push"}
+	sink := &recordingSink{}
+	d := NewDispatcher(zerolog.Nop(), WithChannels(email, push), WithDeadLetters(sink))
+
+	err := d.Dispatch(context.Background(), &Notification{UserID: uuid.New(), Type: "kyc_approved"})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "gave up after 3 attempts: 550")
+	require.Len(t, sink.letters, 1)
+	assert.Equal(t, "email", sink.letters[0].channel)
+	var retry *RetryError
+	assert.ErrorAs(t, sink.letters[0].err, &retry)
+	assert.Len(t, push.sent, 1)
+
+	require.NoError(t, d.Dispatch(context.Background(), &Notification{UserID: uuid.New(), Type: "kyc_approved", Channels: []string{"push"}}))
+	assert.Len(t, push.sent, 2)
+	assert.Len(t, sink.letters, 1)
+}
+
+// fakeHolder holds notifications of one type
+type fakeHolder struct {
+	typ  string
+	err  error
+	held []*Notification
+}
+
+func (h *fakeHolder) Hold(_ context.Context, n *Notification) (bool, error) {
+	if h.err != nil || n.Type != h.typ {
+		return false, h.err
+	}
+	h.held = append(h.held, n)
+	return true, nil
+}
+
+// TestDispatcher_Holders tests that held notifications skip the channels
+// until resumed, and that a failing holder does not stop delivery
+func TestDispatcher_Holders(t *testing.T) {
+	ctx := context.Background()
+	ch := &fakeChannel{name: "ok"}
+	first := &fakeHolder{typ: "bet_settled"}
+	second := &fakeHolder{typ: "promo"}
+	broken := &fakeHolder{err: errors.New("store down")}
+	d := NewDispatcher(zerolog.Nop(), WithChannels(ch), WithHolders(first, broken, second))
+
+	require.NoError(t, d.Dispatch(ctx, &Notification{UserID: uuid.New(), Type: "bet_settled"}))
+	require.NoError(t, d.Dispatch(ctx, &Notification{UserID: uuid.New(), Type: "deposit_received"}))
+	require.Len(t, first.held, 1)
+	require.Len(t, ch.sent, 1)
+	assert.Equal(t, "deposit_received", ch.sent[0].Type)
+
+	// Resuming skips the holder itself but not the ones after it
+	n := first.held[0]
+	n.Type = "promo"
+	require.NoError(t, d.Resume(ctx, n, first))
+	assert.Len(t, second.held, 1)
+	require.NoError(t, d.Resume(ctx, n, second))
+	assert.Len(t, ch.sent, 2)
+
+	assert.Error(t, d.Resume(ctx, n, &fakeHolder{}))
+	n.ExpiresAt = time.Now().Add(-time.Second)
+	assert.ErrorIs(t, d.Resume(ctx, n, second), ErrExpired)
+}
+
+// scopedHolder holds notifications of one type for some channels
+type scopedHolder struct {
+	fakeHolder
+	channels []string
+}
+
+func (h *scopedHolder) Channels() []string { return h.channels }
+
+// TestDispatcher_ScopedHolders tests that a holder limited to some
+// channels holds only their share of a notification, which is resumed over
+// them alone
+func TestDispatcher_ScopedHolders(t *testing.T) {
+	ctx := context.Background()
+	ws, webhook := &fakeChannel{name: "websocket"}, &fakeChannel{name: "webhook"}
+	holder := &scopedHolder{fakeHolder: fakeHolder{typ: "promo"}, channels: []string{"websocket"}}
+	d := NewDispatcher(zerolog.Nop(), WithChannels(ws, webhook), WithHolders(holder))
+
+	require.NoError(t, d.Dispatch(ctx, &Notification{UserID: uuid.New(), Type: "promo"}))
+	require.Len(t, holder.held, 1)
+	assert.Empty(t, ws.sent)
+	require.Len(t, webhook.sent, 1)
+	assert.Equal(t, []string{"webhook"}, webhook.sent[0].Channels)
+
+	require.NoError(t, d.Resume(ctx, holder.held[0], holder))
+	assert.Len(t, ws.sent, 1)
+	assert.Len(t, webhook.sent, 1)
+
+	// Nothing is held for channels the holder does not apply to
+	require.NoError(t, d.Dispatch(ctx, &Notification{UserID: uuid.New(), Type: "promo", Channels: []string{"webhook"}}))
+	webhookOnly := NewDispatcher(zerolog.Nop(), WithChannels(webhook), WithHolders(holder))
+	require.NoError(t, webhookOnly.Dispatch(ctx, &Notification{UserID: uuid.New(), Type: "promo"}))
+	assert.Len(t, webhook.sent, 3)
+	assert.Len(t, holder.held, 1)
+}
+
+// tracked is a step recorded by a recordingTracker
+type tracked struct {
+	channel string
+	state   State
+	reason  string
+}
+
+type recordingTracker struct{ steps []tracked }
+
+func (r *recordingTracker) Track(_ *Notification, channel string, state State, reason string) {
+	r.steps = append(r.steps, tracked{channel: channel, state: state, reason: reason})
+}
+
+// queueingChannel sends in the background
+type queueingChannel struct{ fakeChannel }
+
+func (c *queueingChannel) Queues() bool { return true }
+
+// selectiveChannel wants nothing
+type selectiveChannel struct{ fakeChannel }
+
+func (c *selectiveChannel) Wants(context.Context, *Notification) bool { return false }
+
+// TestDispatcher_Tracker tests the steps recorded for each channel:
+// queued or sent on success, the skip's state for a deliberate skip,
+// failed on error, and nothing for a channel that does not want it
+func TestDispatcher_Tracker(t *testing.T) {
+	ctx := context.Background()
+	tracker := &recordingTracker{}
+	sink := &recordingSink{}
+	d := NewDispatcher(zerolog.Nop(),
+		WithChannels(
+			&fakeChannel{name: "sync"},
+			&queueingChannel{fakeChannel{name: "queued"}},
+			&fakeChannel{name: "capped", err: &SkipError{State: StateFailed, Reason: "dropped by frequency cap"}},
+			&fakeChannel{name: "broken", err: errors.New("down")},
+			&selectiveChannel{fakeChannel{name: "unrouted"}},
+		),
+		WithHolders(&fakeHolder{typ: "promo"}),
+		WithDeadLetters(sink),
+		WithTracker(tracker),
+	)
+
+	err := d.Dispatch(ctx, &Notification{UserID: uuid.New(), Type: "bet_settled"})
+	require.Error(t, err)
+	assert.NotContains(t, err.Error(), "capped", "a skip is not an error")
+	assert.Len(t, sink.letters, 1, "a skip is not dead-lettered")
+	assert.Equal(t, []tracked{
+		{"", StateAccepted, ""},
+		{"sync", StateSent, ""},
+		{"queued", StateQueued, ""},
+		{"capped", StateFailed, "dropped by frequency cap"},
+		{"broken", StateFailed, "down"},
+	}, tracker.steps)
+
+	tracker.steps = nil
+	require.NoError(t, d.Dispatch(ctx, &Notification{UserID: uuid.New(), Type: "promo"}))
+	assert.Equal(t, []tracked{{"", StateAccepted, ""}, {"", StateAccepted, "held for later delivery"}}, tracker.steps)
+
+	tracker.steps = nil
+	assert.ErrorIs(t, d.Dispatch(ctx, &Notification{UserID: uuid.New(), Type: "odds", ExpiresAt: time.Now().Add(-time.Second)}), ErrExpired)
+	assert.Equal(t, []tracked{{"", StateFailed, ErrExpired.Error()}}, tracker.steps)
+}
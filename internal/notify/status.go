@@ -0,0 +1,55 @@
+package notify
+
+import "context"
+
+// State is a step in the delivery of a notification over a channel
+type State string
+
+const (
+	// StateAccepted is a notification taken in by the dispatcher, before
+	// it reaches a channel
+	StateAccepted State = "accepted"
+	// StateQueued is a notification handed to a channel that sends it later
+	StateQueued State = "queued"
+	// StateSent is a notification written to the user's connection or
+	// handed to the provider
+	StateSent State = "sent"
+	// StateDelivered is a notification the provider or receiver confirmed
+	StateDelivered State = "delivered"
+	// StateAcked is a notification the user's client acknowledged
+	StateAcked State = "acked"
+	// StateRead is a notification the user opened
+	StateRead State = "read"
+	// StateFailed is a notification that could not be delivered
+	StateFailed State = "failed"
+)
+
+// Tracker records the delivery progress of notifications. The channel is
+// empty for steps before one is chosen. Track must not block.
+type Tracker interface {
+	Track(n *Notification, channel string, state State, reason string)
+}
+
+// Queuer is implemented by channels whose Send only queues a notification
+// for delivery, such as the WebSocket channel. The dispatcher records
+// their sends as queued, and they report what happens next themselves.
+type Queuer interface {
+	Queues() bool
+}
+
+// SkipError is returned by a channel that deliberately did not send a
+// notification, e.g. over a frequency cap. The dispatcher records it with
+// the given state and reason rather than as a failure.
+type SkipError struct {
+	State  State
+	Reason string
+}
+
+func (e *SkipError) Error() string { return e.Reason }
+
+// Selective is implemented by channels that only send some notifications,
+// such as chat channels routed by type. The dispatcher skips a channel
+// that does not want a notification, and records nothing for it.
+type Selective interface {
+	Wants(ctx context.Context, n *Notification) bool
+}
@@ -0,0 +1,41 @@
+package notify
+
+import (
+	"context"
+
+	ws "github.com/cypherlabdev/notification-service/internal/websocket"
+)
+
+// ChannelWebSocket is the name of the WebSocket channel
+const ChannelWebSocket = "websocket"
+
+// WebSocketChannel delivers notifications to the user's live connections
+type WebSocketChannel struct {
+	hub *ws.Hub
+}
+
+// NewWebSocketChannel creates a channel publishing through hub
+func NewWebSocketChannel(hub *ws.Hub) *WebSocketChannel {
+	return &WebSocketChannel{hub: hub}
+}
+
+// Name implements Channel
+func (c *WebSocketChannel) Name() string { return ChannelWebSocket }
+
+// Queues implements Queuer; the hub reports when the notification is
+// written to the user's connections
+func (c *WebSocketChannel) Queues() bool { return true }
+
+// Send queues the notification on the hub, failing rather than blocking
+// when the hub is saturated or stopped. Users without a live connection
+// are not an error.
+func (c *WebSocketChannel) Send(_ context.Context, n *Notification) error {
+	opts := []ws.SendOption{ws.NotificationID(n.ID)}
+	if !n.ExpiresAt.IsZero() {
+		opts = append(opts, ws.ExpiresAt(n.ExpiresAt))
+	}
+	if n.OrderingKey != "" {
+		opts = append(opts, ws.Ordered(n.OrderingKey, n.Sequence))
+	}
+	return c.hub.TryBroadcastToUser(n.UserID, n.Type, n.Payload, opts...)
+}
@@ -0,0 +1,257 @@
+// Package publish serves the HTTP API other services use to send
+// notifications, immediately or at a later time.
+package publish
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/rs/zerolog"
+
+	"github.com/cypherlabdev/notification-service/internal/notify"
+	"github.com/cypherlabdev/notification-service/internal/scheduler"
+)
+
+// Dispatcher delivers immediate notifications; *notify.Dispatcher implements it
+type Dispatcher interface {
+	Dispatch(ctx context.Context, n *notify.Notification) error
+}
+
+// publishRequest is the body of POST /notifications. Setting send_at, delay
+// (a Go duration such as "10m") or cron schedules the notification;
+// otherwise it is sent immediately. A notification not delivered by
+// expires_at, or within ttl of being sent or falling due, is dropped.
+// Notifications sharing an ordering_key reach clients in seq order.
+type publishRequest struct {
+	ID        string          `json:"id,omitempty"`
+	UserID    uuid.UUID       `json:"user_id"`
+	Type      string          `json:"type"`
+	Category  string          `json:"category,omitempty"`
+	Payload   json.RawMessage `json:"payload,omitempty"`
+	SendAt    *time.Time      `json:"send_at,omitempty"`
+	Delay     string          `json:"delay,omitempty"`
+	Cron      string          `json:"cron,omitempty"`
+	Timezone  string          `json:"timezone,omitempty"`
+	TTL       string          `json:"ttl,omitempty"`
+	ExpiresAt *time.Time      `json:"expires_at,omitempty"`
+
+	OrderingKey string `json:"ordering_key,omitempty"`
+	Sequence    uint64 `json:"seq,omitempty"`
+}
+
+func (r *publishRequest) scheduled() bool {
+	return r.SendAt != nil || r.Delay != "" || r.Cron != ""
+}
+
+// publishResponse acknowledges an immediate notification. A notification
+// that failed on some channels but reached others is "partial": the failed
+// channels are listed and dead-lettered, and it must not be published again.
+type publishResponse struct {
+	ID        string            `json:"id"`
+	Status    string            `json:"status"`
+	Delivered []string          `json:"delivered,omitempty"`
+	Failed    map[string]string `json:"failed,omitempty"`
+}
+
+// Handler serves the publish API:
+//
+//	POST   /notifications        sends or schedules a notification
+//	GET    /notifications/{id}   returns a scheduled notification
+//	DELETE /notifications/{id}   cancels a scheduled notification
+type Handler struct {
+	dispatcher Dispatcher
+	scheduler  *scheduler.Scheduler
+	logger     zerolog.Logger
+	mux        *http.ServeMux
+}
+
+// NewHandler creates the publish API
+func NewHandler(dispatcher Dispatcher, sched *scheduler.Scheduler, logger zerolog.Logger) *Handler {
+	h := &Handler{
+		dispatcher: dispatcher,
+		scheduler:  sched,
+		logger:     logger.With().Str("component", "publish_api").Logger(),
+		mux:        http.NewServeMux(),
+	}
+	h.mux.HandleFunc("POST /notifications", h.publish)
+	h.mux.HandleFunc("GET /notifications/{id}", h.get)
+	h.mux.HandleFunc("DELETE /notifications/{id}", h.cancel)
+	return h
+}
+
+// ServeHTTP implements http.Handler
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	h.mux.ServeHTTP(w, r)
+}
+
+func (h *Handler) publish(w http.ResponseWriter, r *http.Request) {
+	var req publishRequest
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 64<<10)).Decode(&req); err != nil {
+		http.Error(w, "invalid body: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	if req.UserID == uuid.Nil || req.Type == "" {
+		http.Error(w, "user_id and type are required", http.StatusBadRequest)
+		return
+	}
+
+	var ttl time.Duration
+	if req.TTL != "" {
+		var err error
+		if ttl, err = time.ParseDuration(req.TTL); err != nil || ttl <= 0 {
+			http.Error(w, "invalid ttl", http.StatusBadRequest)
+			return
+		}
+	}
+	if req.TTL != "" && req.ExpiresAt != nil {
+		http.Error(w, "set at most one of ttl and expires_at", http.StatusBadRequest)
+		return
+	}
+
+	if req.Sequence != 0 && req.OrderingKey == "" {
+		http.Error(w, "seq requires an ordering_key", http.StatusBadRequest)
+		return
+	}
+
+	if req.scheduled() {
+		if req.OrderingKey != "" {
+			http.Error(w, "scheduled notifications cannot be ordered", http.StatusBadRequest)
+			return
+		}
+		if req.ExpiresAt != nil {
+			http.Error(w, "scheduled notifications take a ttl rather than expires_at", http.StatusBadRequest)
+			return
+		}
+		h.schedule(w, r, &req, ttl)
+		return
+	}
+
+	var payload interface{}
+	if len(req.Payload) > 0 {
+		if err := json.Unmarshal(req.Payload, &payload); err != nil {
+			http.Error(w, "invalid payload: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+	n := &notify.Notification{
+		ID:          req.ID,
+		UserID:      req.UserID,
+		Type:        req.Type,
+		Category:    req.Category,
+		Payload:     payload,
+		Source:      "api",
+		OrderingKey: req.OrderingKey,
+		Sequence:    req.Sequence,
+	}
+	if req.ID != "" {
+		// A caller-chosen ID identifies the notification across retries
+		n.IdempotencyKey = "api:" + req.ID
+	}
+	switch {
+	case req.ExpiresAt != nil:
+		n.ExpiresAt = *req.ExpiresAt
+	case ttl > 0:
+		n.ExpiresAt = time.Now().Add(ttl)
+	}
+	err := h.dispatcher.Dispatch(r.Context(), n)
+	var partial *notify.PartialError
+	if errors.As(err, &partial) {
+		resp := publishResponse{ID: n.ID, Status: "partial", Delivered: partial.Delivered, Failed: make(map[string]string)}
+		for channel, err := range partial.Failed {
+			resp.Failed[channel] = err.Error()
+		}
+		writeJSON(w, http.StatusAccepted, resp)
+		return
+	}
+	if errors.Is(err, notify.ErrDuplicate) {
+		writeJSON(w, http.StatusOK, publishResponse{ID: n.ID, Status: "duplicate"})
+		return
+	}
+	if errors.Is(err, notify.ErrExpired) {
+		http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+		return
+	}
+	if err != nil {
+		// Nothing went out and the dispatcher released the idempotency key,
+		// so the 503 lets the client retry
+		h.logger.Warn().Err(err).Str("notification_id", n.ID).Msg("failed to dispatch notification")
+		http.Error(w, "notification not delivered", http.StatusServiceUnavailable)
+		return
+	}
+	writeJSON(w, http.StatusAccepted, publishResponse{ID: n.ID, Status: "sent"})
+}
+
+func (h *Handler) schedule(w http.ResponseWriter, r *http.Request, req *publishRequest, ttl time.Duration) {
+	sreq := scheduler.Request{
+		ID:       req.ID,
+		UserID:   req.UserID,
+		Type:     req.Type,
+		Category: req.Category,
+		Payload:  req.Payload,
+		Cron:     req.Cron,
+		Timezone: req.Timezone,
+		TTL:      ttl,
+	}
+	if req.SendAt != nil {
+		sreq.SendAt = *req.SendAt
+	}
+	if req.Delay != "" {
+		delay, err := time.ParseDuration(req.Delay)
+		if err != nil {
+			http.Error(w, "invalid delay: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		sreq.Delay = delay
+	}
+
+	job, err := h.scheduler.Schedule(r.Context(), sreq)
+	switch {
+	case errors.Is(err, scheduler.ErrInvalid):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	case errors.Is(err, scheduler.ErrExists):
+		http.Error(w, err.Error(), http.StatusConflict)
+	case err != nil:
+		h.logger.Error().Err(err).Msg("failed to schedule notification")
+		http.Error(w, "internal error", http.StatusInternalServerError)
+	default:
+		writeJSON(w, http.StatusAccepted, job)
+	}
+}
+
+func (h *Handler) get(w http.ResponseWriter, r *http.Request) {
+	job, err := h.scheduler.Get(r.Context(), r.PathValue("id"))
+	if errors.Is(err, scheduler.ErrNotFound) {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		h.logger.Error().Err(err).Msg("failed to load scheduled notification")
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, http.StatusOK, job)
+}
+
+func (h *Handler) cancel(w http.ResponseWriter, r *http.Request) {
+	err := h.scheduler.Cancel(r.Context(), r.PathValue("id"))
+	if errors.Is(err, scheduler.ErrNotFound) {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		h.logger.Error().Err(err).Msg("failed to cancel scheduled notification")
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
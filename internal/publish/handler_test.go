@@ -0,0 +1,225 @@
+package publish
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/cypherlabdev/notification-service/internal/dedup"
+	"github.com/cypherlabdev/notification-service/internal/notify"
+	"github.com/cypherlabdev/notification-service/internal/scheduler"
+)
+
+type fakeDispatcher struct {
+	err  error
+	sent []*notify.Notification
+	mu   sync.Mutex
+}
+
+func (d *fakeDispatcher) Dispatch(_ context.Context, n *notify.Notification) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.err != nil {
+		return d.err
+	}
+	if n.ID == "" {
+		n.ID = uuid.New().String()
+	}
+	d.sent = append(d.sent, n)
+	return nil
+}
+
+func newTestHandler(dispatcher Dispatcher) *Handler {
+	sched := scheduler.New(scheduler.NewMemoryStore(), dispatcher, zerolog.Nop())
+	return NewHandler(dispatcher, sched, zerolog.Nop())
+}
+
+func do(h http.Handler, method, path, body string) *httptest.ResponseRecorder {
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(method, path, strings.NewReader(body)))
+	return rec
+}
+
+// TestHandler_PublishNow tests immediate delivery
+func TestHandler_PublishNow(t *testing.T) {
+	dispatcher := &fakeDispatcher{}
+	h := newTestHandler(dispatcher)
+	userID := uuid.New()
+
+	rec := do(h, http.MethodPost, "/notifications", `{"user_id":"`+userID.String()+`","type":"bet_settled","payload":{"won":true}}`)
+	require.Equal(t, http.StatusAccepted, rec.Code)
+	var resp publishResponse
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &resp))
+	assert.Equal(t, "sent", resp.Status)
+	require.Len(t, dispatcher.sent, 1)
+	assert.Equal(t, resp.ID, dispatcher.sent[0].ID)
+	assert.Equal(t, map[string]interface{}{"won": true}, dispatcher.sent[0].Payload)
+
+	dispatcher.err = errors.New("down")
+	rec = do(h, http.MethodPost, "/notifications", `{"user_id":"`+userID.String()+`","type":"t"}`)
+	assert.Equal(t, http.StatusServiceUnavailable, rec.Code)
+
+	assert.Equal(t, http.StatusBadRequest, do(h, http.MethodPost, "/notifications", `{"type":"t"}`).Code)
+}
+
+// fakeChannel counts sends and fails while err is set
+type fakeChannel struct {
+	name string
+	err  error
+	sent int
+}
+
+func (c *fakeChannel) Name() string { return c.name }
+
+func (c *fakeChannel) Send(context.Context, *notify.Notification) error {
+	if c.err != nil {
+		return c.err
+	}
+	c.sent++
+	return nil
+}
+
+// TestHandler_PartialFailure tests that a notification reaching only some
+// channels is acknowledged, so retries do not deliver it again, while one
+// reaching none can be retried
+func TestHandler_PartialFailure(t *testing.T) {
+	ws, webhook := &fakeChannel{name: "websocket"}, &fakeChannel{name: "webhook", err: errors.New("down")}
+	store := dedup.NewMemoryStore(0)
+	dispatcher := notify.NewDispatcher(zerolog.Nop(), notify.WithChannels(ws, webhook), notify.WithDedup(store, time.Hour))
+	h := dedup.Idempotent(store, time.Hour, zerolog.Nop(), newTestHandler(dispatcher))
+	userID := uuid.New().String()
+
+	post := func(key, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/notifications", strings.NewReader(body))
+		if key != "" {
+			req.Header.Set(dedup.HeaderIdempotencyKey, key)
+		}
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		return rec
+	}
+
+	body := `{"user_id":"` + userID + `","type":"bet_settled"}`
+	rec := post("k1", body)
+	require.Equal(t, http.StatusAccepted, rec.Code)
+	var resp publishResponse
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &resp))
+	assert.Equal(t, "partial", resp.Status)
+	assert.Equal(t, []string{"websocket"}, resp.Delivered)
+	assert.Equal(t, map[string]string{"webhook": "down"}, resp.Failed)
+	rec = post("k1", body)
+	assert.Equal(t, http.StatusAccepted, rec.Code)
+	assert.Equal(t, "true", rec.Header().Get(dedup.HeaderReplayed))
+	assert.Equal(t, 1, ws.sent, "the retry is answered from the first response")
+
+	withID := `{"id":"n1","user_id":"` + userID + `","type":"bet_settled"}`
+	require.Equal(t, http.StatusAccepted, post("", withID).Code)
+	rec = post("", withID)
+	require.Equal(t, http.StatusOK, rec.Code)
+	assert.Contains(t, rec.Body.String(), "duplicate")
+	assert.Equal(t, 2, ws.sent)
+
+	// Nothing went out, so both the HTTP and the dispatch key are released
+	ws.err = errors.New("down")
+	withID = `{"id":"n2","user_id":"` + userID + `","type":"bet_settled"}`
+	require.Equal(t, http.StatusServiceUnavailable, post("k2", withID).Code)
+	ws.err, webhook.err = nil, nil
+	rec = post("k2", withID)
+	require.Equal(t, http.StatusAccepted, rec.Code)
+	assert.Contains(t, rec.Body.String(), `"status":"sent"`)
+	assert.Equal(t, 3, ws.sent)
+}
+
+// TestHandler_Expiry tests the ttl and expires_at fields
+func TestHandler_Expiry(t *testing.T) {
+	dispatcher := &fakeDispatcher{}
+	h := newTestHandler(dispatcher)
+	userID := uuid.New().String()
+
+	rec := do(h, http.MethodPost, "/notifications", `{"user_id":"`+userID+`","type":"odds_changed","ttl":"30s"}`)
+	require.Equal(t, http.StatusAccepted, rec.Code)
+	require.Len(t, dispatcher.sent, 1)
+	assert.WithinDuration(t, time.Now().Add(30*time.Second), dispatcher.sent[0].ExpiresAt, 5*time.Second)
+
+	expiresAt := time.Now().Add(time.Minute).UTC().Truncate(time.Second)
+	rec = do(h, http.MethodPost, "/notifications", `{"user_id":"`+userID+`","type":"t","expires_at":"`+expiresAt.Format(time.RFC3339)+`"}`)
+	require.Equal(t, http.StatusAccepted, rec.Code)
+	assert.True(t, expiresAt.Equal(dispatcher.sent[1].ExpiresAt))
+
+	rec = do(h, http.MethodPost, "/notifications", `{"user_id":"`+userID+`","type":"reminder","delay":"10m","ttl":"1m"}`)
+	require.Equal(t, http.StatusAccepted, rec.Code)
+	assert.Contains(t, rec.Body.String(), `"ttl_seconds":60`)
+
+	for _, body := range []string{
+		`{"user_id":"` + userID + `","type":"t","ttl":"never"}`,
+		`{"user_id":"` + userID + `","type":"t","ttl":"-1s"}`,
+		`{"user_id":"` + userID + `","type":"t","ttl":"1s","expires_at":"` + expiresAt.Format(time.RFC3339) + `"}`,
+		`{"user_id":"` + userID + `","type":"t","delay":"1m","expires_at":"` + expiresAt.Format(time.RFC3339) + `"}`,
+	} {
+		assert.Equal(t, http.StatusBadRequest, do(h, http.MethodPost, "/notifications", body).Code, body)
+	}
+}
+
+// TestHandler_Ordering tests the ordering_key and seq fields
+func TestHandler_Ordering(t *testing.T) {
+	dispatcher := &fakeDispatcher{}
+	h := newTestHandler(dispatcher)
+	userID := uuid.New().String()
+
+	rec := do(h, http.MethodPost, "/notifications", `{"user_id":"`+userID+`","type":"order_filled","ordering_key":"order:7","seq":2}`)
+	require.Equal(t, http.StatusAccepted, rec.Code)
+	require.Len(t, dispatcher.sent, 1)
+	assert.Equal(t, "order:7", dispatcher.sent[0].OrderingKey)
+	assert.Equal(t, uint64(2), dispatcher.sent[0].Sequence)
+
+	for _, body := range []string{
+		`{"user_id":"` + userID + `","type":"t","seq":2}`,
+		`{"user_id":"` + userID + `","type":"t","ordering_key":"order:7","delay":"1m"}`,
+	} {
+		assert.Equal(t, http.StatusBadRequest, do(h, http.MethodPost, "/notifications", body).Code, body)
+	}
+}
+
+// TestHandler_Schedule tests scheduling, inspecting and cancelling notifications
+func TestHandler_Schedule(t *testing.T) {
+	dispatcher := &fakeDispatcher{}
+	h := newTestHandler(dispatcher)
+	userID := uuid.New().String()
+
+	rec := do(h, http.MethodPost, "/notifications", `{"id":"close-m1","user_id":"`+userID+`","type":"market_closing","delay":"10m"}`)
+	require.Equal(t, http.StatusAccepted, rec.Code)
+	var job scheduler.Job
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &job))
+	assert.Equal(t, "close-m1", job.ID)
+	assert.WithinDuration(t, time.Now().Add(10*time.Minute), job.SendAt, 5*time.Second)
+	assert.Empty(t, dispatcher.sent)
+
+	sendAt := time.Now().Add(time.Hour).UTC().Format(time.RFC3339)
+	rec = do(h, http.MethodPost, "/notifications", `{"user_id":"`+userID+`","type":"t","send_at":"`+sendAt+`"}`)
+	require.Equal(t, http.StatusAccepted, rec.Code)
+	rec = do(h, http.MethodPost, "/notifications", `{"user_id":"`+userID+`","type":"daily_digest","cron":"0 9 * * *","timezone":"Europe/London"}`)
+	require.Equal(t, http.StatusAccepted, rec.Code)
+
+	assert.Equal(t, http.StatusConflict, do(h, http.MethodPost, "/notifications", `{"id":"close-m1","user_id":"`+userID+`","type":"t","delay":"1m"}`).Code)
+	assert.Equal(t, http.StatusBadRequest, do(h, http.MethodPost, "/notifications", `{"user_id":"`+userID+`","type":"t","delay":"soon"}`).Code)
+	assert.Equal(t, http.StatusBadRequest, do(h, http.MethodPost, "/notifications", `{"user_id":"`+userID+`","type":"t","delay":"1m","cron":"@daily"}`).Code)
+
+	rec = do(h, http.MethodGet, "/notifications/close-m1", "")
+	require.Equal(t, http.StatusOK, rec.Code)
+	assert.Contains(t, rec.Body.String(), `"status":"pending"`)
+
+	assert.Equal(t, http.StatusNoContent, do(h, http.MethodDelete, "/notifications/close-m1", "").Code)
+	assert.Equal(t, http.StatusNotFound, do(h, http.MethodDelete, "/notifications/close-m1", "").Code)
+	assert.Equal(t, http.StatusNotFound, do(h, http.MethodGet, "/notifications/unknown", "").Code)
+}
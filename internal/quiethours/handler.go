@@ -0,0 +1,136 @@
+package quiethours
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/rs/zerolog"
+)
+
+// settingsRequest is the body of PUT /quiet-hours/{userID}
+type settingsRequest struct {
+	Start             string    `json:"start,omitempty"`
+	End               string    `json:"end,omitempty"`
+	Timezone          string    `json:"timezone,omitempty"`
+	DoNotDisturbUntil time.Time `json:"do_not_disturb_until,omitzero"`
+}
+
+// quietHoursResponse is a user's quiet hours, if any, and what is
+// deferred for them
+type quietHoursResponse struct {
+	UserID   uuid.UUID `json:"user_id"`
+	Settings *Settings `json:"settings"`
+	Deferred []*Item   `json:"deferred"`
+}
+
+// Handler serves the quiet hours API; the GET view lets support staff see
+// why a user has not received something yet:
+//
+//	GET    /quiet-hours/{userID}   settings and deferred notifications
+//	PUT    /quiet-hours/{userID}   {"start": "22:00", "end": "07:00", "timezone": "Europe/London"}
+//	DELETE /quiet-hours/{userID}
+type Handler struct {
+	deferrer *Deferrer
+	logger   zerolog.Logger
+	mux      *http.ServeMux
+}
+
+// NewHandler creates the quiet hours API
+func NewHandler(deferrer *Deferrer, logger zerolog.Logger) *Handler {
+	h := &Handler{
+		deferrer: deferrer,
+		logger:   logger.With().Str("component", "quiet_hours_api").Logger(),
+		mux:      http.NewServeMux(),
+	}
+	h.mux.HandleFunc("GET /quiet-hours/{userID}", h.get)
+	h.mux.HandleFunc("PUT /quiet-hours/{userID}", h.set)
+	h.mux.HandleFunc("DELETE /quiet-hours/{userID}", h.remove)
+	return h
+}
+
+// ServeHTTP implements http.Handler
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	h.mux.ServeHTTP(w, r)
+}
+
+func (h *Handler) get(w http.ResponseWriter, r *http.Request) {
+	userID, ok := pathUser(w, r)
+	if !ok {
+		return
+	}
+	resp := quietHoursResponse{UserID: userID}
+	settings, err := h.deferrer.Settings(r.Context(), userID)
+	if err != nil && !errors.Is(err, ErrNotFound) {
+		h.storeError(w, err, "failed to load quiet hours")
+		return
+	}
+	resp.Settings = settings
+	if resp.Deferred, err = h.deferrer.Deferred(r.Context(), userID); err != nil {
+		h.storeError(w, err, "failed to list deferred notifications")
+		return
+	}
+	if resp.Deferred == nil {
+		resp.Deferred = []*Item{}
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
+
+func (h *Handler) set(w http.ResponseWriter, r *http.Request) {
+	userID, ok := pathUser(w, r)
+	if !ok {
+		return
+	}
+	var req settingsRequest
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 4<<10)).Decode(&req); err != nil {
+		http.Error(w, "invalid body: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	s := &Settings{UserID: userID, Start: req.Start, End: req.End, Timezone: req.Timezone, DoNotDisturbUntil: req.DoNotDisturbUntil}
+	if err := h.deferrer.SetSettings(r.Context(), s); err != nil {
+		h.storeError(w, err, "failed to store quiet hours")
+		return
+	}
+	writeJSON(w, http.StatusOK, s)
+}
+
+func (h *Handler) remove(w http.ResponseWriter, r *http.Request) {
+	userID, ok := pathUser(w, r)
+	if !ok {
+		return
+	}
+	if err := h.deferrer.DeleteSettings(r.Context(), userID); err != nil {
+		h.storeError(w, err, "failed to delete quiet hours")
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *Handler) storeError(w http.ResponseWriter, err error, msg string) {
+	switch {
+	case errors.Is(err, ErrNotFound):
+		http.Error(w, err.Error(), http.StatusNotFound)
+	case errors.Is(err, ErrInvalid):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	default:
+		h.logger.Error().Err(err).Msg(msg)
+		http.Error(w, "internal error", http.StatusInternalServerError)
+	}
+}
+
+func pathUser(w http.ResponseWriter, r *http.Request) (uuid.UUID, bool) {
+	userID, err := uuid.Parse(r.PathValue("userID"))
+	if err != nil {
+		http.Error(w, "invalid user id", http.StatusBadRequest)
+		return uuid.Nil, false
+	}
+	return userID, true
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
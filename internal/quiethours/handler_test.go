@@ -0,0 +1,57 @@
+package quiethours
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/cypherlabdev/notification-service/internal/notify"
+)
+
+func do(h http.Handler, method, path, body string) *httptest.ResponseRecorder {
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(method, path, strings.NewReader(body)))
+	return rec
+}
+
+// TestHandler tests managing quiet hours and viewing deferred items
+func TestHandler(t *testing.T) {
+	d, dispatcher, _ := newTestDeferrer(t, NewMemoryStore(), time.Now())
+	h := NewHandler(d, zerolog.Nop())
+	userID := uuid.New()
+	path := "/quiet-hours/" + userID.String()
+
+	rec := do(h, http.MethodGet, path, "")
+	require.Equal(t, http.StatusOK, rec.Code)
+	assert.JSONEq(t, `{"user_id":"`+userID.String()+`","settings":null,"deferred":[]}`, rec.Body.String())
+
+	until := time.Now().Add(time.Hour).UTC().Format(time.RFC3339)
+	rec = do(h, http.MethodPut, path, `{"start":"22:00","end":"07:00","timezone":"Europe/London","do_not_disturb_until":"`+until+`"}`)
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	require.NoError(t, dispatcher.Dispatch(context.Background(), &notify.Notification{UserID: userID, Type: "promo"}))
+
+	rec = do(h, http.MethodGet, path, "")
+	require.Equal(t, http.StatusOK, rec.Code)
+	var resp quietHoursResponse
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &resp))
+	require.NotNil(t, resp.Settings)
+	assert.Equal(t, "22:00", resp.Settings.Start)
+	require.Len(t, resp.Deferred, 1)
+	assert.Equal(t, "promo", resp.Deferred[0].Type)
+
+	assert.Equal(t, http.StatusBadRequest, do(h, http.MethodPut, path, `{"start":"22:00"}`).Code)
+	assert.Equal(t, http.StatusBadRequest, do(h, http.MethodPut, path, `{"start":"10pm","end":"7am"}`).Code)
+	assert.Equal(t, http.StatusBadRequest, do(h, http.MethodGet, "/quiet-hours/nope", "").Code)
+
+	assert.Equal(t, http.StatusNoContent, do(h, http.MethodDelete, path, "").Code)
+	assert.Equal(t, http.StatusNotFound, do(h, http.MethodDelete, path, "").Code)
+}
@@ -0,0 +1,22 @@
+package quiethours
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var (
+	deferred = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "notification",
+		Subsystem: "quiet_hours",
+		Name:      "deferred_total",
+		Help:      "Notifications deferred until a user's quiet hours end, by category.",
+	}, []string{"category"})
+
+	released = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "notification",
+		Subsystem: "quiet_hours",
+		Name:      "released_total",
+		Help:      "Deferred notifications released, by whether they were sent, failed or expired first.",
+	}, []string{"result"})
+)
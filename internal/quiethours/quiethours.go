@@ -0,0 +1,256 @@
+// Package quiethours defers notifications that arrive during a user's
+// quiet hours or do-not-disturb until they end, except urgent categories
+// such as security alerts, which are always delivered at once.
+package quiethours
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"slices"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/rs/zerolog"
+
+	"github.com/cypherlabdev/notification-service/internal/notify"
+)
+
+const (
+	defaultPollInterval = 30 * time.Second
+	// releaseBatch bounds the items released per poll
+	releaseBatch = 100
+	// claimTTL is how long a replica has to deliver an item it claimed
+	// before another one may
+	claimTTL = time.Minute
+)
+
+// DefaultUrgentCategories are delivered during quiet hours
+var DefaultUrgentCategories = []string{"security", "compliance"}
+
+// Resumer delivers deferred notifications; *notify.Dispatcher implements it
+type Resumer interface {
+	Resume(ctx context.Context, n *notify.Notification, holder notify.Holder) error
+}
+
+// Option configures a Deferrer
+type Option func(*Deferrer)
+
+// WithPollInterval sets how often deferred items are checked for release
+func WithPollInterval(interval time.Duration) Option {
+	return func(d *Deferrer) {
+		d.pollInterval = interval
+	}
+}
+
+// WithUrgentCategories replaces the categories that are never deferred.
+// A notification without a category is matched by its type.
+func WithUrgentCategories(categories ...string) Option {
+	return func(d *Deferrer) {
+		d.urgent = categories
+	}
+}
+
+// WithChannels limits deferral to the named channels, such as those that
+// reach the user's device; the others deliver at once
+func WithChannels(channels ...string) Option {
+	return func(d *Deferrer) {
+		d.channels = channels
+	}
+}
+
+// Deferrer is a notify.Holder that defers notifications arriving during a
+// user's quiet hours or do-not-disturb, and delivers them when those end
+type Deferrer struct {
+	store        Store
+	urgent       []string
+	channels     []string
+	pollInterval time.Duration
+	logger       zerolog.Logger
+	now          func() time.Time
+}
+
+// New creates a deferrer over store. It defers notifications at once;
+// call Run to release them.
+func New(store Store, logger zerolog.Logger, opts ...Option) *Deferrer {
+	d := &Deferrer{
+		store:        store,
+		urgent:       DefaultUrgentCategories,
+		pollInterval: defaultPollInterval,
+		logger:       logger.With().Str("component", "quiet_hours").Logger(),
+		now:          time.Now,
+	}
+	for _, opt := range opts {
+		opt(d)
+	}
+	return d
+}
+
+// Channels implements notify.Scoped
+func (d *Deferrer) Channels() []string {
+	return d.channels
+}
+
+// Hold implements notify.Holder. Notifications aimed at specific
+// channels, e.g. by a replay, are not deferred. One that would expire
+// before the user's quiet hours end is dropped.
+func (d *Deferrer) Hold(ctx context.Context, n *notify.Notification) (bool, error) {
+	if len(n.Channels) > 0 {
+		return false, nil
+	}
+	now := d.now()
+	releaseAt, err := d.ReleaseAt(ctx, n, now)
+	if err != nil || !releaseAt.After(now) {
+		return false, err
+	}
+	if n.Expired(releaseAt) {
+		released.WithLabelValues("expired").Inc()
+		d.logger.Debug().Str("notification_id", n.ID).Str("type", n.Type).Msg("notification expires during quiet hours, dropping")
+		return true, nil
+	}
+	payload, err := json.Marshal(n.Payload)
+	if err != nil {
+		return false, err
+	}
+	err = d.store.Defer(ctx, &Item{
+		ID:          n.ID,
+		UserID:      n.UserID,
+		Type:        n.Type,
+		Category:    n.Category,
+		Payload:     payload,
+		Source:      n.Source,
+		OrderingKey: n.OrderingKey,
+		Sequence:    n.Sequence,
+		CreatedAt:   n.CreatedAt.UTC(),
+		ExpiresAt:   n.ExpiresAt,
+		ReleaseAt:   releaseAt.UTC(),
+	})
+	if err != nil {
+		return false, err
+	}
+	deferred.WithLabelValues(n.CategoryOrType()).Inc()
+	return true, nil
+}
+
+// ReleaseAt returns when n may be delivered to its user if sent at t: t
+// itself unless it falls in their quiet hours or do-not-disturb and n is
+// not urgent
+func (d *Deferrer) ReleaseAt(ctx context.Context, n *notify.Notification, t time.Time) (time.Time, error) {
+	if slices.Contains(d.urgent, n.CategoryOrType()) {
+		return t, nil
+	}
+	settings, err := d.store.Settings(ctx, n.UserID)
+	if errors.Is(err, ErrNotFound) {
+		return t, nil
+	}
+	if err != nil {
+		return t, err
+	}
+	return settings.release(t), nil
+}
+
+// Deferred returns the notifications deferred for the user
+func (d *Deferrer) Deferred(ctx context.Context, userID uuid.UUID) ([]*Item, error) {
+	return d.store.Deferred(ctx, userID)
+}
+
+// Settings returns the user's quiet hours
+func (d *Deferrer) Settings(ctx context.Context, userID uuid.UUID) (*Settings, error) {
+	return d.store.Settings(ctx, userID)
+}
+
+// SetSettings validates and stores quiet hours. Notifications already
+// deferred keep their release time.
+func (d *Deferrer) SetSettings(ctx context.Context, s *Settings) error {
+	if err := s.validate(); err != nil {
+		return err
+	}
+	s.UpdatedAt = d.now().UTC()
+	return d.store.SetSettings(ctx, s)
+}
+
+// DeleteSettings turns quiet hours off for the user
+func (d *Deferrer) DeleteSettings(ctx context.Context, userID uuid.UUID) error {
+	return d.store.DeleteSettings(ctx, userID)
+}
+
+// Run delivers deferred notifications through resumer as they are
+// released, until ctx is cancelled
+func (d *Deferrer) Run(ctx context.Context, resumer Resumer) {
+	ticker := time.NewTicker(d.pollInterval)
+	defer ticker.Stop()
+	for {
+		d.tick(ctx, resumer)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// tick delivers the items that are due
+func (d *Deferrer) tick(ctx context.Context, resumer Resumer) {
+	now := d.now()
+	items, err := d.store.Due(ctx, now, releaseBatch)
+	if err != nil {
+		d.logger.Error().Err(err).Msg("failed to load deferred notifications")
+		return
+	}
+	for _, item := range items {
+		if ctx.Err() != nil {
+			return
+		}
+		claimed, err := d.store.Claim(ctx, item.ID, now, now.Add(claimTTL))
+		if err != nil {
+			d.logger.Error().Err(err).Str("notification_id", item.ID).Msg("failed to claim deferred notification")
+			continue
+		}
+		if claimed {
+			d.release(ctx, resumer, item)
+		}
+	}
+}
+
+// release delivers a claimed item and removes it. Channel failures are
+// dead-lettered by the dispatcher, so the item is removed either way.
+func (d *Deferrer) release(ctx context.Context, resumer Resumer, item *Item) {
+	var payload interface{}
+	if len(item.Payload) > 0 {
+		if err := json.Unmarshal(item.Payload, &payload); err != nil {
+			d.logger.Error().Err(err).Str("notification_id", item.ID).Msg("dropping deferred notification with invalid payload")
+			released.WithLabelValues("failed").Inc()
+			d.remove(ctx, item)
+			return
+		}
+	}
+	n := &notify.Notification{
+		ID:          item.ID,
+		UserID:      item.UserID,
+		Type:        item.Type,
+		Category:    item.Category,
+		Payload:     payload,
+		CreatedAt:   item.CreatedAt,
+		Source:      item.Source,
+		ExpiresAt:   item.ExpiresAt,
+		OrderingKey: item.OrderingKey,
+		Sequence:    item.Sequence,
+	}
+	err := resumer.Resume(ctx, n, d)
+	switch {
+	case errors.Is(err, notify.ErrExpired):
+		released.WithLabelValues("expired").Inc()
+	case err != nil:
+		released.WithLabelValues("failed").Inc()
+		d.logger.Warn().Err(err).Str("notification_id", item.ID).Str("user_id", item.UserID.String()).Msg("failed to deliver deferred notification")
+	default:
+		released.WithLabelValues("sent").Inc()
+	}
+	d.remove(ctx, item)
+}
+
+func (d *Deferrer) remove(ctx context.Context, item *Item) {
+	if err := d.store.Remove(ctx, item.ID); err != nil {
+		d.logger.Error().Err(err).Str("notification_id", item.ID).Msg("failed to remove deferred notification")
+	}
+}
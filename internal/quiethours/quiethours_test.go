@@ -0,0 +1,148 @@
+package quiethours
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/cypherlabdev/notification-service/internal/notify"
+)
+
+// fakeChannel records notifications
+type fakeChannel struct {
+	sent []*notify.Notification
+	mu   sync.Mutex
+}
+
+func (c *fakeChannel) Name() string { return "fake" }
+
+func (c *fakeChannel) Send(_ context.Context, n *notify.Notification) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.sent = append(c.sent, n)
+	return nil
+}
+
+func (c *fakeChannel) all() []*notify.Notification {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return append([]*notify.Notification(nil), c.sent...)
+}
+
+// newTestDeferrer creates a deferrer over store at a fixed time and a
+// dispatcher holding notifications with it
+func newTestDeferrer(t *testing.T, store Store, now time.Time, opts ...Option) (*Deferrer, *notify.Dispatcher, *fakeChannel) {
+	ch := &fakeChannel{}
+	d := New(store, zerolog.Nop(), opts...)
+	d.now = func() time.Time { return now }
+	return d, notify.NewDispatcher(zerolog.Nop(), notify.WithChannels(ch), notify.WithHolders(d)), ch
+}
+
+// TestDeferrer tests that notifications arriving during quiet hours are
+// delivered when they end, except urgent ones
+func TestDeferrer(t *testing.T) {
+	ctx := context.Background()
+	// 03:00 in London, in the future as the dispatcher checks expiry
+	// against the real clock
+	night := utc(t, "2027-06-11T02:00:00Z")
+	d, dispatcher, ch := newTestDeferrer(t, NewMemoryStore(), night)
+	userID := uuid.New()
+	require.NoError(t, d.SetSettings(ctx, &Settings{UserID: userID, Start: "23:00", End: "07:00", Timezone: "Europe/London"}))
+
+	require.NoError(t, dispatcher.Dispatch(ctx, &notify.Notification{UserID: userID, Type: "promo", Payload: map[string]string{"message": "Free bet"}, OrderingKey: "promo", Sequence: 1}))
+	require.NoError(t, dispatcher.Dispatch(ctx, &notify.Notification{UserID: userID, Type: "login_alert", Category: "security"}))
+	require.NoError(t, dispatcher.Dispatch(ctx, &notify.Notification{UserID: uuid.New(), Type: "promo"}))
+	require.NoError(t, dispatcher.Dispatch(ctx, &notify.Notification{UserID: userID, Type: "odds_boost", ExpiresAt: night.Add(time.Hour)}))
+	require.NoError(t, dispatcher.Dispatch(ctx, &notify.Notification{UserID: userID, Type: "promo", Channels: []string{"fake"}}))
+	require.Len(t, ch.all(), 3, "urgent, other users' and replayed notifications are not deferred")
+
+	deferred, err := d.Deferred(ctx, userID)
+	require.NoError(t, err)
+	require.Len(t, deferred, 1, "a notification expiring before the morning is dropped")
+	assert.Equal(t, utc(t, "2027-06-11T06:00:00Z"), deferred[0].ReleaseAt)
+
+	d.tick(ctx, dispatcher)
+	assert.Len(t, ch.all(), 3, "still quiet")
+
+	d.now = func() time.Time { return deferred[0].ReleaseAt }
+	d.tick(ctx, dispatcher)
+	sent := ch.all()
+	require.Len(t, sent, 4)
+	n := sent[3]
+	assert.Equal(t, deferred[0].ID, n.ID)
+	assert.Equal(t, "promo", n.Type)
+	assert.Equal(t, map[string]interface{}{"message": "Free bet"}, n.Payload)
+	assert.Equal(t, uint64(1), n.Sequence)
+
+	deferred, err = d.Deferred(ctx, userID)
+	require.NoError(t, err)
+	assert.Empty(t, deferred)
+}
+
+// namedChannel is a fakeChannel under another name
+type namedChannel struct {
+	fakeChannel
+	name string
+}
+
+func (c *namedChannel) Name() string { return c.name }
+
+// TestDeferrer_Channels tests that a deferrer limited to some channels
+// defers only their share of a notification, and nothing bound for the
+// other channels alone
+func TestDeferrer_Channels(t *testing.T) {
+	ctx := context.Background()
+	night := utc(t, "2027-06-11T02:00:00Z")
+	d := New(NewMemoryStore(), zerolog.Nop(), WithChannels(notify.ChannelWebSocket))
+	d.now = func() time.Time { return night }
+	websocket, webhook := &namedChannel{name: notify.ChannelWebSocket}, &namedChannel{name: "webhook"}
+	dispatcher := notify.NewDispatcher(zerolog.Nop(), notify.WithChannels(websocket, webhook), notify.WithHolders(d))
+	userID := uuid.New()
+	require.NoError(t, d.SetSettings(ctx, &Settings{UserID: userID, Start: "23:00", End: "07:00", Timezone: "Europe/London"}))
+
+	require.NoError(t, dispatcher.Dispatch(ctx, &notify.Notification{UserID: userID, Type: "promo"}))
+	assert.Empty(t, websocket.all())
+	assert.Len(t, webhook.all(), 1, "the webhook is not deferred")
+
+	webhookOnly := notify.NewDispatcher(zerolog.Nop(), notify.WithChannels(webhook), notify.WithHolders(d))
+	require.NoError(t, webhookOnly.Dispatch(ctx, &notify.Notification{UserID: userID, Type: "promo"}))
+	assert.Len(t, webhook.all(), 2)
+	deferred, err := d.Deferred(ctx, userID)
+	require.NoError(t, err)
+	require.Len(t, deferred, 1, "a webhook-only notification is not deferred")
+
+	d.now = func() time.Time { return deferred[0].ReleaseAt }
+	d.tick(ctx, dispatcher)
+	assert.Len(t, websocket.all(), 1)
+	assert.Len(t, webhook.all(), 2, "released over the deferred channels alone")
+}
+
+// TestDeferrer_Run tests releasing in the background, and that a
+// notification expiring while deferred is not delivered
+func TestDeferrer_Run(t *testing.T) {
+	ctx := context.Background()
+	now := time.Now()
+	d, dispatcher, ch := newTestDeferrer(t, NewMemoryStore(), now, WithPollInterval(5*time.Millisecond), WithUrgentCategories())
+	d.now = time.Now
+	userID := uuid.New()
+	require.NoError(t, d.SetSettings(ctx, &Settings{UserID: userID, DoNotDisturbUntil: now.Add(50 * time.Millisecond)}))
+
+	require.NoError(t, dispatcher.Dispatch(ctx, &notify.Notification{UserID: userID, Type: "login_alert", Category: "security"}))
+	require.NoError(t, d.store.Defer(ctx, &Item{ID: "stale", UserID: userID, Type: "promo", ReleaseAt: now, ExpiresAt: now}))
+	assert.Empty(t, ch.all(), "no category is urgent")
+
+	go d.Run(t.Context(), dispatcher)
+	require.Eventually(t, func() bool { return len(ch.all()) == 1 }, time.Second, 5*time.Millisecond)
+	assert.Equal(t, "login_alert", ch.all()[0].Type)
+	require.Eventually(t, func() bool {
+		items, _ := d.Deferred(ctx, userID)
+		return len(items) == 0
+	}, time.Second, 5*time.Millisecond)
+	assert.Len(t, ch.all(), 1)
+}
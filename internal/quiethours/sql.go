@@ -0,0 +1,194 @@
+package quiethours
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// SQLStore is a durable Store in the quiet_hours and quiet_hours_deferred
+// tables. Its statements use SQLite syntax; open the *sql.DB with
+// sqlite.Open. Times are kept as Unix milliseconds, with 0 for unset.
+type SQLStore struct {
+	db *sql.DB
+}
+
+// NewSQLStore creates a store over db; call Migrate to create its tables
+func NewSQLStore(db *sql.DB) *SQLStore {
+	return &SQLStore{db: db}
+}
+
+// Migrate creates the quiet hours tables if they do not exist
+func (s *SQLStore) Migrate(ctx context.Context) error {
+	for _, stmt := range []string{
+		`CREATE TABLE IF NOT EXISTS quiet_hours (
+			user_id              TEXT PRIMARY KEY,
+			start                TEXT NOT NULL DEFAULT '',
+			end                  TEXT NOT NULL DEFAULT '',
+			timezone             TEXT NOT NULL DEFAULT '',
+			do_not_disturb_until INTEGER NOT NULL DEFAULT 0,
+			updated_at           INTEGER NOT NULL
+		)`,
+		`CREATE TABLE IF NOT EXISTS quiet_hours_deferred (
+			id            TEXT PRIMARY KEY,
+			user_id       TEXT NOT NULL,
+			type          TEXT NOT NULL,
+			category      TEXT NOT NULL DEFAULT '',
+			payload       BLOB,
+			source        TEXT NOT NULL DEFAULT '',
+			ordering_key  TEXT NOT NULL DEFAULT '',
+			sequence      INTEGER NOT NULL DEFAULT 0,
+			created_at    INTEGER NOT NULL,
+			expires_at    INTEGER NOT NULL DEFAULT 0,
+			release_at    INTEGER NOT NULL,
+			claimed_until INTEGER NOT NULL DEFAULT 0
+		)`,
+		`CREATE INDEX IF NOT EXISTS quiet_hours_deferred_release ON quiet_hours_deferred (release_at)`,
+		`CREATE INDEX IF NOT EXISTS quiet_hours_deferred_user ON quiet_hours_deferred (user_id, release_at)`,
+	} {
+		if _, err := s.db.ExecContext(ctx, stmt); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Settings implements Store
+func (s *SQLStore) Settings(ctx context.Context, userID uuid.UUID) (*Settings, error) {
+	settings := Settings{UserID: userID}
+	var dnd, updatedAt int64
+	err := s.db.QueryRowContext(ctx,
+		`SELECT start, end, timezone, do_not_disturb_until, updated_at FROM quiet_hours WHERE user_id = ?`,
+		userID.String()).Scan(&settings.Start, &settings.End, &settings.Timezone, &dnd, &updatedAt)
+	if err == sql.ErrNoRows {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	settings.DoNotDisturbUntil = fromMillis(dnd)
+	settings.UpdatedAt = fromMillis(updatedAt)
+	return &settings, nil
+}
+
+// SetSettings implements Store
+func (s *SQLStore) SetSettings(ctx context.Context, settings *Settings) error {
+	_, err := s.db.ExecContext(ctx,
+		`INSERT INTO quiet_hours (user_id, start, end, timezone, do_not_disturb_until, updated_at)
+		 VALUES (?, ?, ?, ?, ?, ?)
+		 ON CONFLICT (user_id) DO UPDATE SET
+			start = excluded.start, end = excluded.end, timezone = excluded.timezone,
+			do_not_disturb_until = excluded.do_not_disturb_until, updated_at = excluded.updated_at`,
+		settings.UserID.String(), settings.Start, settings.End, settings.Timezone,
+		millis(settings.DoNotDisturbUntil), millis(settings.UpdatedAt))
+	return err
+}
+
+// DeleteSettings implements Store
+func (s *SQLStore) DeleteSettings(ctx context.Context, userID uuid.UUID) error {
+	res, err := s.db.ExecContext(ctx, `DELETE FROM quiet_hours WHERE user_id = ?`, userID.String())
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+const itemColumns = `id, user_id, type, category, payload, source, ordering_key, sequence, created_at, expires_at, release_at, claimed_until`
+
+// Defer implements Store
+func (s *SQLStore) Defer(ctx context.Context, item *Item) error {
+	_, err := s.db.ExecContext(ctx,
+		`INSERT INTO quiet_hours_deferred (`+itemColumns+`) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, 0)
+		 ON CONFLICT (id) DO NOTHING`,
+		item.ID, item.UserID.String(), item.Type, item.Category, []byte(item.Payload), item.Source,
+		item.OrderingKey, int64(item.Sequence), millis(item.CreatedAt), millis(item.ExpiresAt), millis(item.ReleaseAt))
+	return err
+}
+
+// Due implements Store
+func (s *SQLStore) Due(ctx context.Context, now time.Time, limit int) ([]*Item, error) {
+	return s.items(ctx,
+		`SELECT `+itemColumns+` FROM quiet_hours_deferred WHERE release_at <= ? AND claimed_until <= ?
+		 ORDER BY release_at, created_at, sequence LIMIT ?`,
+		now.UnixMilli(), now.UnixMilli(), limit)
+}
+
+// Claim implements Store
+func (s *SQLStore) Claim(ctx context.Context, id string, now, until time.Time) (bool, error) {
+	res, err := s.db.ExecContext(ctx,
+		`UPDATE quiet_hours_deferred SET claimed_until = ? WHERE id = ? AND claimed_until <= ?`,
+		until.UnixMilli(), id, now.UnixMilli())
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n > 0, err
+}
+
+// Remove implements Store
+func (s *SQLStore) Remove(ctx context.Context, id string) error {
+	_, err := s.db.ExecContext(ctx, `DELETE FROM quiet_hours_deferred WHERE id = ?`, id)
+	return err
+}
+
+// Deferred implements Store
+func (s *SQLStore) Deferred(ctx context.Context, userID uuid.UUID) ([]*Item, error) {
+	return s.items(ctx,
+		`SELECT `+itemColumns+` FROM quiet_hours_deferred WHERE user_id = ?
+		 ORDER BY release_at, created_at, sequence`, userID.String())
+}
+
+func (s *SQLStore) items(ctx context.Context, query string, args ...interface{}) ([]*Item, error) {
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var items []*Item
+	for rows.Next() {
+		var (
+			item                                          Item
+			userID                                        string
+			payload                                       []byte
+			sequence                                      int64
+			createdAt, expiresAt, releaseAt, claimedUntil int64
+		)
+		if err := rows.Scan(&item.ID, &userID, &item.Type, &item.Category, &payload, &item.Source,
+			&item.OrderingKey, &sequence, &createdAt, &expiresAt, &releaseAt, &claimedUntil); err != nil {
+			return nil, err
+		}
+		if item.UserID, err = uuid.Parse(userID); err != nil {
+			return nil, err
+		}
+		if len(payload) > 0 {
+			item.Payload = payload
+		}
+		item.Sequence = uint64(sequence)
+		item.CreatedAt = fromMillis(createdAt)
+		item.ExpiresAt = fromMillis(expiresAt)
+		item.ReleaseAt = fromMillis(releaseAt)
+		item.ClaimedUntil = fromMillis(claimedUntil)
+		items = append(items, &item)
+	}
+	return items, rows.Err()
+}
+
+func millis(t time.Time) int64 {
+	if t.IsZero() {
+		return 0
+	}
+	return t.UnixMilli()
+}
+
+func fromMillis(ms int64) time.Time {
+	if ms == 0 {
+		return time.Time{}
+	}
+	return time.UnixMilli(ms).UTC()
+}
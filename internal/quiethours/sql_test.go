@@ -0,0 +1,75 @@
+package quiethours
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/cypherlabdev/notification-service/internal/notify"
+	"github.com/cypherlabdev/notification-service/internal/sqlite"
+)
+
+// openTestSQLStore opens a store over the database at path; the database
+// is closed when the test ends or closeDB is called
+func openTestSQLStore(t *testing.T, path string) (store *SQLStore, closeDB func()) {
+	db, err := sqlite.Open(context.Background(), path)
+	require.NoError(t, err)
+	t.Cleanup(func() { db.Close() })
+	store = NewSQLStore(db)
+	require.NoError(t, store.Migrate(context.Background()))
+	return store, func() { db.Close() }
+}
+
+func newTestSQLStore(t *testing.T) *SQLStore {
+	store, _ := openTestSQLStore(t, filepath.Join(t.TempDir(), "quiethours.db"))
+	return store
+}
+
+// TestSQLStore_Deferred tests deferring, claiming and removing items
+func TestSQLStore_Deferred(t *testing.T) {
+	testDeferred(t, newTestSQLStore(t))
+}
+
+// TestSQLStore_Settings tests storing and removing settings
+func TestSQLStore_Settings(t *testing.T) {
+	testSettings(t, newTestSQLStore(t))
+}
+
+// TestSQLStore_Reopen tests that a notification deferred before a restart
+// is delivered once quiet hours end
+func TestSQLStore_Reopen(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "quiethours.db")
+	night := utc(t, "2027-06-11T02:00:00Z")
+	userID := uuid.New()
+
+	store, closeDB := openTestSQLStore(t, path)
+	before, dispatcher, ch := newTestDeferrer(t, store, night)
+	require.NoError(t, before.SetSettings(ctx, &Settings{UserID: userID, Start: "23:00", End: "07:00", Timezone: "Europe/London"}))
+	require.NoError(t, dispatcher.Dispatch(ctx, &notify.Notification{UserID: userID, Type: "promo", Payload: map[string]string{"message": "Free bet"}, OrderingKey: "promo", Sequence: 7}))
+	require.Empty(t, ch.all())
+	closeDB()
+
+	store, _ = openTestSQLStore(t, path)
+	after, dispatcher, ch := newTestDeferrer(t, store, night)
+	deferred, err := after.Deferred(ctx, userID)
+	require.NoError(t, err)
+	require.Len(t, deferred, 1)
+	assert.Equal(t, utc(t, "2027-06-11T06:00:00Z"), deferred[0].ReleaseAt)
+
+	after.now = func() time.Time { return deferred[0].ReleaseAt }
+	after.tick(ctx, dispatcher)
+	sent := ch.all()
+	require.Len(t, sent, 1)
+	assert.Equal(t, deferred[0].ID, sent[0].ID)
+	assert.Equal(t, map[string]interface{}{"message": "Free bet"}, sent[0].Payload)
+	assert.Equal(t, uint64(7), sent[0].Sequence)
+	deferred, err = after.Deferred(ctx, userID)
+	require.NoError(t, err)
+	assert.Empty(t, deferred)
+}
@@ -0,0 +1,297 @@
+package quiethours
+
+import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+var (
+	// ErrNotFound is returned for a user without quiet hours or an unknown
+	// deferred item
+	ErrNotFound = errors.New("quiet hours not found")
+	// ErrInvalid is returned for unusable settings
+	ErrInvalid = errors.New("invalid quiet hours")
+)
+
+// Settings are a user's quiet hours and do-not-disturb
+type Settings struct {
+	UserID uuid.UUID `json:"user_id"`
+	// Start and End bound the daily quiet window as local "HH:MM" times,
+	// e.g. 22:00 to 07:00; the window wraps midnight when End is before
+	// Start. Both are empty if the user only uses do-not-disturb.
+	Start string `json:"start,omitempty"`
+	End   string `json:"end,omitempty"`
+	// Timezone is an IANA name; UTC if empty
+	Timezone string `json:"timezone,omitempty"`
+	// DoNotDisturbUntil, if in the future, defers everything until then
+	DoNotDisturbUntil time.Time `json:"do_not_disturb_until,omitzero"`
+	UpdatedAt         time.Time `json:"updated_at"`
+}
+
+func (s *Settings) validate() error {
+	if s.UserID == uuid.Nil {
+		return fmt.Errorf("%w: user_id is required", ErrInvalid)
+	}
+	if (s.Start == "") != (s.End == "") {
+		return fmt.Errorf("%w: start and end must be set together", ErrInvalid)
+	}
+	if s.Start != "" {
+		start, err := parseClock(s.Start)
+		if err != nil {
+			return err
+		}
+		end, err := parseClock(s.End)
+		if err != nil {
+			return err
+		}
+		if start == end {
+			return fmt.Errorf("%w: start and end must differ", ErrInvalid)
+		}
+	}
+	if _, err := time.LoadLocation(s.Timezone); err != nil {
+		return fmt.Errorf("%w: unknown timezone %q", ErrInvalid, s.Timezone)
+	}
+	return nil
+}
+
+// parseClock returns the minutes past midnight of an "HH:MM" time
+func parseClock(s string) (int, error) {
+	t, err := time.Parse("15:04", s)
+	if err != nil {
+		return 0, fmt.Errorf("%w: %q is not an HH:MM time", ErrInvalid, s)
+	}
+	return t.Hour()*60 + t.Minute(), nil
+}
+
+// location returns the user's timezone, UTC if unset or unknown
+func (s *Settings) location() *time.Location {
+	if loc, err := time.LoadLocation(s.Timezone); err == nil {
+		return loc
+	}
+	return time.UTC
+}
+
+// release returns when a notification arriving at t may be delivered: t
+// itself outside do-not-disturb and the quiet window, otherwise the end
+// of them
+func (s *Settings) release(t time.Time) time.Time {
+	if s.DoNotDisturbUntil.After(t) {
+		t = s.DoNotDisturbUntil
+	}
+	if end, ok := s.windowEnd(t); ok {
+		t = end
+	}
+	return t
+}
+
+// windowEnd returns the end of the quiet window t falls in, if it does.
+// The window is on the local clock, so it keeps its local times across
+// DST changes; an end skipped by a spring-forward shift resolves to the
+// first local time after it.
+func (s *Settings) windowEnd(t time.Time) (time.Time, bool) {
+	start, err := parseClock(s.Start)
+	if err != nil {
+		return time.Time{}, false
+	}
+	end, err := parseClock(s.End)
+	if err != nil {
+		return time.Time{}, false
+	}
+	lt := t.In(s.location())
+	clock := lt.Hour()*60 + lt.Minute()
+	quiet := start <= clock && clock < end
+	if end < start {
+		quiet = clock >= start || clock < end
+	}
+	if !quiet {
+		return time.Time{}, false
+	}
+	y, m, d := lt.Date()
+	next := localTime(y, m, d, end, lt.Location())
+	if !next.After(lt) {
+		next = localTime(y, m, d+1, end, lt.Location())
+	}
+	return next, true
+}
+
+// localTime returns the given local minute of the day. time.Date places a
+// time skipped by a DST gap before the gap, so such a time is moved
+// forward by the size of the gap.
+func localTime(y int, m time.Month, d, minute int, loc *time.Location) time.Time {
+	t := time.Date(y, m, d, 0, minute, 0, 0, loc)
+	if want := time.Date(y, m, d, 0, minute, 0, 0, time.UTC); t.Hour() != want.Hour() {
+		_, before := t.Zone()
+		_, after := t.Add(3 * time.Hour).Zone()
+		t = t.Add(time.Duration(after-before) * time.Second)
+	}
+	return t
+}
+
+// Item is a notification deferred until its user's quiet hours end
+type Item struct {
+	ID          string          `json:"id"`
+	UserID      uuid.UUID       `json:"user_id"`
+	Type        string          `json:"type"`
+	Category    string          `json:"category,omitempty"`
+	Payload     json.RawMessage `json:"payload,omitempty"`
+	Source      string          `json:"source,omitempty"`
+	OrderingKey string          `json:"ordering_key,omitempty"`
+	Sequence    uint64          `json:"sequence,omitempty"`
+	CreatedAt   time.Time       `json:"created_at"`
+	ExpiresAt   time.Time       `json:"expires_at,omitzero"`
+	// ReleaseAt is when the item is delivered
+	ReleaseAt time.Time `json:"release_at"`
+	// ClaimedUntil is set while a replica delivers the item; the item is
+	// due again if it is not removed by then
+	ClaimedUntil time.Time `json:"-"`
+}
+
+// Store persists quiet hours and deferred items
+type Store interface {
+	Settings(ctx context.Context, userID uuid.UUID) (*Settings, error)
+	SetSettings(ctx context.Context, s *Settings) error
+	// DeleteSettings removes the user's settings, or returns ErrNotFound
+	DeleteSettings(ctx context.Context, userID uuid.UUID) error
+
+	// Defer stores an item; deferring an ID again is a no-op
+	Defer(ctx context.Context, item *Item) error
+	// Due returns up to limit unclaimed items with ReleaseAt at or before
+	// now, earliest first
+	Due(ctx context.Context, now time.Time, limit int) ([]*Item, error)
+	// Claim marks an item as being delivered until the given time,
+	// reporting false if it is gone or claimed by someone else
+	Claim(ctx context.Context, id string, now, until time.Time) (bool, error)
+	// Remove deletes a delivered item
+	Remove(ctx context.Context, id string) error
+	// Deferred returns the user's deferred items, earliest release first
+	Deferred(ctx context.Context, userID uuid.UUID) ([]*Item, error)
+}
+
+// MemoryStore is a non-durable Store for tests and single-instance setups
+type MemoryStore struct {
+	settings map[uuid.UUID]Settings
+	items    map[string]Item
+	mu       sync.Mutex
+}
+
+// NewMemoryStore creates an empty in-memory store
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		settings: make(map[uuid.UUID]Settings),
+		items:    make(map[string]Item),
+	}
+}
+
+// Settings implements Store
+func (s *MemoryStore) Settings(_ context.Context, userID uuid.UUID) (*Settings, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	settings, ok := s.settings[userID]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return &settings, nil
+}
+
+// SetSettings implements Store
+func (s *MemoryStore) SetSettings(_ context.Context, settings *Settings) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.settings[settings.UserID] = *settings
+	return nil
+}
+
+// DeleteSettings implements Store
+func (s *MemoryStore) DeleteSettings(_ context.Context, userID uuid.UUID) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.settings[userID]; !ok {
+		return ErrNotFound
+	}
+	delete(s.settings, userID)
+	return nil
+}
+
+// Defer implements Store
+func (s *MemoryStore) Defer(_ context.Context, item *Item) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.items[item.ID]; !ok {
+		s.items[item.ID] = *item
+	}
+	return nil
+}
+
+// Due implements Store
+func (s *MemoryStore) Due(_ context.Context, now time.Time, limit int) ([]*Item, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var due []*Item
+	for _, item := range s.items {
+		if !item.ReleaseAt.After(now) && !item.ClaimedUntil.After(now) {
+			due = append(due, &item)
+		}
+	}
+	sortItems(due)
+	if len(due) > limit {
+		due = due[:limit]
+	}
+	return due, nil
+}
+
+// Claim implements Store
+func (s *MemoryStore) Claim(_ context.Context, id string, now, until time.Time) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	item, ok := s.items[id]
+	if !ok || item.ClaimedUntil.After(now) {
+		return false, nil
+	}
+	item.ClaimedUntil = until
+	s.items[id] = item
+	return true, nil
+}
+
+// Remove implements Store
+func (s *MemoryStore) Remove(_ context.Context, id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.items, id)
+	return nil
+}
+
+// Deferred implements Store
+func (s *MemoryStore) Deferred(_ context.Context, userID uuid.UUID) ([]*Item, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var items []*Item
+	for _, item := range s.items {
+		if item.UserID == userID {
+			items = append(items, &item)
+		}
+	}
+	sortItems(items)
+	return items, nil
+}
+
+// sortItems orders items by release time, then arrival, so notifications
+// deferred together are delivered in the order they came in
+func sortItems(items []*Item) {
+	slices.SortFunc(items, func(a, b *Item) int {
+		if c := a.ReleaseAt.Compare(b.ReleaseAt); c != 0 {
+			return c
+		}
+		if c := a.CreatedAt.Compare(b.CreatedAt); c != 0 {
+			return c
+		}
+		return cmp.Compare(a.Sequence, b.Sequence)
+	})
+}
@@ -0,0 +1,130 @@
+package quiethours
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func utc(t *testing.T, s string) time.Time {
+	ts, err := time.Parse(time.RFC3339, s)
+	require.NoError(t, err)
+	return ts
+}
+
+// TestSettings_Release tests when notifications are released, in the
+// user's timezone and across DST changes
+func TestSettings_Release(t *testing.T) {
+	night := &Settings{Start: "22:00", End: "07:00", Timezone: "America/New_York"}
+	afternoon := &Settings{Start: "13:00", End: "14:30"}
+	dnd := &Settings{DoNotDisturbUntil: utc(t, "2026-06-10T12:00:00Z")}
+	both := &Settings{Start: "22:00", End: "07:00", Timezone: "America/New_York", DoNotDisturbUntil: utc(t, "2026-06-11T03:00:00Z")}
+
+	tests := []struct {
+		name     string
+		settings *Settings
+		at       string
+		release  string
+	}{
+		{"before the window", night, "2026-06-10T21:00:00Z", "2026-06-10T21:00:00Z"},
+		{"late evening", night, "2026-06-11T03:00:00Z", "2026-06-11T11:00:00Z"},
+		{"after midnight", night, "2026-06-11T08:00:00Z", "2026-06-11T11:00:00Z"},
+		{"at the end", night, "2026-06-11T11:00:00Z", "2026-06-11T11:00:00Z"},
+		{"into DST", night, "2026-03-08T05:00:00Z", "2026-03-08T11:00:00Z"},
+		{"out of DST", night, "2026-11-01T05:00:00Z", "2026-11-01T12:00:00Z"},
+		{"end skipped by DST", &Settings{Start: "01:00", End: "02:30", Timezone: "America/New_York"}, "2026-03-08T06:30:00Z", "2026-03-08T07:30:00Z"},
+		{"same day window", afternoon, "2026-06-10T13:15:00Z", "2026-06-10T14:30:00Z"},
+		{"outside same day window", afternoon, "2026-06-10T15:00:00Z", "2026-06-10T15:00:00Z"},
+		{"do not disturb", dnd, "2026-06-10T09:00:00Z", "2026-06-10T12:00:00Z"},
+		{"do not disturb over", dnd, "2026-06-10T13:00:00Z", "2026-06-10T13:00:00Z"},
+		{"do not disturb into quiet hours", both, "2026-06-10T20:00:00Z", "2026-06-11T11:00:00Z"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, utc(t, tt.release), tt.settings.release(utc(t, tt.at)).UTC())
+		})
+	}
+}
+
+// TestSettings_Validate tests rejecting unusable settings
+func TestSettings_Validate(t *testing.T) {
+	valid := Settings{UserID: uuid.New(), Start: "22:00", End: "07:00", Timezone: "Europe/London"}
+	assert.NoError(t, valid.validate())
+	assert.NoError(t, (&Settings{UserID: uuid.New(), DoNotDisturbUntil: time.Now()}).validate())
+
+	for name, change := range map[string]func(s *Settings){
+		"no user":     func(s *Settings) { s.UserID = uuid.Nil },
+		"no end":      func(s *Settings) { s.End = "" },
+		"bad clock":   func(s *Settings) { s.Start = "25:00" },
+		"empty range": func(s *Settings) { s.End = s.Start },
+		"timezone":    func(s *Settings) { s.Timezone = "Mars/Olympus" },
+	} {
+		s := valid
+		change(&s)
+		assert.ErrorIs(t, s.validate(), ErrInvalid, name)
+	}
+}
+
+// TestMemoryStore_Deferred tests deferring, claiming and removing items
+func TestMemoryStore_Deferred(t *testing.T) {
+	testDeferred(t, NewMemoryStore())
+}
+
+func testDeferred(t *testing.T, s Store) {
+	ctx := context.Background()
+	now := time.Now()
+	alice, bob := uuid.New(), uuid.New()
+
+	require.NoError(t, s.Defer(ctx, &Item{ID: "n2", UserID: alice, CreatedAt: now, ReleaseAt: now.Add(-time.Minute)}))
+	require.NoError(t, s.Defer(ctx, &Item{ID: "n1", UserID: alice, CreatedAt: now.Add(-time.Second), ReleaseAt: now.Add(-time.Minute)}))
+	require.NoError(t, s.Defer(ctx, &Item{ID: "n3", UserID: bob, CreatedAt: now, ReleaseAt: now.Add(time.Hour)}))
+	require.NoError(t, s.Defer(ctx, &Item{ID: "n1", UserID: alice, ReleaseAt: now.Add(time.Hour)}))
+
+	due, err := s.Due(ctx, now, 10)
+	require.NoError(t, err)
+	require.Len(t, due, 2)
+	assert.Equal(t, "n1", due[0].ID, "deferring an ID again is a no-op")
+
+	claimed, err := s.Claim(ctx, "n1", now, now.Add(time.Minute))
+	require.NoError(t, err)
+	assert.True(t, claimed)
+	claimed, err = s.Claim(ctx, "n1", now, now.Add(time.Minute))
+	require.NoError(t, err)
+	assert.False(t, claimed, "claimed by another replica")
+	due, err = s.Due(ctx, now, 10)
+	require.NoError(t, err)
+	assert.Len(t, due, 1)
+	due, err = s.Due(ctx, now.Add(2*time.Minute), 10)
+	require.NoError(t, err)
+	assert.Len(t, due, 2, "an expired claim is due again")
+
+	require.NoError(t, s.Remove(ctx, "n1"))
+	items, err := s.Deferred(ctx, alice)
+	require.NoError(t, err)
+	require.Len(t, items, 1)
+	assert.Equal(t, "n2", items[0].ID)
+}
+
+// TestMemoryStore_Settings tests storing and removing settings
+func TestMemoryStore_Settings(t *testing.T) {
+	testSettings(t, NewMemoryStore())
+}
+
+func testSettings(t *testing.T, s Store) {
+	ctx := context.Background()
+	userID := uuid.New()
+
+	_, err := s.Settings(ctx, userID)
+	assert.ErrorIs(t, err, ErrNotFound)
+	require.NoError(t, s.SetSettings(ctx, &Settings{UserID: userID, Start: "22:00", End: "07:00"}))
+	settings, err := s.Settings(ctx, userID)
+	require.NoError(t, err)
+	assert.Equal(t, "22:00", settings.Start)
+
+	require.NoError(t, s.DeleteSettings(ctx, userID))
+	assert.ErrorIs(t, s.DeleteSettings(ctx, userID), ErrNotFound)
+}
@@ -0,0 +1,75 @@
+package ratelimit
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type fakeClock struct {
+	t time.Time
+}
+
+func (c *fakeClock) now() time.Time { return c.t }
+
+// TestBucket_Burst tests that a new bucket allows its burst and then refuses
+func TestBucket_Burst(t *testing.T) {
+	clock := &fakeClock{t: time.Unix(0, 0)}
+	b := newBucket(1, 3, clock.now)
+
+	assert.True(t, b.Allow())
+	assert.True(t, b.Allow())
+	assert.True(t, b.Allow())
+	assert.False(t, b.Allow())
+}
+
+// TestBucket_Refill tests that tokens are refilled at the configured rate up to the burst
+func TestBucket_Refill(t *testing.T) {
+	clock := &fakeClock{t: time.Unix(0, 0)}
+	b := newBucket(2, 2, clock.now)
+
+	assert.True(t, b.Allow())
+	assert.True(t, b.Allow())
+	assert.False(t, b.Allow())
+
+	clock.t = clock.t.Add(500 * time.Millisecond)
+	assert.True(t, b.Allow())
+	assert.False(t, b.Allow())
+
+	// A long idle period never exceeds the burst
+	clock.t = clock.t.Add(time.Hour)
+	assert.True(t, b.Allow())
+	assert.True(t, b.Allow())
+	assert.False(t, b.Allow())
+}
+
+// TestBucket_Wait tests that Wait paces callers at the refill rate and honours cancellation
+func TestBucket_Wait(t *testing.T) {
+	b := NewBucket(100, 1)
+	start := time.Now()
+	for i := 0; i < 5; i++ {
+		assert.NoError(t, b.Wait(context.Background()))
+	}
+	// One token from the burst, then four at 10ms intervals
+	assert.GreaterOrEqual(t, time.Since(start), 35*time.Millisecond)
+
+	slow := NewBucket(0.01, 1)
+	assert.NoError(t, slow.Wait(context.Background()))
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	assert.ErrorIs(t, slow.Wait(ctx), context.DeadlineExceeded)
+}
+
+// TestKeyedLimiter tests that keys are limited independently
+func TestKeyedLimiter(t *testing.T) {
+	l := NewKeyedLimiter(0, 1)
+
+	assert.True(t, l.Allow("a"))
+	assert.False(t, l.Allow("a"))
+	assert.True(t, l.Allow("b"))
+
+	l.Forget("a")
+	assert.True(t, l.Allow("a"))
+}
@@ -0,0 +1,52 @@
+package ratelimit
+
+import "sync"
+
+// ConnLimiter caps the number of concurrent holders per key
+type ConnLimiter struct {
+	max    int
+	counts map[string]int
+	mu     sync.Mutex
+}
+
+// NewConnLimiter creates a limiter allowing up to max concurrent holders per key;
+// max <= 0 disables the cap
+func NewConnLimiter(max int) *ConnLimiter {
+	return &ConnLimiter{
+		max:    max,
+		counts: make(map[string]int),
+	}
+}
+
+// Acquire reserves a slot for key, returning false if the key is at its cap
+func (l *ConnLimiter) Acquire(key string) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.max > 0 && l.counts[key] >= l.max {
+		return false
+	}
+	l.counts[key]++
+	return true
+}
+
+// Release frees a slot for key and returns the number of slots still held
+func (l *ConnLimiter) Release(key string) int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	n := l.counts[key] - 1
+	if n <= 0 {
+		delete(l.counts, key)
+		return 0
+	}
+	l.counts[key] = n
+	return n
+}
+
+// Count returns the number of slots held for key
+func (l *ConnLimiter) Count(key string) int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.counts[key]
+}
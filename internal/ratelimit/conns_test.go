@@ -0,0 +1,33 @@
+package ratelimit
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// TestConnLimiter tests acquiring and releasing connection slots
+func TestConnLimiter(t *testing.T) {
+	l := NewConnLimiter(2)
+
+	assert.True(t, l.Acquire("1.2.3.4"))
+	assert.True(t, l.Acquire("1.2.3.4"))
+	assert.False(t, l.Acquire("1.2.3.4"))
+	assert.True(t, l.Acquire("5.6.7.8"))
+	assert.Equal(t, 2, l.Count("1.2.3.4"))
+
+	assert.Equal(t, 1, l.Release("1.2.3.4"))
+	assert.True(t, l.Acquire("1.2.3.4"))
+
+	assert.Equal(t, 1, l.Release("1.2.3.4"))
+	assert.Equal(t, 0, l.Release("1.2.3.4"))
+	assert.Equal(t, 0, l.Count("1.2.3.4"))
+}
+
+// TestConnLimiter_Unlimited tests that a non-positive max disables the cap
+func TestConnLimiter_Unlimited(t *testing.T) {
+	l := NewConnLimiter(0)
+	for i := 0; i < 100; i++ {
+		assert.True(t, l.Acquire("key"))
+	}
+}
@@ -0,0 +1,68 @@
+package scheduler
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestParseCron_Errors tests that malformed expressions are rejected
+func TestParseCron_Errors(t *testing.T) {
+	for _, expr := range []string{"", "* * * *", "60 * * * *", "* 24 * * *", "* * 0 * *", "* * * 13 *", "* * * * 8", "*/0 * * * *", "5-1 * * * *", "a * * * *", "@yearly"} {
+		_, err := ParseCron(expr)
+		assert.Error(t, err, expr)
+	}
+}
+
+// TestCron_Next tests finding the next matching minute
+func TestCron_Next(t *testing.T) {
+	base := time.Date(2026, 3, 4, 10, 17, 30, 0, time.UTC) // a Wednesday
+	cases := map[string]time.Time{
+		"* * * * *":      time.Date(2026, 3, 4, 10, 18, 0, 0, time.UTC),
+		"*/15 * * * *":   time.Date(2026, 3, 4, 10, 30, 0, 0, time.UTC),
+		"50 9 * * *":     time.Date(2026, 3, 5, 9, 50, 0, 0, time.UTC),
+		"@daily":         time.Date(2026, 3, 5, 0, 0, 0, 0, time.UTC),
+		"@hourly":        time.Date(2026, 3, 4, 11, 0, 0, 0, time.UTC),
+		"0 8-18/2 * * *": time.Date(2026, 3, 4, 12, 0, 0, 0, time.UTC),
+		"0 9 * * 1-5":    time.Date(2026, 3, 5, 9, 0, 0, 0, time.UTC),
+		"0 9 * * 7":      time.Date(2026, 3, 8, 9, 0, 0, 0, time.UTC),
+		"0 0 1 * *":      time.Date(2026, 4, 1, 0, 0, 0, 0, time.UTC),
+		"0 0 29 2 *":     time.Date(2028, 2, 29, 0, 0, 0, 0, time.UTC),
+		// Day of month and day of week both restricted: either matches
+		"0 0 13 * 5": time.Date(2026, 3, 6, 0, 0, 0, 0, time.UTC),
+	}
+	for expr, want := range cases {
+		c, err := ParseCron(expr)
+		require.NoError(t, err, expr)
+		assert.Equal(t, want, c.Next(base), expr)
+	}
+
+	never, err := ParseCron("0 0 31 2 *")
+	require.NoError(t, err)
+	assert.True(t, never.Next(base).IsZero())
+}
+
+// TestCron_Next_DST tests schedules across daylight-saving transitions
+func TestCron_Next_DST(t *testing.T) {
+	berlin, err := time.LoadLocation("Europe/Berlin")
+	require.NoError(t, err)
+
+	// 02:30 does not exist on 29 March 2026 in Berlin; that day is skipped
+	c, _ := ParseCron("30 2 * * *")
+	next := c.Next(time.Date(2026, 3, 28, 12, 0, 0, 0, berlin))
+	assert.Equal(t, time.Date(2026, 3, 30, 2, 30, 0, 0, berlin), next)
+
+	// 02:30 happens twice on 25 October 2026; it fires once
+	first := c.Next(time.Date(2026, 10, 25, 0, 0, 0, 0, berlin))
+	assert.Equal(t, 25, first.Day())
+	second := c.Next(first)
+	assert.Equal(t, time.Date(2026, 10, 26, 2, 30, 0, 0, berlin), second)
+
+	// A daily 09:00 stays at 09:00 local time across the change
+	daily, _ := ParseCron("0 9 * * *")
+	next = daily.Next(time.Date(2026, 3, 28, 10, 0, 0, 0, berlin))
+	assert.Equal(t, 9, next.Hour())
+	assert.Equal(t, 29, next.Day())
+}
@@ -0,0 +1,29 @@
+package scheduler
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var (
+	scheduled = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: "notification",
+		Subsystem: "scheduler",
+		Name:      "scheduled_total",
+		Help:      "Notifications scheduled for later delivery.",
+	})
+
+	fired = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "notification",
+		Subsystem: "scheduler",
+		Name:      "fired_total",
+		Help:      "Scheduled notifications fired, by result.",
+	}, []string{"result"})
+
+	leader = promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: "notification",
+		Subsystem: "scheduler",
+		Name:      "leader",
+		Help:      "Whether this replica holds the scheduler lease.",
+	})
+)
@@ -0,0 +1,313 @@
+// Package scheduler sends notifications at a later time or on a recurring
+// cron schedule. Jobs live in a Store so they survive restarts; when
+// several processes share a store, a lease elects the one that fires them.
+package scheduler
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/rs/zerolog"
+
+	"github.com/cypherlabdev/notification-service/internal/notify"
+)
+
+const (
+	leaseName           = "notification-scheduler"
+	defaultPollInterval = time.Second
+	defaultLeaseTTL     = 15 * time.Second
+	// dueBatch bounds the jobs fired per poll
+	dueBatch = 100
+)
+
+// ErrInvalid wraps validation failures of a schedule request
+var ErrInvalid = errors.New("invalid schedule")
+
+// Dispatcher delivers fired notifications; *notify.Dispatcher implements it
+type Dispatcher interface {
+	Dispatch(ctx context.Context, n *notify.Notification) error
+}
+
+// Request describes a notification to schedule. Exactly one of SendAt,
+// Delay and Cron must be set.
+type Request struct {
+	// ID identifies the notification for cancellation; generated if empty
+	ID       string
+	UserID   uuid.UUID
+	Type     string
+	Category string
+	Payload  json.RawMessage
+	SendAt   time.Time
+	Delay    time.Duration
+	Cron     string
+	Timezone string
+	// TTL drops each run not delivered within TTL of falling due
+	TTL time.Duration
+}
+
+// Option configures a Scheduler
+type Option func(*Scheduler)
+
+// WithPollInterval sets how often the store is checked for due jobs
+func WithPollInterval(interval time.Duration) Option {
+	return func(s *Scheduler) {
+		s.pollInterval = interval
+	}
+}
+
+// WithLeaseTTL sets how long leadership lasts without renewal. It should
+// be several poll intervals so a healthy leader never loses it.
+func WithLeaseTTL(ttl time.Duration) Option {
+	return func(s *Scheduler) {
+		s.leaseTTL = ttl
+	}
+}
+
+// WithHolder sets the name this replica takes the lease under, such as its
+// pod name; a random ID by default
+func WithHolder(holder string) Option {
+	return func(s *Scheduler) {
+		s.holder = holder
+	}
+}
+
+// Scheduler stores scheduled notifications and fires them when due
+type Scheduler struct {
+	store        Store
+	dispatcher   Dispatcher
+	holder       string
+	pollInterval time.Duration
+	leaseTTL     time.Duration
+	leader       atomic.Bool
+	logger       zerolog.Logger
+	now          func() time.Time
+}
+
+// New creates a scheduler over store; call Run to start firing jobs
+func New(store Store, dispatcher Dispatcher, logger zerolog.Logger, opts ...Option) *Scheduler {
+	s := &Scheduler{
+		store:        store,
+		dispatcher:   dispatcher,
+		holder:       uuid.New().String(),
+		pollInterval: defaultPollInterval,
+		leaseTTL:     defaultLeaseTTL,
+		logger:       logger.With().Str("component", "scheduler").Logger(),
+		now:          time.Now,
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	s.logger = s.logger.With().Str("holder", s.holder).Logger()
+	return s
+}
+
+// Schedule validates and stores a request, returning the pending job
+func (s *Scheduler) Schedule(ctx context.Context, req Request) (*Job, error) {
+	if req.UserID == uuid.Nil || req.Type == "" {
+		return nil, fmt.Errorf("%w: user_id and type are required", ErrInvalid)
+	}
+	set := 0
+	for _, isSet := range []bool{!req.SendAt.IsZero(), req.Delay != 0, req.Cron != ""} {
+		if isSet {
+			set++
+		}
+	}
+	if set != 1 {
+		return nil, fmt.Errorf("%w: exactly one of send_at, delay and cron is required", ErrInvalid)
+	}
+	if len(req.Payload) > 0 && !json.Valid(req.Payload) {
+		return nil, fmt.Errorf("%w: payload is not valid JSON", ErrInvalid)
+	}
+
+	now := s.now()
+	job := &Job{
+		ID:         req.ID,
+		UserID:     req.UserID,
+		Type:       req.Type,
+		Category:   req.Category,
+		Payload:    req.Payload,
+		SendAt:     req.SendAt.UTC(),
+		Status:     StatusPending,
+		TTLSeconds: int64(req.TTL / time.Second),
+		CreatedAt:  now.UTC(),
+	}
+	if job.ID == "" {
+		job.ID = uuid.New().String()
+	}
+	switch {
+	case req.TTL < 0 || (req.TTL > 0 && req.TTL < time.Second):
+		return nil, fmt.Errorf("%w: ttl must be at least one second", ErrInvalid)
+	case req.Delay < 0:
+		return nil, fmt.Errorf("%w: delay must be positive", ErrInvalid)
+	case req.Delay > 0:
+		job.SendAt = now.Add(req.Delay).UTC()
+	case req.Cron != "":
+		next, err := nextRun(req.Cron, req.Timezone, now)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalid, err)
+		}
+		job.Cron, job.Timezone, job.SendAt = req.Cron, req.Timezone, next
+	}
+
+	if err := s.store.Create(ctx, job); err != nil {
+		return nil, err
+	}
+	scheduled.Inc()
+	return job, nil
+}
+
+// Get returns a scheduled job by notification ID
+func (s *Scheduler) Get(ctx context.Context, id string) (*Job, error) {
+	return s.store.Get(ctx, id)
+}
+
+// Cancel stops a pending job from firing, including future runs of a
+// recurring one
+func (s *Scheduler) Cancel(ctx context.Context, id string) error {
+	return s.store.Cancel(ctx, id)
+}
+
+// Leader reports whether this replica currently fires jobs
+func (s *Scheduler) Leader() bool {
+	return s.leader.Load()
+}
+
+// Run polls for due jobs until ctx is cancelled, firing them while this
+// replica holds the lease
+func (s *Scheduler) Run(ctx context.Context) {
+	ticker := time.NewTicker(s.pollInterval)
+	defer ticker.Stop()
+
+	for {
+		s.tick(ctx)
+		select {
+		case <-ctx.Done():
+			if s.leader.Swap(false) {
+				leader.Set(0)
+				if err := s.store.ReleaseLease(context.WithoutCancel(ctx), leaseName, s.holder); err != nil {
+					s.logger.Warn().Err(err).Msg("failed to release scheduler lease")
+				}
+			}
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// tick renews leadership and fires the due jobs if this replica leads
+func (s *Scheduler) tick(ctx context.Context) {
+	ok, err := s.store.AcquireLease(ctx, leaseName, s.holder, s.now(), s.leaseTTL)
+	if err != nil {
+		s.logger.Error().Err(err).Msg("failed to acquire scheduler lease")
+		ok = false
+	}
+	if was := s.leader.Swap(ok); was != ok {
+		s.logger.Info().Bool("leader", ok).Msg("scheduler leadership changed")
+		if ok {
+			leader.Set(1)
+		} else {
+			leader.Set(0)
+		}
+	}
+	if !ok {
+		return
+	}
+
+	jobs, err := s.store.Due(ctx, s.now(), dueBatch)
+	if err != nil {
+		s.logger.Error().Err(err).Msg("failed to load due notifications")
+		return
+	}
+	for _, job := range jobs {
+		if ctx.Err() != nil {
+			return
+		}
+		s.fire(ctx, job)
+	}
+}
+
+// fire dispatches a due job and records the outcome, rescheduling
+// recurring jobs from the current time so downtime does not cause a burst
+func (s *Scheduler) fire(ctx context.Context, job *Job) {
+	id := job.ID
+	if job.Cron != "" {
+		id += ":" + strconv.FormatInt(job.SendAt.Unix(), 10)
+	}
+	var payload interface{}
+	if len(job.Payload) > 0 {
+		json.Unmarshal(job.Payload, &payload)
+	}
+	var expiresAt time.Time
+	if job.TTLSeconds > 0 {
+		expiresAt = job.SendAt.Add(time.Duration(job.TTLSeconds) * time.Second)
+	}
+
+	err := notify.ErrExpired
+	if expiresAt.IsZero() || s.now().Before(expiresAt) {
+		err = s.dispatcher.Dispatch(ctx, &notify.Notification{
+			ID:        id,
+			UserID:    job.UserID,
+			Type:      job.Type,
+			Category:  job.Category,
+			Payload:   payload,
+			Source:    "schedule:" + job.ID,
+			ExpiresAt: expiresAt,
+			// A run fired again after losing the lease mid-dispatch is dropped
+			IdempotencyKey: "schedule:" + id,
+		})
+	}
+	job.Runs++
+	job.LastError = ""
+	job.Status = StatusSent
+	switch {
+	case errors.Is(err, notify.ErrExpired):
+		fired.WithLabelValues("expired").Inc()
+		job.Status = StatusExpired
+		s.logger.Info().Str("notification_id", id).Time("due", job.SendAt).Msg("scheduled notification expired before it could be sent")
+	case err != nil:
+		fired.WithLabelValues("failed").Inc()
+		job.LastError = err.Error()
+		job.Status = StatusFailed
+		s.logger.Warn().Err(err).Str("notification_id", id).Msg("scheduled notification failed")
+	default:
+		fired.WithLabelValues("sent").Inc()
+	}
+
+	if job.Cron != "" {
+		next, cronErr := nextRun(job.Cron, job.Timezone, s.now())
+		if cronErr == nil && !next.IsZero() {
+			job.SendAt, job.Status = next, StatusPending
+		}
+	}
+	err = s.store.Update(ctx, job)
+	switch {
+	case errors.Is(err, ErrConflict):
+		s.logger.Info().Str("notification_id", job.ID).Msg("scheduled notification was cancelled while it was sent")
+	case err != nil:
+		s.logger.Error().Err(err).Str("notification_id", job.ID).Msg("failed to record scheduled notification")
+	}
+}
+
+// nextRun returns the first run of a cron expression after now, evaluated
+// in the named timezone
+func nextRun(expr, timezone string, now time.Time) (time.Time, error) {
+	cron, err := ParseCron(expr)
+	if err != nil {
+		return time.Time{}, err
+	}
+	loc, err := time.LoadLocation(timezone)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("unknown timezone %q", timezone)
+	}
+	next := cron.Next(now.In(loc))
+	if next.IsZero() {
+		return time.Time{}, fmt.Errorf("cron %q never fires", expr)
+	}
+	return next.UTC(), nil
+}
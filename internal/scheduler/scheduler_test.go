@@ -0,0 +1,309 @@
+package scheduler
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/cypherlabdev/notification-service/internal/notify"
+)
+
+type fakeDispatcher struct {
+	err  error
+	sent []*notify.Notification
+	mu   sync.Mutex
+}
+
+func (d *fakeDispatcher) Dispatch(_ context.Context, n *notify.Notification) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.err != nil {
+		return d.err
+	}
+	d.sent = append(d.sent, n)
+	return nil
+}
+
+func (d *fakeDispatcher) ids() []string {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	ids := make([]string, len(d.sent))
+	for i, n := range d.sent {
+		ids[i] = n.ID
+	}
+	return ids
+}
+
+type fakeClock struct {
+	t  time.Time
+	mu sync.Mutex
+}
+
+func (c *fakeClock) now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.t
+}
+
+func (c *fakeClock) advance(d time.Duration) {
+	c.mu.Lock()
+	c.t = c.t.Add(d)
+	c.mu.Unlock()
+}
+
+func newTestScheduler(store Store, dispatcher Dispatcher, clock *fakeClock, holder string) *Scheduler {
+	s := New(store, dispatcher, zerolog.Nop(), WithHolder(holder), WithLeaseTTL(10*time.Second))
+	s.now = clock.now
+	return s
+}
+
+// TestScheduler_Delay tests that delayed and timed notifications fire once when due
+func TestScheduler_Delay(t *testing.T) {
+	ctx := context.Background()
+	clock := &fakeClock{t: time.Date(2026, 5, 1, 12, 0, 0, 0, time.UTC)}
+	dispatcher := &fakeDispatcher{}
+	s := newTestScheduler(NewMemoryStore(), dispatcher, clock, "a")
+	userID := uuid.New()
+
+	delayed, err := s.Schedule(ctx, Request{ID: "reminder-1", UserID: userID, Type: "reminder", Delay: 10 * time.Minute, Payload: []byte(`{"market":"m-1"}`)})
+	require.NoError(t, err)
+	assert.Equal(t, clock.now().Add(10*time.Minute), delayed.SendAt)
+	_, err = s.Schedule(ctx, Request{UserID: userID, Type: "promo", SendAt: clock.now().Add(time.Hour)})
+	require.NoError(t, err)
+
+	s.tick(ctx)
+	assert.Empty(t, dispatcher.ids())
+
+	clock.advance(10 * time.Minute)
+	s.tick(ctx)
+	s.tick(ctx)
+	assert.Equal(t, []string{"reminder-1"}, dispatcher.ids())
+	assert.Equal(t, map[string]interface{}{"market": "m-1"}, dispatcher.sent[0].Payload)
+	assert.Equal(t, "schedule:reminder-1", dispatcher.sent[0].Source)
+
+	job, err := s.Get(ctx, "reminder-1")
+	require.NoError(t, err)
+	assert.Equal(t, StatusSent, job.Status)
+	assert.Equal(t, 1, job.Runs)
+
+	clock.advance(time.Hour)
+	s.tick(ctx)
+	assert.Len(t, dispatcher.ids(), 2)
+}
+
+// TestScheduler_Cron tests that recurring jobs reschedule after each run
+func TestScheduler_Cron(t *testing.T) {
+	ctx := context.Background()
+	clock := &fakeClock{t: time.Date(2026, 5, 1, 8, 30, 0, 0, time.UTC)}
+	dispatcher := &fakeDispatcher{}
+	s := newTestScheduler(NewMemoryStore(), dispatcher, clock, "a")
+
+	job, err := s.Schedule(ctx, Request{ID: "digest", UserID: uuid.New(), Type: "daily_digest", Cron: "0 9 * * *", Timezone: "Europe/Berlin"})
+	require.NoError(t, err)
+	// 09:00 in Berlin is 07:00 UTC, so the first run is the next morning
+	assert.Equal(t, time.Date(2026, 5, 2, 7, 0, 0, 0, time.UTC), job.SendAt)
+
+	clock.advance(23 * time.Hour)
+	s.tick(ctx)
+	job, _ = s.Get(ctx, "digest")
+	assert.Equal(t, StatusPending, job.Status)
+	assert.Equal(t, time.Date(2026, 5, 3, 7, 0, 0, 0, time.UTC), job.SendAt)
+
+	// After downtime the job fires once and resumes from the current time
+	clock.advance(72 * time.Hour)
+	s.tick(ctx)
+	job, _ = s.Get(ctx, "digest")
+	assert.Equal(t, 2, job.Runs)
+	assert.Equal(t, time.Date(2026, 5, 6, 7, 0, 0, 0, time.UTC), job.SendAt)
+	assert.Equal(t, []string{"digest:1777705200", "digest:1777791600"}, dispatcher.ids())
+
+	require.NoError(t, s.Cancel(ctx, "digest"))
+	clock.advance(48 * time.Hour)
+	s.tick(ctx)
+	assert.Len(t, dispatcher.ids(), 2)
+	assert.ErrorIs(t, s.Cancel(ctx, "digest"), ErrNotFound)
+}
+
+// TestScheduler_Failure tests that dispatch failures are recorded on the job
+func TestScheduler_Failure(t *testing.T) {
+	ctx := context.Background()
+	clock := &fakeClock{t: time.Now()}
+	s := newTestScheduler(NewMemoryStore(), &fakeDispatcher{err: errors.New("hub saturated")}, clock, "a")
+
+	_, err := s.Schedule(ctx, Request{ID: "x", UserID: uuid.New(), Type: "t", Delay: time.Second})
+	require.NoError(t, err)
+	clock.advance(time.Second)
+	s.tick(ctx)
+
+	job, _ := s.Get(ctx, "x")
+	assert.Equal(t, StatusFailed, job.Status)
+	assert.Contains(t, job.LastError, "hub saturated")
+}
+
+// TestScheduler_TTL tests that runs delivered too late after falling due are dropped
+func TestScheduler_TTL(t *testing.T) {
+	ctx := context.Background()
+	clock := &fakeClock{t: time.Date(2026, 5, 1, 12, 0, 0, 0, time.UTC)}
+	dispatcher := &fakeDispatcher{}
+	s := newTestScheduler(NewMemoryStore(), dispatcher, clock, "a")
+	userID := uuid.New()
+
+	_, err := s.Schedule(ctx, Request{ID: "closing", UserID: userID, Type: "market_closing", Delay: time.Minute, TTL: 30 * time.Second})
+	require.NoError(t, err)
+	_, err = s.Schedule(ctx, Request{ID: "on-time", UserID: userID, Type: "market_closing", Delay: 2 * time.Minute, TTL: 30 * time.Second})
+	require.NoError(t, err)
+
+	// The scheduler was down when "closing" fell due
+	clock.advance(2 * time.Minute)
+	s.tick(ctx)
+
+	job, _ := s.Get(ctx, "closing")
+	assert.Equal(t, StatusExpired, job.Status)
+	assert.Equal(t, []string{"on-time"}, dispatcher.ids())
+	assert.Equal(t, time.Date(2026, 5, 1, 12, 2, 30, 0, time.UTC), dispatcher.sent[0].ExpiresAt)
+
+	// A recurring job skips the stale run and stays scheduled
+	_, err = s.Schedule(ctx, Request{ID: "hourly", UserID: userID, Type: "t", Cron: "@hourly", TTL: time.Minute})
+	require.NoError(t, err)
+	clock.advance(2 * time.Hour)
+	s.tick(ctx)
+	job, _ = s.Get(ctx, "hourly")
+	assert.Equal(t, StatusPending, job.Status)
+	assert.Equal(t, time.Date(2026, 5, 1, 15, 0, 0, 0, time.UTC), job.SendAt)
+	assert.Len(t, dispatcher.ids(), 1)
+}
+
+// TestScheduler_Schedule_Invalid tests request validation
+func TestScheduler_Schedule_Invalid(t *testing.T) {
+	ctx := context.Background()
+	s := New(NewMemoryStore(), &fakeDispatcher{}, zerolog.Nop())
+	userID := uuid.New()
+
+	for _, req := range []Request{
+		{Type: "t", Delay: time.Second},
+		{UserID: userID, Delay: time.Second},
+		{UserID: userID, Type: "t"},
+		{UserID: userID, Type: "t", Delay: time.Second, Cron: "@daily"},
+		{UserID: userID, Type: "t", Delay: -time.Second},
+		{UserID: userID, Type: "t", Cron: "bad"},
+		{UserID: userID, Type: "t", Cron: "@daily", Timezone: "Mars/Olympus"},
+		{UserID: userID, Type: "t", Cron: "0 0 31 2 *"},
+		{UserID: userID, Type: "t", Delay: time.Second, Payload: []byte(`{`)},
+		{UserID: userID, Type: "t", Delay: time.Second, TTL: time.Millisecond},
+	} {
+		_, err := s.Schedule(ctx, req)
+		assert.ErrorIs(t, err, ErrInvalid)
+	}
+
+	_, err := s.Schedule(ctx, Request{ID: "dup", UserID: userID, Type: "t", Delay: time.Second})
+	require.NoError(t, err)
+	_, err = s.Schedule(ctx, Request{ID: "dup", UserID: userID, Type: "t", Delay: time.Second})
+	assert.ErrorIs(t, err, ErrExists)
+}
+
+// TestScheduler_Leadership tests that only the lease holder fires jobs and
+// that another replica takes over once the lease expires
+func TestScheduler_Leadership(t *testing.T) {
+	ctx := context.Background()
+	clock := &fakeClock{t: time.Now()}
+	store := NewMemoryStore()
+	dispatcher := &fakeDispatcher{}
+	a := newTestScheduler(store, dispatcher, clock, "a")
+	b := newTestScheduler(store, dispatcher, clock, "b")
+
+	_, err := a.Schedule(ctx, Request{ID: "1", UserID: uuid.New(), Type: "t", Delay: time.Second})
+	require.NoError(t, err)
+	clock.advance(time.Second)
+
+	a.tick(ctx)
+	b.tick(ctx)
+	assert.True(t, a.Leader())
+	assert.False(t, b.Leader())
+	assert.Equal(t, []string{"1"}, dispatcher.ids())
+
+	// a stops renewing; b takes over after the TTL
+	_, err = b.Schedule(ctx, Request{ID: "2", UserID: uuid.New(), Type: "t", Delay: time.Second})
+	require.NoError(t, err)
+	clock.advance(5 * time.Second)
+	b.tick(ctx)
+	assert.False(t, b.Leader())
+	clock.advance(6 * time.Second)
+	b.tick(ctx)
+	assert.True(t, b.Leader())
+	assert.Equal(t, []string{"1", "2"}, dispatcher.ids())
+}
+
+// TestScheduler_Run tests the polling loop and releasing the lease on shutdown
+func TestScheduler_Run(t *testing.T) {
+	store := NewMemoryStore()
+	dispatcher := &fakeDispatcher{}
+	s := New(store, dispatcher, zerolog.Nop(), WithHolder("a"), WithPollInterval(5*time.Millisecond))
+
+	_, err := s.Schedule(context.Background(), Request{ID: "soon", UserID: uuid.New(), Type: "t", Delay: 10 * time.Millisecond})
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		s.Run(ctx)
+		close(done)
+	}()
+	require.Eventually(t, func() bool { return len(dispatcher.ids()) == 1 }, time.Second, 5*time.Millisecond)
+	cancel()
+	<-done
+
+	// The lease was released, so another replica leads immediately
+	ok, err := store.AcquireLease(context.Background(), leaseName, "b", time.Now(), time.Second)
+	require.NoError(t, err)
+	assert.True(t, ok)
+}
+
+// cancellingDispatcher cancels the job it is dispatching, as a DELETE
+// landing while the notification is being sent would
+type cancellingDispatcher struct {
+	fakeDispatcher
+	scheduler *Scheduler
+	jobID     string
+}
+
+func (d *cancellingDispatcher) Dispatch(ctx context.Context, n *notify.Notification) error {
+	if err := d.scheduler.Cancel(ctx, d.jobID); err != nil {
+		return err
+	}
+	return d.fakeDispatcher.Dispatch(ctx, n)
+}
+
+// TestScheduler_CancelDuringDispatch tests that a recurring job cancelled
+// while it fires stays cancelled
+func TestScheduler_CancelDuringDispatch(t *testing.T) {
+	ctx := context.Background()
+	for name, store := range testStores(t) {
+		t.Run(name, func(t *testing.T) {
+			clock := &fakeClock{t: time.Date(2026, 5, 1, 8, 30, 0, 0, time.UTC)}
+			dispatcher := &cancellingDispatcher{jobID: "digest"}
+			s := newTestScheduler(store, dispatcher, clock, "a")
+			dispatcher.scheduler = s
+
+			_, err := s.Schedule(ctx, Request{ID: "digest", UserID: uuid.New(), Type: "daily_digest", Cron: "0 9 * * *"})
+			require.NoError(t, err)
+			clock.advance(time.Hour)
+			s.tick(ctx)
+			require.Len(t, dispatcher.ids(), 1)
+
+			job, err := s.Get(ctx, "digest")
+			require.NoError(t, err)
+			assert.Equal(t, StatusCancelled, job.Status)
+
+			clock.advance(48 * time.Hour)
+			s.tick(ctx)
+			assert.Len(t, dispatcher.ids(), 1, "the cancelled job does not fire again")
+		})
+	}
+}
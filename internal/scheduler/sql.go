@@ -0,0 +1,182 @@
+package scheduler
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// SQLStore is a durable Store in the scheduled_notifications and
+// scheduler_leases tables. Its statements use SQLite syntax; open the
+// *sql.DB with sqlite.Open. Times are kept as Unix milliseconds.
+type SQLStore struct {
+	db *sql.DB
+}
+
+// NewSQLStore creates a store over db; call Migrate to create its tables
+func NewSQLStore(db *sql.DB) *SQLStore {
+	return &SQLStore{db: db}
+}
+
+// Migrate creates the scheduler tables if they do not exist
+func (s *SQLStore) Migrate(ctx context.Context) error {
+	for _, stmt := range []string{
+		`CREATE TABLE IF NOT EXISTS scheduled_notifications (
+			id         TEXT PRIMARY KEY,
+			user_id    TEXT NOT NULL,
+			type       TEXT NOT NULL,
+			category   TEXT NOT NULL DEFAULT '',
+			payload    BLOB,
+			send_at    INTEGER NOT NULL,
+			cron       TEXT NOT NULL DEFAULT '',
+			timezone   TEXT NOT NULL DEFAULT '',
+			ttl_seconds INTEGER NOT NULL DEFAULT 0,
+			status     TEXT NOT NULL,
+			runs       INTEGER NOT NULL DEFAULT 0,
+			last_error TEXT NOT NULL DEFAULT '',
+			created_at INTEGER NOT NULL
+		)`,
+		`CREATE INDEX IF NOT EXISTS scheduled_notifications_due ON scheduled_notifications (status, send_at)`,
+		`CREATE TABLE IF NOT EXISTS scheduler_leases (
+			name       TEXT PRIMARY KEY,
+			holder     TEXT NOT NULL,
+			expires_at INTEGER NOT NULL
+		)`,
+	} {
+		if _, err := s.db.ExecContext(ctx, stmt); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+const jobColumns = `id, user_id, type, category, payload, send_at, cron, timezone, ttl_seconds, status, runs, last_error, created_at`
+
+// Create implements Store
+func (s *SQLStore) Create(ctx context.Context, job *Job) error {
+	res, err := s.db.ExecContext(ctx,
+		`INSERT INTO scheduled_notifications (`+jobColumns+`) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+		 ON CONFLICT (id) DO NOTHING`,
+		job.ID, job.UserID.String(), job.Type, job.Category, []byte(job.Payload), job.SendAt.UnixMilli(), job.Cron, job.Timezone,
+		job.TTLSeconds, string(job.Status), job.Runs, job.LastError, job.CreatedAt.UnixMilli())
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		return ErrExists
+	}
+	return nil
+}
+
+// Update implements Store
+func (s *SQLStore) Update(ctx context.Context, job *Job) error {
+	res, err := s.db.ExecContext(ctx,
+		`UPDATE scheduled_notifications SET send_at = ?, status = ?, runs = ?, last_error = ? WHERE id = ? AND status = ?`,
+		job.SendAt.UnixMilli(), string(job.Status), job.Runs, job.LastError, job.ID, string(StatusPending))
+	if err != nil {
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err != nil || n > 0 {
+		return err
+	}
+	if _, err := s.Get(ctx, job.ID); err != nil {
+		return err
+	}
+	return ErrConflict
+}
+
+// Get implements Store
+func (s *SQLStore) Get(ctx context.Context, id string) (*Job, error) {
+	job, err := scanJob(s.db.QueryRowContext(ctx, `SELECT `+jobColumns+` FROM scheduled_notifications WHERE id = ?`, id))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	return job, err
+}
+
+// Cancel implements Store
+func (s *SQLStore) Cancel(ctx context.Context, id string) error {
+	res, err := s.db.ExecContext(ctx,
+		`UPDATE scheduled_notifications SET status = ? WHERE id = ? AND status = ?`,
+		string(StatusCancelled), id, string(StatusPending))
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// Due implements Store
+func (s *SQLStore) Due(ctx context.Context, now time.Time, limit int) ([]*Job, error) {
+	rows, err := s.db.QueryContext(ctx,
+		`SELECT `+jobColumns+` FROM scheduled_notifications WHERE status = ? AND send_at <= ? ORDER BY send_at LIMIT ?`,
+		string(StatusPending), now.UnixMilli(), limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var jobs []*Job
+	for rows.Next() {
+		job, err := scanJob(rows)
+		if err != nil {
+			return nil, err
+		}
+		jobs = append(jobs, job)
+	}
+	return jobs, rows.Err()
+}
+
+// AcquireLease implements Store
+func (s *SQLStore) AcquireLease(ctx context.Context, name, holder string, now time.Time, ttl time.Duration) (bool, error) {
+	res, err := s.db.ExecContext(ctx,
+		`INSERT INTO scheduler_leases (name, holder, expires_at) VALUES (?, ?, ?)
+		 ON CONFLICT (name) DO UPDATE SET holder = excluded.holder, expires_at = excluded.expires_at
+		 WHERE scheduler_leases.holder = excluded.holder OR scheduler_leases.expires_at <= ?`,
+		name, holder, now.Add(ttl).UnixMilli(), now.UnixMilli())
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n > 0, err
+}
+
+// ReleaseLease implements Store
+func (s *SQLStore) ReleaseLease(ctx context.Context, name, holder string) error {
+	_, err := s.db.ExecContext(ctx, `DELETE FROM scheduler_leases WHERE name = ? AND holder = ?`, name, holder)
+	return err
+}
+
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanJob(row rowScanner) (*Job, error) {
+	var (
+		job               Job
+		userID, status    string
+		payload           []byte
+		sendAt, createdAt int64
+	)
+	if err := row.Scan(&job.ID, &userID, &job.Type, &job.Category, &payload, &sendAt, &job.Cron, &job.Timezone,
+		&job.TTLSeconds, &status, &job.Runs, &job.LastError, &createdAt); err != nil {
+		return nil, err
+	}
+	var err error
+	if job.UserID, err = uuid.Parse(userID); err != nil {
+		return nil, err
+	}
+	if len(payload) > 0 {
+		job.Payload = payload
+	}
+	job.Status = Status(status)
+	job.SendAt = time.UnixMilli(sendAt).UTC()
+	job.CreatedAt = time.UnixMilli(createdAt).UTC()
+	return &job, nil
+}
@@ -0,0 +1,100 @@
+package scheduler
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/cypherlabdev/notification-service/internal/sqlite"
+)
+
+func newTestSQLStore(t *testing.T) *SQLStore {
+	db, err := sqlite.Open(context.Background(), filepath.Join(t.TempDir(), "scheduler.db"))
+	require.NoError(t, err)
+	t.Cleanup(func() { db.Close() })
+	store := NewSQLStore(db)
+	require.NoError(t, store.Migrate(context.Background()))
+	return store
+}
+
+// testStores returns each Store implementation, empty
+func testStores(t *testing.T) map[string]Store {
+	return map[string]Store{"memory": NewMemoryStore(), "sql": newTestSQLStore(t)}
+}
+
+// TestStore tests the job lifecycle against each store
+func TestStore(t *testing.T) {
+	ctx := context.Background()
+	now := time.Date(2026, 5, 1, 12, 0, 0, 0, time.UTC)
+	for name, store := range testStores(t) {
+		t.Run(name, func(t *testing.T) {
+			job := &Job{ID: "a", UserID: uuid.New(), Type: "reminder", Payload: []byte(`{"n":1}`), SendAt: now, Status: StatusPending, CreatedAt: now}
+			require.NoError(t, store.Create(ctx, job))
+			assert.ErrorIs(t, store.Create(ctx, job), ErrExists)
+			later := &Job{ID: "b", UserID: uuid.New(), Type: "reminder", SendAt: now.Add(time.Minute), Status: StatusPending, CreatedAt: now}
+			require.NoError(t, store.Create(ctx, later))
+
+			due, err := store.Due(ctx, now.Add(time.Minute), 10)
+			require.NoError(t, err)
+			require.Len(t, due, 2)
+			assert.Equal(t, "a", due[0].ID, "earliest first")
+			assert.Equal(t, job.UserID, due[0].UserID)
+			assert.JSONEq(t, `{"n":1}`, string(due[0].Payload))
+
+			job.Runs, job.SendAt, job.LastError = 1, now.Add(time.Hour), "down"
+			require.NoError(t, store.Update(ctx, job))
+			got, err := store.Get(ctx, "a")
+			require.NoError(t, err)
+			assert.Equal(t, 1, got.Runs)
+			assert.Equal(t, now.Add(time.Hour), got.SendAt)
+			assert.Equal(t, "down", got.LastError)
+
+			require.NoError(t, store.Cancel(ctx, "a"))
+			assert.ErrorIs(t, store.Cancel(ctx, "a"), ErrNotFound)
+			assert.ErrorIs(t, store.Update(ctx, job), ErrConflict, "a cancelled job is not overwritten")
+			got, err = store.Get(ctx, "a")
+			require.NoError(t, err)
+			assert.Equal(t, StatusCancelled, got.Status)
+			assert.ErrorIs(t, store.Update(ctx, &Job{ID: "missing"}), ErrNotFound)
+			_, err = store.Get(ctx, "missing")
+			assert.ErrorIs(t, err, ErrNotFound)
+		})
+	}
+}
+
+// TestStore_Lease tests that one holder at a time has the lease
+func TestStore_Lease(t *testing.T) {
+	ctx := context.Background()
+	now := time.Date(2026, 5, 1, 12, 0, 0, 0, time.UTC)
+	for name, store := range testStores(t) {
+		t.Run(name, func(t *testing.T) {
+			ok, err := store.AcquireLease(ctx, leaseName, "a", now, 10*time.Second)
+			require.NoError(t, err)
+			assert.True(t, ok)
+			ok, err = store.AcquireLease(ctx, leaseName, "b", now.Add(5*time.Second), 10*time.Second)
+			require.NoError(t, err)
+			assert.False(t, ok, "a's lease is still valid")
+			ok, err = store.AcquireLease(ctx, leaseName, "a", now.Add(5*time.Second), 10*time.Second)
+			require.NoError(t, err)
+			assert.True(t, ok, "a renews")
+
+			ok, err = store.AcquireLease(ctx, leaseName, "b", now.Add(15*time.Second), 10*time.Second)
+			require.NoError(t, err)
+			assert.True(t, ok, "b takes over once a's lease expires")
+
+			require.NoError(t, store.ReleaseLease(ctx, leaseName, "a"), "releasing a lost lease is a no-op")
+			ok, err = store.AcquireLease(ctx, leaseName, "a", now.Add(16*time.Second), 10*time.Second)
+			require.NoError(t, err)
+			assert.False(t, ok)
+			require.NoError(t, store.ReleaseLease(ctx, leaseName, "b"))
+			ok, err = store.AcquireLease(ctx, leaseName, "a", now.Add(16*time.Second), 10*time.Second)
+			require.NoError(t, err)
+			assert.True(t, ok)
+		})
+	}
+}
@@ -0,0 +1,187 @@
+package scheduler
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+var (
+	// ErrNotFound is returned for an unknown or no longer pending job
+	ErrNotFound = errors.New("scheduled notification not found")
+	// ErrExists is returned when scheduling a job under an ID already in use
+	ErrExists = errors.New("scheduled notification already exists")
+	// ErrConflict is returned when updating a job that stopped being
+	// pending since it was loaded, e.g. because it was cancelled
+	ErrConflict = errors.New("scheduled notification is no longer pending")
+)
+
+// Status is the state of a scheduled job
+type Status string
+
+const (
+	StatusPending   Status = "pending"
+	StatusSent      Status = "sent"
+	StatusFailed    Status = "failed"
+	StatusExpired   Status = "expired"
+	StatusCancelled Status = "cancelled"
+)
+
+// Job is a notification to send at SendAt, repeating on Cron if set
+type Job struct {
+	ID      string          `json:"id"`
+	UserID  uuid.UUID       `json:"user_id"`
+	Type    string          `json:"type"`
+	Payload json.RawMessage `json:"payload,omitempty"`
+	SendAt  time.Time       `json:"send_at"`
+	// Category is passed on to the notification; see notify.Notification
+	Category string `json:"category,omitempty"`
+	// Cron and Timezone make the job recurring; Timezone is an IANA name
+	// that the cron expression is evaluated in, UTC if empty
+	Cron     string `json:"cron,omitempty"`
+	Timezone string `json:"timezone,omitempty"`
+	// TTLSeconds, if set, drops a run not delivered within that many
+	// seconds of falling due, e.g. after downtime
+	TTLSeconds int64 `json:"ttl_seconds,omitempty"`
+
+	Status    Status    `json:"status"`
+	Runs      int       `json:"runs"`
+	LastError string    `json:"last_error,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// Store persists scheduled jobs and the scheduler's leader lease
+type Store interface {
+	// Create stores a new job, failing with ErrExists if the ID is taken
+	Create(ctx context.Context, job *Job) error
+	// Update overwrites a stored job if it is still pending, returning
+	// ErrConflict if not, so a cancel made while the job fires is kept
+	Update(ctx context.Context, job *Job) error
+	Get(ctx context.Context, id string) (*Job, error)
+	// Cancel marks a pending job cancelled, or returns ErrNotFound
+	Cancel(ctx context.Context, id string) error
+	// Due returns up to limit pending jobs with SendAt at or before now,
+	// earliest first
+	Due(ctx context.Context, now time.Time, limit int) ([]*Job, error)
+	// AcquireLease takes or renews the named lease for holder until
+	// now+ttl, reporting false if another holder's lease is still valid
+	AcquireLease(ctx context.Context, name, holder string, now time.Time, ttl time.Duration) (bool, error)
+	// ReleaseLease gives up the lease if holder has it
+	ReleaseLease(ctx context.Context, name, holder string) error
+}
+
+type lease struct {
+	holder  string
+	expires time.Time
+}
+
+// MemoryStore is a non-durable Store for tests and single-instance setups
+type MemoryStore struct {
+	jobs   map[string]*Job
+	leases map[string]lease
+	mu     sync.Mutex
+}
+
+// NewMemoryStore creates an empty in-memory job store
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		jobs:   make(map[string]*Job),
+		leases: make(map[string]lease),
+	}
+}
+
+// Create implements Store
+func (s *MemoryStore) Create(_ context.Context, job *Job) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.jobs[job.ID]; ok {
+		return ErrExists
+	}
+	copied := *job
+	s.jobs[job.ID] = &copied
+	return nil
+}
+
+// Update implements Store
+func (s *MemoryStore) Update(_ context.Context, job *Job) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	stored, ok := s.jobs[job.ID]
+	if !ok {
+		return ErrNotFound
+	}
+	if stored.Status != StatusPending {
+		return ErrConflict
+	}
+	copied := *job
+	s.jobs[job.ID] = &copied
+	return nil
+}
+
+// Get implements Store
+func (s *MemoryStore) Get(_ context.Context, id string) (*Job, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	job, ok := s.jobs[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	copied := *job
+	return &copied, nil
+}
+
+// Cancel implements Store
+func (s *MemoryStore) Cancel(_ context.Context, id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	job, ok := s.jobs[id]
+	if !ok || job.Status != StatusPending {
+		return ErrNotFound
+	}
+	job.Status = StatusCancelled
+	return nil
+}
+
+// Due implements Store
+func (s *MemoryStore) Due(_ context.Context, now time.Time, limit int) ([]*Job, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var due []*Job
+	for _, job := range s.jobs {
+		if job.Status == StatusPending && !job.SendAt.After(now) {
+			copied := *job
+			due = append(due, &copied)
+		}
+	}
+	slices.SortFunc(due, func(a, b *Job) int { return a.SendAt.Compare(b.SendAt) })
+	if len(due) > limit {
+		due = due[:limit]
+	}
+	return due, nil
+}
+
+// AcquireLease implements Store
+func (s *MemoryStore) AcquireLease(_ context.Context, name, holder string, now time.Time, ttl time.Duration) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if l, ok := s.leases[name]; ok && l.holder != holder && now.Before(l.expires) {
+		return false, nil
+	}
+	s.leases[name] = lease{holder: holder, expires: now.Add(ttl)}
+	return true, nil
+}
+
+// ReleaseLease implements Store
+func (s *MemoryStore) ReleaseLease(_ context.Context, name, holder string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if l, ok := s.leases[name]; ok && l.holder == holder {
+		delete(s.leases, name)
+	}
+	return nil
+}
@@ -0,0 +1,310 @@
+package segments
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
+
+type tokenKind int
+
+const (
+	tokEOF tokenKind = iota
+	tokIdent
+	tokString
+	tokNumber
+	tokOp
+	tokLParen
+	tokRParen
+	tokComma
+	tokNow // now, now-30d, now+1h
+)
+
+type token struct {
+	kind tokenKind
+	text string
+	pos  int
+}
+
+func (t token) String() string {
+	if t.kind == tokEOF {
+		return "end of segment"
+	}
+	return fmt.Sprintf("%q", t.text)
+}
+
+type lexer struct {
+	src string
+	pos int
+}
+
+func newLexer(src string) *lexer {
+	return &lexer{src: src}
+}
+
+func (l *lexer) next() (token, error) {
+	for l.pos < len(l.src) && unicode.IsSpace(rune(l.src[l.pos])) {
+		l.pos++
+	}
+	start := l.pos
+	if l.pos >= len(l.src) {
+		return token{kind: tokEOF, pos: start}, nil
+	}
+
+	c := l.src[l.pos]
+	switch {
+	case c == '(':
+		l.pos++
+		return token{kind: tokLParen, text: "(", pos: start}, nil
+	case c == ')':
+		l.pos++
+		return token{kind: tokRParen, text: ")", pos: start}, nil
+	case c == ',':
+		l.pos++
+		return token{kind: tokComma, text: ",", pos: start}, nil
+	case c == '=':
+		l.pos++
+		return token{kind: tokOp, text: "=", pos: start}, nil
+	case c == '!' || c == '<' || c == '>':
+		l.pos++
+		if l.pos < len(l.src) && l.src[l.pos] == '=' {
+			l.pos++
+		}
+		op := l.src[start:l.pos]
+		if op == "!" {
+			return token{}, fmt.Errorf("position %d: expected != ", start)
+		}
+		return token{kind: tokOp, text: op, pos: start}, nil
+	case c == '"':
+		return l.string()
+	case c == '-' || isDigit(c):
+		l.pos++
+		for l.pos < len(l.src) && (isDigit(l.src[l.pos]) || l.src[l.pos] == '.') {
+			l.pos++
+		}
+		return token{kind: tokNumber, text: l.src[start:l.pos], pos: start}, nil
+	case isIdentStart(c):
+		for l.pos < len(l.src) && isIdentPart(l.src[l.pos]) {
+			l.pos++
+		}
+		word := l.src[start:l.pos]
+		if strings.EqualFold(word, "now") {
+			if l.pos < len(l.src) && (l.src[l.pos] == '-' || l.src[l.pos] == '+') {
+				l.pos++
+				for l.pos < len(l.src) && (isDigit(l.src[l.pos]) || unicode.IsLetter(rune(l.src[l.pos])) || l.src[l.pos] == '.') {
+					l.pos++
+				}
+			}
+			return token{kind: tokNow, text: l.src[start:l.pos], pos: start}, nil
+		}
+		return token{kind: tokIdent, text: word, pos: start}, nil
+	}
+	return token{}, fmt.Errorf("position %d: unexpected character %q", start, c)
+}
+
+func (l *lexer) string() (token, error) {
+	start := l.pos
+	var b strings.Builder
+	for l.pos++; l.pos < len(l.src); l.pos++ {
+		switch c := l.src[l.pos]; c {
+		case '\\':
+			if l.pos+1 < len(l.src) {
+				l.pos++
+				b.WriteByte(l.src[l.pos])
+			}
+		case '"':
+			l.pos++
+			return token{kind: tokString, text: b.String(), pos: start}, nil
+		default:
+			b.WriteByte(c)
+		}
+	}
+	return token{}, fmt.Errorf("position %d: unterminated string", start)
+}
+
+func isDigit(c byte) bool      { return c >= '0' && c <= '9' }
+func isIdentStart(c byte) bool { return c == '_' || unicode.IsLetter(rune(c)) }
+func isIdentPart(c byte) bool  { return isIdentStart(c) || isDigit(c) || c == '.' }
+
+// parser is a recursive descent parser over the grammar
+//
+//	or      = and { OR and }
+//	and     = unary { AND unary }
+//	unary   = NOT unary | "(" or ")" | ident op value
+//	        | ident IN "(" value { "," value } ")" | ident EXISTS
+type parser struct {
+	lex *lexer
+	tok token
+}
+
+func (p *parser) advance() error {
+	tok, err := p.lex.next()
+	if err != nil {
+		return err
+	}
+	p.tok = tok
+	return nil
+}
+
+func (p *parser) errorf(format string, args ...interface{}) error {
+	return fmt.Errorf("position %d: %s", p.tok.pos, fmt.Sprintf(format, args...))
+}
+
+// keyword reports whether the current token is the given keyword, in any case
+func (p *parser) keyword(kw string) bool {
+	return p.tok.kind == tokIdent && strings.EqualFold(p.tok.text, kw)
+}
+
+func (p *parser) parseOr() (node, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for p.keyword("OR") {
+		if err := p.advance(); err != nil {
+			return nil, err
+		}
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		left = orNode{left, right}
+	}
+	return left, nil
+}
+
+func (p *parser) parseAnd() (node, error) {
+	left, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	for p.keyword("AND") {
+		if err := p.advance(); err != nil {
+			return nil, err
+		}
+		right, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		left = andNode{left, right}
+	}
+	return left, nil
+}
+
+func (p *parser) parseUnary() (node, error) {
+	switch {
+	case p.keyword("NOT"):
+		if err := p.advance(); err != nil {
+			return nil, err
+		}
+		expr, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return notNode{expr}, nil
+	case p.tok.kind == tokLParen:
+		if err := p.advance(); err != nil {
+			return nil, err
+		}
+		expr, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if p.tok.kind != tokRParen {
+			return nil, p.errorf("expected ) but found %s", p.tok)
+		}
+		return expr, p.advance()
+	case p.tok.kind == tokIdent && !p.keyword("AND") && !p.keyword("OR"):
+		return p.parseCondition()
+	}
+	return nil, p.errorf("expected a condition but found %s", p.tok)
+}
+
+func (p *parser) parseCondition() (node, error) {
+	attr := p.tok.text
+	if err := p.advance(); err != nil {
+		return nil, err
+	}
+
+	switch {
+	case p.keyword("EXISTS"):
+		return existsNode{attr}, p.advance()
+	case p.keyword("IN"):
+		return p.parseIn(attr)
+	case p.tok.kind == tokOp:
+		op := p.tok.text
+		if err := p.advance(); err != nil {
+			return nil, err
+		}
+		val, err := p.parseValue()
+		if err != nil {
+			return nil, err
+		}
+		return compareNode{attr: attr, op: op, val: val}, nil
+	}
+	return nil, p.errorf("expected an operator after %q but found %s", attr, p.tok)
+}
+
+func (p *parser) parseIn(attr string) (node, error) {
+	if err := p.advance(); err != nil {
+		return nil, err
+	}
+	if p.tok.kind != tokLParen {
+		return nil, p.errorf("expected ( after IN but found %s", p.tok)
+	}
+	var vals []value
+	for {
+		if err := p.advance(); err != nil {
+			return nil, err
+		}
+		val, err := p.parseValue()
+		if err != nil {
+			return nil, err
+		}
+		vals = append(vals, val)
+		if p.tok.kind == tokRParen {
+			return inNode{attr: attr, vals: vals}, p.advance()
+		}
+		if p.tok.kind != tokComma {
+			return nil, p.errorf("expected , or ) but found %s", p.tok)
+		}
+	}
+}
+
+// parseValue consumes a literal
+func (p *parser) parseValue() (value, error) {
+	tok := p.tok
+	var val value
+	switch {
+	case tok.kind == tokString:
+		s := tok.text
+		val.str = &s
+	case tok.kind == tokNumber:
+		f, err := strconv.ParseFloat(tok.text, 64)
+		if err != nil {
+			return val, p.errorf("invalid number %q", tok.text)
+		}
+		val.num = &f
+	case p.keyword("true") || p.keyword("false"):
+		b := strings.EqualFold(tok.text, "true")
+		val.boolean = &b
+	case tok.kind == tokNow:
+		var d time.Duration
+		if offset := tok.text[3:]; offset != "" {
+			parsed, err := parseDuration(offset[1:])
+			if err != nil {
+				return val, p.errorf("%v", err)
+			}
+			d = parsed
+			if offset[0] == '-' {
+				d = -d
+			}
+		}
+		val.relative = &d
+	default:
+		return val, p.errorf("expected a value but found %s", tok)
+	}
+	return val, p.advance()
+}
@@ -0,0 +1,243 @@
+// Package segments selects campaign audiences by evaluating segment
+// expressions against user attributes.
+//
+// A segment combines comparisons of attributes with AND, OR, NOT and
+// parentheses:
+//
+//	verified = true AND country = "DE" AND last_deposit_at >= now-30d
+//	country IN ("DE", "AT") AND NOT vip = true
+//	tier EXISTS OR balance > 100.5
+//
+// Values are double-quoted strings, numbers, true and false, or a time
+// relative to evaluation: now, now-30d, now+12h. Durations accept the units
+// of time.ParseDuration plus d (days) and w (weeks). Comparisons against a
+// time read the attribute as a time.Time or an RFC 3339 string. A
+// comparison with a missing attribute or a value of another type is false.
+package segments
+
+import (
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Attributes are the properties of one user that segments are evaluated against
+type Attributes map[string]interface{}
+
+// Segment is a parsed segment expression
+type Segment struct {
+	src  string
+	root node
+}
+
+// Parse compiles a segment expression
+func Parse(src string) (*Segment, error) {
+	p := &parser{lex: newLexer(src)}
+	if err := p.advance(); err != nil {
+		return nil, err
+	}
+	if p.tok.kind == tokEOF {
+		return nil, fmt.Errorf("segment is empty")
+	}
+	root, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if p.tok.kind != tokEOF {
+		return nil, p.errorf("unexpected %s", p.tok)
+	}
+	return &Segment{src: src, root: root}, nil
+}
+
+// String returns the expression the segment was parsed from
+func (s *Segment) String() string { return s.src }
+
+// Match reports whether a user with the given attributes belongs to the
+// segment; now anchors relative times such as now-30d
+func (s *Segment) Match(attrs Attributes, now time.Time) bool {
+	return s.root.eval(attrs, now)
+}
+
+type node interface {
+	eval(attrs Attributes, now time.Time) bool
+}
+
+type andNode struct{ left, right node }
+
+func (n andNode) eval(attrs Attributes, now time.Time) bool {
+	return n.left.eval(attrs, now) && n.right.eval(attrs, now)
+}
+
+type orNode struct{ left, right node }
+
+func (n orNode) eval(attrs Attributes, now time.Time) bool {
+	return n.left.eval(attrs, now) || n.right.eval(attrs, now)
+}
+
+type notNode struct{ expr node }
+
+func (n notNode) eval(attrs Attributes, now time.Time) bool {
+	return !n.expr.eval(attrs, now)
+}
+
+type existsNode struct{ attr string }
+
+func (n existsNode) eval(attrs Attributes, _ time.Time) bool {
+	v, ok := attrs[n.attr]
+	return ok && v != nil
+}
+
+// value is a literal on the right-hand side of a comparison
+type value struct {
+	str     *string
+	num     *float64
+	boolean *bool
+	// relative is set for now±duration literals
+	relative *time.Duration
+}
+
+type compareNode struct {
+	attr string
+	op   string
+	val  value
+}
+
+func (n compareNode) eval(attrs Attributes, now time.Time) bool {
+	v, ok := attrs[n.attr]
+	if !ok || v == nil {
+		return false
+	}
+	c, ok := compare(v, n.val, now)
+	if !ok {
+		return false
+	}
+	switch n.op {
+	case "=":
+		return c == 0
+	case "!=":
+		return c != 0
+	case "<":
+		return c < 0
+	case "<=":
+		return c <= 0
+	case ">":
+		return c > 0
+	case ">=":
+		return c >= 0
+	}
+	return false
+}
+
+type inNode struct {
+	attr string
+	vals []value
+}
+
+func (n inNode) eval(attrs Attributes, now time.Time) bool {
+	v, ok := attrs[n.attr]
+	if !ok || v == nil {
+		return false
+	}
+	return slices.ContainsFunc(n.vals, func(val value) bool {
+		c, ok := compare(v, val, now)
+		return ok && c == 0
+	})
+}
+
+// compare orders an attribute value against a literal, reporting false if
+// they are not comparable
+func compare(attr interface{}, val value, now time.Time) (int, bool) {
+	switch {
+	case val.relative != nil:
+		t, ok := toTime(attr)
+		if !ok {
+			return 0, false
+		}
+		return t.Compare(now.Add(*val.relative)), true
+	case val.str != nil:
+		s, ok := attr.(string)
+		if !ok {
+			return 0, false
+		}
+		return strings.Compare(s, *val.str), true
+	case val.num != nil:
+		f, ok := toFloat(attr)
+		if !ok {
+			return 0, false
+		}
+		switch {
+		case f < *val.num:
+			return -1, true
+		case f > *val.num:
+			return 1, true
+		}
+		return 0, true
+	case val.boolean != nil:
+		b, ok := attr.(bool)
+		if !ok {
+			return 0, false
+		}
+		switch {
+		case b == *val.boolean:
+			return 0, true
+		case !b:
+			return -1, true
+		}
+		return 1, true
+	}
+	return 0, false
+}
+
+func toFloat(v interface{}) (float64, bool) {
+	switch n := v.(type) {
+	case float64:
+		return n, true
+	case float32:
+		return float64(n), true
+	case int:
+		return float64(n), true
+	case int32:
+		return float64(n), true
+	case int64:
+		return float64(n), true
+	case uint:
+		return float64(n), true
+	case uint32:
+		return float64(n), true
+	case uint64:
+		return float64(n), true
+	}
+	return 0, false
+}
+
+func toTime(v interface{}) (time.Time, bool) {
+	switch t := v.(type) {
+	case time.Time:
+		return t, true
+	case string:
+		parsed, err := time.Parse(time.RFC3339, t)
+		return parsed, err == nil
+	}
+	return time.Time{}, false
+}
+
+// parseDuration extends time.ParseDuration with days and weeks
+func parseDuration(s string) (time.Duration, error) {
+	if len(s) > 1 {
+		unit := map[byte]time.Duration{'d': 24 * time.Hour, 'w': 7 * 24 * time.Hour}[s[len(s)-1]]
+		if unit != 0 {
+			n, err := strconv.Atoi(s[:len(s)-1])
+			if err != nil {
+				return 0, fmt.Errorf("invalid duration %q", s)
+			}
+			return time.Duration(n) * unit, nil
+		}
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil {
+		return 0, fmt.Errorf("invalid duration %q", s)
+	}
+	return d, nil
+}
@@ -0,0 +1,76 @@
+package segments
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestParse_Errors tests that malformed segments are rejected with a position
+func TestParse_Errors(t *testing.T) {
+	for _, src := range []string{
+		"",
+		"country",
+		`country = `,
+		`country = "DE" AND`,
+		`(country = "DE"`,
+		`country IN "DE"`,
+		`country IN ("DE" "AT")`,
+		`country = "DE`,
+		`last_deposit_at > now-30x`,
+		`signed_up_at < now-1y`,
+		`country ! "DE"`,
+		`AND verified = true`,
+		`country = "DE" extra`,
+	} {
+		_, err := Parse(src)
+		assert.Error(t, err, src)
+	}
+}
+
+// TestSegment_Match tests evaluation of comparisons, boolean logic and relative times
+func TestSegment_Match(t *testing.T) {
+	now := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	user := Attributes{
+		"verified":        true,
+		"country":         "DE",
+		"balance":         250,
+		"last_deposit_at": now.Add(-10 * 24 * time.Hour).Format(time.RFC3339),
+		"signed_up_at":    now.Add(-400 * 24 * time.Hour),
+		"profile.tier":    "gold",
+	}
+
+	cases := map[string]bool{
+		`verified = true AND country = "DE" AND last_deposit_at >= now-30d`: true,
+		`verified = true AND country = "DE" AND last_deposit_at >= now-1w`:  false,
+		`country IN ("AT", "DE")`:                        true,
+		`country in ("AT", "CH")`:                        false,
+		`NOT country = "DE" OR balance > 100.5`:          true,
+		`NOT (country = "DE" OR balance > 100.5)`:        false,
+		`balance >= 250 and balance <= 250`:              true,
+		`balance != 250`:                                 false,
+		`balance = "250"`:                                false,
+		`signed_up_at < now-52w`:                         true,
+		`signed_up_at < now`:                             true,
+		`profile.tier EXISTS AND NOT vip EXISTS`:         true,
+		`vip = false`:                                    false,
+		`NOT vip = true`:                                 true,
+		`country = "DE" OR vip = true AND balance < 0`:   true,
+		`(country = "DE" OR vip = true) AND balance < 0`: false,
+	}
+	for src, want := range cases {
+		seg, err := Parse(src)
+		require.NoError(t, err, src)
+		assert.Equal(t, want, seg.Match(user, now), src)
+	}
+}
+
+// TestParse_String tests that a segment keeps its source
+func TestParse_String(t *testing.T) {
+	seg, err := Parse(`name = "a \"quoted\" value"`)
+	require.NoError(t, err)
+	assert.Equal(t, `name = "a \"quoted\" value"`, seg.String())
+	assert.True(t, seg.Match(Attributes{"name": `a "quoted" value`}, time.Now()))
+}
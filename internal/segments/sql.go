@@ -0,0 +1,94 @@
+package segments
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/google/uuid"
+)
+
+// SQLStore keeps attributes as a JSON document per user in a SQL table. Its
+// statements use SQLite syntax; open the *sql.DB with sqlite.Open.
+type SQLStore struct {
+	db    *sql.DB
+	table string
+}
+
+// NewSQLStore creates a store over the given table, which Migrate creates
+func NewSQLStore(db *sql.DB, table string) *SQLStore {
+	return &SQLStore{db: db, table: table}
+}
+
+// Migrate creates the attribute table if it does not exist
+func (s *SQLStore) Migrate(ctx context.Context) error {
+	_, err := s.db.ExecContext(ctx, fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s (
+		user_id    TEXT PRIMARY KEY,
+		attributes TEXT NOT NULL
+	)`, s.table))
+	return err
+}
+
+// Put implements Store
+func (s *SQLStore) Put(ctx context.Context, userID uuid.UUID, attrs Attributes) error {
+	doc, err := json.Marshal(attrs)
+	if err != nil {
+		return fmt.Errorf("encode attributes: %w", err)
+	}
+	_, err = s.db.ExecContext(ctx, fmt.Sprintf(
+		`INSERT INTO %s (user_id, attributes) VALUES (?, ?)
+		 ON CONFLICT (user_id) DO UPDATE SET attributes = excluded.attributes`, s.table),
+		userID.String(), string(doc))
+	return err
+}
+
+// Get implements Store
+func (s *SQLStore) Get(ctx context.Context, userID uuid.UUID) (Attributes, error) {
+	var doc string
+	err := s.db.QueryRowContext(ctx, fmt.Sprintf(`SELECT attributes FROM %s WHERE user_id = ?`, s.table), userID.String()).Scan(&doc)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var attrs Attributes
+	if err := json.Unmarshal([]byte(doc), &attrs); err != nil {
+		return nil, fmt.Errorf("decode attributes of %s: %w", userID, err)
+	}
+	return attrs, nil
+}
+
+// Scan implements Store
+func (s *SQLStore) Scan(ctx context.Context, after uuid.UUID, limit int) ([]User, error) {
+	cursor := ""
+	if after != uuid.Nil {
+		cursor = after.String()
+	}
+	rows, err := s.db.QueryContext(ctx, fmt.Sprintf(
+		`SELECT user_id, attributes FROM %s WHERE user_id > ? ORDER BY user_id LIMIT ?`, s.table),
+		cursor, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var users []User
+	for rows.Next() {
+		var id, doc string
+		if err := rows.Scan(&id, &doc); err != nil {
+			return nil, err
+		}
+		user := User{}
+		if user.ID, err = uuid.Parse(id); err != nil {
+			return nil, fmt.Errorf("invalid user id %q: %w", id, err)
+		}
+		if err := json.Unmarshal([]byte(doc), &user.Attributes); err != nil {
+			return nil, fmt.Errorf("decode attributes of %s: %w", id, err)
+		}
+		users = append(users, user)
+	}
+	return users, rows.Err()
+}
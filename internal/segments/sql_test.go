@@ -0,0 +1,30 @@
+package segments
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/cypherlabdev/notification-service/internal/sqlite"
+)
+
+func newTestSQLStore(t *testing.T) *SQLStore {
+	db, err := sqlite.Open(context.Background(), filepath.Join(t.TempDir(), "segments.db"))
+	require.NoError(t, err)
+	t.Cleanup(func() { db.Close() })
+	store := NewSQLStore(db, "user_attributes")
+	require.NoError(t, store.Migrate(context.Background()))
+	return store
+}
+
+// TestSQLStore_Scan tests paging through users in ID order
+func TestSQLStore_Scan(t *testing.T) {
+	testScan(t, newTestSQLStore(t))
+}
+
+// TestSQLStore_PutGet tests that Put replaces attributes
+func TestSQLStore_PutGet(t *testing.T) {
+	testPutGet(t, newTestSQLStore(t))
+}
@@ -0,0 +1,82 @@
+package segments
+
+import (
+	"context"
+	"maps"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/google/uuid"
+)
+
+// User is one row of the attribute store
+type User struct {
+	ID         uuid.UUID
+	Attributes Attributes
+}
+
+// Store holds user attributes. Scan pages through users in ascending order
+// of their string ID, so audiences are resolved in bounded batches.
+type Store interface {
+	// Put replaces the attributes of a user
+	Put(ctx context.Context, userID uuid.UUID, attrs Attributes) error
+	// Get returns a user's attributes, or nil if the user has none
+	Get(ctx context.Context, userID uuid.UUID) (Attributes, error)
+	// Scan returns up to limit users whose ID sorts after the given one;
+	// uuid.Nil starts from the first user
+	Scan(ctx context.Context, after uuid.UUID, limit int) ([]User, error)
+}
+
+// MemoryStore is an in-process Store for tests and single-instance setups
+type MemoryStore struct {
+	users map[uuid.UUID]Attributes
+	mu    sync.RWMutex
+}
+
+// NewMemoryStore creates an empty in-memory attribute store
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{users: make(map[uuid.UUID]Attributes)}
+}
+
+// Put implements Store
+func (s *MemoryStore) Put(_ context.Context, userID uuid.UUID, attrs Attributes) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.users[userID] = maps.Clone(attrs)
+	return nil
+}
+
+// Get implements Store
+func (s *MemoryStore) Get(_ context.Context, userID uuid.UUID) (Attributes, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return maps.Clone(s.users[userID]), nil
+}
+
+// Scan implements Store
+func (s *MemoryStore) Scan(_ context.Context, after uuid.UUID, limit int) ([]User, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	cursor := ""
+	if after != uuid.Nil {
+		cursor = after.String()
+	}
+	ids := make([]uuid.UUID, 0, len(s.users))
+	for id := range s.users {
+		if id.String() > cursor {
+			ids = append(ids, id)
+		}
+	}
+	slices.SortFunc(ids, func(a, b uuid.UUID) int { return strings.Compare(a.String(), b.String()) })
+	if len(ids) > limit {
+		ids = ids[:limit]
+	}
+
+	users := make([]User, len(ids))
+	for i, id := range ids {
+		users[i] = User{ID: id, Attributes: maps.Clone(s.users[id])}
+	}
+	return users, nil
+}
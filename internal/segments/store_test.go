@@ -0,0 +1,66 @@
+package segments
+
+import (
+	"context"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestMemoryStore_Scan tests paging through users in ID order
+func TestMemoryStore_Scan(t *testing.T) {
+	testScan(t, NewMemoryStore())
+}
+
+// TestMemoryStore_PutGet tests that Put replaces attributes and copies them
+func TestMemoryStore_PutGet(t *testing.T) {
+	testPutGet(t, NewMemoryStore())
+}
+
+func testScan(t *testing.T, store Store) {
+	ctx := context.Background()
+	seen := make(map[uuid.UUID]bool)
+	for i := 0; i < 25; i++ {
+		require.NoError(t, store.Put(ctx, uuid.New(), Attributes{"n": i}))
+	}
+
+	after := uuid.Nil
+	pages := 0
+	for {
+		users, err := store.Scan(ctx, after, 10)
+		require.NoError(t, err)
+		if len(users) == 0 {
+			break
+		}
+		pages++
+		for _, u := range users {
+			assert.False(t, seen[u.ID], "user returned twice")
+			assert.Greater(t, u.ID.String(), after.String())
+			seen[u.ID] = true
+			after = u.ID
+		}
+	}
+	assert.Equal(t, 3, pages)
+	assert.Len(t, seen, 25)
+}
+
+func testPutGet(t *testing.T, store Store) {
+	ctx := context.Background()
+	userID := uuid.New()
+
+	attrs := Attributes{"country": "DE", "verified": true}
+	require.NoError(t, store.Put(ctx, userID, attrs))
+	attrs["country"] = "FR"
+	got, err := store.Get(ctx, userID)
+	require.NoError(t, err)
+	assert.Equal(t, "DE", got["country"])
+
+	require.NoError(t, store.Put(ctx, userID, Attributes{"country": "AT"}))
+	got, _ = store.Get(ctx, userID)
+	assert.Equal(t, Attributes{"country": "AT"}, got)
+
+	got, _ = store.Get(ctx, uuid.New())
+	assert.Nil(t, got)
+}
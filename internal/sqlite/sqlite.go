@@ -0,0 +1,39 @@
+// Package sqlite opens the SQLite database the service's durable stores
+// share. Processes on one host can share it by opening the same file, but
+// WAL mode relies on shared memory, so the file must be on a local
+// filesystem rather than NFS or another network share. Replicas on
+// different hosts cannot share a database.
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"net/url"
+
+	_ "modernc.org/sqlite" // registers the "sqlite" driver
+)
+
+// busyTimeout is how long, in milliseconds, a statement waits for another
+// connection or process to release the database before failing
+const busyTimeout = "5000"
+
+// Open opens the database file at path, creating it if needed.
+// Transactions take the write lock when they begin, so a transaction that
+// reads before it writes waits its turn rather than failing to upgrade
+// its lock, and WAL mode lets reads run alongside the writer.
+func Open(ctx context.Context, path string) (*sql.DB, error) {
+	q := url.Values{}
+	q.Set("_txlock", "immediate")
+	q.Add("_pragma", "busy_timeout("+busyTimeout+")")
+	q.Add("_pragma", "journal_mode(WAL)")
+	q.Add("_pragma", "synchronous(NORMAL)")
+	db, err := sql.Open("sqlite", "file:"+path+"?"+q.Encode())
+	if err != nil {
+		return nil, err
+	}
+	if err := db.PingContext(ctx); err != nil {
+		db.Close()
+		return nil, err
+	}
+	return db, nil
+}
@@ -0,0 +1,134 @@
+package status
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/rs/zerolog"
+)
+
+const (
+	defaultPage = 50
+	maxPage     = 500
+)
+
+// notificationResponse lists a notification's statuses by user and channel
+type notificationResponse struct {
+	NotificationID string    `json:"notification_id"`
+	Statuses       []*Status `json:"statuses"`
+}
+
+// userResponse is a page of a user's statuses, newest first. NextBefore is
+// the before of the next page, if there may be one.
+type userResponse struct {
+	UserID     uuid.UUID `json:"user_id"`
+	Statuses   []*Status `json:"statuses"`
+	NextBefore time.Time `json:"next_before,omitzero"`
+}
+
+// Handler serves the delivery status API:
+//
+//	GET /delivery-status/notifications/{id}               every recipient and channel
+//	GET /delivery-status/users/{userID}?limit=&before=    newest first; before is RFC 3339
+//
+// A status with an empty channel tracks the notification before it reached
+// any channel, e.g. while held for a digest or quiet hours.
+type Handler struct {
+	tracker *Tracker
+	logger  zerolog.Logger
+	mux     *http.ServeMux
+}
+
+// NewHandler creates the delivery status API
+func NewHandler(tracker *Tracker, logger zerolog.Logger) *Handler {
+	h := &Handler{
+		tracker: tracker,
+		logger:  logger.With().Str("component", "delivery_status_api").Logger(),
+		mux:     http.NewServeMux(),
+	}
+	h.mux.HandleFunc("GET /delivery-status/notifications/{id}", h.notification)
+	h.mux.HandleFunc("GET /delivery-status/users/{userID}", h.user)
+	return h
+}
+
+// ServeHTTP implements http.Handler
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	h.mux.ServeHTTP(w, r)
+}
+
+func (h *Handler) notification(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	statuses, err := h.tracker.ByNotification(r.Context(), id)
+	if err != nil {
+		h.storeError(w, err, "failed to load delivery statuses")
+		return
+	}
+	writeJSON(w, http.StatusOK, notificationResponse{NotificationID: id, Statuses: statuses})
+}
+
+func (h *Handler) user(w http.ResponseWriter, r *http.Request) {
+	userID, ok := pathUser(w, r)
+	if !ok {
+		return
+	}
+	query := r.URL.Query()
+	limit := defaultPage
+	if v := query.Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 {
+			http.Error(w, "invalid limit", http.StatusBadRequest)
+			return
+		}
+		limit = min(n, maxPage)
+	}
+	var before time.Time
+	if v := query.Get("before"); v != "" {
+		t, err := time.Parse(time.RFC3339Nano, v)
+		if err != nil {
+			http.Error(w, "invalid before", http.StatusBadRequest)
+			return
+		}
+		before = t
+	}
+	statuses, err := h.tracker.ByUser(r.Context(), userID, before, limit)
+	if err != nil {
+		h.storeError(w, err, "failed to list delivery statuses")
+		return
+	}
+	resp := userResponse{UserID: userID, Statuses: statuses}
+	if resp.Statuses == nil {
+		resp.Statuses = []*Status{}
+	}
+	if len(statuses) == limit {
+		resp.NextBefore = statuses[len(statuses)-1].CreatedAt
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
+
+func (h *Handler) storeError(w http.ResponseWriter, err error, msg string) {
+	if errors.Is(err, ErrNotFound) {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	h.logger.Error().Err(err).Msg(msg)
+	http.Error(w, "internal error", http.StatusInternalServerError)
+}
+
+func pathUser(w http.ResponseWriter, r *http.Request) (uuid.UUID, bool) {
+	userID, err := uuid.Parse(r.PathValue("userID"))
+	if err != nil {
+		http.Error(w, "invalid user id", http.StatusBadRequest)
+		return uuid.Nil, false
+	}
+	return userID, true
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
@@ -0,0 +1,76 @@
+package status
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/cypherlabdev/notification-service/internal/notify"
+)
+
+func get(h http.Handler, path string) *httptest.ResponseRecorder {
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+	return rec
+}
+
+// TestHandler tests querying statuses by notification and by user
+func TestHandler(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemoryStore()
+	h := NewHandler(New(store, zerolog.Nop()), zerolog.Nop())
+	userID := uuid.New()
+	base := time.Date(2026, 6, 10, 12, 0, 0, 0, time.UTC)
+	for i, id := range []string{"n1", "n2", "n3"} {
+		key := Key{NotificationID: id, UserID: userID, Channel: notify.ChannelWebSocket}
+		require.NoError(t, store.Record(ctx, key, "bet_settled", Event{State: notify.StateSent, At: base.Add(time.Duration(i) * time.Minute)}))
+	}
+
+	rec := get(h, "/delivery-status/notifications/n1")
+	require.Equal(t, http.StatusOK, rec.Code)
+	var byNotification notificationResponse
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &byNotification))
+	require.Len(t, byNotification.Statuses, 1)
+	assert.Equal(t, notify.StateSent, byNotification.Statuses[0].State)
+	assert.Equal(t, http.StatusNotFound, get(h, "/delivery-status/notifications/missing").Code)
+
+	path := "/delivery-status/users/" + userID.String()
+	rec = get(h, path+"?limit=2")
+	require.Equal(t, http.StatusOK, rec.Code)
+	var page userResponse
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &page))
+	require.Len(t, page.Statuses, 2)
+	assert.Equal(t, "n3", page.Statuses[0].NotificationID)
+	require.False(t, page.NextBefore.IsZero())
+
+	rec = get(h, path+"?limit=2&before="+url.QueryEscape(page.NextBefore.Format(time.RFC3339Nano)))
+	require.Equal(t, http.StatusOK, rec.Code)
+	page = userResponse{}
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &page))
+	require.Len(t, page.Statuses, 1)
+	assert.Equal(t, "n1", page.Statuses[0].NotificationID)
+	assert.True(t, page.NextBefore.IsZero(), "no more pages")
+
+	rec = get(h, "/delivery-status/users/"+uuid.NewString())
+	require.Equal(t, http.StatusOK, rec.Code)
+	assert.JSONEq(t, `[]`, mustField(t, rec.Body.Bytes(), "statuses"))
+
+	assert.Equal(t, http.StatusBadRequest, get(h, "/delivery-status/users/nope").Code)
+	assert.Equal(t, http.StatusBadRequest, get(h, path+"?limit=0").Code)
+	assert.Equal(t, http.StatusBadRequest, get(h, path+"?before=yesterday").Code)
+}
+
+func mustField(t *testing.T, body []byte, field string) string {
+	var m map[string]json.RawMessage
+	require.NoError(t, json.Unmarshal(body, &m))
+	return string(m[field])
+}
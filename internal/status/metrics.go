@@ -0,0 +1,22 @@
+package status
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var (
+	recorded = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "notification",
+		Subsystem: "delivery_status",
+		Name:      "events_total",
+		Help:      "Delivery status events recorded, by state.",
+	}, []string{"state"})
+
+	dropped = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: "notification",
+		Subsystem: "delivery_status",
+		Name:      "events_dropped_total",
+		Help:      "Delivery status events dropped because the tracker's buffer was full.",
+	})
+)
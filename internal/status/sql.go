@@ -0,0 +1,166 @@
+package status
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/cypherlabdev/notification-service/internal/notify"
+)
+
+// SQLStore is a durable Store in the delivery_statuses table. Its
+// statements use SQLite syntax; open the *sql.DB with sqlite.Open. Times
+// are kept as Unix milliseconds and the event history as JSON.
+type SQLStore struct {
+	db *sql.DB
+}
+
+// NewSQLStore creates a store over db; call Migrate to create its table
+func NewSQLStore(db *sql.DB) *SQLStore {
+	return &SQLStore{db: db}
+}
+
+// Migrate creates the delivery status table if it does not exist
+func (s *SQLStore) Migrate(ctx context.Context) error {
+	for _, stmt := range []string{
+		`CREATE TABLE IF NOT EXISTS delivery_statuses (
+			notification_id TEXT NOT NULL,
+			user_id         TEXT NOT NULL,
+			channel         TEXT NOT NULL,
+			type            TEXT NOT NULL DEFAULT '',
+			state           TEXT NOT NULL,
+			reason          TEXT NOT NULL DEFAULT '',
+			events          TEXT NOT NULL,
+			created_at      INTEGER NOT NULL,
+			updated_at      INTEGER NOT NULL,
+			PRIMARY KEY (notification_id, user_id, channel)
+		)`,
+		`CREATE INDEX IF NOT EXISTS delivery_statuses_user ON delivery_statuses (user_id, created_at)`,
+		`CREATE INDEX IF NOT EXISTS delivery_statuses_updated ON delivery_statuses (updated_at)`,
+	} {
+		if _, err := s.db.ExecContext(ctx, stmt); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+const statusColumns = `notification_id, user_id, channel, type, state, reason, events, created_at, updated_at`
+
+// Record implements Store. The status is read and written back in one
+// transaction, so processes recording the same delivery do not lose events.
+func (s *SQLStore) Record(ctx context.Context, key Key, typ string, e Event) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	st, err := scanStatus(tx.QueryRowContext(ctx,
+		`SELECT `+statusColumns+` FROM delivery_statuses WHERE notification_id = ? AND user_id = ? AND channel = ?`,
+		key.NotificationID, key.UserID.String(), key.Channel))
+	if errors.Is(err, sql.ErrNoRows) {
+		st, err = &Status{NotificationID: key.NotificationID, UserID: key.UserID, Channel: key.Channel, CreatedAt: e.At}, nil
+	}
+	if err != nil {
+		return err
+	}
+	st.apply(typ, e)
+	events, err := json.Marshal(st.Events)
+	if err != nil {
+		return err
+	}
+	_, err = tx.ExecContext(ctx,
+		`INSERT INTO delivery_statuses (`+statusColumns+`) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)
+		 ON CONFLICT (notification_id, user_id, channel) DO UPDATE SET
+			type = excluded.type, state = excluded.state, reason = excluded.reason,
+			events = excluded.events, updated_at = excluded.updated_at`,
+		st.NotificationID, st.UserID.String(), st.Channel, st.Type, string(st.State), st.Reason, string(events),
+		st.CreatedAt.UnixMilli(), st.UpdatedAt.UnixMilli())
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// ByNotification implements Store
+func (s *SQLStore) ByNotification(ctx context.Context, notificationID string) ([]*Status, error) {
+	statuses, err := s.statuses(ctx,
+		`SELECT `+statusColumns+` FROM delivery_statuses WHERE notification_id = ? ORDER BY user_id, channel`,
+		notificationID)
+	if err != nil {
+		return nil, err
+	}
+	if len(statuses) == 0 {
+		return nil, ErrNotFound
+	}
+	return statuses, nil
+}
+
+// ByUser implements Store
+func (s *SQLStore) ByUser(ctx context.Context, userID uuid.UUID, before time.Time, limit int) ([]*Status, error) {
+	query := `SELECT ` + statusColumns + ` FROM delivery_statuses WHERE user_id = ?`
+	args := []interface{}{userID.String()}
+	if !before.IsZero() {
+		query += ` AND created_at < ?`
+		args = append(args, before.UnixMilli())
+	}
+	query += ` ORDER BY created_at DESC, notification_id, channel LIMIT ?`
+	return s.statuses(ctx, query, append(args, limit)...)
+}
+
+// Prune implements Store
+func (s *SQLStore) Prune(ctx context.Context, before time.Time) (int, error) {
+	res, err := s.db.ExecContext(ctx, `DELETE FROM delivery_statuses WHERE updated_at < ?`, before.UnixMilli())
+	if err != nil {
+		return 0, err
+	}
+	n, err := res.RowsAffected()
+	return int(n), err
+}
+
+func (s *SQLStore) statuses(ctx context.Context, query string, args ...interface{}) ([]*Status, error) {
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var statuses []*Status
+	for rows.Next() {
+		st, err := scanStatus(rows)
+		if err != nil {
+			return nil, err
+		}
+		statuses = append(statuses, st)
+	}
+	return statuses, rows.Err()
+}
+
+// scanStatus reads a row of statusColumns
+func scanStatus(row interface{ Scan(...interface{}) error }) (*Status, error) {
+	var (
+		st                   Status
+		userID, state        string
+		events               string
+		createdAt, updatedAt int64
+	)
+	if err := row.Scan(&st.NotificationID, &userID, &st.Channel, &st.Type, &state, &st.Reason, &events, &createdAt, &updatedAt); err != nil {
+		return nil, err
+	}
+	var err error
+	if st.UserID, err = uuid.Parse(userID); err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal([]byte(events), &st.Events); err != nil {
+		return nil, err
+	}
+	st.State = notify.State(state)
+	st.CreatedAt = time.UnixMilli(createdAt).UTC()
+	st.UpdatedAt = time.UnixMilli(updatedAt).UTC()
+	return &st, nil
+}
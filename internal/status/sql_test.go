@@ -0,0 +1,60 @@
+package status
+
+import (
+	"context"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/cypherlabdev/notification-service/internal/notify"
+	"github.com/cypherlabdev/notification-service/internal/sqlite"
+)
+
+// newTestSQLStore opens a store over the database at path, so that stores
+// opened on the same path act like processes on one host sharing the file
+func newTestSQLStore(t *testing.T, path string) *SQLStore {
+	db, err := sqlite.Open(context.Background(), path)
+	require.NoError(t, err)
+	t.Cleanup(func() { db.Close() })
+	store := NewSQLStore(db)
+	require.NoError(t, store.Migrate(context.Background()))
+	return store
+}
+
+// TestSQLStore tests recording and querying statuses
+func TestSQLStore(t *testing.T) {
+	testStore(t, newTestSQLStore(t, filepath.Join(t.TempDir(), "status.db")))
+}
+
+// TestSQLStore_Processes tests that processes recording events of one
+// delivery at once lose none of them
+func TestSQLStore_Processes(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "status.db")
+	key := Key{NotificationID: "n1", UserID: uuid.New(), Channel: notify.ChannelWebSocket}
+	base := time.Date(2026, 6, 10, 12, 0, 0, 0, time.UTC)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		s := newTestSQLStore(t, path)
+		for j := 0; j < 5; j++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				at := base.Add(time.Duration(i*5+j) * time.Millisecond)
+				assert.NoError(t, s.Record(ctx, key, "bet_settled", Event{State: notify.StateQueued, At: at}))
+			}()
+		}
+	}
+	wg.Wait()
+
+	statuses, err := newTestSQLStore(t, path).ByNotification(ctx, "n1")
+	require.NoError(t, err)
+	require.Len(t, statuses, 1)
+	assert.Len(t, statuses[0].Events, 20)
+}
@@ -0,0 +1,203 @@
+package status
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/cypherlabdev/notification-service/internal/notify"
+)
+
+// ErrNotFound is returned for a notification without recorded statuses
+var ErrNotFound = errors.New("delivery status not found")
+
+// maxEvents bounds the history kept per status; the oldest events go first
+const maxEvents = 20
+
+// Key identifies the delivery of a notification to a user over a channel.
+// Channel is empty for the steps before the dispatcher picks channels.
+type Key struct {
+	NotificationID string
+	UserID         uuid.UUID
+	Channel        string
+}
+
+// Event is a step reported in a delivery
+type Event struct {
+	State  notify.State `json:"state"`
+	Reason string       `json:"reason,omitempty"`
+	At     time.Time    `json:"at"`
+}
+
+// Status is where the delivery of a notification to a user over a channel
+// has got to, with the events that led there
+type Status struct {
+	NotificationID string       `json:"notification_id"`
+	UserID         uuid.UUID    `json:"user_id"`
+	Channel        string       `json:"channel"`
+	Type           string       `json:"type,omitempty"`
+	State          notify.State `json:"state"`
+	Reason         string       `json:"reason,omitempty"`
+	Events         []Event      `json:"events"`
+	CreatedAt      time.Time    `json:"created_at"`
+	UpdatedAt      time.Time    `json:"updated_at"`
+}
+
+// rank orders the states a delivery moves through
+var rank = map[notify.State]int{
+	notify.StateAccepted:  1,
+	notify.StateQueued:    2,
+	notify.StateSent:      3,
+	notify.StateDelivered: 4,
+	notify.StateAcked:     5,
+	notify.StateRead:      6,
+}
+
+// apply records e in the status. Events can arrive out of order, e.g. a
+// client's ack before the channel reports the send, so the state only
+// moves forward: a failure overrides a delivery still in flight, and a
+// later attempt getting as far as queued overrides a failure.
+func (s *Status) apply(typ string, e Event) {
+	if s.Type == "" {
+		s.Type = typ
+	}
+	s.Events = append(s.Events, e)
+	if len(s.Events) > maxEvents {
+		s.Events = slices.Delete(s.Events, 0, len(s.Events)-maxEvents)
+	}
+	if e.At.After(s.UpdatedAt) {
+		s.UpdatedAt = e.At
+	}
+
+	var advance bool
+	switch {
+	case s.State == "":
+		advance = true
+	case e.State == notify.StateFailed:
+		advance = s.State == notify.StateFailed || rank[s.State] <= rank[notify.StateSent]
+	case s.State == notify.StateFailed:
+		advance = rank[e.State] >= rank[notify.StateQueued]
+	default:
+		advance = rank[e.State] > rank[s.State]
+	}
+	if advance {
+		s.State = e.State
+		s.Reason = e.Reason
+	}
+}
+
+// Store persists delivery statuses
+type Store interface {
+	// Record applies an event to the status for key, creating it on the
+	// first event. typ is the notification type, if the reporter knows it.
+	Record(ctx context.Context, key Key, typ string, e Event) error
+	// ByNotification returns the statuses of a notification by user and
+	// channel, or ErrNotFound
+	ByNotification(ctx context.Context, notificationID string) ([]*Status, error)
+	// ByUser returns up to limit of the user's statuses created before
+	// before, newest first; a zero before means now
+	ByUser(ctx context.Context, userID uuid.UUID, before time.Time, limit int) ([]*Status, error)
+	// Prune deletes the statuses last updated before the given time,
+	// returning how many it deleted
+	Prune(ctx context.Context, before time.Time) (int, error)
+}
+
+// MemoryStore is a non-durable Store for tests and single-instance setups
+type MemoryStore struct {
+	statuses map[Key]*Status
+	mu       sync.Mutex
+}
+
+// NewMemoryStore creates an empty in-memory store
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{statuses: make(map[Key]*Status)}
+}
+
+// Record implements Store
+func (s *MemoryStore) Record(_ context.Context, key Key, typ string, e Event) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	st, ok := s.statuses[key]
+	if !ok {
+		st = &Status{NotificationID: key.NotificationID, UserID: key.UserID, Channel: key.Channel, CreatedAt: e.At}
+		s.statuses[key] = st
+	}
+	st.apply(typ, e)
+	return nil
+}
+
+// ByNotification implements Store
+func (s *MemoryStore) ByNotification(_ context.Context, notificationID string) ([]*Status, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var out []*Status
+	for key, st := range s.statuses {
+		if key.NotificationID == notificationID {
+			out = append(out, clone(st))
+		}
+	}
+	if len(out) == 0 {
+		return nil, ErrNotFound
+	}
+	slices.SortFunc(out, func(a, b *Status) int {
+		if c := cmp.Compare(a.UserID.String(), b.UserID.String()); c != 0 {
+			return c
+		}
+		return cmp.Compare(a.Channel, b.Channel)
+	})
+	return out, nil
+}
+
+// ByUser implements Store
+func (s *MemoryStore) ByUser(_ context.Context, userID uuid.UUID, before time.Time, limit int) ([]*Status, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var out []*Status
+	for key, st := range s.statuses {
+		if key.UserID == userID && (before.IsZero() || st.CreatedAt.Before(before)) {
+			out = append(out, clone(st))
+		}
+	}
+	slices.SortFunc(out, newestFirst)
+	if len(out) > limit {
+		out = out[:limit]
+	}
+	return out, nil
+}
+
+// Prune implements Store
+func (s *MemoryStore) Prune(_ context.Context, before time.Time) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	pruned := 0
+	for key, st := range s.statuses {
+		if st.UpdatedAt.Before(before) {
+			delete(s.statuses, key)
+			pruned++
+		}
+	}
+	return pruned, nil
+}
+
+func clone(st *Status) *Status {
+	c := *st
+	c.Events = slices.Clone(st.Events)
+	return &c
+}
+
+// newestFirst orders statuses by creation, newest first, keeping the
+// channels of a notification together
+func newestFirst(a, b *Status) int {
+	if c := b.CreatedAt.Compare(a.CreatedAt); c != 0 {
+		return c
+	}
+	if c := cmp.Compare(a.NotificationID, b.NotificationID); c != 0 {
+		return c
+	}
+	return cmp.Compare(a.Channel, b.Channel)
+}
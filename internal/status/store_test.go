@@ -0,0 +1,107 @@
+package status
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/cypherlabdev/notification-service/internal/notify"
+)
+
+// TestStatus_Apply tests that states only move forward, whatever order
+// events arrive in
+func TestStatus_Apply(t *testing.T) {
+	tests := []struct {
+		name   string
+		states []notify.State
+		want   notify.State
+	}{
+		{"in order", []notify.State{notify.StateQueued, notify.StateSent, notify.StateAcked, notify.StateRead}, notify.StateRead},
+		{"ack before send", []notify.State{notify.StateQueued, notify.StateAcked, notify.StateSent}, notify.StateAcked},
+		{"late queued", []notify.State{notify.StateSent, notify.StateQueued}, notify.StateSent},
+		{"failure in flight", []notify.State{notify.StateQueued, notify.StateFailed}, notify.StateFailed},
+		{"failure after delivery", []notify.State{notify.StateDelivered, notify.StateFailed}, notify.StateDelivered},
+		{"retry after failure", []notify.State{notify.StateFailed, notify.StateQueued}, notify.StateQueued},
+		{"accepted after failure", []notify.State{notify.StateFailed, notify.StateAccepted}, notify.StateFailed},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var s Status
+			for _, state := range tt.states {
+				s.apply("", Event{State: state, Reason: string(state)})
+			}
+			assert.Equal(t, tt.want, s.State)
+			assert.Equal(t, string(tt.want), s.Reason, "the reason is the winning event's")
+			assert.Len(t, s.Events, len(tt.states), "every event is kept")
+		})
+	}
+
+	var s Status
+	for i := range maxEvents + 5 {
+		s.apply("bet_settled", Event{State: notify.StateSent, Reason: fmt.Sprint(i)})
+	}
+	assert.Len(t, s.Events, maxEvents)
+	assert.Equal(t, fmt.Sprint(maxEvents+4), s.Events[maxEvents-1].Reason, "the newest events are kept")
+	assert.Equal(t, "bet_settled", s.Type)
+}
+
+// TestMemoryStore tests recording and querying statuses
+func TestMemoryStore(t *testing.T) {
+	testStore(t, NewMemoryStore())
+}
+
+func testStore(t *testing.T, s Store) {
+	ctx := context.Background()
+	alice, bob := uuid.New(), uuid.New()
+	base := time.Date(2026, 6, 10, 12, 0, 0, 0, time.UTC)
+
+	record := func(id string, user uuid.UUID, channel string, state notify.State, at time.Time) {
+		require.NoError(t, s.Record(ctx, Key{NotificationID: id, UserID: user, Channel: channel}, "bet_settled", Event{State: state, At: at}))
+	}
+	record("n1", alice, "", notify.StateAccepted, base)
+	record("n1", alice, "websocket", notify.StateQueued, base)
+	record("n1", alice, "websocket", notify.StateSent, base.Add(time.Second))
+	record("n1", bob, "websocket", notify.StateFailed, base)
+	record("n2", alice, "webhook", notify.StateQueued, base.Add(time.Minute))
+
+	statuses, err := s.ByNotification(ctx, "n1")
+	require.NoError(t, err)
+	require.Len(t, statuses, 3)
+	var aliceWS *Status
+	for _, st := range statuses {
+		if st.UserID == alice && st.Channel == "websocket" {
+			aliceWS = st
+		}
+	}
+	require.NotNil(t, aliceWS)
+	assert.Equal(t, notify.StateSent, aliceWS.State)
+	assert.Equal(t, base, aliceWS.CreatedAt)
+	assert.Equal(t, base.Add(time.Second), aliceWS.UpdatedAt)
+	assert.Len(t, aliceWS.Events, 2)
+
+	_, err = s.ByNotification(ctx, "missing")
+	assert.ErrorIs(t, err, ErrNotFound)
+
+	page, err := s.ByUser(ctx, alice, time.Time{}, 2)
+	require.NoError(t, err)
+	require.Len(t, page, 2)
+	assert.Equal(t, "n2", page[0].NotificationID, "newest first")
+	assert.Equal(t, "", page[1].Channel, "channels of a notification sort together")
+
+	page, err = s.ByUser(ctx, alice, base.Add(time.Minute), 10)
+	require.NoError(t, err)
+	assert.Len(t, page, 2, "before excludes n2")
+
+	pruned, err := s.Prune(ctx, base.Add(30*time.Second))
+	require.NoError(t, err)
+	assert.Equal(t, 3, pruned)
+	page, err = s.ByUser(ctx, alice, time.Time{}, 10)
+	require.NoError(t, err)
+	require.Len(t, page, 1)
+	assert.Equal(t, "n2", page[0].NotificationID)
+}
@@ -0,0 +1,158 @@
+// Package status records how far each notification got on its way to each
+// recipient over each channel, from the dispatcher accepting it to the
+// user reading it, so support can answer "did we notify this user?".
+package status
+
+import (
+	"context"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/rs/zerolog"
+
+	"github.com/cypherlabdev/notification-service/internal/notify"
+)
+
+const (
+	defaultBuffer    = 4096
+	defaultRetention = 30 * 24 * time.Hour
+	pruneInterval    = time.Hour
+	// drainTimeout bounds how long Run spends recording buffered events
+	// once it is stopped
+	drainTimeout = 5 * time.Second
+)
+
+// Option configures a Tracker
+type Option func(*Tracker)
+
+// WithBuffer sets how many events may wait to be recorded before new ones
+// are dropped
+func WithBuffer(size int) Option {
+	return func(t *Tracker) {
+		t.events = make(chan record, max(size, 1))
+	}
+}
+
+// WithRetention sets how long a status is kept after its last event
+func WithRetention(d time.Duration) Option {
+	return func(t *Tracker) {
+		t.retention = d
+	}
+}
+
+// record is an event waiting to be stored
+type record struct {
+	key   Key
+	typ   string
+	event Event
+}
+
+// Tracker is a notify.Tracker that records delivery statuses in a store.
+// Events are buffered so reporters never wait on the store; when the
+// buffer is full they are dropped and counted.
+type Tracker struct {
+	store     Store
+	events    chan record
+	retention time.Duration
+	logger    zerolog.Logger
+	now       func() time.Time
+}
+
+// New creates a tracker over store; call Run to record events
+func New(store Store, logger zerolog.Logger, opts ...Option) *Tracker {
+	t := &Tracker{
+		store:     store,
+		events:    make(chan record, defaultBuffer),
+		retention: defaultRetention,
+		logger:    logger.With().Str("component", "delivery_status").Logger(),
+		now:       time.Now,
+	}
+	for _, opt := range opts {
+		opt(t)
+	}
+	return t
+}
+
+// Track implements notify.Tracker
+func (t *Tracker) Track(n *notify.Notification, channel string, state notify.State, reason string) {
+	t.add(Key{NotificationID: n.ID, UserID: n.UserID, Channel: channel}, n.Type, state, reason)
+}
+
+// FromHub is a websocket.StatusFunc recording what the hub and the user's
+// clients report for messages of the WebSocket channel
+func (t *Tracker) FromHub(notificationID string, userID uuid.UUID, status, reason string) {
+	t.add(Key{NotificationID: notificationID, UserID: userID, Channel: notify.ChannelWebSocket}, "", notify.State(status), reason)
+}
+
+func (t *Tracker) add(key Key, typ string, state notify.State, reason string) {
+	if key.NotificationID == "" {
+		return
+	}
+	select {
+	case t.events <- record{key: key, typ: typ, event: Event{State: state, Reason: reason, At: t.now().UTC()}}:
+	default:
+		dropped.Inc()
+	}
+}
+
+// ByNotification returns the statuses of a notification
+func (t *Tracker) ByNotification(ctx context.Context, notificationID string) ([]*Status, error) {
+	return t.store.ByNotification(ctx, notificationID)
+}
+
+// ByUser returns the user's statuses created before before, newest first
+func (t *Tracker) ByUser(ctx context.Context, userID uuid.UUID, before time.Time, limit int) ([]*Status, error) {
+	return t.store.ByUser(ctx, userID, before, limit)
+}
+
+// Run records events and prunes expired statuses until ctx is cancelled,
+// then records the events still buffered
+func (t *Tracker) Run(ctx context.Context) {
+	ticker := time.NewTicker(pruneInterval)
+	defer ticker.Stop()
+	t.prune(ctx)
+	for {
+		select {
+		case r := <-t.events:
+			t.record(ctx, r)
+		case <-ticker.C:
+			t.prune(ctx)
+		case <-ctx.Done():
+			t.drain()
+			return
+		}
+	}
+}
+
+// drain records the buffered events after Run is stopped
+func (t *Tracker) drain() {
+	ctx, cancel := context.WithTimeout(context.Background(), drainTimeout)
+	defer cancel()
+	for {
+		select {
+		case r := <-t.events:
+			t.record(ctx, r)
+		default:
+			return
+		}
+	}
+}
+
+func (t *Tracker) record(ctx context.Context, r record) {
+	if err := t.store.Record(ctx, r.key, r.typ, r.event); err != nil {
+		t.logger.Error().Err(err).Str("notification_id", r.key.NotificationID).Str("channel", r.key.Channel).Msg("failed to record delivery status")
+		return
+	}
+	recorded.WithLabelValues(string(r.event.State)).Inc()
+}
+
+func (t *Tracker) prune(ctx context.Context) {
+	pruned, err := t.store.Prune(ctx, t.now().Add(-t.retention))
+	if err != nil {
+		t.logger.Error().Err(err).Msg("failed to prune delivery statuses")
+		return
+	}
+	if pruned > 0 {
+		t.logger.Debug().Int("pruned", pruned).Msg("pruned delivery statuses")
+	}
+}
@@ -0,0 +1,82 @@
+package status
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/cypherlabdev/notification-service/internal/notify"
+)
+
+// TestTracker tests recording events from the dispatcher and the hub
+func TestTracker(t *testing.T) {
+	store := NewMemoryStore()
+	tracker := New(store, zerolog.Nop())
+	userID := uuid.New()
+	n := &notify.Notification{ID: "n1", UserID: userID, Type: "bet_settled"}
+
+	tracker.Track(n, "", notify.StateAccepted, "")
+	tracker.Track(n, notify.ChannelWebSocket, notify.StateQueued, "")
+	tracker.FromHub("n1", userID, "sent", "")
+	tracker.FromHub("n1", userID, "read", "")
+	tracker.FromHub("", userID, "acked", "")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	tracker.Run(ctx)
+
+	statuses, err := tracker.ByNotification(context.Background(), "n1")
+	require.NoError(t, err)
+	require.Len(t, statuses, 2)
+	assert.Equal(t, notify.StateAccepted, statuses[0].State)
+	ws := statuses[1]
+	assert.Equal(t, notify.ChannelWebSocket, ws.Channel)
+	assert.Equal(t, notify.StateRead, ws.State)
+	assert.Equal(t, "bet_settled", ws.Type)
+	assert.Len(t, ws.Events, 3)
+}
+
+// TestTracker_Full tests that events are dropped rather than blocking
+// when the buffer is full
+func TestTracker_Full(t *testing.T) {
+	tracker := New(NewMemoryStore(), zerolog.Nop(), WithBuffer(1))
+	n := &notify.Notification{ID: "n1", UserID: uuid.New()}
+
+	done := make(chan struct{})
+	go func() {
+		tracker.Track(n, "", notify.StateAccepted, "")
+		tracker.Track(n, "websocket", notify.StateQueued, "")
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("Track blocked on a full buffer")
+	}
+	assert.Len(t, tracker.events, 1)
+}
+
+// TestTracker_Retention tests pruning statuses past the retention period
+func TestTracker_Retention(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemoryStore()
+	tracker := New(store, zerolog.Nop(), WithRetention(24*time.Hour))
+	now := time.Date(2026, 6, 10, 12, 0, 0, 0, time.UTC)
+	tracker.now = func() time.Time { return now }
+	userID := uuid.New()
+
+	require.NoError(t, store.Record(ctx, Key{NotificationID: "old", UserID: userID}, "", Event{State: notify.StateAccepted, At: now.Add(-25 * time.Hour)}))
+	require.NoError(t, store.Record(ctx, Key{NotificationID: "new", UserID: userID}, "", Event{State: notify.StateAccepted, At: now.Add(-time.Hour)}))
+
+	tracker.prune(ctx)
+
+	_, err := store.ByNotification(ctx, "old")
+	assert.ErrorIs(t, err, ErrNotFound)
+	_, err = store.ByNotification(ctx, "new")
+	assert.NoError(t, err)
+}
@@ -0,0 +1,291 @@
+// Package webhook delivers notifications to partner HTTPS endpoints as
+// HMAC-signed POST requests, retrying failures and disabling endpoints
+// that keep failing.
+package webhook
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/url"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+var (
+	// ErrNotFound is returned for an unknown endpoint
+	ErrNotFound = errors.New("webhook endpoint not found")
+	// ErrInvalid is returned for an endpoint that cannot be registered
+	ErrInvalid = errors.New("invalid webhook endpoint")
+)
+
+// Status is the state of an endpoint
+type Status string
+
+const (
+	StatusActive   Status = "active"
+	StatusDisabled Status = "disabled"
+)
+
+// secretPrefix marks signing secrets so they are recognisable in config
+const secretPrefix = "whsec_"
+
+// Secret is a signing secret. Deliveries are signed with every secret that
+// has not expired, so a rotated-out secret keeps verifying until receivers
+// have switched to the new one.
+type Secret struct {
+	Value     string    `json:"value"`
+	CreatedAt time.Time `json:"created_at"`
+	// ExpiresAt is set when the secret is rotated out
+	ExpiresAt time.Time `json:"expires_at,omitzero"`
+}
+
+// Endpoint is a partner URL receiving an account's notifications
+type Endpoint struct {
+	ID        uuid.UUID `json:"id"`
+	AccountID uuid.UUID `json:"account_id"`
+	URL       string    `json:"url"`
+	// Types limits the notification types delivered; empty means all
+	Types []string `json:"types,omitempty"`
+	// Secrets are only returned when an endpoint is created or rotated
+	Secrets []Secret `json:"-"`
+	Status  Status   `json:"status"`
+	// DisabledReason says why the endpoint was disabled
+	DisabledReason string `json:"disabled_reason,omitempty"`
+	// ConsecutiveFailures counts failed deliveries since the last success,
+	// which began at FailingSince
+	ConsecutiveFailures int       `json:"consecutive_failures"`
+	FailingSince        time.Time `json:"failing_since,omitzero"`
+	CreatedAt           time.Time `json:"created_at"`
+	UpdatedAt           time.Time `json:"updated_at"`
+}
+
+// NewEndpoint validates and creates an endpoint with a fresh secret.
+// Endpoints must use HTTPS.
+func NewEndpoint(accountID uuid.UUID, rawURL string, types []string, now time.Time) (*Endpoint, error) {
+	if accountID == uuid.Nil {
+		return nil, fmt.Errorf("%w: account_id is required", ErrInvalid)
+	}
+	if err := validateURL(rawURL); err != nil {
+		return nil, err
+	}
+	secret, err := newSecret()
+	if err != nil {
+		return nil, err
+	}
+	return &Endpoint{
+		ID:        uuid.New(),
+		AccountID: accountID,
+		URL:       rawURL,
+		Types:     types,
+		Secrets:   []Secret{{Value: secret, CreatedAt: now}},
+		Status:    StatusActive,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}, nil
+}
+
+func validateURL(rawURL string) error {
+	u, err := url.Parse(rawURL)
+	if err != nil || u.Scheme != "https" || u.Host == "" {
+		return fmt.Errorf("%w: url must be an absolute https URL", ErrInvalid)
+	}
+	return nil
+}
+
+// wants reports whether the endpoint takes notifications of msgType
+func (e *Endpoint) wants(msgType string) bool {
+	return e.Status == StatusActive && (len(e.Types) == 0 || slices.Contains(e.Types, msgType))
+}
+
+// activeSecrets returns the secrets deliveries are signed with at now
+func (e *Endpoint) activeSecrets(now time.Time) []string {
+	var out []string
+	for _, s := range e.Secrets {
+		if s.ExpiresAt.IsZero() || now.Before(s.ExpiresAt) {
+			out = append(out, s.Value)
+		}
+	}
+	return out
+}
+
+// rotate adds a new secret, expiring the current ones after grace, and
+// returns it
+func (e *Endpoint) rotate(now time.Time, grace time.Duration) (Secret, error) {
+	value, err := newSecret()
+	if err != nil {
+		return Secret{}, err
+	}
+	kept := e.Secrets[:0]
+	for _, s := range e.Secrets {
+		if !s.ExpiresAt.IsZero() && !now.Before(s.ExpiresAt) {
+			continue
+		}
+		if s.ExpiresAt.IsZero() || s.ExpiresAt.After(now.Add(grace)) {
+			s.ExpiresAt = now.Add(grace)
+		}
+		kept = append(kept, s)
+	}
+	secret := Secret{Value: value, CreatedAt: now}
+	e.Secrets = append(kept, secret)
+	return secret, nil
+}
+
+func newSecret() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return secretPrefix + base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// DeliveryStatus is the outcome of one delivery attempt
+type DeliveryStatus string
+
+const (
+	DeliverySucceeded DeliveryStatus = "succeeded"
+	// DeliveryRetrying is a failed attempt that will be retried
+	DeliveryRetrying DeliveryStatus = "retrying"
+	DeliveryFailed   DeliveryStatus = "failed"
+)
+
+// Delivery is one attempt to deliver a notification to an endpoint
+type Delivery struct {
+	ID             uuid.UUID      `json:"id"`
+	EndpointID     uuid.UUID      `json:"endpoint_id"`
+	NotificationID string         `json:"notification_id"`
+	Type           string         `json:"type"`
+	Attempt        int            `json:"attempt"`
+	Status         DeliveryStatus `json:"status"`
+	StatusCode     int            `json:"status_code,omitempty"`
+	Error          string         `json:"error,omitempty"`
+	DurationMillis int64          `json:"duration_ms"`
+	At             time.Time      `json:"at"`
+}
+
+// Store persists endpoints and their delivery log
+type Store interface {
+	Create(ctx context.Context, e *Endpoint) error
+	Get(ctx context.Context, id uuid.UUID) (*Endpoint, error)
+	// Update overwrites a stored endpoint, or returns ErrNotFound
+	Update(ctx context.Context, e *Endpoint) error
+	Delete(ctx context.Context, id uuid.UUID) error
+	// ForAccount returns the account's endpoints, oldest first
+	ForAccount(ctx context.Context, accountID uuid.UUID) ([]*Endpoint, error)
+	// LogDelivery appends to the endpoint's delivery log
+	LogDelivery(ctx context.Context, d *Delivery) error
+	// Deliveries returns the endpoint's latest deliveries, newest first
+	Deliveries(ctx context.Context, endpointID uuid.UUID, limit int) ([]*Delivery, error)
+}
+
+// maxLoggedDeliveries bounds the delivery log kept per endpoint in memory
+const maxLoggedDeliveries = 200
+
+// MemoryStore is an in-process Store
+type MemoryStore struct {
+	endpoints  map[uuid.UUID]*Endpoint
+	deliveries map[uuid.UUID][]*Delivery // oldest first
+	mu         sync.Mutex
+}
+
+// NewMemoryStore creates an empty in-memory store
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		endpoints:  make(map[uuid.UUID]*Endpoint),
+		deliveries: make(map[uuid.UUID][]*Delivery),
+	}
+}
+
+// Create implements Store
+func (s *MemoryStore) Create(_ context.Context, e *Endpoint) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.endpoints[e.ID] = cloneEndpoint(e)
+	return nil
+}
+
+// Get implements Store
+func (s *MemoryStore) Get(_ context.Context, id uuid.UUID) (*Endpoint, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	e, ok := s.endpoints[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return cloneEndpoint(e), nil
+}
+
+// Update implements Store
+func (s *MemoryStore) Update(_ context.Context, e *Endpoint) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.endpoints[e.ID]; !ok {
+		return ErrNotFound
+	}
+	s.endpoints[e.ID] = cloneEndpoint(e)
+	return nil
+}
+
+// Delete implements Store
+func (s *MemoryStore) Delete(_ context.Context, id uuid.UUID) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.endpoints[id]; !ok {
+		return ErrNotFound
+	}
+	delete(s.endpoints, id)
+	delete(s.deliveries, id)
+	return nil
+}
+
+// ForAccount implements Store
+func (s *MemoryStore) ForAccount(_ context.Context, accountID uuid.UUID) ([]*Endpoint, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var out []*Endpoint
+	for _, e := range s.endpoints {
+		if e.AccountID == accountID {
+			out = append(out, cloneEndpoint(e))
+		}
+	}
+	slices.SortFunc(out, func(a, b *Endpoint) int { return a.CreatedAt.Compare(b.CreatedAt) })
+	return out, nil
+}
+
+// LogDelivery implements Store
+func (s *MemoryStore) LogDelivery(_ context.Context, d *Delivery) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	log := append(s.deliveries[d.EndpointID], new(Delivery))
+	*log[len(log)-1] = *d
+	if len(log) > maxLoggedDeliveries {
+		log = slices.Delete(log, 0, len(log)-maxLoggedDeliveries)
+	}
+	s.deliveries[d.EndpointID] = log
+	return nil
+}
+
+// Deliveries implements Store
+func (s *MemoryStore) Deliveries(_ context.Context, endpointID uuid.UUID, limit int) ([]*Delivery, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	log := s.deliveries[endpointID]
+	var out []*Delivery
+	for i := len(log) - 1; i >= 0 && (limit <= 0 || len(out) < limit); i-- {
+		d := *log[i]
+		out = append(out, &d)
+	}
+	return out, nil
+}
+
+func cloneEndpoint(e *Endpoint) *Endpoint {
+	c := *e
+	c.Types = slices.Clone(e.Types)
+	c.Secrets = slices.Clone(e.Secrets)
+	return &c
+}
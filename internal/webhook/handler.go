@@ -0,0 +1,252 @@
+package webhook
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/rs/zerolog"
+)
+
+const (
+	defaultDeliveryPage = 50
+	maxDeliveryPage     = maxLoggedDeliveries
+)
+
+// registerRequest is the body of POST /webhooks
+type registerRequest struct {
+	AccountID uuid.UUID `json:"account_id"`
+	URL       string    `json:"url"`
+	Types     []string  `json:"types,omitempty"`
+}
+
+// rotateRequest is the optional body of POST /webhooks/{id}/rotate; grace
+// is a Go duration such as "24h"
+type rotateRequest struct {
+	Grace string `json:"grace,omitempty"`
+}
+
+// secretResponse is an endpoint with the signing secret just issued; the
+// secret is not returned again
+type secretResponse struct {
+	*Endpoint
+	Secret string `json:"secret"`
+}
+
+// endpointsResponse lists an account's endpoints
+type endpointsResponse struct {
+	Endpoints []*Endpoint `json:"endpoints"`
+}
+
+// deliveriesResponse lists an endpoint's latest deliveries
+type deliveriesResponse struct {
+	Deliveries []*Delivery `json:"deliveries"`
+}
+
+// Handler serves the webhook endpoint API:
+//
+//	POST   /webhooks                   registers an endpoint and returns its secret
+//	GET    /webhooks?account_id=       lists an account's endpoints
+//	GET    /webhooks/{id}
+//	PATCH  /webhooks/{id}              changes url or types
+//	DELETE /webhooks/{id}
+//	POST   /webhooks/{id}/rotate       issues a new secret; the old one keeps signing for grace
+//	POST   /webhooks/{id}/enable       re-enables a disabled endpoint
+//	GET    /webhooks/{id}/deliveries   returns the latest delivery attempts
+type Handler struct {
+	channel *Channel
+	logger  zerolog.Logger
+	mux     *http.ServeMux
+}
+
+// NewHandler creates the endpoint API over channel
+func NewHandler(channel *Channel, logger zerolog.Logger) *Handler {
+	h := &Handler{
+		channel: channel,
+		logger:  logger.With().Str("component", "webhook_api").Logger(),
+		mux:     http.NewServeMux(),
+	}
+	h.mux.HandleFunc("POST /webhooks", h.register)
+	h.mux.HandleFunc("GET /webhooks", h.list)
+	h.mux.HandleFunc("GET /webhooks/{id}", h.get)
+	h.mux.HandleFunc("PATCH /webhooks/{id}", h.modify)
+	h.mux.HandleFunc("DELETE /webhooks/{id}", h.deregister)
+	h.mux.HandleFunc("POST /webhooks/{id}/rotate", h.rotate)
+	h.mux.HandleFunc("POST /webhooks/{id}/enable", h.enable)
+	h.mux.HandleFunc("GET /webhooks/{id}/deliveries", h.deliveries)
+	return h
+}
+
+// ServeHTTP implements http.Handler
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	h.mux.ServeHTTP(w, r)
+}
+
+func (h *Handler) register(w http.ResponseWriter, r *http.Request) {
+	var req registerRequest
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 64<<10)).Decode(&req); err != nil {
+		http.Error(w, "invalid body: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	ep, err := h.channel.Register(r.Context(), req.AccountID, req.URL, req.Types)
+	if err != nil {
+		h.storeError(w, err, "failed to register webhook endpoint")
+		return
+	}
+	writeJSON(w, http.StatusCreated, secretResponse{Endpoint: ep, Secret: ep.Secrets[0].Value})
+}
+
+func (h *Handler) list(w http.ResponseWriter, r *http.Request) {
+	accountID, err := uuid.Parse(r.URL.Query().Get("account_id"))
+	if err != nil {
+		http.Error(w, "account_id is required", http.StatusBadRequest)
+		return
+	}
+	endpoints, err := h.channel.Endpoints(r.Context(), accountID)
+	if err != nil {
+		h.storeError(w, err, "failed to list webhook endpoints")
+		return
+	}
+	if endpoints == nil {
+		endpoints = []*Endpoint{}
+	}
+	writeJSON(w, http.StatusOK, endpointsResponse{Endpoints: endpoints})
+}
+
+func (h *Handler) get(w http.ResponseWriter, r *http.Request) {
+	id, ok := pathID(w, r)
+	if !ok {
+		return
+	}
+	ep, err := h.channel.Endpoint(r.Context(), id)
+	if err != nil {
+		h.storeError(w, err, "failed to load webhook endpoint")
+		return
+	}
+	writeJSON(w, http.StatusOK, ep)
+}
+
+func (h *Handler) modify(w http.ResponseWriter, r *http.Request) {
+	id, ok := pathID(w, r)
+	if !ok {
+		return
+	}
+	var update EndpointUpdate
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 64<<10)).Decode(&update); err != nil {
+		http.Error(w, "invalid body: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	ep, err := h.channel.Modify(r.Context(), id, update)
+	if err != nil {
+		h.storeError(w, err, "failed to update webhook endpoint")
+		return
+	}
+	writeJSON(w, http.StatusOK, ep)
+}
+
+func (h *Handler) deregister(w http.ResponseWriter, r *http.Request) {
+	id, ok := pathID(w, r)
+	if !ok {
+		return
+	}
+	if err := h.channel.Deregister(r.Context(), id); err != nil {
+		h.storeError(w, err, "failed to delete webhook endpoint")
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *Handler) rotate(w http.ResponseWriter, r *http.Request) {
+	id, ok := pathID(w, r)
+	if !ok {
+		return
+	}
+	var req rotateRequest
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 4<<10)).Decode(&req); err != nil && !errors.Is(err, io.EOF) {
+		http.Error(w, "invalid body: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	grace := defaultRotationGrace
+	if req.Grace != "" {
+		var err error
+		if grace, err = time.ParseDuration(req.Grace); err != nil || grace < 0 {
+			http.Error(w, "invalid grace", http.StatusBadRequest)
+			return
+		}
+	}
+	ep, secret, err := h.channel.Rotate(r.Context(), id, grace)
+	if err != nil {
+		h.storeError(w, err, "failed to rotate webhook secret")
+		return
+	}
+	writeJSON(w, http.StatusOK, secretResponse{Endpoint: ep, Secret: secret.Value})
+}
+
+func (h *Handler) enable(w http.ResponseWriter, r *http.Request) {
+	id, ok := pathID(w, r)
+	if !ok {
+		return
+	}
+	ep, err := h.channel.Enable(r.Context(), id)
+	if err != nil {
+		h.storeError(w, err, "failed to enable webhook endpoint")
+		return
+	}
+	writeJSON(w, http.StatusOK, ep)
+}
+
+func (h *Handler) deliveries(w http.ResponseWriter, r *http.Request) {
+	id, ok := pathID(w, r)
+	if !ok {
+		return
+	}
+	limit := defaultDeliveryPage
+	if v := r.URL.Query().Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 {
+			http.Error(w, "invalid limit", http.StatusBadRequest)
+			return
+		}
+		limit = min(n, maxDeliveryPage)
+	}
+	log, err := h.channel.Deliveries(r.Context(), id, limit)
+	if err != nil {
+		h.storeError(w, err, "failed to list webhook deliveries")
+		return
+	}
+	if log == nil {
+		log = []*Delivery{}
+	}
+	writeJSON(w, http.StatusOK, deliveriesResponse{Deliveries: log})
+}
+
+func (h *Handler) storeError(w http.ResponseWriter, err error, msg string) {
+	switch {
+	case errors.Is(err, ErrNotFound):
+		http.Error(w, err.Error(), http.StatusNotFound)
+	case errors.Is(err, ErrInvalid):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	default:
+		h.logger.Error().Err(err).Msg(msg)
+		http.Error(w, "internal error", http.StatusInternalServerError)
+	}
+}
+
+func pathID(w http.ResponseWriter, r *http.Request) (uuid.UUID, bool) {
+	id, err := uuid.Parse(r.PathValue("id"))
+	if err != nil {
+		http.Error(w, "invalid endpoint id", http.StatusBadRequest)
+		return uuid.Nil, false
+	}
+	return id, true
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
@@ -0,0 +1,112 @@
+package webhook
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func do(h http.Handler, method, path, body string) *httptest.ResponseRecorder {
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(method, path, strings.NewReader(body)))
+	return rec
+}
+
+// TestHandler tests registering, listing, updating, rotating and deleting
+// endpoints
+func TestHandler(t *testing.T) {
+	r := newReceiver(t)
+	c, _ := newTestChannel(t, r)
+	h := NewHandler(c, zerolog.Nop())
+	accountID := uuid.New()
+
+	rec := do(h, http.MethodPost, "/webhooks", `{"account_id":"`+accountID.String()+`","url":"http://partner.example/hook"}`)
+	assert.Equal(t, http.StatusBadRequest, rec.Code, "plain http")
+
+	rec = do(h, http.MethodPost, "/webhooks", `{"account_id":"`+accountID.String()+`","url":"`+r.srv.URL+`","types":["deposit_received"]}`)
+	require.Equal(t, http.StatusCreated, rec.Code)
+	var created struct {
+		ID     uuid.UUID `json:"id"`
+		Secret string    `json:"secret"`
+		Status Status    `json:"status"`
+	}
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &created))
+	assert.True(t, strings.HasPrefix(created.Secret, secretPrefix))
+	assert.Equal(t, StatusActive, created.Status)
+	path := "/webhooks/" + created.ID.String()
+
+	rec = do(h, http.MethodGet, "/webhooks?account_id="+accountID.String(), "")
+	require.Equal(t, http.StatusOK, rec.Code)
+	assert.NotContains(t, rec.Body.String(), created.Secret, "secrets are not listed")
+	var list endpointsResponse
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &list))
+	require.Len(t, list.Endpoints, 1)
+	assert.Equal(t, []string{"deposit_received"}, list.Endpoints[0].Types)
+
+	rec = do(h, http.MethodPatch, path, `{"types":[]}`)
+	require.Equal(t, http.StatusOK, rec.Code)
+	rec = do(h, http.MethodPatch, path, `{"url":"ftp://partner.example"}`)
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+
+	rec = do(h, http.MethodPost, path+"/rotate", `{"grace":"1h"}`)
+	require.Equal(t, http.StatusOK, rec.Code)
+	var rotated struct {
+		Secret string `json:"secret"`
+	}
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &rotated))
+	assert.NotEqual(t, created.Secret, rotated.Secret)
+	rec = do(h, http.MethodPost, path+"/rotate", `{"grace":"soon"}`)
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+
+	// Deliveries after the rotation verify with both secrets
+	r.verifyWith(created.Secret, rotated.Secret)
+	require.NoError(t, c.Send(context.Background(), notification(accountID, "withdrawal_sent")))
+	require.Eventually(t, func() bool { return len(r.received()) == 1 }, time.Second, 5*time.Millisecond)
+
+	rec = do(h, http.MethodGet, path+"/deliveries?limit=10", "")
+	require.Equal(t, http.StatusOK, rec.Code)
+	var log deliveriesResponse
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &log))
+	require.Len(t, log.Deliveries, 1)
+	assert.Equal(t, DeliverySucceeded, log.Deliveries[0].Status)
+
+	rec = do(h, http.MethodDelete, path, "")
+	assert.Equal(t, http.StatusNoContent, rec.Code)
+	rec = do(h, http.MethodGet, path, "")
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+	rec = do(h, http.MethodGet, "/webhooks/nope", "")
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+}
+
+// TestHandler_Enable tests re-enabling a disabled endpoint
+func TestHandler_Enable(t *testing.T) {
+	ctx := context.Background()
+	r := newReceiver(t)
+	c, _ := newTestChannel(t, r)
+	h := NewHandler(c, zerolog.Nop())
+
+	ep, err := c.Register(ctx, uuid.New(), r.srv.URL, nil)
+	require.NoError(t, err)
+	c.failed(ep.ID, http.StatusGone, time.Now())
+
+	rec := do(h, http.MethodGet, "/webhooks/"+ep.ID.String(), "")
+	require.Equal(t, http.StatusOK, rec.Code)
+	assert.Contains(t, rec.Body.String(), `"status":"disabled"`)
+
+	rec = do(h, http.MethodPost, "/webhooks/"+ep.ID.String()+"/enable", "")
+	require.Equal(t, http.StatusOK, rec.Code)
+	var enabled Endpoint
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &enabled))
+	assert.Equal(t, StatusActive, enabled.Status)
+	assert.Empty(t, enabled.DisabledReason)
+	assert.Zero(t, enabled.ConsecutiveFailures)
+}
@@ -0,0 +1,22 @@
+package webhook
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var (
+	deliveries = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "notification",
+		Subsystem: "webhook",
+		Name:      "delivery_attempts_total",
+		Help:      "Webhook delivery attempts, by whether they succeeded, will be retried or failed for good.",
+	}, []string{"result"})
+
+	endpointsDisabled = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: "notification",
+		Subsystem: "webhook",
+		Name:      "endpoints_disabled_total",
+		Help:      "Webhook endpoints disabled after sustained delivery failures.",
+	})
+)
@@ -0,0 +1,125 @@
+package webhook
+
+import (
+	"context"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// defaultRotationGrace is how long a rotated-out secret keeps signing
+const defaultRotationGrace = 24 * time.Hour
+
+// EndpointUpdate changes an endpoint; nil fields are kept
+type EndpointUpdate struct {
+	URL   *string   `json:"url,omitempty"`
+	Types *[]string `json:"types,omitempty"`
+}
+
+// Register creates an endpoint for the account and returns it with its
+// signing secret
+func (c *Channel) Register(ctx context.Context, accountID uuid.UUID, rawURL string, types []string) (*Endpoint, error) {
+	ep, err := NewEndpoint(accountID, rawURL, types, c.now())
+	if err != nil {
+		return nil, err
+	}
+	if err := c.store.Create(ctx, ep); err != nil {
+		return nil, err
+	}
+	c.logger.Info().Str("endpoint_id", ep.ID.String()).Str("account_id", accountID.String()).Msg("webhook endpoint registered")
+	return ep, nil
+}
+
+// Modify applies update to an endpoint
+func (c *Channel) Modify(ctx context.Context, id uuid.UUID, update EndpointUpdate) (*Endpoint, error) {
+	if update.URL != nil {
+		if err := validateURL(*update.URL); err != nil {
+			return nil, err
+		}
+	}
+	return c.change(ctx, id, func(ep *Endpoint) error {
+		if update.URL != nil {
+			ep.URL = *update.URL
+		}
+		if update.Types != nil {
+			ep.Types = *update.Types
+		}
+		return nil
+	})
+}
+
+// Rotate issues a new signing secret. Until grace has passed deliveries
+// carry signatures from both the old and new secrets, so receivers can
+// switch without dropping any.
+func (c *Channel) Rotate(ctx context.Context, id uuid.UUID, grace time.Duration) (*Endpoint, Secret, error) {
+	if grace < 0 {
+		grace = 0
+	}
+	var secret Secret
+	ep, err := c.change(ctx, id, func(ep *Endpoint) error {
+		var err error
+		secret, err = ep.rotate(c.now(), grace)
+		return err
+	})
+	if err != nil {
+		return nil, Secret{}, err
+	}
+	c.logger.Info().Str("endpoint_id", id.String()).Dur("grace", grace).Msg("webhook secret rotated")
+	return ep, secret, nil
+}
+
+// Enable re-enables an endpoint and clears its failure streak
+func (c *Channel) Enable(ctx context.Context, id uuid.UUID) (*Endpoint, error) {
+	return c.change(ctx, id, func(ep *Endpoint) error {
+		ep.Status = StatusActive
+		ep.DisabledReason = ""
+		ep.ConsecutiveFailures = 0
+		ep.FailingSince = time.Time{}
+		return nil
+	})
+}
+
+// Endpoint returns an endpoint
+func (c *Channel) Endpoint(ctx context.Context, id uuid.UUID) (*Endpoint, error) {
+	return c.store.Get(ctx, id)
+}
+
+// Endpoints returns the account's endpoints
+func (c *Channel) Endpoints(ctx context.Context, accountID uuid.UUID) ([]*Endpoint, error) {
+	return c.store.ForAccount(ctx, accountID)
+}
+
+// Deregister removes an endpoint; deliveries in progress stop before their
+// next attempt
+func (c *Channel) Deregister(ctx context.Context, id uuid.UUID) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.store.Delete(ctx, id)
+}
+
+// Deliveries returns the endpoint's latest deliveries, newest first
+func (c *Channel) Deliveries(ctx context.Context, id uuid.UUID, limit int) ([]*Delivery, error) {
+	if _, err := c.store.Get(ctx, id); err != nil {
+		return nil, err
+	}
+	return c.store.Deliveries(ctx, id, limit)
+}
+
+// change applies fn to a stored endpoint under the bookkeeping lock, so it
+// does not race with delivery failures being recorded
+func (c *Channel) change(ctx context.Context, id uuid.UUID, fn func(ep *Endpoint) error) (*Endpoint, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	ep, err := c.store.Get(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if err := fn(ep); err != nil {
+		return nil, err
+	}
+	ep.UpdatedAt = c.now()
+	if err := c.store.Update(ctx, ep); err != nil {
+		return nil, err
+	}
+	return ep, nil
+}
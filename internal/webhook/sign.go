@@ -0,0 +1,76 @@
+package webhook
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Headers set on every delivery
+const (
+	// HeaderID is the notification ID; receivers use it to drop retries
+	// they already processed
+	HeaderID = "Webhook-Id"
+	// HeaderTimestamp is the Unix time the attempt was signed at
+	HeaderTimestamp = "Webhook-Timestamp"
+	// HeaderSignature holds one "v1=<hex>" signature per active secret,
+	// separated by spaces
+	HeaderSignature = "Webhook-Signature"
+)
+
+// signatureVersion prefixes signatures so the scheme can change later
+const signatureVersion = "v1="
+
+// DefaultTolerance is how old a delivery's timestamp may be before
+// receivers should reject it as a replay
+const DefaultTolerance = 5 * time.Minute
+
+var (
+	// ErrSignature is returned by Verify for a missing or wrong signature
+	ErrSignature = errors.New("webhook signature mismatch")
+	// ErrTimestamp is returned by Verify for a missing or stale timestamp
+	ErrTimestamp = errors.New("webhook timestamp outside tolerance")
+)
+
+// Sign returns the HMAC-SHA256 signature of body sent at timestamp: the
+// hex digest of "<timestamp>.<body>" keyed with secret
+func Sign(secret string, timestamp int64, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(strconv.FormatInt(timestamp, 10)))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// signatureHeader signs body with every secret
+func signatureHeader(secrets []string, timestamp int64, body []byte) string {
+	sigs := make([]string, len(secrets))
+	for i, secret := range secrets {
+		sigs[i] = signatureVersion + Sign(secret, timestamp, body)
+	}
+	return strings.Join(sigs, " ")
+}
+
+// Verify checks a delivery as a receiver would: the timestamp must be
+// within tolerance of now and one of the signatures must match secret.
+func Verify(secret, timestampHeader, signatureHeader string, body []byte, tolerance time.Duration, now time.Time) error {
+	ts, err := strconv.ParseInt(timestampHeader, 10, 64)
+	if err != nil {
+		return ErrTimestamp
+	}
+	if age := now.Sub(time.Unix(ts, 0)); age > tolerance || age < -tolerance {
+		return ErrTimestamp
+	}
+	want := Sign(secret, ts, body)
+	for _, sig := range strings.Fields(signatureHeader) {
+		got, ok := strings.CutPrefix(sig, signatureVersion)
+		if ok && hmac.Equal([]byte(got), []byte(want)) {
+			return nil
+		}
+	}
+	return ErrSignature
+}
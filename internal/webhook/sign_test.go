@@ -0,0 +1,50 @@
+package webhook
+
+import (
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// TestVerify tests signature and timestamp checks, including headers that
+// carry signatures from several secrets
+func TestVerify(t *testing.T) {
+	now := time.Unix(1_700_000_000, 0)
+	ts := now.Unix()
+	body := []byte(`{"id":"n1"}`)
+	header := signatureHeader([]string{"whsec_old", "whsec_new"}, ts, body)
+	tsHeader := strconv.FormatInt(ts, 10)
+
+	assert.NoError(t, Verify("whsec_old", tsHeader, header, body, DefaultTolerance, now))
+	assert.NoError(t, Verify("whsec_new", tsHeader, header, body, DefaultTolerance, now.Add(time.Minute)))
+
+	assert.ErrorIs(t, Verify("whsec_other", tsHeader, header, body, DefaultTolerance, now), ErrSignature)
+	assert.ErrorIs(t, Verify("whsec_new", tsHeader, header, []byte(`{"id":"n2"}`), DefaultTolerance, now), ErrSignature)
+	assert.ErrorIs(t, Verify("whsec_new", tsHeader, Sign("whsec_new", ts, body), body, DefaultTolerance, now), ErrSignature, "unversioned")
+
+	assert.ErrorIs(t, Verify("whsec_new", tsHeader, header, body, DefaultTolerance, now.Add(6*time.Minute)), ErrTimestamp)
+	assert.ErrorIs(t, Verify("whsec_new", tsHeader, header, body, DefaultTolerance, now.Add(-6*time.Minute)), ErrTimestamp)
+	assert.ErrorIs(t, Verify("whsec_new", "", header, body, DefaultTolerance, now), ErrTimestamp)
+}
+
+// TestEndpoint_Rotate tests that rotated-out secrets keep signing until the
+// grace period ends
+func TestEndpoint_Rotate(t *testing.T) {
+	now := time.Now()
+	ep := &Endpoint{Secrets: []Secret{{Value: "whsec_a", CreatedAt: now}}}
+
+	b, err := ep.rotate(now, time.Hour)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"whsec_a", b.Value}, ep.activeSecrets(now))
+
+	c, err := ep.rotate(now.Add(30*time.Minute), 0)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{c.Value}, ep.activeSecrets(now.Add(30*time.Minute)))
+
+	d, err := ep.rotate(now.Add(2*time.Hour), time.Hour)
+	assert.NoError(t, err)
+	assert.Len(t, ep.Secrets, 2, "expired secrets are dropped")
+	assert.Equal(t, []string{c.Value, d.Value}, ep.activeSecrets(now.Add(2*time.Hour)))
+}
@@ -0,0 +1,211 @@
+package webhook
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// SQLStore is a durable Store in the webhook_endpoints and
+// webhook_deliveries tables. Secrets are kept in their own JSON column so
+// they never travel with the rest of the endpoint document. Its statements
+// use SQLite syntax; open the *sql.DB with sqlite.Open. Times are kept as
+// Unix milliseconds.
+type SQLStore struct {
+	db *sql.DB
+}
+
+// NewSQLStore creates a store over db; call Migrate to create its tables
+func NewSQLStore(db *sql.DB) *SQLStore {
+	return &SQLStore{db: db}
+}
+
+// Migrate creates the webhook tables if they do not exist
+func (s *SQLStore) Migrate(ctx context.Context) error {
+	for _, stmt := range []string{
+		`CREATE TABLE IF NOT EXISTS webhook_endpoints (
+			id         TEXT PRIMARY KEY,
+			account_id TEXT NOT NULL,
+			created_at INTEGER NOT NULL,
+			endpoint   BLOB NOT NULL,
+			secrets    BLOB NOT NULL
+		)`,
+		`CREATE INDEX IF NOT EXISTS webhook_endpoints_account ON webhook_endpoints (account_id, created_at)`,
+		`CREATE TABLE IF NOT EXISTS webhook_deliveries (
+			id          TEXT PRIMARY KEY,
+			endpoint_id TEXT NOT NULL,
+			at          INTEGER NOT NULL,
+			delivery    BLOB NOT NULL
+		)`,
+		`CREATE INDEX IF NOT EXISTS webhook_deliveries_endpoint ON webhook_deliveries (endpoint_id, at)`,
+	} {
+		if _, err := s.db.ExecContext(ctx, stmt); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Create implements Store
+func (s *SQLStore) Create(ctx context.Context, e *Endpoint) error {
+	doc, secrets, err := encodeEndpoint(e)
+	if err != nil {
+		return err
+	}
+	_, err = s.db.ExecContext(ctx,
+		`INSERT INTO webhook_endpoints (id, account_id, created_at, endpoint, secrets) VALUES (?, ?, ?, ?, ?)`,
+		e.ID.String(), e.AccountID.String(), e.CreatedAt.UnixMilli(), doc, secrets)
+	return err
+}
+
+// Get implements Store
+func (s *SQLStore) Get(ctx context.Context, id uuid.UUID) (*Endpoint, error) {
+	var doc, secrets []byte
+	err := s.db.QueryRowContext(ctx, `SELECT endpoint, secrets FROM webhook_endpoints WHERE id = ?`, id.String()).Scan(&doc, &secrets)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return decodeEndpoint(doc, secrets)
+}
+
+// Update implements Store
+func (s *SQLStore) Update(ctx context.Context, e *Endpoint) error {
+	doc, secrets, err := encodeEndpoint(e)
+	if err != nil {
+		return err
+	}
+	res, err := s.db.ExecContext(ctx,
+		`UPDATE webhook_endpoints SET endpoint = ?, secrets = ? WHERE id = ?`, doc, secrets, e.ID.String())
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// Delete implements Store
+func (s *SQLStore) Delete(ctx context.Context, id uuid.UUID) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	res, err := tx.ExecContext(ctx, `DELETE FROM webhook_endpoints WHERE id = ?`, id.String())
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		return ErrNotFound
+	}
+	if _, err := tx.ExecContext(ctx, `DELETE FROM webhook_deliveries WHERE endpoint_id = ?`, id.String()); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// ForAccount implements Store
+func (s *SQLStore) ForAccount(ctx context.Context, accountID uuid.UUID) ([]*Endpoint, error) {
+	rows, err := s.db.QueryContext(ctx,
+		`SELECT endpoint, secrets FROM webhook_endpoints WHERE account_id = ? ORDER BY created_at`, accountID.String())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []*Endpoint
+	for rows.Next() {
+		var doc, secrets []byte
+		if err := rows.Scan(&doc, &secrets); err != nil {
+			return nil, err
+		}
+		e, err := decodeEndpoint(doc, secrets)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, e)
+	}
+	return out, rows.Err()
+}
+
+// LogDelivery implements Store. The log is not trimmed here; run
+// PruneDeliveries periodically.
+func (s *SQLStore) LogDelivery(ctx context.Context, d *Delivery) error {
+	doc, err := json.Marshal(d)
+	if err != nil {
+		return err
+	}
+	_, err = s.db.ExecContext(ctx,
+		`INSERT INTO webhook_deliveries (id, endpoint_id, at, delivery) VALUES (?, ?, ?, ?)`,
+		d.ID.String(), d.EndpointID.String(), d.At.UnixMilli(), doc)
+	return err
+}
+
+// Deliveries implements Store
+func (s *SQLStore) Deliveries(ctx context.Context, endpointID uuid.UUID, limit int) ([]*Delivery, error) {
+	query := `SELECT delivery FROM webhook_deliveries WHERE endpoint_id = ? ORDER BY at DESC, id DESC`
+	args := []interface{}{endpointID.String()}
+	if limit > 0 {
+		query += ` LIMIT ?`
+		args = append(args, limit)
+	}
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []*Delivery
+	for rows.Next() {
+		var doc []byte
+		if err := rows.Scan(&doc); err != nil {
+			return nil, err
+		}
+		var d Delivery
+		if err := json.Unmarshal(doc, &d); err != nil {
+			return nil, err
+		}
+		out = append(out, &d)
+	}
+	return out, rows.Err()
+}
+
+// PruneDeliveries deletes delivery log entries older than before and
+// returns how many were removed
+func (s *SQLStore) PruneDeliveries(ctx context.Context, before time.Time) (int, error) {
+	res, err := s.db.ExecContext(ctx, `DELETE FROM webhook_deliveries WHERE at < ?`, before.UnixMilli())
+	if err != nil {
+		return 0, err
+	}
+	n, err := res.RowsAffected()
+	return int(n), err
+}
+
+func encodeEndpoint(e *Endpoint) (doc, secrets []byte, err error) {
+	if doc, err = json.Marshal(e); err != nil {
+		return nil, nil, err
+	}
+	if secrets, err = json.Marshal(e.Secrets); err != nil {
+		return nil, nil, err
+	}
+	return doc, secrets, nil
+}
+
+func decodeEndpoint(doc, secrets []byte) (*Endpoint, error) {
+	var e Endpoint
+	if err := json.Unmarshal(doc, &e); err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(secrets, &e.Secrets); err != nil {
+		return nil, err
+	}
+	return &e, nil
+}
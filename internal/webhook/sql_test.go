@@ -0,0 +1,99 @@
+package webhook
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/cypherlabdev/notification-service/internal/sqlite"
+)
+
+func newTestSQLStore(t *testing.T) *SQLStore {
+	db, err := sqlite.Open(context.Background(), filepath.Join(t.TempDir(), "webhook.db"))
+	require.NoError(t, err)
+	t.Cleanup(func() { db.Close() })
+	store := NewSQLStore(db)
+	require.NoError(t, store.Migrate(context.Background()))
+	return store
+}
+
+// TestStore tests endpoints and their delivery log against each store
+func TestStore(t *testing.T) {
+	ctx := context.Background()
+	now := time.Date(2026, 6, 1, 12, 0, 0, 0, time.UTC)
+	for name, store := range map[string]Store{"memory": NewMemoryStore(), "sql": newTestSQLStore(t)} {
+		t.Run(name, func(t *testing.T) {
+			accountID := uuid.New()
+			first, err := NewEndpoint(accountID, "https://partner.example/hooks", []string{"deposit_received"}, now)
+			require.NoError(t, err)
+			second, err := NewEndpoint(accountID, "https://partner.example/other", nil, now.Add(time.Minute))
+			require.NoError(t, err)
+			require.NoError(t, store.Create(ctx, second))
+			require.NoError(t, store.Create(ctx, first))
+
+			got, err := store.Get(ctx, first.ID)
+			require.NoError(t, err)
+			assert.Equal(t, first.Secrets, got.Secrets)
+			assert.Equal(t, []string{"deposit_received"}, got.Types)
+
+			endpoints, err := store.ForAccount(ctx, accountID)
+			require.NoError(t, err)
+			require.Len(t, endpoints, 2)
+			assert.Equal(t, first.ID, endpoints[0].ID, "oldest first")
+			none, err := store.ForAccount(ctx, uuid.New())
+			require.NoError(t, err)
+			assert.Empty(t, none)
+
+			got.Status, got.ConsecutiveFailures = StatusDisabled, 3
+			_, err = got.rotate(now, time.Hour)
+			require.NoError(t, err)
+			require.NoError(t, store.Update(ctx, got))
+			got, err = store.Get(ctx, first.ID)
+			require.NoError(t, err)
+			assert.Equal(t, StatusDisabled, got.Status)
+			assert.Equal(t, 3, got.ConsecutiveFailures)
+			assert.Len(t, got.Secrets, 2)
+			assert.ErrorIs(t, store.Update(ctx, &Endpoint{ID: uuid.New()}), ErrNotFound)
+
+			for i := 1; i <= 3; i++ {
+				require.NoError(t, store.LogDelivery(ctx, &Delivery{ID: uuid.New(), EndpointID: first.ID, Attempt: i, At: now.Add(time.Duration(i) * time.Second)}))
+			}
+			log, err := store.Deliveries(ctx, first.ID, 2)
+			require.NoError(t, err)
+			require.Len(t, log, 2)
+			assert.Equal(t, []int{3, 2}, []int{log[0].Attempt, log[1].Attempt}, "newest first")
+
+			require.NoError(t, store.Delete(ctx, first.ID))
+			assert.ErrorIs(t, store.Delete(ctx, first.ID), ErrNotFound)
+			_, err = store.Get(ctx, first.ID)
+			assert.ErrorIs(t, err, ErrNotFound)
+			log, err = store.Deliveries(ctx, first.ID, 0)
+			require.NoError(t, err)
+			assert.Empty(t, log, "the log goes with the endpoint")
+		})
+	}
+}
+
+// TestSQLStore_PruneDeliveries tests trimming the delivery log by age
+func TestSQLStore_PruneDeliveries(t *testing.T) {
+	ctx := context.Background()
+	store := newTestSQLStore(t)
+	endpointID := uuid.New()
+	now := time.Date(2026, 6, 1, 12, 0, 0, 0, time.UTC)
+	for _, age := range []time.Duration{48 * time.Hour, 25 * time.Hour, time.Hour} {
+		require.NoError(t, store.LogDelivery(ctx, &Delivery{ID: uuid.New(), EndpointID: endpointID, At: now.Add(-age)}))
+	}
+
+	n, err := store.PruneDeliveries(ctx, now.Add(-24*time.Hour))
+	require.NoError(t, err)
+	assert.Equal(t, 2, n)
+	log, err := store.Deliveries(ctx, endpointID, 0)
+	require.NoError(t, err)
+	require.Len(t, log, 1)
+	assert.Equal(t, now.Add(-time.Hour), log[0].At.UTC())
+}
@@ -0,0 +1,399 @@
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/rs/zerolog"
+
+	"github.com/cypherlabdev/notification-service/internal/notify"
+)
+
+// ChannelName is the name of the webhook channel
+const ChannelName = "webhook"
+
+const (
+	defaultAttempts    = 6
+	defaultBackoff     = time.Second
+	maxBackoff         = 5 * time.Minute
+	defaultTimeout     = 10 * time.Second
+	defaultConcurrency = 64
+	// An endpoint is disabled once it has failed defaultDisableFailures
+	// deliveries in a row over at least defaultDisableAfter
+	defaultDisableFailures = 10
+	defaultDisableAfter    = 24 * time.Hour
+)
+
+// ErrClosed is returned by Send once the channel is closed
+var ErrClosed = errors.New("webhook channel closed")
+
+// errDisabled fails deliveries to an endpoint disabled while they were pending
+var errDisabled = errors.New("webhook endpoint disabled")
+
+// event is the JSON body POSTed to endpoints
+type event struct {
+	ID        string      `json:"id"`
+	Type      string      `json:"type"`
+	AccountID uuid.UUID   `json:"account_id"`
+	CreatedAt time.Time   `json:"created_at"`
+	Payload   interface{} `json:"payload"`
+}
+
+// Option configures a Channel
+type Option func(*Channel)
+
+// WithHTTPClient sets the client deliveries are POSTed with
+func WithHTTPClient(client *http.Client) Option {
+	return func(c *Channel) {
+		c.client = client
+	}
+}
+
+// WithRetry sets how many times a delivery is attempted and the backoff
+// before the first retry, which doubles with each retry after it
+func WithRetry(attempts int, backoff time.Duration) Option {
+	return func(c *Channel) {
+		c.attempts = max(attempts, 1)
+		c.backoff = backoff
+	}
+}
+
+// WithDisableAfter disables an endpoint once failures deliveries in a row
+// have failed over at least period
+func WithDisableAfter(failures int, period time.Duration) Option {
+	return func(c *Channel) {
+		c.disableFailures = max(failures, 1)
+		c.disableAfter = period
+	}
+}
+
+// WithDeadLetters hands deliveries that failed every attempt to sink
+func WithDeadLetters(sink notify.DeadLetterSink) Option {
+	return func(c *Channel) {
+		c.deadLetters = sink
+	}
+}
+
+// WithTracker records the outcome of each delivery with t
+func WithTracker(t notify.Tracker) Option {
+	return func(c *Channel) {
+		c.tracker = t
+	}
+}
+
+// Channel delivers notifications to the endpoints registered for the
+// recipient's account. Deliveries run in the background, so Send only
+// fails if they cannot be started; deliveries that exhaust their retries
+// go to the dead-letter sink.
+type Channel struct {
+	store           Store
+	client          *http.Client
+	attempts        int
+	backoff         time.Duration
+	disableFailures int
+	disableAfter    time.Duration
+	deadLetters     notify.DeadLetterSink
+	tracker         notify.Tracker
+	slots           chan struct{} // bounds concurrent POSTs; backoff holds none
+	logger          zerolog.Logger
+	now             func() time.Time
+	ctx             context.Context
+	cancel          context.CancelFunc
+	wg              sync.WaitGroup
+	mu              sync.Mutex // serialises endpoint failure bookkeeping
+}
+
+// NewChannel creates a webhook channel over store
+func NewChannel(store Store, logger zerolog.Logger, opts ...Option) *Channel {
+	ctx, cancel := context.WithCancel(context.Background())
+	c := &Channel{
+		store:           store,
+		client:          &http.Client{Timeout: defaultTimeout},
+		attempts:        defaultAttempts,
+		backoff:         defaultBackoff,
+		disableFailures: defaultDisableFailures,
+		disableAfter:    defaultDisableAfter,
+		slots:           make(chan struct{}, defaultConcurrency),
+		logger:          logger.With().Str("component", "webhook").Logger(),
+		now:             time.Now,
+		ctx:             ctx,
+		cancel:          cancel,
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c
+}
+
+// Name implements notify.Channel
+func (c *Channel) Name() string { return ChannelName }
+
+// Queues implements notify.Queuer; deliveries complete in the background
+func (c *Channel) Queues() bool { return true }
+
+// Wants implements notify.Selective, reporting whether the account has an
+// active endpoint taking the notification's type. It reports true if the
+// endpoints cannot be loaded, so Send surfaces the error.
+func (c *Channel) Wants(ctx context.Context, n *notify.Notification) bool {
+	endpoints, err := c.store.ForAccount(ctx, n.UserID)
+	if err != nil {
+		return true
+	}
+	for _, ep := range endpoints {
+		if ep.wants(n.Type) {
+			return true
+		}
+	}
+	return false
+}
+
+// Send implements notify.Channel. It starts a delivery to each active
+// endpoint of the account that takes the notification's type; accounts
+// without endpoints are not an error.
+func (c *Channel) Send(ctx context.Context, n *notify.Notification) error {
+	if c.ctx.Err() != nil {
+		return ErrClosed
+	}
+	endpoints, err := c.store.ForAccount(ctx, n.UserID)
+	if err != nil {
+		return err
+	}
+	var body []byte
+	for _, ep := range endpoints {
+		if !ep.wants(n.Type) {
+			continue
+		}
+		if body == nil {
+			if body, err = json.Marshal(event{ID: n.ID, Type: n.Type, AccountID: n.UserID, CreatedAt: n.CreatedAt, Payload: n.Payload}); err != nil {
+				return err
+			}
+		}
+		select {
+		case c.slots <- struct{}{}:
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-c.ctx.Done():
+			return ErrClosed
+		}
+		c.wg.Add(1)
+		go func(endpointID uuid.UUID) {
+			defer c.wg.Done()
+			c.deliver(endpointID, n, body)
+		}(ep.ID)
+	}
+	return nil
+}
+
+// Close stops retrying and waits for in-flight deliveries. Deliveries
+// that were waiting to retry are dead-lettered.
+func (c *Channel) Close() {
+	c.cancel()
+	c.wg.Wait()
+}
+
+// deliver POSTs body to the endpoint until it succeeds, fails permanently
+// or runs out of attempts. It is called holding a slot and gives it up
+// after each POST, so retries backing off against a failing endpoint do
+// not stall Send.
+func (c *Channel) deliver(endpointID uuid.UUID, n *notify.Notification, body []byte) {
+	var attempts []notify.Attempt
+	for attempt := 1; ; attempt++ {
+		// Reloaded every attempt to pick up rotated secrets and disabling.
+		// A store error is retried like a failed POST; an endpoint disabled
+		// or removed meanwhile fails the delivery.
+		var status int
+		start := c.now()
+		ep, err := c.store.Get(context.Background(), endpointID)
+		posted, gone := false, false
+		switch {
+		case errors.Is(err, ErrNotFound):
+			gone = true
+		case err != nil:
+		case ep.Status != StatusActive:
+			err, gone = errDisabled, true
+		default:
+			status, err = c.post(ep, n.ID, body)
+			posted = true
+		}
+		<-c.slots
+		now := c.now()
+		d := &Delivery{
+			ID:             uuid.New(),
+			EndpointID:     endpointID,
+			NotificationID: n.ID,
+			Type:           n.Type,
+			Attempt:        attempt,
+			StatusCode:     status,
+			DurationMillis: now.Sub(start).Milliseconds(),
+			At:             now,
+		}
+		if err == nil {
+			d.Status = DeliverySucceeded
+			c.log(d)
+			c.succeeded(endpointID)
+			deliveries.WithLabelValues("ok").Inc()
+			c.track(n, notify.StateDelivered, "")
+			return
+		}
+
+		d.Error = err.Error()
+		attempts = append(attempts, notify.Attempt{At: now, Error: d.Error})
+		wait := c.retryAfter(attempt)
+		giveUp := gone || attempt >= c.attempts || !retryable(status) ||
+			(!n.ExpiresAt.IsZero() && !now.Add(wait).Before(n.ExpiresAt))
+		if !giveUp {
+			d.Status = DeliveryRetrying
+			c.log(d)
+			deliveries.WithLabelValues("retry").Inc()
+			if c.retake(wait) {
+				continue
+			}
+			d.Error = "shutting down: " + d.Error
+		}
+
+		d.Status = DeliveryFailed
+		if !errors.Is(err, ErrNotFound) {
+			c.log(d)
+		}
+		// Only a failed POST counts against the endpoint, and not one cut
+		// short by Close
+		if posted && c.ctx.Err() == nil {
+			c.failed(endpointID, status, now)
+		}
+		deliveries.WithLabelValues("failed").Inc()
+		c.track(n, notify.StateFailed, d.Error)
+		if c.deadLetters != nil {
+			c.deadLetters.DeadLetter(context.Background(), n, ChannelName, &notify.RetryError{Attempts: attempts, Err: err})
+		}
+		return
+	}
+}
+
+// retake waits out a retry's backoff and takes a slot for it, reporting
+// false if the channel is closed first
+func (c *Channel) retake(wait time.Duration) bool {
+	select {
+	case <-time.After(wait):
+	case <-c.ctx.Done():
+		return false
+	}
+	select {
+	case c.slots <- struct{}{}:
+		return true
+	case <-c.ctx.Done():
+		return false
+	}
+}
+
+// track records a delivery outcome, if a tracker is configured
+func (c *Channel) track(n *notify.Notification, state notify.State, reason string) {
+	if c.tracker != nil {
+		c.tracker.Track(n, ChannelName, state, reason)
+	}
+}
+
+// post sends one signed attempt, returning the response status if there
+// was one and an error unless it was 2xx
+func (c *Channel) post(ep *Endpoint, id string, body []byte) (int, error) {
+	req, err := http.NewRequestWithContext(c.ctx, http.MethodPost, ep.URL, bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+	ts := c.now().Unix()
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "cypherlab-notification-service/webhook")
+	req.Header.Set(HeaderID, id)
+	req.Header.Set(HeaderTimestamp, strconv.FormatInt(ts, 10))
+	req.Header.Set(HeaderSignature, signatureHeader(ep.activeSecrets(c.now()), ts, body))
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	// Drain a little so the connection can be reused
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 4<<10))
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return resp.StatusCode, fmt.Errorf("endpoint returned %d", resp.StatusCode)
+	}
+	return resp.StatusCode, nil
+}
+
+// retryable reports whether a failure with the response status, 0 if there
+// was no response, is worth retrying
+func retryable(status int) bool {
+	return status == 0 || status == http.StatusRequestTimeout || status == http.StatusTooManyRequests || status >= 500
+}
+
+// retryAfter returns the backoff after the given attempt
+func (c *Channel) retryAfter(attempt int) time.Duration {
+	wait := c.backoff << (attempt - 1)
+	if wait <= 0 || wait > maxBackoff {
+		return maxBackoff
+	}
+	return wait
+}
+
+func (c *Channel) log(d *Delivery) {
+	if err := c.store.LogDelivery(context.Background(), d); err != nil {
+		c.logger.Warn().Err(err).Str("endpoint_id", d.EndpointID.String()).Msg("failed to log webhook delivery")
+	}
+}
+
+// succeeded resets the endpoint's failure streak
+func (c *Channel) succeeded(id uuid.UUID) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	ep, err := c.store.Get(context.Background(), id)
+	if err != nil || ep.ConsecutiveFailures == 0 {
+		return
+	}
+	ep.ConsecutiveFailures = 0
+	ep.FailingSince = time.Time{}
+	ep.UpdatedAt = c.now()
+	c.update(ep)
+}
+
+// failed extends the endpoint's failure streak, disabling it once the
+// failures are sustained or the receiver reports it gone
+func (c *Channel) failed(id uuid.UUID, status int, now time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	ep, err := c.store.Get(context.Background(), id)
+	if err != nil || ep.Status != StatusActive {
+		return
+	}
+	if ep.ConsecutiveFailures == 0 {
+		ep.FailingSince = now
+	}
+	ep.ConsecutiveFailures++
+	ep.UpdatedAt = now
+	switch {
+	case status == http.StatusGone:
+		ep.Status = StatusDisabled
+		ep.DisabledReason = "endpoint returned 410 Gone"
+	case ep.ConsecutiveFailures >= c.disableFailures && now.Sub(ep.FailingSince) >= c.disableAfter:
+		ep.Status = StatusDisabled
+		ep.DisabledReason = fmt.Sprintf("%d consecutive failed deliveries since %s", ep.ConsecutiveFailures, ep.FailingSince.Format(time.RFC3339))
+	}
+	if ep.Status == StatusDisabled {
+		endpointsDisabled.Inc()
+		c.logger.Warn().Str("endpoint_id", ep.ID.String()).Str("account_id", ep.AccountID.String()).Str("reason", ep.DisabledReason).Msg("webhook endpoint disabled")
+	}
+	c.update(ep)
+}
+
+func (c *Channel) update(ep *Endpoint) {
+	if err := c.store.Update(context.Background(), ep); err != nil && !errors.Is(err, ErrNotFound) {
+		c.logger.Warn().Err(err).Str("endpoint_id", ep.ID.String()).Msg("failed to update webhook endpoint")
+	}
+}
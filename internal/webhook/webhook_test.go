@@ -0,0 +1,425 @@
+package webhook
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/cypherlabdev/notification-service/internal/notify"
+)
+
+// receiver is a partner endpoint that verifies deliveries with its secrets
+// and answers with the next queued status, or 200
+type receiver struct {
+	srv      *httptest.Server
+	secrets  []string
+	statuses []int
+	got      []event
+	rejected int
+	mu       sync.Mutex
+}
+
+func newReceiver(t *testing.T) *receiver {
+	r := &receiver{}
+	r.srv = httptest.NewTLSServer(http.HandlerFunc(r.serve))
+	t.Cleanup(r.srv.Close)
+	return r
+}
+
+func (r *receiver) serve(w http.ResponseWriter, req *http.Request) {
+	body, _ := io.ReadAll(req.Body)
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, secret := range r.secrets {
+		if err := Verify(secret, req.Header.Get(HeaderTimestamp), req.Header.Get(HeaderSignature), body, DefaultTolerance, time.Now()); err != nil {
+			r.rejected++
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+	}
+	if len(r.statuses) > 0 {
+		status := r.statuses[0]
+		r.statuses = r.statuses[1:]
+		if status != http.StatusOK {
+			w.WriteHeader(status)
+			return
+		}
+	}
+	var e event
+	json.Unmarshal(body, &e)
+	r.got = append(r.got, e)
+}
+
+func (r *receiver) respond(statuses ...int) {
+	r.mu.Lock()
+	r.statuses = append(r.statuses, statuses...)
+	r.mu.Unlock()
+}
+
+func (r *receiver) verifyWith(secrets ...string) {
+	r.mu.Lock()
+	r.secrets = secrets
+	r.mu.Unlock()
+}
+
+func (r *receiver) received() []event {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]event(nil), r.got...)
+}
+
+// deadLetters records what the channel gave up on
+type deadLetters struct {
+	errs []error
+	mu   sync.Mutex
+}
+
+func (d *deadLetters) DeadLetter(_ context.Context, _ *notify.Notification, channel string, err error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if channel == ChannelName {
+		d.errs = append(d.errs, err)
+	}
+}
+
+func (d *deadLetters) all() []error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return append([]error(nil), d.errs...)
+}
+
+// newTestChannel creates a channel that trusts the receiver's certificate
+// and retries quickly
+func newTestChannel(t *testing.T, r *receiver, opts ...Option) (*Channel, *deadLetters) {
+	dl := &deadLetters{}
+	opts = append([]Option{WithHTTPClient(r.srv.Client()), WithRetry(3, time.Millisecond), WithDeadLetters(dl)}, opts...)
+	c := NewChannel(NewMemoryStore(), zerolog.Nop(), opts...)
+	t.Cleanup(c.Close)
+	return c, dl
+}
+
+func notification(accountID uuid.UUID, typ string) *notify.Notification {
+	return &notify.Notification{ID: uuid.NewString(), UserID: accountID, Type: typ, Payload: map[string]int{"amount": 5}, CreatedAt: time.Now()}
+}
+
+// TestChannel_Deliver tests that deliveries are signed, filtered by type and
+// logged
+func TestChannel_Deliver(t *testing.T) {
+	ctx := context.Background()
+	r := newReceiver(t)
+	c, _ := newTestChannel(t, r)
+
+	accountID := uuid.New()
+	ep, err := c.Register(ctx, accountID, r.srv.URL, []string{"deposit_received"})
+	require.NoError(t, err)
+	r.verifyWith(ep.Secrets[0].Value)
+
+	require.NoError(t, c.Send(ctx, notification(accountID, "withdrawal_sent")))
+	n := notification(accountID, "deposit_received")
+	require.NoError(t, c.Send(ctx, n))
+	require.NoError(t, c.Send(ctx, notification(uuid.New(), "deposit_received")), "accounts without endpoints are skipped")
+
+	require.Eventually(t, func() bool { return len(r.received()) == 1 }, time.Second, 5*time.Millisecond)
+	got := r.received()[0]
+	assert.Equal(t, n.ID, got.ID)
+	assert.Equal(t, accountID, got.AccountID)
+	assert.Equal(t, map[string]interface{}{"amount": float64(5)}, got.Payload)
+
+	log, err := c.Deliveries(ctx, ep.ID, 0)
+	require.NoError(t, err)
+	require.Len(t, log, 1)
+	assert.Equal(t, DeliverySucceeded, log[0].Status)
+	assert.Equal(t, http.StatusOK, log[0].StatusCode)
+	assert.Equal(t, 1, log[0].Attempt)
+}
+
+// TestChannel_Retry tests that failures are retried and an exhausted
+// delivery is dead-lettered with every attempt
+func TestChannel_Retry(t *testing.T) {
+	ctx := context.Background()
+	r := newReceiver(t)
+	c, dl := newTestChannel(t, r)
+
+	accountID := uuid.New()
+	ep, err := c.Register(ctx, accountID, r.srv.URL, nil)
+	require.NoError(t, err)
+
+	r.respond(http.StatusServiceUnavailable, http.StatusTooManyRequests)
+	require.NoError(t, c.Send(ctx, notification(accountID, "deposit_received")))
+	// The success is logged after the receiver sees it, so wait on the log
+	var log []*Delivery
+	require.Eventually(t, func() bool {
+		log, err = c.Deliveries(ctx, ep.ID, 0)
+		return err == nil && len(log) == 3
+	}, time.Second, 5*time.Millisecond)
+	assert.Equal(t, []DeliveryStatus{DeliverySucceeded, DeliveryRetrying, DeliveryRetrying}, []DeliveryStatus{log[0].Status, log[1].Status, log[2].Status})
+	assert.Equal(t, 3, log[0].Attempt)
+	assert.Equal(t, http.StatusTooManyRequests, log[1].StatusCode)
+
+	r.respond(http.StatusBadGateway, http.StatusBadGateway, http.StatusBadGateway)
+	require.NoError(t, c.Send(ctx, notification(accountID, "deposit_received")))
+	require.Eventually(t, func() bool { return len(dl.all()) == 1 }, time.Second, 5*time.Millisecond)
+	var retryErr *notify.RetryError
+	require.True(t, errors.As(dl.all()[0], &retryErr))
+	assert.Len(t, retryErr.Attempts, 3)
+
+	ep, err = c.Endpoint(ctx, ep.ID)
+	require.NoError(t, err)
+	assert.Equal(t, 1, ep.ConsecutiveFailures)
+	assert.Equal(t, StatusActive, ep.Status)
+
+	// Client errors are not retried
+	r.respond(http.StatusBadRequest)
+	require.NoError(t, c.Send(ctx, notification(accountID, "deposit_received")))
+	require.Eventually(t, func() bool { return len(dl.all()) == 2 }, time.Second, 5*time.Millisecond)
+	require.True(t, errors.As(dl.all()[1], &retryErr))
+	assert.Len(t, retryErr.Attempts, 1)
+}
+
+// TestChannel_Expiry tests that a delivery is not retried past the
+// notification's expiry
+func TestChannel_Expiry(t *testing.T) {
+	ctx := context.Background()
+	r := newReceiver(t)
+	c, dl := newTestChannel(t, r, WithRetry(5, time.Hour))
+
+	accountID := uuid.New()
+	_, err := c.Register(ctx, accountID, r.srv.URL, nil)
+	require.NoError(t, err)
+
+	r.respond(http.StatusServiceUnavailable)
+	n := notification(accountID, "price_alert")
+	n.ExpiresAt = time.Now().Add(time.Minute)
+	require.NoError(t, c.Send(ctx, n))
+	require.Eventually(t, func() bool { return len(dl.all()) == 1 }, time.Second, 5*time.Millisecond)
+	assert.Empty(t, r.received())
+}
+
+// TestChannel_Rotate tests that deliveries verify with both the old and new
+// secret during the grace period, and only the new one after it
+func TestChannel_Rotate(t *testing.T) {
+	ctx := context.Background()
+	r := newReceiver(t)
+	c, _ := newTestChannel(t, r)
+
+	accountID := uuid.New()
+	ep, err := c.Register(ctx, accountID, r.srv.URL, nil)
+	require.NoError(t, err)
+	old := ep.Secrets[0].Value
+
+	_, secret, err := c.Rotate(ctx, ep.ID, time.Hour)
+	require.NoError(t, err)
+	assert.NotEqual(t, old, secret.Value)
+
+	// A receiver still on the old secret and one already on the new one
+	// both accept the delivery
+	r.verifyWith(old, secret.Value)
+	require.NoError(t, c.Send(ctx, notification(accountID, "deposit_received")))
+	require.Eventually(t, func() bool { return len(r.received()) == 1 }, time.Second, 5*time.Millisecond)
+
+	_, secret, err = c.Rotate(ctx, ep.ID, 0)
+	require.NoError(t, err)
+	r.verifyWith(secret.Value)
+	require.NoError(t, c.Send(ctx, notification(accountID, "deposit_received")))
+	require.Eventually(t, func() bool { return len(r.received()) == 2 }, time.Second, 5*time.Millisecond)
+
+	r.verifyWith(old)
+	require.NoError(t, c.Send(ctx, notification(accountID, "deposit_received")))
+	require.Eventually(t, func() bool {
+		r.mu.Lock()
+		defer r.mu.Unlock()
+		return r.rejected == 1
+	}, time.Second, 5*time.Millisecond)
+}
+
+// TestChannel_Disable tests that endpoints are disabled after sustained
+// failures or a 410, and deliver again once re-enabled
+func TestChannel_Disable(t *testing.T) {
+	ctx := context.Background()
+	r := newReceiver(t)
+	c, dl := newTestChannel(t, r, WithRetry(1, time.Millisecond), WithDisableAfter(2, 0))
+
+	accountID := uuid.New()
+	ep, err := c.Register(ctx, accountID, r.srv.URL, nil)
+	require.NoError(t, err)
+
+	for i := 1; i <= 2; i++ {
+		r.respond(http.StatusInternalServerError)
+		require.NoError(t, c.Send(ctx, notification(accountID, "deposit_received")))
+		require.Eventually(t, func() bool { return len(dl.all()) == i }, time.Second, 5*time.Millisecond)
+	}
+	ep, err = c.Endpoint(ctx, ep.ID)
+	require.NoError(t, err)
+	assert.Equal(t, StatusDisabled, ep.Status)
+	assert.Equal(t, 2, ep.ConsecutiveFailures)
+	assert.Contains(t, ep.DisabledReason, "2 consecutive failed deliveries")
+
+	require.NoError(t, c.Send(ctx, notification(accountID, "deposit_received")))
+	ep, err = c.Enable(ctx, ep.ID)
+	require.NoError(t, err)
+	assert.Zero(t, ep.ConsecutiveFailures)
+	require.NoError(t, c.Send(ctx, notification(accountID, "deposit_received")))
+	require.Eventually(t, func() bool { return len(r.received()) == 1 }, time.Second, 5*time.Millisecond)
+
+	r.respond(http.StatusGone)
+	require.NoError(t, c.Send(ctx, notification(accountID, "deposit_received")))
+	require.Eventually(t, func() bool { return len(dl.all()) == 3 }, time.Second, 5*time.Millisecond)
+	ep, err = c.Endpoint(ctx, ep.ID)
+	require.NoError(t, err)
+	assert.Equal(t, StatusDisabled, ep.Status)
+	assert.Contains(t, ep.DisabledReason, "410")
+}
+
+// flakyStore fails the next Get calls
+type flakyStore struct {
+	*MemoryStore
+	failures atomic.Int32
+}
+
+func (s *flakyStore) Get(ctx context.Context, id uuid.UUID) (*Endpoint, error) {
+	if s.failures.Add(-1) >= 0 {
+		return nil, errors.New("database is locked")
+	}
+	return s.MemoryStore.Get(ctx, id)
+}
+
+// TestChannel_Reload tests that a store error reloading the endpoint is
+// retried, and that a delivery whose endpoint is disabled while it waits to
+// retry fails and is dead-lettered rather than dropped
+func TestChannel_Reload(t *testing.T) {
+	ctx := context.Background()
+	r := newReceiver(t)
+	store := &flakyStore{MemoryStore: NewMemoryStore()}
+	tr := &tracker{}
+	dl := &deadLetters{}
+	c := NewChannel(store, zerolog.Nop(), WithHTTPClient(r.srv.Client()), WithRetry(3, 50*time.Millisecond), WithDeadLetters(dl), WithTracker(tr))
+	t.Cleanup(c.Close)
+
+	accountID := uuid.New()
+	ep, err := c.Register(ctx, accountID, r.srv.URL, nil)
+	require.NoError(t, err)
+
+	store.failures.Store(1)
+	require.NoError(t, c.Send(ctx, notification(accountID, "deposit_received")))
+	require.Eventually(t, func() bool { return len(tr.all()) == 1 }, time.Second, 5*time.Millisecond)
+	assert.Equal(t, []notify.State{notify.StateDelivered}, tr.all())
+	assert.Len(t, r.received(), 1)
+
+	r.respond(http.StatusServiceUnavailable)
+	require.NoError(t, c.Send(ctx, notification(accountID, "deposit_received")))
+	require.Eventually(t, func() bool {
+		log, err := c.Deliveries(ctx, ep.ID, 0)
+		return err == nil && len(log) == 3
+	}, time.Second, 5*time.Millisecond)
+	disabled, err := store.MemoryStore.Get(ctx, ep.ID)
+	require.NoError(t, err)
+	disabled.Status = StatusDisabled
+	require.NoError(t, store.Update(ctx, disabled))
+
+	require.Eventually(t, func() bool { return len(dl.all()) == 1 }, time.Second, 5*time.Millisecond)
+	assert.ErrorIs(t, dl.all()[0], errDisabled)
+	assert.Equal(t, []notify.State{notify.StateDelivered, notify.StateFailed}, tr.all())
+	log, err := c.Deliveries(ctx, ep.ID, 1)
+	require.NoError(t, err)
+	assert.Equal(t, DeliveryFailed, log[0].Status)
+	assert.Len(t, r.received(), 1)
+}
+
+// TestChannel_Backoff tests that a delivery waiting to retry does not hold
+// a slot, and that one cut short by Close does not count toward disabling
+// its endpoint
+func TestChannel_Backoff(t *testing.T) {
+	ctx := context.Background()
+	r := newReceiver(t)
+	c, dl := newTestChannel(t, r, WithRetry(3, time.Hour), WithDisableAfter(1, 0))
+	c.slots = make(chan struct{}, 1)
+
+	failing := uuid.New()
+	ep, err := c.Register(ctx, failing, r.srv.URL, nil)
+	require.NoError(t, err)
+	r.respond(http.StatusServiceUnavailable)
+	require.NoError(t, c.Send(ctx, notification(failing, "deposit_received")))
+	require.Eventually(t, func() bool {
+		log, _ := c.Deliveries(ctx, ep.ID, 0)
+		return len(log) == 1
+	}, time.Second, 5*time.Millisecond)
+
+	healthy := uuid.New()
+	_, err = c.Register(ctx, healthy, r.srv.URL, nil)
+	require.NoError(t, err)
+	sendCtx, cancel := context.WithTimeout(ctx, time.Second)
+	defer cancel()
+	require.NoError(t, c.Send(sendCtx, notification(healthy, "deposit_received")))
+	require.Eventually(t, func() bool { return len(r.received()) == 1 }, time.Second, 5*time.Millisecond)
+
+	c.Close()
+	require.Len(t, dl.all(), 1)
+	assert.Contains(t, dl.all()[0].Error(), "503")
+	ep, err = c.Endpoint(ctx, ep.ID)
+	require.NoError(t, err)
+	assert.Equal(t, StatusActive, ep.Status)
+	assert.Zero(t, ep.ConsecutiveFailures)
+}
+
+// TestChannel_Close tests that Send fails once the channel is closed
+func TestChannel_Close(t *testing.T) {
+	c := NewChannel(NewMemoryStore(), zerolog.Nop())
+	c.Close()
+	assert.ErrorIs(t, c.Send(context.Background(), notification(uuid.New(), "deposit_received")), ErrClosed)
+}
+
+// tracker records the states reported for the webhook channel
+type tracker struct {
+	states []notify.State
+	mu     sync.Mutex
+}
+
+func (tr *tracker) Track(_ *notify.Notification, channel string, state notify.State, _ string) {
+	tr.mu.Lock()
+	defer tr.mu.Unlock()
+	if channel == ChannelName {
+		tr.states = append(tr.states, state)
+	}
+}
+
+func (tr *tracker) all() []notify.State {
+	tr.mu.Lock()
+	defer tr.mu.Unlock()
+	return append([]notify.State(nil), tr.states...)
+}
+
+// TestChannel_Tracker tests that only accounts with a matching endpoint
+// are wanted, and that the outcome of each delivery is tracked
+func TestChannel_Tracker(t *testing.T) {
+	ctx := context.Background()
+	r := newReceiver(t)
+	tr := &tracker{}
+	c, _ := newTestChannel(t, r, WithTracker(tr))
+
+	accountID := uuid.New()
+	_, err := c.Register(ctx, accountID, r.srv.URL, []string{"deposit_received"})
+	require.NoError(t, err)
+	assert.True(t, c.Wants(ctx, notification(accountID, "deposit_received")))
+	assert.False(t, c.Wants(ctx, notification(accountID, "withdrawal_sent")))
+	assert.False(t, c.Wants(ctx, notification(uuid.New(), "deposit_received")))
+	assert.True(t, c.Queues())
+
+	require.NoError(t, c.Send(ctx, notification(accountID, "deposit_received")))
+	require.Eventually(t, func() bool { return len(tr.all()) == 1 }, time.Second, 5*time.Millisecond)
+	r.respond(http.StatusBadRequest)
+	require.NoError(t, c.Send(ctx, notification(accountID, "deposit_received")))
+	require.Eventually(t, func() bool { return len(tr.all()) == 2 }, time.Second, 5*time.Millisecond)
+	assert.Equal(t, []notify.State{notify.StateDelivered, notify.StateFailed}, tr.all())
+}
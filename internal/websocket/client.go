@@ -1,11 +1,16 @@
 package websocket
 
 import (
+	"context"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/google/uuid"
 	"github.com/gorilla/websocket"
 	"github.com/rs/zerolog"
+
+	"github.com/cypherlabdev/notification-service/internal/ratelimit"
 )
 
 const (
@@ -15,32 +20,71 @@ const (
 	maxMessageSize = 512
 )
 
+// frame is an encoded message queued for writing
+type frame struct {
+	data     []byte
+	compress bool // write with permessage-deflate when negotiated
+	saved    int  // sampled estimate of the bytes saved by compressing
+	msgType  string
+	expires  time.Time // zero if the message never expires
+	id       string    // notification ID, reported once written
+}
+
 // Client represents a WebSocket client
 type Client struct {
-	id     string
-	userID *uuid.UUID
-	hub    *Hub
-	conn   *websocket.Conn
-	send   chan []byte
-	logger zerolog.Logger
+	id          string
+	userID      *uuid.UUID
+	hub         *Hub
+	conn        *websocket.Conn
+	send        chan frame // normal priority lane
+	sendHigh    chan frame
+	sendLow     chan frame
+	credits     [numLanes]int // remaining frames per lane in the current weighted round
+	conflated   *conflator
+	format      Format            // wire format negotiated via subprotocol
+	compression bool              // permessage-deflate negotiated
+	frames      *ratelimit.Bucket // inbound frame budget, nil when unlimited
+	done        chan struct{}     // closed by the hub on unregister
+	closeOnce   sync.Once
+	ctx         context.Context // cancelled on unregister, ending running RPC calls
+	cancel      context.CancelFunc
+	rpcInFlight atomic.Int32
+	device      Device
+	lastActive  atomic.Int64 // unix nanoseconds of the last inbound data frame
+	sent        sentIDs      // notifications written, which the client may ack
+	logger      zerolog.Logger
 }
 
 // NewClient creates a new WebSocket client
 func NewClient(hub *Hub, conn *websocket.Conn, userID *uuid.UUID, logger zerolog.Logger) *Client {
-	return &Client{
-		id:     uuid.New().String(),
-		userID: userID,
-		hub:    hub,
-		conn:   conn,
-		send:   make(chan []byte, 256),
-		logger: logger.With().Str("component", "websocket_client").Str("client_id", uuid.New().String()).Logger(),
+	c := &Client{
+		id:        uuid.New().String(),
+		userID:    userID,
+		hub:       hub,
+		conn:      conn,
+		send:      make(chan frame, 256),
+		sendHigh:  make(chan frame, 64),
+		sendLow:   make(chan frame, 256),
+		conflated: newConflator(hub.conflationInterval),
+		done:      make(chan struct{}),
 	}
+	c.ctx, c.cancel = context.WithCancel(context.Background())
+	c.lastActive.Store(time.Now().UnixNano())
+	// Log under the same ID the hub uses for this client
+	c.logger = logger.With().Str("component", "websocket_client").Str("client_id", c.id).Logger()
+	if conn != nil {
+		c.format = FormatForSubprotocol(conn.Subprotocol())
+	}
+	if hub.limiter != nil {
+		c.frames = hub.limiter.newConnBucket()
+	}
+	return c
 }
 
 // ReadPump pumps messages from the WebSocket connection to the hub
 func (c *Client) ReadPump() {
 	defer func() {
-		c.hub.unregister <- c
+		c.hub.Unregister(c)
 		c.conn.Close()
 	}()
 
@@ -52,16 +96,191 @@ func (c *Client) ReadPump() {
 	})
 
 	for {
-		_, _, err := c.conn.ReadMessage()
+		frameType, data, err := c.conn.ReadMessage()
 		if err != nil {
 			if websocket.IsUnexpectedCloseError(err, websocket.CloseGoingAway, websocket.CloseAbnormalClosure) {
 				c.logger.Error().Err(err).Msg("websocket error")
 			}
 			break
 		}
+		c.lastActive.Store(time.Now().UnixNano())
+
+		if !c.allowFrame() {
+			if c.hub.limiter.config.Action == ActionClose {
+				break
+			}
+			continue
+		}
+
+		c.handleControl(frameType, data)
 	}
 }
 
+// allowFrame applies the hub's rate limits to an inbound frame and carries
+// out the configured action when the frame is rejected
+func (c *Client) allowFrame() bool {
+	limiter := c.hub.limiter
+	if limiter == nil {
+		return true
+	}
+
+	scope, ok := limiter.allowFrame(c)
+	if ok {
+		return true
+	}
+
+	action := limiter.config.Action
+	framesRateLimited.WithLabelValues(scope, action.String()).Inc()
+	c.logger.Warn().Str("scope", scope).Str("action", action.String()).Msg("inbound frame rate limited")
+
+	switch action {
+	case ActionWarn:
+		c.sendMessage(&Message{
+			Type:    "rate_limited",
+			Payload: map[string]string{"scope": scope},
+		})
+	case ActionClose:
+		c.conn.WriteControl(websocket.CloseMessage,
+			websocket.FormatCloseMessage(websocket.ClosePolicyViolation, "rate limit exceeded"),
+			time.Now().Add(writeWait))
+	}
+	return false
+}
+
+// ID returns the client's connection ID
+func (c *Client) ID() string { return c.id }
+
+// UserID returns the authenticated user of the connection, if any
+func (c *Client) UserID() *uuid.UUID { return c.userID }
+
+// SetDevice records the device and session behind the connection; it must
+// be called before the client is registered
+func (c *Client) SetDevice(device Device) {
+	c.device = device
+}
+
+// Device returns the device and session behind the connection
+func (c *Client) Device() Device { return c.device }
+
+// LastActive returns when the client last sent a frame
+func (c *Client) LastActive() time.Time {
+	return time.Unix(0, c.lastActive.Load())
+}
+
+// Close ends the write pump once the hub has unregistered the client. The
+// lanes stay open, as ReadPump may still be queueing replies.
+func (c *Client) Close() {
+	c.closeOnce.Do(func() {
+		close(c.done)
+		if c.cancel != nil {
+			c.cancel()
+		}
+	})
+}
+
+// Enqueue queues a message in the client's wire format, conflating it when keyed
+func (c *Client) Enqueue(enc *Delivery) bool {
+	message := enc.msg
+	f, first, err := enc.encode(c.format)
+	if err != nil {
+		if first {
+			c.logger.Error().Err(err).Str("type", message.Type).Str("format", c.format.String()).Msg("failed to marshal message")
+		}
+		return false
+	}
+
+	if message.ConflationKey != "" && c.conflated != nil {
+		replaced, ok := c.conflated.offer(message.ConflationKey, f)
+		if replaced {
+			messagesConflated.Inc()
+		}
+		return ok
+	}
+	return c.enqueue(f, message.Priority)
+}
+
+// sendMessage encodes a server-originated message in the client's wire
+// format and queues it on the lane for its priority
+func (c *Client) sendMessage(msg *Message) bool {
+	f, _, err := newDelivery(msg, c.hub.compression).encode(c.format)
+	if err != nil {
+		c.logger.Error().Err(err).Str("type", msg.Type).Msg("failed to marshal message")
+		return false
+	}
+	return c.enqueue(f, msg.Priority)
+}
+
+// enqueue queues an encoded message on the lane for its priority without
+// blocking, returning false if that lane is full
+func (c *Client) enqueue(f frame, priority Priority) bool {
+	select {
+	case c.lanes()[priority.lane()] <- f:
+		return true
+	default:
+		return false
+	}
+}
+
+func (c *Client) lanes() [numLanes]chan frame {
+	return [numLanes]chan frame{c.sendHigh, c.send, c.sendLow}
+}
+
+// nextFrame takes the next queued frame without blocking, honouring the
+// hub's lane scheduling. ready is false when every lane is empty.
+func (c *Client) nextFrame() (f frame, ok bool, ready bool) {
+	lanes := c.lanes()
+
+	if weights := c.hub.weights; weights != nil {
+		// A second pass runs with refilled credits once the round is spent
+		for pass := 0; pass < 2; pass++ {
+			for lane, ch := range lanes {
+				if c.credits[lane] <= 0 {
+					continue
+				}
+				select {
+				case f, ok = <-ch:
+					c.credits[lane]--
+					return f, ok, true
+				default:
+				}
+			}
+			c.credits = weights.credits()
+		}
+		return c.nextConflated()
+	}
+
+	for _, ch := range lanes {
+		select {
+		case f, ok = <-ch:
+			return f, ok, true
+		default:
+		}
+	}
+	return c.nextConflated()
+}
+
+// nextConflated takes the next sendable conflated frame; conflated updates
+// are served once the priority lanes have nothing ready
+func (c *Client) nextConflated() (frame, bool, bool) {
+	if c.conflated == nil {
+		return frame{}, false, false
+	}
+	f, ready := c.conflated.take(time.Now())
+	return f, ready, ready
+}
+
+// conflationWake returns the channels that signal new or newly sendable conflated frames
+func (c *Client) conflationWake() (<-chan struct{}, <-chan time.Time) {
+	if c.conflated == nil {
+		return nil, nil
+	}
+	var retry <-chan time.Time
+	if wait := c.conflated.nextDue(time.Now()); wait > 0 {
+		retry = time.After(wait)
+	}
+	return c.conflated.signal, retry
+}
+
 // WritePump pumps messages from the hub to the WebSocket connection
 func (c *Client) WritePump() {
 	ticker := time.NewTicker(pingPeriod)
@@ -71,29 +290,116 @@ func (c *Client) WritePump() {
 	}()
 
 	for {
+		// Keep pinging, and notice unregistration, even while the lanes never run dry
 		select {
-		case message, ok := <-c.send:
-			c.conn.SetWriteDeadline(time.Now().Add(writeWait))
-			if !ok {
-				c.conn.WriteMessage(websocket.CloseMessage, []byte{})
+		case <-ticker.C:
+			if !c.writePing() {
 				return
 			}
+		case <-c.done:
+			c.flushHigh()
+			c.writeClose()
+			return
+		default:
+		}
 
-			w, err := c.conn.NextWriter(websocket.TextMessage)
-			if err != nil {
+		f, ok, ready := c.nextFrame()
+		if !ready {
+			signal, retry := c.conflationWake()
+			select {
+			case f, ok = <-c.sendHigh:
+			case f, ok = <-c.send:
+			case f, ok = <-c.sendLow:
+			case <-ticker.C:
+				if !c.writePing() {
+					return
+				}
+				continue
+			case <-signal:
+				continue
+			case <-retry:
+				continue
+			case <-c.done:
+				c.flushHigh()
+				c.writeClose()
 				return
 			}
-			w.Write(message)
+		}
 
-			if err := w.Close(); err != nil {
-				return
-			}
+		if !ok {
+			c.writeClose()
+			return
+		}
 
-		case <-ticker.C:
-			c.conn.SetWriteDeadline(time.Now().Add(writeWait))
-			if err := c.conn.WriteMessage(websocket.PingMessage, nil); err != nil {
+		if !c.writeFrame(f) {
+			return
+		}
+	}
+}
+
+// writeFrame writes a queued frame, compressing it if it qualified for
+// compression and the client negotiated permessage-deflate
+func (c *Client) writeFrame(f frame) bool {
+	if !f.expires.IsZero() && !time.Now().Before(f.expires) {
+		dropExpired(f.msgType, expiredAtWrite)
+		c.hub.reportStatus(f.id, c.userID, StatusFailed, "expired")
+		return true
+	}
+	c.conn.SetWriteDeadline(time.Now().Add(writeWait))
+	compress := f.compress && c.compression
+	c.conn.EnableWriteCompression(compress)
+
+	w, err := c.conn.NextWriter(c.format.frameType())
+	if err != nil {
+		return false
+	}
+	w.Write(f.data)
+	if err := w.Close(); err != nil {
+		return false
+	}
+
+	if f.id != "" {
+		c.sent.add(f.id)
+	}
+	c.hub.reportStatus(f.id, c.userID, StatusSent, "")
+
+	if compress {
+		framesWritten.WithLabelValues("true").Inc()
+		compressionBytesIn.Add(float64(len(f.data)))
+		compressionBytesSaved.Add(float64(f.saved))
+	} else {
+		framesWritten.WithLabelValues("false").Inc()
+	}
+	return true
+}
+
+// EnableCompression records that permessage-deflate was negotiated for the
+// connection, allowing qualifying frames to be compressed
+func (c *Client) EnableCompression() {
+	c.compression = true
+}
+
+// flushHigh writes the high priority frames still queued when the client
+// is closed, such as a session_revoked notice
+func (c *Client) flushHigh() {
+	for {
+		select {
+		case f := <-c.sendHigh:
+			if !c.writeFrame(f) {
 				return
 			}
+		default:
+			return
 		}
 	}
 }
+
+func (c *Client) writeClose() {
+	c.conn.SetWriteDeadline(time.Now().Add(writeWait))
+	c.conn.WriteMessage(websocket.CloseMessage, []byte{})
+}
+
+func (c *Client) writePing() bool {
+	c.conn.SetWriteDeadline(time.Now().Add(writeWait))
+	return c.conn.WriteMessage(websocket.PingMessage, nil) == nil
+}
@@ -83,7 +83,7 @@ func TestNewClient_WithoutUserID(t *testing.T) {
 func TestClient_WritePump(t *testing.T) {
 	logger := zerolog.Nop()
 	hub := NewHub(logger)
-	go hub.Run()
+	go hub.Run(t.Context())
 
 	// Create test server
 	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -127,7 +127,7 @@ func TestClient_WritePump(t *testing.T) {
 	}
 
 	for _, msg := range testMessages {
-		client.send <- msg
+		client.send <- frame{data: msg}
 		time.Sleep(50 * time.Millisecond)
 	}
 
@@ -143,7 +143,7 @@ func TestClient_WritePump(t *testing.T) {
 func TestClient_ReadPump(t *testing.T) {
 	logger := zerolog.Nop()
 	hub := NewHub(logger)
-	go hub.Run()
+	go hub.Run(t.Context())
 
 	msgReceived := make(chan bool, 1)
 
@@ -182,7 +182,7 @@ func TestClient_ReadPump(t *testing.T) {
 	client := NewClient(hub, conn, &userID, logger)
 
 	// Register client
-	hub.register <- client
+	require.NoError(t, hub.Register(client))
 	time.Sleep(50 * time.Millisecond)
 
 	// Start read pump
@@ -203,7 +203,7 @@ func TestClient_ReadPump(t *testing.T) {
 func TestClient_ReadPump_ConnectionClose(t *testing.T) {
 	logger := zerolog.Nop()
 	hub := NewHub(logger)
-	go hub.Run()
+	go hub.Run(t.Context())
 
 	unregisterReceived := make(chan bool, 1)
 
@@ -238,7 +238,7 @@ func TestClient_ReadPump_ConnectionClose(t *testing.T) {
 	client := NewClient(hub, conn, &userID, logger)
 
 	// Register client
-	hub.register <- client
+	require.NoError(t, hub.Register(client))
 	time.Sleep(50 * time.Millisecond)
 
 	// Start read pump (should handle close and unregister)
@@ -257,7 +257,7 @@ func TestClient_ReadPump_ConnectionClose(t *testing.T) {
 func TestClient_WritePump_ChannelClose(t *testing.T) {
 	logger := zerolog.Nop()
 	hub := NewHub(logger)
-	go hub.Run()
+	go hub.Run(t.Context())
 
 	closeReceived := make(chan bool, 1)
 
@@ -313,7 +313,7 @@ func TestClient_WritePump_ChannelClose(t *testing.T) {
 func TestClient_WritePump_PingPong(t *testing.T) {
 	logger := zerolog.Nop()
 	hub := NewHub(logger)
-	go hub.Run()
+	go hub.Run(t.Context())
 
 	pingReceived := make(chan bool, 1)
 
@@ -373,7 +373,7 @@ func TestClient_WritePump_PingPong(t *testing.T) {
 func TestClient_ReadPump_PongHandler(t *testing.T) {
 	logger := zerolog.Nop()
 	hub := NewHub(logger)
-	go hub.Run()
+	go hub.Run(t.Context())
 
 	// Create test server that sends pings
 	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -408,7 +408,7 @@ func TestClient_ReadPump_PongHandler(t *testing.T) {
 	client := NewClient(hub, conn, &userID, logger)
 
 	// Register client
-	hub.register <- client
+	require.NoError(t, hub.Register(client))
 	time.Sleep(50 * time.Millisecond)
 
 	// Start read pump (will handle pongs)
@@ -439,7 +439,7 @@ func TestClient_Constants(t *testing.T) {
 func TestClient_ReadPump_MaxMessageSize(t *testing.T) {
 	logger := zerolog.Nop()
 	hub := NewHub(logger)
-	go hub.Run()
+	go hub.Run(t.Context())
 
 	connectionClosed := make(chan bool, 1)
 
@@ -478,7 +478,7 @@ func TestClient_ReadPump_MaxMessageSize(t *testing.T) {
 	client := NewClient(hub, conn, &userID, logger)
 
 	// Register client
-	hub.register <- client
+	require.NoError(t, hub.Register(client))
 	time.Sleep(50 * time.Millisecond)
 
 	// Start read pump (should close on oversized message)
@@ -497,7 +497,7 @@ func TestClient_ReadPump_MaxMessageSize(t *testing.T) {
 func TestClient_Integration(t *testing.T) {
 	logger := zerolog.Nop()
 	hub := NewHub(logger)
-	go hub.Run()
+	go hub.Run(t.Context())
 
 	// Give hub time to start
 	time.Sleep(50 * time.Millisecond)
@@ -546,7 +546,7 @@ func TestClient_Integration(t *testing.T) {
 	client := NewClient(hub, conn, &userID, logger)
 
 	// Register client
-	hub.register <- client
+	require.NoError(t, hub.Register(client))
 	time.Sleep(50 * time.Millisecond)
 
 	// Start pumps
@@ -556,7 +556,7 @@ func TestClient_Integration(t *testing.T) {
 	// Send messages to client
 	for i := 0; i < 3; i++ {
 		select {
-		case client.send <- []byte("from client"):
+		case client.send <- frame{data: []byte("from client")}:
 			time.Sleep(50 * time.Millisecond)
 		case <-time.After(500 * time.Millisecond):
 			t.Log("Timeout sending message")
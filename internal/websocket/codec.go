@@ -0,0 +1,255 @@
+package websocket
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+
+	"github.com/gorilla/websocket"
+	"github.com/vmihailenco/msgpack/v5"
+	"google.golang.org/protobuf/encoding/protowire"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+// Format is the wire encoding negotiated with a client
+type Format int
+
+const (
+	FormatJSON Format = iota
+	FormatMsgpack
+	FormatProto
+	numFormats
+)
+
+// WebSocket subprotocols offered at upgrade, in server preference order
+const (
+	SubprotocolJSON    = "notif.v1.json"
+	SubprotocolMsgpack = "notif.v1.msgpack"
+	SubprotocolProto   = "notif.v1.proto"
+)
+
+// Subprotocols lists the subprotocols the upgrader should offer
+var Subprotocols = []string{SubprotocolJSON, SubprotocolMsgpack, SubprotocolProto}
+
+// FormatForSubprotocol maps a negotiated subprotocol to its format; clients
+// that negotiate none get JSON
+func FormatForSubprotocol(subprotocol string) Format {
+	switch subprotocol {
+	case SubprotocolMsgpack:
+		return FormatMsgpack
+	case SubprotocolProto:
+		return FormatProto
+	default:
+		return FormatJSON
+	}
+}
+
+func (f Format) String() string {
+	switch f {
+	case FormatMsgpack:
+		return "msgpack"
+	case FormatProto:
+		return "proto"
+	default:
+		return "json"
+	}
+}
+
+// frameType is the WebSocket frame type used to carry the format
+func (f Format) frameType() int {
+	if f == FormatJSON {
+		return websocket.TextMessage
+	}
+	return websocket.BinaryMessage
+}
+
+// encode serialises a message in the given format
+func encode(f Format, msg *Message) ([]byte, error) {
+	switch f {
+	case FormatMsgpack:
+		return encodeMsgpack(msg)
+	case FormatProto:
+		return encodeProto(msg)
+	default:
+		return json.Marshal(msg)
+	}
+}
+
+// wireEnvelope is the msgpack shape of a message, keyed like the JSON form
+type wireEnvelope struct {
+	ID          string      `json:"id,omitempty"`
+	Type        string      `json:"type"`
+	UserID      string      `json:"user_id,omitempty"`
+	Payload     interface{} `json:"payload"`
+	Topic       string      `json:"topic,omitempty"`
+	Version     uint64      `json:"version,omitempty"`
+	Group       string      `json:"group,omitempty"`
+	OrderingKey string      `json:"ordering_key,omitempty"`
+	Sequence    uint64      `json:"seq,omitempty"`
+}
+
+func newWireEnvelope(msg *Message) wireEnvelope {
+	env := wireEnvelope{
+		ID:      msg.ID,
+		Type:    msg.Type,
+		Payload: msg.Payload,
+		Topic:   msg.Topic,
+		Version: msg.Version,
+		Group:   msg.Group,
+
+		OrderingKey: msg.OrderingKey,
+		Sequence:    msg.Sequence,
+	}
+	if msg.UserID != nil {
+		env.UserID = msg.UserID.String()
+	}
+	return env
+}
+
+func encodeMsgpack(msg *Message) ([]byte, error) {
+	var buf bytes.Buffer
+	enc := msgpack.NewEncoder(&buf)
+	// Honour json tags so payload structs keep the same keys as in JSON
+	enc.SetCustomStructTag("json")
+	enc.UseCompactInts(true)
+	if err := enc.Encode(newWireEnvelope(msg)); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// Field numbers of notif.v1.Envelope, see api/proto/notif/v1/envelope.proto
+const (
+	envelopeType        protowire.Number = 1
+	envelopeUserID      protowire.Number = 2
+	envelopePayload     protowire.Number = 3
+	envelopeTopic       protowire.Number = 4
+	envelopeVersion     protowire.Number = 5
+	envelopeGroup       protowire.Number = 6
+	envelopeOrderingKey protowire.Number = 7
+	envelopeSeq         protowire.Number = 8
+	envelopeID          protowire.Number = 9
+)
+
+func encodeProto(msg *Message) ([]byte, error) {
+	payload, err := payloadValue(msg.Payload)
+	if err != nil {
+		return nil, err
+	}
+	payloadBytes, err := proto.Marshal(payload)
+	if err != nil {
+		return nil, err
+	}
+
+	var b []byte
+	b = protowire.AppendTag(b, envelopeType, protowire.BytesType)
+	b = protowire.AppendString(b, msg.Type)
+	if msg.UserID != nil {
+		b = protowire.AppendTag(b, envelopeUserID, protowire.BytesType)
+		b = protowire.AppendString(b, msg.UserID.String())
+	}
+	b = protowire.AppendTag(b, envelopePayload, protowire.BytesType)
+	b = protowire.AppendBytes(b, payloadBytes)
+	if msg.Topic != "" {
+		b = protowire.AppendTag(b, envelopeTopic, protowire.BytesType)
+		b = protowire.AppendString(b, msg.Topic)
+	}
+	if msg.Version != 0 {
+		b = protowire.AppendTag(b, envelopeVersion, protowire.VarintType)
+		b = protowire.AppendVarint(b, msg.Version)
+	}
+	if msg.Group != "" {
+		b = protowire.AppendTag(b, envelopeGroup, protowire.BytesType)
+		b = protowire.AppendString(b, msg.Group)
+	}
+	if msg.OrderingKey != "" {
+		b = protowire.AppendTag(b, envelopeOrderingKey, protowire.BytesType)
+		b = protowire.AppendString(b, msg.OrderingKey)
+		b = protowire.AppendTag(b, envelopeSeq, protowire.VarintType)
+		b = protowire.AppendVarint(b, msg.Sequence)
+	}
+	if msg.ID != "" {
+		b = protowire.AppendTag(b, envelopeID, protowire.BytesType)
+		b = protowire.AppendString(b, msg.ID)
+	}
+	return b, nil
+}
+
+// payloadValue converts an arbitrary payload into a google.protobuf.Value by
+// way of its JSON form, so json tags and MarshalJSON are honoured
+func payloadValue(payload interface{}) (*structpb.Value, error) {
+	raw, err := json.Marshal(payload)
+	if err != nil {
+		return nil, err
+	}
+	var generic interface{}
+	if err := json.Unmarshal(raw, &generic); err != nil {
+		return nil, err
+	}
+	v, err := structpb.NewValue(generic)
+	if err != nil {
+		return nil, fmt.Errorf("convert payload: %w", err)
+	}
+	return v, nil
+}
+
+// Delivery is a message handed to a Subscriber. It encodes the message at
+// most once per wire format, however many subscribers it is delivered to.
+// A Delivery is not safe for concurrent use and should not be retained
+// after Enqueue returns; the Message it carries may be.
+type Delivery struct {
+	msg         *Message
+	eventID     string // replay event ID assigned by the hub, if any
+	compression *CompressionConfig
+	frames      [numFormats]frame
+	err         [numFormats]error
+	done        [numFormats]bool
+	deadLetter  DeadLetterFunc // receives the message if encoding fails
+	reported    bool
+}
+
+func newDelivery(msg *Message, compression *CompressionConfig) *Delivery {
+	return &Delivery{msg: msg, compression: compression}
+}
+
+// Message returns the message being delivered; it must not be modified
+func (d *Delivery) Message() *Message {
+	return d.msg
+}
+
+// EventID returns the replay event ID of the message, or "" for messages
+// that cannot be resumed from, such as topic snapshots and deltas
+func (d *Delivery) EventID() string {
+	return d.eventID
+}
+
+// Encode returns the message encoded in the given wire format
+func (d *Delivery) Encode(f Format) ([]byte, error) {
+	if f < 0 || f >= numFormats {
+		return nil, fmt.Errorf("unknown format %d", f)
+	}
+	fr, _, err := d.encode(f)
+	return fr.data, err
+}
+
+// encode returns the message framed in the given format; first reports
+// whether this call performed the encoding
+func (d *Delivery) encode(f Format) (fr frame, first bool, err error) {
+	if !d.done[f] {
+		data, err := encode(f, d.msg)
+		d.err[f] = err
+		if err != nil {
+			d.reportFailure(err)
+		} else {
+			d.frames[f] = frame{data: data, msgType: d.msg.Type, expires: d.msg.ExpiresAt, id: d.msg.ID}
+			if d.compression.shouldCompress(d.msg.Type, len(data)) {
+				d.frames[f].compress = true
+				d.frames[f].saved = estimateSaved(data)
+			}
+		}
+		d.done[f] = true
+		first = true
+	}
+	return d.frames[f], first, d.err[f]
+}
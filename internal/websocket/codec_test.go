@@ -0,0 +1,197 @@
+package websocket
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/websocket"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/vmihailenco/msgpack/v5"
+	"google.golang.org/protobuf/encoding/protowire"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+type testPayload struct {
+	MarketID string  `json:"market_id"`
+	Price    float64 `json:"price"`
+}
+
+// TestFormatForSubprotocol tests subprotocol to format mapping
+func TestFormatForSubprotocol(t *testing.T) {
+	assert.Equal(t, FormatJSON, FormatForSubprotocol(""))
+	assert.Equal(t, FormatJSON, FormatForSubprotocol(SubprotocolJSON))
+	assert.Equal(t, FormatMsgpack, FormatForSubprotocol(SubprotocolMsgpack))
+	assert.Equal(t, FormatProto, FormatForSubprotocol(SubprotocolProto))
+
+	assert.Equal(t, websocket.TextMessage, FormatJSON.frameType())
+	assert.Equal(t, websocket.BinaryMessage, FormatMsgpack.frameType())
+	assert.Equal(t, websocket.BinaryMessage, FormatProto.frameType())
+}
+
+// TestEncode_Msgpack tests that msgpack frames use the same keys as JSON
+func TestEncode_Msgpack(t *testing.T) {
+	userID := uuid.New()
+	data, err := encode(FormatMsgpack, &Message{
+		Type:    "odds_update",
+		UserID:  &userID,
+		Payload: testPayload{MarketID: "m1", Price: 1.85},
+	})
+	require.NoError(t, err)
+
+	var decoded map[string]interface{}
+	require.NoError(t, msgpack.Unmarshal(data, &decoded))
+	assert.Equal(t, "odds_update", decoded["type"])
+	assert.Equal(t, userID.String(), decoded["user_id"])
+	payload := decoded["payload"].(map[string]interface{})
+	assert.Equal(t, "m1", payload["market_id"])
+	assert.Equal(t, 1.85, payload["price"])
+}
+
+// TestEncode_Proto tests that proto frames decode as a notif.v1.Envelope
+func TestEncode_Proto(t *testing.T) {
+	data, err := encode(FormatProto, &Message{
+		Type:    "delta",
+		Topic:   "market:1",
+		Version: 42,
+		Payload: testPayload{MarketID: "m1", Price: 2.5},
+	})
+	require.NoError(t, err)
+
+	fields := map[protowire.Number][]byte{}
+	var version uint64
+	for len(data) > 0 {
+		num, typ, n := protowire.ConsumeTag(data)
+		require.GreaterOrEqual(t, n, 0)
+		data = data[n:]
+		if typ == protowire.VarintType {
+			v, n := protowire.ConsumeVarint(data)
+			require.GreaterOrEqual(t, n, 0)
+			version = v
+			data = data[n:]
+			continue
+		}
+		v, n := protowire.ConsumeBytes(data)
+		require.GreaterOrEqual(t, n, 0)
+		fields[num] = v
+		data = data[n:]
+	}
+
+	assert.Equal(t, "delta", string(fields[envelopeType]))
+	assert.Equal(t, "market:1", string(fields[envelopeTopic]))
+	assert.Equal(t, uint64(42), version)
+	_, hasUser := fields[envelopeUserID]
+	assert.False(t, hasUser)
+
+	var payload structpb.Value
+	require.NoError(t, proto.Unmarshal(fields[envelopePayload], &payload))
+	assert.Equal(t, "m1", payload.GetStructValue().Fields["market_id"].GetStringValue())
+	assert.Equal(t, 2.5, payload.GetStructValue().Fields["price"].GetNumberValue())
+}
+
+// TestEncodedMessage_OncePerFormat tests that each format is encoded at most once
+func TestEncodedMessage_OncePerFormat(t *testing.T) {
+	enc := newDelivery(&Message{Type: "test", Payload: "x"}, nil)
+
+	first1, isFirst, err := enc.encode(FormatMsgpack)
+	require.NoError(t, err)
+	assert.True(t, isFirst)
+
+	first2, isFirst, _ := enc.encode(FormatMsgpack)
+	assert.False(t, isFirst)
+	assert.Equal(t, &first1.data[0], &first2.data[0], "expected the cached encoding")
+
+	_, isFirst, _ = enc.encode(FormatJSON)
+	assert.True(t, isFirst)
+}
+
+// TestHub_Broadcast_MixedFormats tests that each client receives its negotiated format
+func TestHub_Broadcast_MixedFormats(t *testing.T) {
+	hub := NewHub(zerolog.Nop())
+	go hub.Run(t.Context())
+
+	jsonClient := newLaneClient(hub)
+	packClient := newLaneClient(hub)
+	packClient.format = FormatMsgpack
+	require.NoError(t, hub.Register(jsonClient))
+	require.NoError(t, hub.Register(packClient))
+	time.Sleep(50 * time.Millisecond)
+
+	hub.BroadcastToAll("announcement", map[string]string{"text": "hi"})
+	time.Sleep(100 * time.Millisecond)
+
+	jsonData := <-jsonClient.send
+	packData := <-packClient.send
+	assert.True(t, bytes.HasPrefix(jsonData.data, []byte("{")))
+
+	var decoded map[string]interface{}
+	require.NoError(t, msgpack.Unmarshal(packData.data, &decoded))
+	assert.Equal(t, "announcement", decoded["type"])
+}
+
+// TestClient_WritePump_BinaryFrames tests subprotocol negotiation and binary frames end to end
+func TestClient_WritePump_BinaryFrames(t *testing.T) {
+	logger := zerolog.Nop()
+	hub := NewHub(logger)
+	go hub.Run(t.Context())
+
+	received := make(chan int, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		upgrader := websocket.Upgrader{Subprotocols: Subprotocols}
+		serverConn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer serverConn.Close()
+
+		serverConn.SetReadDeadline(time.Now().Add(2 * time.Second))
+		messageType, _, err := serverConn.ReadMessage()
+		if err == nil {
+			received <- messageType
+		}
+	}))
+	defer server.Close()
+
+	dialer := websocket.Dialer{Subprotocols: []string{SubprotocolProto}}
+	wsURL := "ws" + strings.TrimPrefix(server.URL, "http")
+	conn, _, err := dialer.Dial(wsURL, nil)
+	require.NoError(t, err)
+	defer conn.Close()
+
+	client := NewClient(hub, conn, nil, logger)
+	assert.Equal(t, FormatProto, client.format)
+	go client.WritePump()
+
+	require.True(t, client.sendMessage(&Message{Type: "test", Payload: "x"}))
+
+	select {
+	case messageType := <-received:
+		assert.Equal(t, websocket.BinaryMessage, messageType)
+	case <-time.After(2 * time.Second):
+		t.Fatal("Timeout waiting for binary frame")
+	}
+}
+
+// TestClient_HandleControl_MsgpackBinary tests binary control messages from msgpack clients
+func TestClient_HandleControl_MsgpackBinary(t *testing.T) {
+	c := newLaneClient(NewHub(zerolog.Nop()))
+	c.conflated = newConflator(0)
+	c.format = FormatMsgpack
+
+	data, err := msgpack.Marshal(map[string]interface{}{"op": "conflation", "interval_ms": 100})
+	require.NoError(t, err)
+	c.handleControl(websocket.BinaryMessage, data)
+	assert.Equal(t, 100*time.Millisecond, c.conflated.interval)
+
+	// JSON clients may not send binary control frames
+	c.format = FormatJSON
+	c.handleControl(websocket.BinaryMessage, data)
+	assert.Contains(t, string((<-c.send).data), "invalid_message")
+}
@@ -0,0 +1,95 @@
+package websocket
+
+import (
+	"compress/flate"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// savingsSampleRate is how many compressed encodings share one estimate of
+// the bytes deflate saves, as estimating deflates the frame a second time
+const savingsSampleRate = 16
+
+// savingsSamples counts compressed encodings to pick the sampled ones
+var savingsSamples atomic.Uint64
+
+// CompressionConfig controls which frames are sent with permessage-deflate
+// once the extension has been negotiated
+type CompressionConfig struct {
+	// MinSize is the encoded size below which frames are sent uncompressed,
+	// as deflate costs more CPU than it saves on small frames
+	MinSize int
+	// SkipTypePrefixes lists latency-sensitive message types that are never compressed
+	SkipTypePrefixes []string
+}
+
+// DefaultCompressionConfig compresses large payloads such as bet history
+// and portfolio snapshots, but never market ticks
+func DefaultCompressionConfig() CompressionConfig {
+	return CompressionConfig{
+		MinSize:          1024,
+		SkipTypePrefixes: []string{"odds", "price", "ticker"},
+	}
+}
+
+func (cfg *CompressionConfig) shouldCompress(msgType string, size int) bool {
+	if cfg == nil || size < cfg.MinSize {
+		return false
+	}
+	for _, prefix := range cfg.SkipTypePrefixes {
+		if strings.HasPrefix(msgType, prefix) {
+			return false
+		}
+	}
+	return true
+}
+
+// OffersCompression reports whether the upgrade request offers permessage-deflate
+func OffersCompression(r *http.Request) bool {
+	for _, ext := range r.Header.Values("Sec-Websocket-Extensions") {
+		if strings.Contains(ext, "permessage-deflate") {
+			return true
+		}
+	}
+	return false
+}
+
+var flateWriters = sync.Pool{
+	New: func() interface{} {
+		// BestSpeed matches gorilla/websocket's default compression level
+		w, _ := flate.NewWriter(nil, flate.BestSpeed)
+		return w
+	},
+}
+
+type countingWriter int
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	*c += countingWriter(len(p))
+	return len(p), nil
+}
+
+// estimateSaved returns the bytes deflate saves on data, scaled up on one
+// in savingsSampleRate calls and zero on the rest, so the saved-bytes
+// counter stays an unbiased estimate at a fraction of the CPU
+func estimateSaved(data []byte) int {
+	if savingsSamples.Add(1)%savingsSampleRate != 0 {
+		return 0
+	}
+	return savingsSampleRate * (len(data) - deflatedSize(data))
+}
+
+// deflatedSize estimates the on-the-wire size of data after permessage-deflate
+func deflatedSize(data []byte) int {
+	var n countingWriter
+	w := flateWriters.Get().(*flate.Writer)
+	w.Reset(&n)
+	w.Write(data)
+	w.Flush()
+	flateWriters.Put(w)
+
+	// permessage-deflate strips the 4-byte empty block trailer added by Flush
+	return max(int(n)-4, 0)
+}
@@ -0,0 +1,215 @@
+package websocket
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// betHistory builds a JSON payload resembling a page of settled bets
+func betHistory(n int) []map[string]interface{} {
+	bets := make([]map[string]interface{}, n)
+	for i := range bets {
+		bets[i] = map[string]interface{}{
+			"bet_id":     fmt.Sprintf("bet-%06d", i),
+			"market":     "Premier League - Match Winner",
+			"selection":  "Home",
+			"odds":       1.85 + float64(i%7)/100,
+			"stake":      "10.00",
+			"status":     "settled",
+			"settled_at": "2026-10-18T12:00:00Z",
+		}
+	}
+	return bets
+}
+
+// TestCompressionConfig_ShouldCompress tests the size threshold and per-type opt-out
+func TestCompressionConfig_ShouldCompress(t *testing.T) {
+	cfg := DefaultCompressionConfig()
+
+	assert.False(t, cfg.shouldCompress("bet_history", 100))
+	assert.True(t, cfg.shouldCompress("bet_history", 4096))
+	assert.False(t, cfg.shouldCompress("odds_update", 4096))
+
+	var disabled *CompressionConfig
+	assert.False(t, disabled.shouldCompress("bet_history", 1<<20))
+}
+
+// TestOffersCompression tests detection of the permessage-deflate offer
+func TestOffersCompression(t *testing.T) {
+	r := httptest.NewRequest(http.MethodGet, "/ws", nil)
+	assert.False(t, OffersCompression(r))
+
+	r.Header.Set("Sec-WebSocket-Extensions", "permessage-deflate; client_max_window_bits")
+	assert.True(t, OffersCompression(r))
+}
+
+// TestEncodedMessage_CompressionEstimate tests that one in every
+// savingsSampleRate qualifying frames carries a scaled bytes-saved estimate
+func TestEncodedMessage_CompressionEstimate(t *testing.T) {
+	cfg := DefaultCompressionConfig()
+
+	sampled := 0
+	for range savingsSampleRate {
+		big, _, err := newDelivery(&Message{Type: "bet_history", Payload: betHistory(50)}, &cfg).encode(FormatJSON)
+		require.NoError(t, err)
+		assert.True(t, big.compress)
+		if big.saved > 0 {
+			sampled++
+			assert.Greater(t, big.saved, savingsSampleRate*len(big.data)/2)
+		}
+	}
+	assert.Equal(t, 1, sampled)
+
+	small, _, err := newDelivery(&Message{Type: "bet_settled", Payload: "x"}, &cfg).encode(FormatJSON)
+	require.NoError(t, err)
+	assert.False(t, small.compress)
+	assert.Zero(t, small.saved)
+}
+
+// TestClient_WritePump_Compressed tests that compressed frames arrive intact
+func TestClient_WritePump_Compressed(t *testing.T) {
+	logger := zerolog.Nop()
+	cfg := DefaultCompressionConfig()
+	hub := NewHub(logger, WithCompression(cfg))
+	go hub.Run(t.Context())
+
+	received := make(chan []byte, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		upgrader := websocket.Upgrader{EnableCompression: true}
+		serverConn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer serverConn.Close()
+
+		serverConn.SetReadDeadline(time.Now().Add(2 * time.Second))
+		if _, data, err := serverConn.ReadMessage(); err == nil {
+			received <- data
+		}
+	}))
+	defer server.Close()
+
+	dialer := websocket.Dialer{EnableCompression: true}
+	wsURL := "ws" + strings.TrimPrefix(server.URL, "http")
+	conn, _, err := dialer.Dial(wsURL, nil)
+	require.NoError(t, err)
+	defer conn.Close()
+
+	client := NewClient(hub, conn, nil, logger)
+	client.EnableCompression()
+	go client.WritePump()
+
+	msg := &Message{Type: "bet_history", Payload: betHistory(100)}
+	require.True(t, client.sendMessage(msg))
+
+	select {
+	case data := <-received:
+		want, _ := json.Marshal(msg)
+		assert.True(t, bytes.Equal(want, data))
+	case <-time.After(2 * time.Second):
+		t.Fatal("Timeout waiting for compressed frame")
+	}
+}
+
+// countingListener counts the bytes servers read from accepted connections
+type countingListener struct {
+	net.Listener
+	read atomic.Int64
+}
+
+func (l *countingListener) Accept() (net.Conn, error) {
+	conn, err := l.Listener.Accept()
+	if err != nil {
+		return nil, err
+	}
+	return &countingConn{Conn: conn, read: &l.read}, nil
+}
+
+type countingConn struct {
+	net.Conn
+	read *atomic.Int64
+}
+
+func (c *countingConn) Read(p []byte) (int, error) {
+	n, err := c.Conn.Read(p)
+	c.read.Add(int64(n))
+	return n, err
+}
+
+// BenchmarkCompression compares the CPU cost of writing frames with and
+// without permessage-deflate against the bytes that reach the wire
+// (wire_bytes/op, including framing)
+func BenchmarkCompression(b *testing.B) {
+	for _, bets := range []int{1, 10, 100, 1000} {
+		data, err := json.Marshal(&Message{Type: "bet_history", Payload: betHistory(bets)})
+		if err != nil {
+			b.Fatal(err)
+		}
+
+		for _, compress := range []bool{false, true} {
+			b.Run(fmt.Sprintf("%dB/compressed=%v", len(data), compress), func(b *testing.B) {
+				benchmarkWrites(b, data, compress)
+			})
+		}
+	}
+}
+
+func benchmarkWrites(b *testing.B, data []byte, compress bool) {
+	done := make(chan struct{})
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		defer close(done)
+		upgrader := websocket.Upgrader{EnableCompression: true}
+		serverConn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		defer serverConn.Close()
+		for {
+			_, reader, err := serverConn.NextReader()
+			if err != nil {
+				return
+			}
+			io.Copy(io.Discard, reader)
+		}
+	}))
+	listener := &countingListener{Listener: server.Listener}
+	server.Listener = listener
+	server.Start()
+	defer server.Close()
+
+	dialer := websocket.Dialer{EnableCompression: true}
+	conn, _, err := dialer.Dial("ws"+strings.TrimPrefix(server.URL, "http"), nil)
+	if err != nil {
+		b.Fatal(err)
+	}
+	conn.EnableWriteCompression(compress)
+	handshake := listener.read.Load()
+
+	b.SetBytes(int64(len(data)))
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if err := conn.WriteMessage(websocket.TextMessage, data); err != nil {
+			b.Fatal(err)
+		}
+	}
+	conn.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""))
+	<-done
+	b.StopTimer()
+	conn.Close()
+
+	b.ReportMetric(float64(listener.read.Load()-handshake)/float64(b.N), "wire_bytes/op")
+}
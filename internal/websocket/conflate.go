@@ -0,0 +1,115 @@
+package websocket
+
+import (
+	"sync"
+	"time"
+)
+
+const (
+	// maxConflationKeys bounds the distinct keys pending per client
+	maxConflationKeys = 1024
+	// maxConflationInterval bounds the minimum publish interval a client may request
+	maxConflationInterval = 5 * time.Second
+)
+
+// conflator holds the latest undelivered frame per conflation key. A newer
+// frame for a pending key replaces the older one in place, so a client only
+// ever receives the most recent update for a market.
+type conflator struct {
+	pending  map[string]frame
+	order    []string // pending keys in first-arrival order
+	lastSent map[string]time.Time
+	interval time.Duration
+	signal   chan struct{}
+	mu       sync.Mutex
+}
+
+func newConflator(interval time.Duration) *conflator {
+	return &conflator{
+		pending:  make(map[string]frame),
+		lastSent: make(map[string]time.Time),
+		interval: interval,
+		signal:   make(chan struct{}, 1),
+	}
+}
+
+// offer queues data under key, replacing any pending frame for the key.
+// It returns whether a frame was replaced, and false for ok if the client
+// already has too many keys pending.
+func (q *conflator) offer(key string, f frame) (replaced bool, ok bool) {
+	q.mu.Lock()
+	if _, exists := q.pending[key]; exists {
+		replaced = true
+	} else {
+		if len(q.pending) >= maxConflationKeys {
+			q.mu.Unlock()
+			return false, false
+		}
+		q.order = append(q.order, key)
+	}
+	q.pending[key] = f
+	q.mu.Unlock()
+
+	select {
+	case q.signal <- struct{}{}:
+	default:
+	}
+	return replaced, true
+}
+
+// take removes the oldest pending frame whose key is outside its minimum
+// publish interval
+func (q *conflator) take(now time.Time) (frame, bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	for i, key := range q.order {
+		if q.interval > 0 && now.Sub(q.lastSent[key]) < q.interval {
+			continue
+		}
+		f := q.pending[key]
+		delete(q.pending, key)
+		q.order = append(q.order[:i], q.order[i+1:]...)
+		if q.interval > 0 {
+			q.lastSent[key] = now
+		}
+		return f, true
+	}
+
+	// Forget send times that can no longer hold anything back
+	for key, sent := range q.lastSent {
+		if _, queued := q.pending[key]; !queued && now.Sub(sent) >= q.interval {
+			delete(q.lastSent, key)
+		}
+	}
+	return frame{}, false
+}
+
+// nextDue returns how long until a held-back frame becomes sendable, or 0
+// if nothing is held back
+func (q *conflator) nextDue(now time.Time) time.Duration {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	var wait time.Duration
+	for _, key := range q.order {
+		remaining := q.interval - now.Sub(q.lastSent[key])
+		if remaining > 0 && (wait == 0 || remaining < wait) {
+			wait = remaining
+		}
+	}
+	return wait
+}
+
+// setInterval changes the minimum publish interval per key
+func (q *conflator) setInterval(interval time.Duration) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.interval = min(max(interval, 0), maxConflationInterval)
+}
+
+func (q *conflator) len() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return len(q.pending)
+}
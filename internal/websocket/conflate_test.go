@@ -0,0 +1,121 @@
+package websocket
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/websocket"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestConflator_ReplacesPendingKey tests that a newer frame replaces the queued one in place
+func TestConflator_ReplacesPendingKey(t *testing.T) {
+	q := newConflator(0)
+	now := time.Now()
+
+	_, ok := q.offer("market:1", frame{data: []byte("m1-v1")})
+	require.True(t, ok)
+	q.offer("market:2", frame{data: []byte("m2-v1")})
+	replaced, _ := q.offer("market:1", frame{data: []byte("m1-v2")})
+	assert.True(t, replaced)
+	assert.Equal(t, 2, q.len())
+
+	data, ok := q.take(now)
+	require.True(t, ok)
+	assert.Equal(t, "m1-v2", string(data.data))
+
+	data, ok = q.take(now)
+	require.True(t, ok)
+	assert.Equal(t, "m2-v1", string(data.data))
+
+	_, ok = q.take(now)
+	assert.False(t, ok)
+}
+
+// TestConflator_MinInterval tests that updates for a key are held back within the interval
+func TestConflator_MinInterval(t *testing.T) {
+	q := newConflator(100 * time.Millisecond)
+	now := time.Now()
+
+	q.offer("market:1", frame{data: []byte("v1")})
+	data, ok := q.take(now)
+	require.True(t, ok)
+	assert.Equal(t, "v1", string(data.data))
+
+	q.offer("market:1", frame{data: []byte("v2")})
+	q.offer("market:1", frame{data: []byte("v3")})
+	_, ok = q.take(now.Add(50 * time.Millisecond))
+	assert.False(t, ok)
+	assert.Equal(t, 50*time.Millisecond, q.nextDue(now.Add(50*time.Millisecond)))
+
+	data, ok = q.take(now.Add(100 * time.Millisecond))
+	require.True(t, ok)
+	assert.Equal(t, "v3", string(data.data))
+}
+
+// TestConflator_KeyCap tests that the number of pending keys is bounded
+func TestConflator_KeyCap(t *testing.T) {
+	q := newConflator(0)
+	for i := 0; i < maxConflationKeys; i++ {
+		_, ok := q.offer(uuid.New().String(), frame{data: []byte("x")})
+		require.True(t, ok)
+	}
+	_, ok := q.offer("one-too-many", frame{data: []byte("x")})
+	assert.False(t, ok)
+}
+
+// TestConflator_SetIntervalClamped tests that client-requested intervals are bounded
+func TestConflator_SetIntervalClamped(t *testing.T) {
+	q := newConflator(0)
+	q.setInterval(time.Hour)
+	assert.Equal(t, maxConflationInterval, q.interval)
+	q.setInterval(-time.Second)
+	assert.Equal(t, time.Duration(0), q.interval)
+}
+
+// TestHub_Broadcast_Conflated tests that keyed messages are conflated per client
+func TestHub_Broadcast_Conflated(t *testing.T) {
+	hub := NewHub(zerolog.Nop())
+	go hub.Run(t.Context())
+
+	userID := uuid.New()
+	c := newLaneClient(hub)
+	c.userID = &userID
+	c.conflated = newConflator(0)
+	require.NoError(t, hub.Register(c))
+	time.Sleep(50 * time.Millisecond)
+
+	for i := 0; i < 10; i++ {
+		hub.Broadcast(&Message{
+			Type:          "odds_update",
+			UserID:        &userID,
+			Payload:       map[string]int{"version": i},
+			Priority:      PriorityLow,
+			ConflationKey: "market:123",
+		})
+	}
+	time.Sleep(100 * time.Millisecond)
+
+	assert.Len(t, c.sendLow, 0)
+	assert.Equal(t, 1, c.conflated.len())
+
+	data, _, ready := c.nextFrame()
+	require.True(t, ready)
+	assert.Contains(t, string(data.data), `"version":9`)
+}
+
+// TestClient_HandleControl_Conflation tests that clients can set their conflation interval
+func TestClient_HandleControl_Conflation(t *testing.T) {
+	c := newLaneClient(NewHub(zerolog.Nop()))
+	c.conflated = newConflator(0)
+
+	c.handleControl(websocket.TextMessage, []byte(`{"op":"conflation","interval_ms":250}`))
+	assert.Equal(t, 250*time.Millisecond, c.conflated.interval)
+
+	c.handleControl(websocket.TextMessage, []byte(`not json`))
+	require.Len(t, c.send, 1)
+	assert.Contains(t, string((<-c.send).data), "invalid_message")
+}
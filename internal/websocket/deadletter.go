@@ -0,0 +1,24 @@
+package websocket
+
+// DeadLetterFunc receives a message that could not be encoded for its
+// recipients, with the encoding error. It runs on the hub goroutine and
+// must not block.
+type DeadLetterFunc func(msg *Message, err error)
+
+// WithDeadLetter hands messages that fail to encode to fn instead of only
+// logging them
+func WithDeadLetter(fn DeadLetterFunc) Option {
+	return func(h *Hub) {
+		h.deadLetter = fn
+	}
+}
+
+// reportFailure passes a message that failed to encode to the dead-letter
+// func, once per delivery however many formats or recipients failed
+func (d *Delivery) reportFailure(err error) {
+	if d.deadLetter == nil || d.reported {
+		return
+	}
+	d.reported = true
+	d.deadLetter(d.msg, err)
+}
@@ -0,0 +1,38 @@
+package websocket
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestHub_DeadLetter tests that a message failing to encode is reported once
+func TestHub_DeadLetter(t *testing.T) {
+	failed := make(chan *Message, 4)
+	hub := NewHub(zerolog.Nop(), WithDeadLetter(func(msg *Message, err error) {
+		assert.Error(t, err)
+		failed <- msg
+	}))
+	go hub.Run(t.Context())
+
+	userID := uuid.New()
+	for i := 0; i < 2; i++ {
+		require.NoError(t, hub.Register(NewClient(hub, nil, &userID, zerolog.Nop())))
+	}
+
+	hub.BroadcastToUser(userID, "bet_settled", func() {})
+	hub.BroadcastToUser(userID, "bet_settled", "ok")
+	require.NoError(t, hub.sync())
+
+	select {
+	case msg := <-failed:
+		assert.Equal(t, "bet_settled", msg.Type)
+	case <-time.After(time.Second):
+		t.Fatal("message was not dead-lettered")
+	}
+	assert.Empty(t, failed, "reported once for both connections")
+}
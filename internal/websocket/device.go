@@ -0,0 +1,238 @@
+package websocket
+
+import (
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Client platforms reported at connect time
+const (
+	PlatformWeb     = "web"
+	PlatformIOS     = "ios"
+	PlatformAndroid = "android"
+	PlatformDesktop = "desktop"
+)
+
+// MessageTypeSessionRevoked tells a connection its session was logged out
+const MessageTypeSessionRevoked = "session_revoked"
+
+// Device describes the app and session behind a connection
+type Device struct {
+	Platform   string `json:"platform,omitempty"`
+	AppVersion string `json:"app_version,omitempty"`
+	DeviceID   string `json:"device_id,omitempty"`
+	SessionID  string `json:"session_id,omitempty"`
+}
+
+// DeviceFromRequest reads the platform, app version and device ID a client
+// reports in its X-Client-* headers or query parameters. The session ID is
+// not taken from the request; it comes from the authenticated token.
+func DeviceFromRequest(r *http.Request) Device {
+	get := func(header, param string) string {
+		if v := r.Header.Get(header); v != "" {
+			return v
+		}
+		return r.URL.Query().Get(param)
+	}
+	return Device{
+		Platform:   strings.ToLower(get("X-Client-Platform", "platform")),
+		AppVersion: get("X-Client-Version", "app_version"),
+		DeviceID:   get("X-Device-ID", "device_id"),
+	}
+}
+
+// DeviceSubscriber is implemented by subscribers that know which device
+// and session they serve, enabling targeted delivery and session kicks
+type DeviceSubscriber interface {
+	Subscriber
+	Device() Device
+	// LastActive is when the user last interacted through the connection
+	LastActive() time.Time
+}
+
+func deviceOf(sub Subscriber) Device {
+	if ds, ok := sub.(DeviceSubscriber); ok {
+		return ds.Device()
+	}
+	return Device{}
+}
+
+func lastActiveOf(sub Subscriber) time.Time {
+	if ds, ok := sub.(DeviceSubscriber); ok {
+		return ds.LastActive()
+	}
+	return time.Time{}
+}
+
+// Target narrows which of the recipient's connections receive a message
+type Target struct {
+	// Platforms limits delivery to connections on these platforms
+	Platforms []string
+	// ExcludeDeviceID and ExcludeSessionID skip the originating device or session
+	ExcludeDeviceID  string
+	ExcludeSessionID string
+	// MostRecentDevice delivers only to the user's most recently active
+	// device; it applies to messages for a single user
+	MostRecentDevice bool
+}
+
+// SendOption adjusts a single broadcast, such as which of the recipient's
+// connections it targets or when it expires
+type SendOption func(*Message)
+
+// OnlyPlatforms delivers only to connections on the given platforms
+func OnlyPlatforms(platforms ...string) SendOption {
+	return func(m *Message) {
+		t := m.target()
+		for _, p := range platforms {
+			t.Platforms = append(t.Platforms, strings.ToLower(p))
+		}
+	}
+}
+
+// ExceptDevice skips connections from the given device, typically the one
+// that triggered the notification
+func ExceptDevice(deviceID string) SendOption {
+	return func(m *Message) {
+		m.target().ExcludeDeviceID = deviceID
+	}
+}
+
+// ExceptSession skips connections of the given session
+func ExceptSession(sessionID string) SendOption {
+	return func(m *Message) {
+		m.target().ExcludeSessionID = sessionID
+	}
+}
+
+// MostRecentDevice delivers only to the user's most recently active device
+func MostRecentDevice() SendOption {
+	return func(m *Message) {
+		m.target().MostRecentDevice = true
+	}
+}
+
+// target returns the message's target, creating it on first use
+func (m *Message) target() *Target {
+	if m.Target == nil {
+		m.Target = &Target{}
+	}
+	return m.Target
+}
+
+// applySendOptions applies opts to msg and returns it
+func applySendOptions(msg *Message, opts []SendOption) *Message {
+	for _, opt := range opts {
+		opt(msg)
+	}
+	return msg
+}
+
+// matches reports whether a connection passes the target's filters; a nil
+// target matches every connection
+func (t *Target) matches(sub Subscriber) bool {
+	if t == nil {
+		return true
+	}
+	device := deviceOf(sub)
+	if len(t.Platforms) > 0 && !slices.Contains(t.Platforms, device.Platform) {
+		return false
+	}
+	if t.ExcludeDeviceID != "" && device.DeviceID == t.ExcludeDeviceID {
+		return false
+	}
+	if t.ExcludeSessionID != "" && device.SessionID == t.ExcludeSessionID {
+		return false
+	}
+	return true
+}
+
+// selectUserConns returns the connections of one user that should receive
+// a message with the given target
+func (t *Target) selectUserConns(conns []Subscriber) []Subscriber {
+	if t == nil {
+		return conns
+	}
+
+	var selected []Subscriber
+	var latest Subscriber
+	for _, sub := range conns {
+		if !t.matches(sub) {
+			continue
+		}
+		selected = append(selected, sub)
+		if latest == nil || lastActiveOf(sub).After(lastActiveOf(latest)) {
+			latest = sub
+		}
+	}
+	if !t.MostRecentDevice || latest == nil {
+		return selected
+	}
+
+	// Every connection of the most recent device, such as two tabs of one browser
+	deviceID := deviceOf(latest).DeviceID
+	if deviceID == "" {
+		return []Subscriber{latest}
+	}
+	var device []Subscriber
+	for _, sub := range selected {
+		if deviceOf(sub).DeviceID == deviceID {
+			device = append(device, sub)
+		}
+	}
+	return device
+}
+
+// kickRequest logs out every connection of one of a user's sessions
+type kickRequest struct {
+	userID    uuid.UUID
+	sessionID string
+	reason    string
+	reply     chan int
+}
+
+// KickSession disconnects every connection of the user's session, for "log
+// out this device", after sending each a session_revoked message. It
+// returns the number of connections closed.
+func (h *Hub) KickSession(userID uuid.UUID, sessionID, reason string) (int, error) {
+	if sessionID == "" {
+		return 0, nil
+	}
+	reply := make(chan int, 1)
+	select {
+	case h.kicks <- kickRequest{userID: userID, sessionID: sessionID, reason: reason, reply: reply}:
+		return <-reply, nil
+	case <-h.done:
+		return 0, ErrHubStopped
+	}
+}
+
+func (h *Hub) handleKick(req kickRequest) {
+	h.mu.RLock()
+	var kicked []Subscriber
+	for _, sub := range h.userConns[req.userID] {
+		if deviceOf(sub).SessionID == req.sessionID {
+			kicked = append(kicked, sub)
+		}
+	}
+	h.mu.RUnlock()
+
+	notice := newDelivery(&Message{
+		Type:     MessageTypeSessionRevoked,
+		UserID:   &req.userID,
+		Payload:  map[string]string{"session_id": req.sessionID, "reason": req.reason},
+		Priority: PriorityHigh,
+	}, nil)
+	for _, sub := range kicked {
+		h.deliver(sub, notice)
+		h.removeSubscriber(sub)
+	}
+	if len(kicked) > 0 {
+		h.logger.Info().Str("user_id", req.userID.String()).Str("session_id", req.sessionID).Int("connections", len(kicked)).Msg("session kicked")
+	}
+	req.reply <- len(kicked)
+}
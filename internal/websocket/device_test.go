@@ -0,0 +1,211 @@
+package websocket
+
+import (
+	"bufio"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/websocket"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newDeviceRecorder(userID *uuid.UUID, platform, deviceID, sessionID string) *Recorder {
+	rec := NewRecorder(userID)
+	rec.SetDevice(Device{Platform: platform, DeviceID: deviceID, SessionID: sessionID})
+	return rec
+}
+
+// TestDeviceFromRequest tests reading device metadata from headers and query parameters
+func TestDeviceFromRequest(t *testing.T) {
+	r := httptest.NewRequest(http.MethodGet, "/ws?platform=iOS&app_version=5.2.0", nil)
+	r.Header.Set("X-Device-ID", "dev-1")
+	assert.Equal(t, Device{Platform: PlatformIOS, AppVersion: "5.2.0", DeviceID: "dev-1"}, DeviceFromRequest(r))
+
+	r = httptest.NewRequest(http.MethodGet, "/ws?platform=ios", nil)
+	r.Header.Set("X-Client-Platform", "android")
+	assert.Equal(t, PlatformAndroid, DeviceFromRequest(r).Platform)
+
+	assert.Equal(t, PlatformWeb, streamDevice(httptest.NewRequest(http.MethodGet, "/sse", nil)).Platform)
+}
+
+// TestHub_BroadcastToUser_Targeting tests platform, device and session targeting
+func TestHub_BroadcastToUser_Targeting(t *testing.T) {
+	hub := NewHub(zerolog.Nop())
+	go hub.Run(t.Context())
+
+	userID := uuid.New()
+	web := newDeviceRecorder(&userID, PlatformWeb, "browser-1", "s1")
+	phone := newDeviceRecorder(&userID, PlatformIOS, "phone-1", "s2")
+	tablet := newDeviceRecorder(&userID, PlatformAndroid, "tablet-1", "s3")
+	for _, rec := range []*Recorder{web, phone, tablet} {
+		require.NoError(t, hub.Register(rec))
+	}
+
+	hub.BroadcastToUser(userID, "web_only", nil, OnlyPlatforms("WEB"))
+	hub.BroadcastToUser(userID, "mobile", nil, OnlyPlatforms(PlatformIOS, PlatformAndroid))
+	hub.BroadcastToUser(userID, "not_origin", nil, ExceptDevice("phone-1"))
+	hub.BroadcastToUser(userID, "other_sessions", nil, ExceptSession("s3"))
+	hub.BroadcastToUser(userID, "all", nil)
+
+	require.True(t, web.WaitFor(4, time.Second))
+	require.True(t, phone.WaitFor(3, time.Second))
+	require.True(t, tablet.WaitFor(3, time.Second))
+	require.NoError(t, hub.Ping(t.Context()))
+
+	assert.Equal(t, []string{"web_only", "not_origin", "other_sessions", "all"}, web.Types())
+	assert.Equal(t, []string{"mobile", "other_sessions", "all"}, phone.Types())
+	assert.Equal(t, []string{"mobile", "not_origin", "all"}, tablet.Types())
+}
+
+// TestHub_BroadcastToUser_MostRecentDevice tests delivery to the most recently active device only
+func TestHub_BroadcastToUser_MostRecentDevice(t *testing.T) {
+	hub := NewHub(zerolog.Nop())
+	go hub.Run(t.Context())
+
+	userID := uuid.New()
+	laptopTab1 := newDeviceRecorder(&userID, PlatformWeb, "laptop", "s1")
+	phone := newDeviceRecorder(&userID, PlatformIOS, "phone", "s2")
+	laptopTab2 := newDeviceRecorder(&userID, PlatformWeb, "laptop", "s1")
+	for _, rec := range []*Recorder{laptopTab1, phone, laptopTab2} {
+		require.NoError(t, hub.Register(rec))
+	}
+
+	time.Sleep(5 * time.Millisecond)
+	phone.Touch()
+	hub.BroadcastToUser(userID, "first", nil, MostRecentDevice())
+
+	time.Sleep(5 * time.Millisecond)
+	laptopTab1.Touch()
+	hub.BroadcastToUser(userID, "second", nil, MostRecentDevice())
+
+	// The most recent device among the matching platforms
+	hub.BroadcastToUser(userID, "third", nil, MostRecentDevice(), OnlyPlatforms(PlatformIOS))
+
+	require.NoError(t, hub.Ping(t.Context()))
+	assert.Equal(t, []string{"first", "third"}, phone.Types())
+	// Both tabs of the laptop are the same device
+	assert.Equal(t, []string{"second"}, laptopTab1.Types())
+	assert.Equal(t, []string{"second"}, laptopTab2.Types())
+}
+
+// TestHub_BroadcastToAll_Targeting tests platform filters on broadcasts to everyone
+func TestHub_BroadcastToAll_Targeting(t *testing.T) {
+	hub := NewHub(zerolog.Nop())
+	go hub.Run(t.Context())
+
+	web := newDeviceRecorder(nil, PlatformWeb, "", "")
+	plain := NewRecorder(nil)
+	require.NoError(t, hub.Register(web))
+	require.NoError(t, hub.Register(plain))
+
+	hub.BroadcastToAll("web_banner", nil, OnlyPlatforms(PlatformWeb))
+	require.True(t, web.WaitFor(1, time.Second))
+	require.NoError(t, hub.Ping(t.Context()))
+	assert.Empty(t, plain.Messages())
+}
+
+// TestHub_KickSession tests that kicking a session notifies and disconnects only its connections
+func TestHub_KickSession(t *testing.T) {
+	hub := NewHub(zerolog.Nop())
+	go hub.Run(t.Context())
+
+	userID := uuid.New()
+	kicked1 := newDeviceRecorder(&userID, PlatformWeb, "laptop", "s1")
+	kicked2 := newDeviceRecorder(&userID, PlatformWeb, "laptop", "s1")
+	kept := newDeviceRecorder(&userID, PlatformIOS, "phone", "s2")
+	for _, rec := range []*Recorder{kicked1, kicked2, kept} {
+		require.NoError(t, hub.Register(rec))
+	}
+
+	n, err := hub.KickSession(userID, "s1", "logged_out")
+	require.NoError(t, err)
+	assert.Equal(t, 2, n)
+
+	for _, rec := range []*Recorder{kicked1, kicked2} {
+		assert.True(t, rec.Closed())
+		require.Len(t, rec.Messages(), 1)
+		msg := rec.Messages()[0]
+		assert.Equal(t, MessageTypeSessionRevoked, msg.Type)
+		assert.Equal(t, map[string]string{"session_id": "s1", "reason": "logged_out"}, msg.Payload)
+	}
+	assert.False(t, kept.Closed())
+	assert.Empty(t, kept.Messages())
+	assert.Equal(t, 1, hub.Stats().Subscribers)
+
+	n, err = hub.KickSession(userID, "unknown", "")
+	require.NoError(t, err)
+	assert.Equal(t, 0, n)
+}
+
+// TestHub_KickSession_WebSocket tests that a kicked WebSocket client receives the notice before the close frame
+func TestHub_KickSession_WebSocket(t *testing.T) {
+	logger := zerolog.Nop()
+	hub := NewHub(logger)
+	go hub.Run(t.Context())
+	userID := uuid.New()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := (&websocket.Upgrader{}).Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		client := NewClient(hub, conn, &userID, logger)
+		client.SetDevice(Device{Platform: PlatformWeb, SessionID: "s1"})
+		if hub.Register(client) != nil {
+			return
+		}
+		go client.WritePump()
+		client.ReadPump()
+	}))
+	defer server.Close()
+
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(server.URL, "http"), nil)
+	require.NoError(t, err)
+	defer conn.Close()
+
+	require.Eventually(t, func() bool { return hub.Stats().Subscribers == 1 }, time.Second, 10*time.Millisecond)
+	n, err := hub.KickSession(userID, "s1", "logged_out")
+	require.NoError(t, err)
+	require.Equal(t, 1, n)
+
+	conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	_, data, err := conn.ReadMessage()
+	require.NoError(t, err)
+	assert.Contains(t, string(data), MessageTypeSessionRevoked)
+
+	_, _, err = conn.ReadMessage()
+	assert.True(t, websocket.IsCloseError(err, websocket.CloseNoStatusReceived), "expected close frame, got %v", err)
+}
+
+// TestServeSSE_Targeting tests that SSE subscribers take part in device targeting
+func TestServeSSE_Targeting(t *testing.T) {
+	hub := NewHub(zerolog.Nop())
+	go hub.Run(t.Context())
+	userID := uuid.New()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ServeSSE(hub, w, r, &userID, zerolog.Nop())
+	}))
+	defer server.Close()
+
+	resp, err := http.Get(server.URL + "?" + url.Values{"device_id": {"browser-9"}}.Encode())
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	require.Eventually(t, func() bool { return hub.Stats().Subscribers == 1 }, time.Second, 10*time.Millisecond)
+
+	// SSE subscribers report the web platform, so a web-only message reaches them
+	hub.BroadcastToUser(userID, "web_only", nil, OnlyPlatforms(PlatformWeb))
+	hub.BroadcastToUser(userID, "not_this_browser", nil, ExceptDevice("browser-9"))
+	hub.BroadcastToUser(userID, "after", nil)
+
+	events := readSSE(t, bufio.NewReader(resp.Body), 2)
+	assert.Contains(t, events[0].data, "web_only")
+	assert.Contains(t, events[1].data, `"after"`)
+}
@@ -0,0 +1,34 @@
+package websocket
+
+import "time"
+
+// Places where an expired message can be dropped, used as metric labels
+const (
+	expiredAtHub    = "hub"    // before fan-out
+	expiredAtReplay = "replay" // when replaying missed messages on reconnect
+	expiredAtWrite  = "write"  // in a client's send lane, before writing
+	expiredAtStream = "stream" // queued for an SSE or long-poll response
+)
+
+// TTL drops the message if it is not delivered within d, for data such as
+// prices and odds that are worse than useless once stale
+func TTL(d time.Duration) SendOption {
+	return ExpiresAt(time.Now().Add(d))
+}
+
+// ExpiresAt drops the message if it is not delivered by t
+func ExpiresAt(t time.Time) SendOption {
+	return func(m *Message) {
+		m.ExpiresAt = t
+	}
+}
+
+// expired reports whether the message's deadline has passed
+func (m *Message) expired(now time.Time) bool {
+	return !m.ExpiresAt.IsZero() && !now.Before(m.ExpiresAt)
+}
+
+// dropExpired counts an expired message of msgType dropped at stage
+func dropExpired(msgType, stage string) {
+	messagesExpired.WithLabelValues(msgType, stage).Inc()
+}
@@ -0,0 +1,81 @@
+package websocket
+
+import (
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestHub_Broadcast_Expired tests that messages past their expiry are not fanned out
+func TestHub_Broadcast_Expired(t *testing.T) {
+	hub := NewHub(zerolog.Nop())
+	go hub.Run(t.Context())
+
+	userID := uuid.New()
+	rec := NewRecorder(&userID)
+	require.NoError(t, hub.Register(rec))
+
+	hub.BroadcastToUser(userID, "odds_suspended", nil, ExpiresAt(time.Now().Add(-time.Second)))
+	hub.BroadcastToAll("price_changed", nil, TTL(-time.Millisecond))
+	hub.BroadcastToUser(userID, "price_changed", nil, TTL(time.Minute), OnlyPlatforms(PlatformWeb))
+	hub.BroadcastToUser(userID, "bet_settled", nil)
+
+	require.True(t, rec.WaitFor(1, time.Second))
+	require.NoError(t, hub.Ping(t.Context()))
+	assert.Equal(t, []string{"bet_settled"}, rec.Types())
+}
+
+// TestHub_Replay_Expired tests that reconnecting clients are not replayed stale messages
+func TestHub_Replay_Expired(t *testing.T) {
+	hub := NewHub(zerolog.Nop(), WithReplay(16, time.Minute))
+	go hub.Run(t.Context())
+	require.NoError(t, hub.Ping(t.Context()))
+
+	userID := uuid.New()
+	cursor := hub.replay.head()
+	hub.BroadcastToUser(userID, "odds_changed", nil, TTL(20*time.Millisecond))
+	hub.BroadcastToUser(userID, "bet_settled", nil)
+	require.NoError(t, hub.Ping(t.Context()))
+	time.Sleep(30 * time.Millisecond)
+
+	rec := NewRecorder(&userID)
+	result, err := hub.attach(rec, cursor)
+	require.NoError(t, err)
+	assert.True(t, result.resumed)
+	assert.Equal(t, []string{"bet_settled"}, rec.Types())
+}
+
+// TestClient_WriteFrame_Expired tests that a frame that expired in a send lane is skipped
+func TestClient_WriteFrame_Expired(t *testing.T) {
+	c := newLaneClient(NewHub(zerolog.Nop()))
+	d := newDelivery(&Message{Type: "price_changed", ExpiresAt: time.Now().Add(-time.Millisecond)}, nil)
+	f, _, err := d.encode(FormatJSON)
+	require.NoError(t, err)
+	assert.Equal(t, "price_changed", f.msgType)
+
+	// The client has no connection, so reaching the write would panic
+	assert.True(t, c.writeFrame(f))
+}
+
+// TestStream_Expired tests that SSE and long-poll responses skip stale events but advance the cursor
+func TestStream_Expired(t *testing.T) {
+	stale := streamEvent{id: "e-1", data: []byte(`{"type":"odds"}`), msgType: "odds", expires: time.Now().Add(-time.Second)}
+	fresh := streamEvent{id: "e-2", data: []byte(`{"type":"bet"}`), msgType: "bet", expires: time.Now().Add(time.Minute)}
+
+	w := httptest.NewRecorder()
+	writeSSEEvent(w, stale)
+	writeSSEEvent(w, fresh)
+	assert.Equal(t, "id: e-1\n\nid: e-2\ndata: {\"type\":\"bet\"}\n\n", w.Body.String())
+
+	var resp pollResponse
+	resp.add(fresh)
+	resp.add(stale)
+	require.Len(t, resp.Events, 1)
+	assert.JSONEq(t, `{"type":"bet"}`, string(resp.Events[0]))
+	assert.Equal(t, "e-1", resp.Cursor)
+}
@@ -0,0 +1,71 @@
+package websocket
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/google/uuid"
+)
+
+// ErrGroupsDisabled is returned by BroadcastToGroup on a hub without WithGroups
+var ErrGroupsDisabled = errors.New("group broadcasts are not configured")
+
+// GroupResolver looks up the members of a named group, such as a betting
+// syndicate, a tournament's participants, a VIP tier or staff
+type GroupResolver interface {
+	Members(ctx context.Context, group string) ([]uuid.UUID, error)
+}
+
+// WithGroups enables BroadcastToGroup, resolving membership through groups
+func WithGroups(groups GroupResolver) Option {
+	return func(h *Hub) {
+		h.groups = groups
+	}
+}
+
+// BroadcastToGroup sends a message to the connections of every member of
+// a group. Membership is resolved when the message is sent, so users added
+// or removed since they connected are included or skipped without
+// reconnecting. It blocks while the broadcast queue is full.
+func (h *Hub) BroadcastToGroup(ctx context.Context, group, msgType string, payload interface{}, opts ...SendOption) error {
+	msg, err := h.groupMessage(ctx, group, msgType, payload, opts)
+	if err != nil || msg == nil {
+		return err
+	}
+	h.publish(msg)
+	return nil
+}
+
+// TryBroadcastToGroup is BroadcastToGroup without blocking: it fails with
+// ErrHubSaturated when the broadcast queue is full
+func (h *Hub) TryBroadcastToGroup(ctx context.Context, group, msgType string, payload interface{}, opts ...SendOption) error {
+	msg, err := h.groupMessage(ctx, group, msgType, payload, opts)
+	if err != nil || msg == nil {
+		return err
+	}
+	return h.tryPublish(msg)
+}
+
+// groupMessage resolves the group's members; it returns a nil message for
+// an empty group
+func (h *Hub) groupMessage(ctx context.Context, group, msgType string, payload interface{}, opts []SendOption) (*Message, error) {
+	if h.groups == nil {
+		return nil, ErrGroupsDisabled
+	}
+	members, err := h.groups.Members(ctx, group)
+	if err != nil {
+		return nil, fmt.Errorf("resolve group %s: %w", group, err)
+	}
+	if len(members) == 0 {
+		return nil, nil
+	}
+
+	return applySendOptions(&Message{
+		Type:       msgType,
+		Group:      group,
+		Payload:    payload,
+		Priority:   h.priority(msgType),
+		recipients: members,
+	}, opts), nil
+}
@@ -0,0 +1,131 @@
+package websocket
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+// testGroups is a mutable GroupResolver
+type testGroups struct {
+	members map[string][]uuid.UUID
+	err     error
+	mu      sync.Mutex
+}
+
+func (g *testGroups) Members(_ context.Context, group string) ([]uuid.UUID, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.members[group], g.err
+}
+
+func (g *testGroups) set(group string, members ...uuid.UUID) {
+	g.mu.Lock()
+	g.members[group] = members
+	g.mu.Unlock()
+}
+
+// TestHub_BroadcastToGroup tests that membership is resolved at send time for connected users
+func TestHub_BroadcastToGroup(t *testing.T) {
+	groups := &testGroups{members: map[string][]uuid.UUID{}}
+	hub := NewHub(zerolog.Nop(), WithGroups(groups))
+	go hub.Run(t.Context())
+
+	alice, bob, carol := uuid.New(), uuid.New(), uuid.New()
+	aliceRec, bobRec, carolRec := NewRecorder(&alice), NewRecorder(&bob), NewRecorder(&carol)
+	for _, rec := range []*Recorder{aliceRec, bobRec, carolRec} {
+		require.NoError(t, hub.Register(rec))
+	}
+
+	groups.set("syndicate:1", alice, bob)
+	require.NoError(t, hub.BroadcastToGroup(t.Context(), "syndicate:1", "syndicate_bet_placed", nil))
+
+	// Bob leaves and Carol joins without reconnecting
+	groups.set("syndicate:1", alice, carol)
+	require.NoError(t, hub.BroadcastToGroup(t.Context(), "syndicate:1", "syndicate_bet_settled", nil))
+
+	require.NoError(t, hub.Ping(t.Context()))
+	assert.Equal(t, []string{"syndicate_bet_placed", "syndicate_bet_settled"}, aliceRec.Types())
+	assert.Equal(t, []string{"syndicate_bet_placed"}, bobRec.Types())
+	assert.Equal(t, []string{"syndicate_bet_settled"}, carolRec.Types())
+
+	msg := aliceRec.Messages()[0]
+	assert.Equal(t, "syndicate:1", msg.Group)
+	assert.Nil(t, msg.UserID)
+
+	// Empty groups send nothing, rather than falling back to everyone
+	require.NoError(t, hub.BroadcastToGroup(t.Context(), "empty", "nobody", nil))
+	require.NoError(t, hub.Ping(t.Context()))
+	assert.Len(t, aliceRec.Messages(), 2)
+}
+
+// TestHub_BroadcastToGroup_Targeting tests send options on group broadcasts
+func TestHub_BroadcastToGroup_Targeting(t *testing.T) {
+	userID := uuid.New()
+	groups := &testGroups{members: map[string][]uuid.UUID{"staff": {userID}}}
+	hub := NewHub(zerolog.Nop(), WithGroups(groups))
+	go hub.Run(t.Context())
+
+	web := newDeviceRecorder(&userID, PlatformWeb, "d1", "s1")
+	phone := newDeviceRecorder(&userID, PlatformIOS, "d2", "s2")
+	require.NoError(t, hub.Register(web))
+	require.NoError(t, hub.Register(phone))
+
+	require.NoError(t, hub.TryBroadcastToGroup(t.Context(), "staff", "shift_change", nil, OnlyPlatforms(PlatformWeb)))
+	require.True(t, web.WaitFor(1, time.Second))
+	assert.Empty(t, phone.Messages())
+}
+
+// TestHub_BroadcastToGroup_Errors tests resolver failures and hubs without groups
+func TestHub_BroadcastToGroup_Errors(t *testing.T) {
+	hub := NewHub(zerolog.Nop())
+	assert.ErrorIs(t, hub.BroadcastToGroup(context.Background(), "vip", "x", nil), ErrGroupsDisabled)
+
+	failing := errors.New("store unavailable")
+	hub = NewHub(zerolog.Nop(), WithGroups(&testGroups{err: failing}))
+	assert.ErrorIs(t, hub.BroadcastToGroup(context.Background(), "vip", "x", nil), failing)
+}
+
+// TestReplayLog_Group tests that group messages are replayed to members only
+func TestReplayLog_Group(t *testing.T) {
+	l := newReplayLog(10, time.Minute)
+	member, outsider := uuid.New(), uuid.New()
+
+	start := l.head()
+	l.append(&Message{Type: "group_msg", Group: "vip", recipients: []uuid.UUID{member}})
+
+	entries, ok := l.since(&member, start)
+	require.True(t, ok)
+	assert.Equal(t, []string{"group_msg"}, replayTypes(entries))
+
+	entries, ok = l.since(&outsider, start)
+	require.True(t, ok)
+	assert.Empty(t, entries)
+}
+
+// TestEncode_Group tests that the group is part of every wire format
+func TestEncode_Group(t *testing.T) {
+	msg := &Message{Type: "x", Group: "tournament:42"}
+
+	data, err := encode(FormatJSON, msg)
+	require.NoError(t, err)
+	assert.Contains(t, string(data), `"group":"tournament:42"`)
+
+	data, err = encode(FormatMsgpack, msg)
+	require.NoError(t, err)
+	var decoded map[string]interface{}
+	require.NoError(t, msgpack.Unmarshal(data, &decoded))
+	assert.Equal(t, "tournament:42", decoded["group"])
+
+	data, err = encode(FormatProto, msg)
+	require.NoError(t, err)
+	assert.Contains(t, string(data), "tournament:42")
+}
@@ -1,128 +1,702 @@
 package websocket
 
 import (
-	"encoding/json"
+	"context"
+	"errors"
 	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/google/uuid"
 	"github.com/rs/zerolog"
 )
 
+var (
+	// ErrHubStopped is returned once the hub's Run loop has exited
+	ErrHubStopped = errors.New("hub stopped")
+	// ErrHubSaturated is returned by the TryBroadcast methods when the
+	// broadcast queue is full
+	ErrHubSaturated = errors.New("hub broadcast queue full")
+)
+
 // Hub maintains active WebSocket connections
 type Hub struct {
-	clients    map[*Client]bool
-	userConns  map[uuid.UUID][]*Client // userID -> connections
-	broadcast  chan *Message
-	register   chan *Client
-	unregister chan *Client
-	logger     zerolog.Logger
-	mu         sync.RWMutex
+	clients            map[Subscriber]bool
+	userConns          map[uuid.UUID][]Subscriber // userID -> connections
+	broadcast          chan *Message
+	register           chan Subscriber
+	unregister         chan Subscriber
+	attaching          chan attachRequest
+	ping               chan chan struct{}
+	subscriptions      chan subscription
+	kicks              chan kickRequest
+	topics             *TopicCache
+	topicSubs          map[string]map[Subscriber]bool // topic -> subscribed clients
+	subTopics          map[Subscriber]map[string]bool // client -> subscribed topics
+	replay             *replayLog
+	sequencer          *Sequencer
+	limiter            *Limiter
+	priority           func(msgType string) Priority
+	weights            *LaneWeights // nil selects strict lane priority
+	conflationInterval time.Duration
+	compression        *CompressionConfig // nil disables compression
+	rpc                *RPCRouter         // nil disables RPC over the connection
+	groups             GroupResolver      // nil disables group broadcasts
+	deadLetter         DeadLetterFunc     // nil only logs messages that fail to encode
+	status             StatusFunc         // nil reports no delivery progress
+	done               chan struct{}      // closed when Run returns
+	delivered          atomic.Uint64
+	dropped            atomic.Uint64
+	logger             zerolog.Logger
+	mu                 sync.RWMutex
+}
+
+// Option configures optional Hub behaviour
+type Option func(*Hub)
+
+// WithLimiter applies inbound frame limits to the hub's clients
+func WithLimiter(limiter *Limiter) Option {
+	return func(h *Hub) {
+		h.limiter = limiter
+	}
+}
+
+// WithPriorityFunc overrides how a message's priority is derived from its type
+func WithPriorityFunc(fn func(msgType string) Priority) Option {
+	return func(h *Hub) {
+		h.priority = fn
+	}
+}
+
+// WithWeightedLanes makes clients drain their send lanes in weighted
+// round-robin order instead of strict priority order
+func WithWeightedLanes(weights LaneWeights) Option {
+	return func(h *Hub) {
+		weights.High = max(weights.High, 1)
+		weights.Normal = max(weights.Normal, 1)
+		weights.Low = max(weights.Low, 1)
+		h.weights = &weights
+	}
+}
+
+// WithConflationInterval sets the default minimum interval between two
+// conflated updates for the same key to a client
+func WithConflationInterval(interval time.Duration) Option {
+	return func(h *Hub) {
+		h.conflationInterval = interval
+	}
+}
+
+// WithSnapshotFunc lets the hub fetch a fresh topic snapshot when it
+// detects a version gap in a delta stream
+func WithSnapshotFunc(fn SnapshotFunc) Option {
+	return func(h *Hub) {
+		h.topics = NewTopicCache(fn)
+	}
+}
+
+// WithCompression compresses qualifying frames for clients that negotiated
+// permessage-deflate
+func WithCompression(cfg CompressionConfig) Option {
+	return func(h *Hub) {
+		h.compression = &cfg
+	}
+}
+
+// WithReplay sets how many recent messages are retained per user, and for
+// how long, for SSE and long-poll clients resuming after a disconnect
+func WithReplay(size int, maxAge time.Duration) Option {
+	return func(h *Hub) {
+		h.replay = newReplayLog(size, maxAge)
+	}
+}
+
+// WithRPC lets clients call the router's methods over their connection. The
+// built-in "subscriptions.list" method is added unless the router has one.
+func WithRPC(router *RPCRouter) Option {
+	return func(h *Hub) {
+		if _, ok := router.lookup("subscriptions.list"); !ok {
+			router.Handle("subscriptions.list", h.subscriptionsList, RPCAllowAnonymous())
+		}
+		h.rpc = router
+	}
+}
+
+// subscription is a client's request to join or leave a topic stream
+type subscription struct {
+	subscriber  Subscriber
+	topic       string
+	unsubscribe bool
+}
+
+// attachRequest registers a subscriber and replays what it missed since
+// lastEventID in one step on the hub goroutine
+type attachRequest struct {
+	subscriber  Subscriber
+	lastEventID string
+	reply       chan attachResult
+}
+
+// attachResult reports where an attached subscriber's stream starts
+type attachResult struct {
+	head    string // event ID of the newest message at attach time
+	resumed bool   // whether lastEventID could be resumed from without a gap
 }
 
+// maxTopicsPerClient bounds the topics a single connection may follow
+const maxTopicsPerClient = 100
+
 // Message represents a WebSocket message
 type Message struct {
-	Type    string      `json:"type"`
-	UserID  *uuid.UUID  `json:"user_id,omitempty"`
-	Payload interface{} `json:"payload"`
+	// ID is the notification the message carries, if any; see NotificationID
+	ID       string      `json:"id,omitempty"`
+	Type     string      `json:"type"`
+	UserID   *uuid.UUID  `json:"user_id,omitempty"`
+	Payload  interface{} `json:"payload"`
+	Priority Priority    `json:"-"`
+	// ConflationKey (e.g. "market:123") lets a newer message replace an
+	// undelivered older one with the same key
+	ConflationKey string `json:"-"`
+	// Topic and Version identify snapshot and delta messages of a topic stream
+	Topic   string `json:"topic,omitempty"`
+	Version uint64 `json:"version,omitempty"`
+	// Group names the audience of a BroadcastToGroup message
+	Group string `json:"group,omitempty"`
+	// Target narrows delivery to some of the recipient's connections
+	Target *Target `json:"-"`
+	// ExpiresAt, if set, is when the message becomes stale; it is dropped
+	// rather than delivered late
+	ExpiresAt time.Time `json:"-"`
+	// OrderingKey (e.g. "order:123") names a stream whose messages are
+	// delivered in Sequence order; see Ordered
+	OrderingKey string `json:"ordering_key,omitempty"`
+	Sequence    uint64 `json:"seq,omitempty"`
+
+	recipients []uuid.UUID // group members resolved at send time
 }
 
 // NewHub creates a new WebSocket hub
-func NewHub(logger zerolog.Logger) *Hub {
-	return &Hub{
-		clients:    make(map[*Client]bool),
-		userConns:  make(map[uuid.UUID][]*Client),
-		broadcast:  make(chan *Message, 256),
-		register:   make(chan *Client),
-		unregister: make(chan *Client),
-		logger:     logger.With().Str("component", "websocket_hub").Logger(),
+func NewHub(logger zerolog.Logger, opts ...Option) *Hub {
+	h := &Hub{
+		clients:       make(map[Subscriber]bool),
+		userConns:     make(map[uuid.UUID][]Subscriber),
+		broadcast:     make(chan *Message, 256),
+		register:      make(chan Subscriber),
+		unregister:    make(chan Subscriber),
+		attaching:     make(chan attachRequest),
+		ping:          make(chan chan struct{}),
+		topics:        NewTopicCache(nil),
+		topicSubs:     make(map[string]map[Subscriber]bool),
+		subTopics:     make(map[Subscriber]map[string]bool),
+		subscriptions: make(chan subscription),
+		kicks:         make(chan kickRequest),
+		replay:        newReplayLog(defaultReplaySize, defaultReplayMaxAge),
+		sequencer:     NewSequencer(defaultOrderingHold),
+		priority:      DefaultPriority,
+		done:          make(chan struct{}),
+		logger:        logger.With().Str("component", "websocket_hub").Logger(),
 	}
+	for _, opt := range opts {
+		opt(h)
+	}
+	return h
 }
 
-// Run starts the hub
-func (h *Hub) Run() {
+// Run processes registrations and broadcasts until ctx is cancelled. On
+// return every subscriber is closed, and further calls to the hub fail
+// with ErrHubStopped or are dropped. Run must be called exactly once.
+func (h *Hub) Run(ctx context.Context) {
+	defer h.stop()
+
+	// Checks often enough that a held message waits little beyond the hold
+	ordering := time.NewTicker(h.sequencer.hold / 4)
+	defer ordering.Stop()
+
 	for {
 		select {
-		case client := <-h.register:
-			h.mu.Lock()
-			h.clients[client] = true
-			if client.userID != nil {
-				h.userConns[*client.userID] = append(h.userConns[*client.userID], client)
+		case <-ctx.Done():
+			return
+
+		case sub := <-h.register:
+			h.addSubscriber(sub)
+
+		case sub := <-h.unregister:
+			h.removeSubscriber(sub)
+
+		case req := <-h.attaching:
+			h.handleAttach(req)
+
+		case message := <-h.broadcast:
+			h.broadcastMessage(message)
+
+		case now := <-ordering.C:
+			for _, message := range h.sequencer.Flush(now) {
+				h.fanOut(message)
 			}
-			h.mu.Unlock()
-			h.logger.Info().Str("client_id", client.id).Msg("client registered")
-
-		case client := <-h.unregister:
-			h.mu.Lock()
-			if _, ok := h.clients[client]; ok {
-				delete(h.clients, client)
-				close(client.send)
-
-				if client.userID != nil {
-					conns := h.userConns[*client.userID]
-					for i, c := range conns {
-						if c == client {
-							h.userConns[*client.userID] = append(conns[:i], conns[i+1:]...)
-							break
-						}
-					}
+
+		case sub := <-h.subscriptions:
+			h.handleSubscription(sub)
+
+		case req := <-h.kicks:
+			h.handleKick(req)
+
+		case reply := <-h.ping:
+			close(reply)
+		}
+	}
+}
+
+// stop closes the remaining subscribers once the Run loop has exited
+func (h *Hub) stop() {
+	h.mu.Lock()
+	for sub := range h.clients {
+		sub.Close()
+	}
+	count := len(h.clients)
+	h.clients = make(map[Subscriber]bool)
+	h.userConns = make(map[uuid.UUID][]Subscriber)
+	h.topicSubs = make(map[string]map[Subscriber]bool)
+	h.subTopics = make(map[Subscriber]map[string]bool)
+	h.mu.Unlock()
+
+	close(h.done)
+	h.logger.Info().Int("clients", count).Msg("hub stopped")
+}
+
+func (h *Hub) addSubscriber(sub Subscriber) {
+	h.mu.Lock()
+	h.clients[sub] = true
+	if userID := sub.UserID(); userID != nil {
+		h.userConns[*userID] = append(h.userConns[*userID], sub)
+	}
+	h.mu.Unlock()
+	h.logger.Info().Str("client_id", sub.ID()).Msg("client registered")
+}
+
+func (h *Hub) removeSubscriber(sub Subscriber) {
+	h.mu.Lock()
+	if _, ok := h.clients[sub]; ok {
+		delete(h.clients, sub)
+		sub.Close()
+
+		if userID := sub.UserID(); userID != nil {
+			conns := h.userConns[*userID]
+			for i, c := range conns {
+				if c == sub {
+					h.userConns[*userID] = append(conns[:i], conns[i+1:]...)
+					break
 				}
 			}
-			h.mu.Unlock()
-			h.logger.Info().Str("client_id", client.id).Msg("client unregistered")
+		}
 
-		case message := <-h.broadcast:
-			h.broadcastMessage(message)
+		for topic := range h.subTopics[sub] {
+			h.removeTopicSub(sub, topic)
 		}
 	}
+	h.mu.Unlock()
+	h.logger.Info().Str("client_id", sub.ID()).Msg("client unregistered")
 }
 
-// BroadcastToUser sends a message to all connections of a specific user
-func (h *Hub) BroadcastToUser(userID uuid.UUID, msgType string, payload interface{}) {
-	msg := &Message{
-		Type:    msgType,
-		UserID:  &userID,
-		Payload: payload,
+// attach registers sub and, if lastEventID is set, replays the messages it missed
+func (h *Hub) attach(sub Subscriber, lastEventID string) (attachResult, error) {
+	reply := make(chan attachResult, 1)
+	select {
+	case h.attaching <- attachRequest{subscriber: sub, lastEventID: lastEventID, reply: reply}:
+		return <-reply, nil
+	case <-h.done:
+		return attachResult{}, ErrHubStopped
 	}
-	h.broadcast <- msg
 }
 
-// BroadcastToAll sends a message to all connected clients
-func (h *Hub) BroadcastToAll(msgType string, payload interface{}) {
-	msg := &Message{
-		Type:    msgType,
-		Payload: payload,
+func (h *Hub) handleAttach(req attachRequest) {
+	h.addSubscriber(req.subscriber)
+
+	result := attachResult{head: h.replay.head(), resumed: true}
+	if req.lastEventID != "" {
+		entries, ok := h.replay.since(req.subscriber.UserID(), req.lastEventID)
+		result.resumed = ok
+		now := time.Now()
+		for _, entry := range entries {
+			if !entry.msg.Target.matches(req.subscriber) {
+				continue
+			}
+			if entry.msg.expired(now) {
+				dropExpired(entry.msg.Type, expiredAtReplay)
+				continue
+			}
+			enc := newDelivery(entry.msg, h.compression)
+			enc.eventID = h.replay.eventID(entry.seq)
+			h.deliver(req.subscriber, enc)
+		}
 	}
-	h.broadcast <- msg
+	req.reply <- result
 }
 
-func (h *Hub) broadcastMessage(message *Message) {
-	data, err := json.Marshal(message)
+// Register adds a subscriber to the hub. It returns once the subscriber
+// receives broadcasts and fails with ErrHubStopped once Run has returned.
+func (h *Hub) Register(sub Subscriber) error {
+	select {
+	case h.register <- sub:
+		return h.sync()
+	case <-h.done:
+		return ErrHubStopped
+	}
+}
+
+// Unregister removes a subscriber from the hub and closes it before
+// returning. Unregistering a subscriber that is not registered, or after Run
+// has returned, is a no-op.
+func (h *Hub) Unregister(sub Subscriber) {
+	select {
+	case h.unregister <- sub:
+		h.sync()
+	case <-h.done:
+	}
+}
+
+// sync waits until the Run loop has finished handling earlier requests
+func (h *Hub) sync() error {
+	reply := make(chan struct{})
+	select {
+	case h.ping <- reply:
+		<-reply
+		return nil
+	case <-h.done:
+		return ErrHubStopped
+	}
+}
+
+// Stats is a point-in-time snapshot of the hub's state
+type Stats struct {
+	Subscribers       int    `json:"subscribers"`
+	Users             int    `json:"users"`
+	Topics            int    `json:"topics"`
+	BroadcastQueue    int    `json:"broadcast_queue"`
+	BroadcastCapacity int    `json:"broadcast_capacity"`
+	Delivered         uint64 `json:"delivered"`
+	Dropped           uint64 `json:"dropped"`
+	Running           bool   `json:"running"`
+}
+
+// Stats returns a snapshot of the hub's subscribers, queue depth and
+// delivery counters
+func (h *Hub) Stats() Stats {
+	h.mu.RLock()
+	stats := Stats{
+		Subscribers: len(h.clients),
+		Topics:      len(h.topicSubs),
+	}
+	for _, conns := range h.userConns {
+		if len(conns) > 0 {
+			stats.Users++
+		}
+	}
+	h.mu.RUnlock()
+
+	stats.BroadcastQueue = len(h.broadcast)
+	stats.BroadcastCapacity = cap(h.broadcast)
+	stats.Delivered = h.delivered.Load()
+	stats.Dropped = h.dropped.Load()
+	select {
+	case <-h.done:
+	default:
+		stats.Running = true
+	}
+	return stats
+}
+
+// Ping round-trips a heartbeat through the Run loop, failing if the loop
+// does not answer before ctx is done
+func (h *Hub) Ping(ctx context.Context) error {
+	reply := make(chan struct{})
+	select {
+	case h.ping <- reply:
+	case <-h.done:
+		return ErrHubStopped
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+
+	select {
+	case <-reply:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// BroadcastToUser sends a message to all connections of a specific user,
+// or those selected by opts. It blocks while the broadcast queue is full;
+// see TryBroadcastToUser.
+func (h *Hub) BroadcastToUser(userID uuid.UUID, msgType string, payload interface{}, opts ...SendOption) {
+	h.publish(h.userMessage(userID, msgType, payload, opts))
+}
+
+// BroadcastToAll sends a message to all connected clients, or those
+// selected by opts. It blocks while the broadcast queue is full; see
+// TryBroadcastToAll.
+func (h *Hub) BroadcastToAll(msgType string, payload interface{}, opts ...SendOption) {
+	h.publish(h.allMessage(msgType, payload, opts))
+}
+
+// Broadcast sends a prepared message, keeping its priority and conflation key
+func (h *Hub) Broadcast(msg *Message) {
+	h.publish(msg)
+}
+
+// TryBroadcastToUser is BroadcastToUser without blocking: it fails with
+// ErrHubSaturated when the broadcast queue is full
+func (h *Hub) TryBroadcastToUser(userID uuid.UUID, msgType string, payload interface{}, opts ...SendOption) error {
+	return h.tryPublish(h.userMessage(userID, msgType, payload, opts))
+}
+
+// TryBroadcastToAll is BroadcastToAll without blocking: it fails with
+// ErrHubSaturated when the broadcast queue is full
+func (h *Hub) TryBroadcastToAll(msgType string, payload interface{}, opts ...SendOption) error {
+	return h.tryPublish(h.allMessage(msgType, payload, opts))
+}
+
+// TryBroadcast is Broadcast without blocking: it fails with
+// ErrHubSaturated when the broadcast queue is full
+func (h *Hub) TryBroadcast(msg *Message) error {
+	return h.tryPublish(msg)
+}
+
+// PublishSnapshot replaces the cached state of a topic and streams it to subscribers
+func (h *Hub) PublishSnapshot(topic string, version uint64, payload interface{}) {
+	h.publish(&Message{
+		Type:     MessageTypeSnapshot,
+		Topic:    topic,
+		Version:  version,
+		Payload:  payload,
+		Priority: PriorityLow,
+	})
+}
+
+// PublishDelta streams an incremental update of a topic; version must be
+// exactly one past the previous snapshot or delta, otherwise the topic is
+// re-snapshotted
+func (h *Hub) PublishDelta(topic string, version uint64, payload interface{}) {
+	h.publish(&Message{
+		Type:     MessageTypeDelta,
+		Topic:    topic,
+		Version:  version,
+		Payload:  payload,
+		Priority: PriorityLow,
+	})
+}
+
+func (h *Hub) userMessage(userID uuid.UUID, msgType string, payload interface{}, opts []SendOption) *Message {
+	return applySendOptions(&Message{
+		Type:     msgType,
+		UserID:   &userID,
+		Payload:  payload,
+		Priority: h.priority(msgType),
+	}, opts)
+}
+
+func (h *Hub) allMessage(msgType string, payload interface{}, opts []SendOption) *Message {
+	return applySendOptions(&Message{
+		Type:     msgType,
+		Payload:  payload,
+		Priority: h.priority(msgType),
+	}, opts)
+}
+
+// publish queues a message for the Run loop, dropping it once the hub has stopped
+func (h *Hub) publish(msg *Message) {
+	select {
+	case h.broadcast <- msg:
+	case <-h.done:
+		broadcastsRejected.WithLabelValues("stopped").Inc()
+	}
+}
+
+func (h *Hub) tryPublish(msg *Message) error {
+	select {
+	case <-h.done:
+		broadcastsRejected.WithLabelValues("stopped").Inc()
+		return ErrHubStopped
+	default:
+	}
+
+	select {
+	case h.broadcast <- msg:
+		return nil
+	default:
+		broadcastsRejected.WithLabelValues("saturated").Inc()
+		return ErrHubSaturated
+	}
+}
+
+// Subscribe asks the hub to stream a topic to the client, starting with the cached snapshot
+func (h *Hub) Subscribe(sub Subscriber, topic string) {
+	select {
+	case h.subscriptions <- subscription{subscriber: sub, topic: topic}:
+	case <-h.done:
+	}
+}
+
+// Unsubscribe stops streaming a topic to the client
+func (h *Hub) Unsubscribe(sub Subscriber, topic string) {
+	select {
+	case h.subscriptions <- subscription{subscriber: sub, topic: topic, unsubscribe: true}:
+	case <-h.done:
+	}
+}
+
+func (h *Hub) handleSubscription(req subscription) {
+	sub := req.subscriber
+
+	h.mu.Lock()
+	if _, ok := h.clients[sub]; !ok {
+		h.mu.Unlock()
+		return
+	}
+	if req.unsubscribe {
+		h.removeTopicSub(sub, req.topic)
+		h.mu.Unlock()
+		return
+	}
+	topics := h.subTopics[sub]
+	if !topics[req.topic] && len(topics) >= maxTopicsPerClient {
+		h.mu.Unlock()
+		h.deliver(sub, newDelivery(errorMessage("subscribe", "too_many_topics", "topic subscription limit reached"), nil))
+		return
+	}
+	if topics == nil {
+		topics = make(map[string]bool)
+		h.subTopics[sub] = topics
+	}
+	topics[req.topic] = true
+	if h.topicSubs[req.topic] == nil {
+		h.topicSubs[req.topic] = make(map[Subscriber]bool)
+	}
+	h.topicSubs[req.topic][sub] = true
+	h.mu.Unlock()
+
+	// Runs on the hub goroutine, so no delta can slip in between the snapshot and its deltas
+	for _, msg := range h.topics.view(req.topic) {
+		h.deliver(sub, newDelivery(msg, h.compression))
+	}
+}
+
+// removeTopicSub must be called with h.mu held
+func (h *Hub) removeTopicSub(sub Subscriber, topic string) {
+	if topics := h.subTopics[sub]; topics != nil {
+		delete(topics, topic)
+		if len(topics) == 0 {
+			delete(h.subTopics, sub)
+		}
+	}
+	if subs := h.topicSubs[topic]; subs != nil {
+		delete(subs, sub)
+		if len(subs) == 0 {
+			delete(h.topicSubs, topic)
+		}
+	}
+}
+
+func (h *Hub) publishTopic(message *Message) {
+	forward, refresh := h.topics.apply(message)
+	if refresh {
+		go h.refreshTopic(message.Topic)
+	}
+
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	for _, msg := range forward {
+		enc := newDelivery(msg, h.compression)
+		for client := range h.topicSubs[msg.Topic] {
+			h.deliver(client, enc)
+		}
+	}
+}
+
+// refreshTopic fetches a fresh snapshot after a version gap
+func (h *Hub) refreshTopic(topic string) {
+	version, payload, err := h.topics.fetch(topic)
 	if err != nil {
-		h.logger.Error().Err(err).Msg("failed to marshal message")
+		h.logger.Error().Err(err).Str("topic", topic).Msg("failed to fetch topic snapshot")
+		h.topics.refreshFailed(topic)
 		return
 	}
+	h.PublishSnapshot(topic, version, payload)
+}
+
+func (h *Hub) broadcastMessage(message *Message) {
+	if message.Topic != "" {
+		if message.expired(time.Now()) {
+			dropExpired(message.Type, expiredAtHub)
+			return
+		}
+		h.publishTopic(message)
+		return
+	}
+	if message.OrderingKey != "" {
+		// None is conflated away; the sequencer keeps every message of a key
+		// on one send lane, so a client's lanes cannot reorder them
+		message.ConflationKey = ""
+	}
+	for _, msg := range h.sequencer.Offer(message, time.Now()) {
+		h.fanOut(msg)
+	}
+}
+
+// fanOut delivers a sequenced message to its recipients
+func (h *Hub) fanOut(message *Message) {
+	// Checked after sequencing, so an expired message still fills its gap
+	if message.expired(time.Now()) {
+		dropExpired(message.Type, expiredAtHub)
+		h.reportStatus(message.ID, message.UserID, StatusFailed, "expired")
+		return
+	}
+
+	// Encoded lazily, once per wire format in use by the recipients
+	enc := newDelivery(message, h.compression)
+	enc.eventID = h.replay.append(message)
+	enc.deadLetter = h.deadLetter
 
 	h.mu.RLock()
 	defer h.mu.RUnlock()
 
-	if message.UserID != nil {
+	if message.recipients != nil {
+		// Send to the connections of every group member
+		for _, userID := range message.recipients {
+			for _, client := range message.Target.selectUserConns(h.userConns[userID]) {
+				h.deliver(client, enc)
+			}
+		}
+	} else if message.UserID != nil {
 		// Send to specific user's connections
-		for _, client := range h.userConns[*message.UserID] {
-			select {
-			case client.send <- data:
-			default:
-				// Client buffer full, skip
-				h.logger.Warn().Str("client_id", client.id).Msg("client buffer full")
+		queued := 0
+		for _, client := range message.Target.selectUserConns(h.userConns[*message.UserID]) {
+			if h.deliver(client, enc) {
+				queued++
 			}
 		}
+		if queued == 0 {
+			h.reportStatus(message.ID, message.UserID, StatusFailed, "no live connection took the message")
+		}
 	} else {
 		// Broadcast to all
 		for client := range h.clients {
-			select {
-			case client.send <- data:
-			default:
-				h.logger.Warn().Str("client_id", client.id).Msg("client buffer full")
+			if message.Target.matches(client) {
+				h.deliver(client, enc)
 			}
 		}
 	}
 }
+
+// deliver queues a message for a subscriber, logging when it is dropped
+func (h *Hub) deliver(sub Subscriber, enc *Delivery) bool {
+	if sub.Enqueue(enc) {
+		h.delivered.Add(1)
+		return true
+	}
+	// Client buffer full, skip
+	h.dropped.Add(1)
+	h.logger.Warn().Str("client_id", sub.ID()).Str("priority", enc.msg.Priority.String()).Msg("client buffer full")
+	return false
+}
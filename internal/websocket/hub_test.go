@@ -1,6 +1,7 @@
 package websocket
 
 import (
+	"context"
 	"encoding/json"
 	"sync"
 	"testing"
@@ -23,6 +24,9 @@ func TestNewHub(t *testing.T) {
 	assert.NotNil(t, hub.broadcast)
 	assert.NotNil(t, hub.register)
 	assert.NotNil(t, hub.unregister)
+	assert.NotNil(t, hub.ping)
+	assert.NotNil(t, hub.topics)
+	assert.NotNil(t, hub.subscriptions)
 	assert.Equal(t, 256, cap(hub.broadcast))
 }
 
@@ -32,33 +36,21 @@ func TestHub_RegisterClient(t *testing.T) {
 	hub := NewHub(logger)
 
 	// Start hub in goroutine
-	go hub.Run()
+	go hub.Run(t.Context())
 
-	// Give hub time to start
-	time.Sleep(50 * time.Millisecond)
-
-	// Create a mock client
+	// Register a recording subscriber in place of a connection
 	userID := uuid.New()
-	client := &Client{
-		id:     uuid.New().String(),
-		userID: &userID,
-		hub:    hub,
-		conn:   nil, // Mock connection not needed for this test
-		send:   make(chan []byte, 256),
-		logger: logger,
-	}
-
-	// Register client
-	hub.register <- client
+	sub := NewRecorder(&userID)
+	require.NoError(t, hub.Register(sub))
 
 	// Wait a bit for registration to complete
 	time.Sleep(100 * time.Millisecond)
 
-	// Check client is registered
+	// Check subscriber is registered
 	hub.mu.RLock()
-	assert.True(t, hub.clients[client])
+	assert.True(t, hub.clients[sub])
 	assert.Len(t, hub.userConns[userID], 1)
-	assert.Equal(t, client, hub.userConns[userID][0])
+	assert.Equal(t, Subscriber(sub), hub.userConns[userID][0])
 	hub.mu.RUnlock()
 }
 
@@ -68,40 +60,49 @@ func TestHub_UnregisterClient(t *testing.T) {
 	hub := NewHub(logger)
 
 	// Start hub in goroutine
-	go hub.Run()
+	go hub.Run(t.Context())
 
-	// Give hub time to start
-	time.Sleep(50 * time.Millisecond)
-
-	// Create and register a mock client
 	userID := uuid.New()
-	client := &Client{
-		id:     uuid.New().String(),
-		userID: &userID,
-		hub:    hub,
-		conn:   nil,
-		send:   make(chan []byte, 256),
-		logger: logger,
-	}
+	sub := NewRecorder(&userID)
 
-	hub.register <- client
+	require.NoError(t, hub.Register(sub))
 	time.Sleep(100 * time.Millisecond)
 
-	// Verify client is registered
+	// Verify subscriber is registered
 	hub.mu.RLock()
-	assert.True(t, hub.clients[client])
+	assert.True(t, hub.clients[sub])
 	hub.mu.RUnlock()
 
-	// Unregister client
-	hub.unregister <- client
+	// Unregister subscriber
+	hub.Unregister(sub)
 	time.Sleep(100 * time.Millisecond)
 
-	// Verify client is unregistered
+	// Verify subscriber is unregistered and closed
 	hub.mu.RLock()
-	_, exists := hub.clients[client]
+	_, exists := hub.clients[sub]
 	assert.False(t, exists)
 	assert.Len(t, hub.userConns[userID], 0)
 	hub.mu.RUnlock()
+	assert.True(t, sub.Closed())
+}
+
+// TestHub_UnregisterClient_Connection tests that unregistering a WebSocket client stops its write pump
+func TestHub_UnregisterClient_Connection(t *testing.T) {
+	hub := NewHub(zerolog.Nop())
+	go hub.Run(t.Context())
+
+	client := NewClient(hub, nil, nil, zerolog.Nop())
+	require.NoError(t, hub.Register(client))
+	hub.Unregister(client)
+
+	select {
+	case <-client.done:
+	default:
+		t.Fatal("client not closed on unregister")
+	}
+
+	// Replies queued after unregistration must not panic
+	assert.True(t, client.sendMessage(&Message{Type: "late"}))
 }
 
 // TestHub_BroadcastToUser tests broadcasting to a specific user
@@ -110,68 +111,30 @@ func TestHub_BroadcastToUser(t *testing.T) {
 	hub := NewHub(logger)
 
 	// Start hub in background
-	go hub.Run()
-	defer func() {
-		// Note: In production, we'd need proper cleanup, but for testing this is acceptable
-		time.Sleep(100 * time.Millisecond)
-	}()
+	go hub.Run(t.Context())
 
 	userID := uuid.New()
 
-	// Create two clients for the same user
-	client1 := &Client{
-		id:     uuid.New().String(),
-		userID: &userID,
-		hub:    hub,
-		conn:   nil,
-		send:   make(chan []byte, 256),
-		logger: logger,
-	}
-
-	client2 := &Client{
-		id:     uuid.New().String(),
-		userID: &userID,
-		hub:    hub,
-		conn:   nil,
-		send:   make(chan []byte, 256),
-		logger: logger,
-	}
+	// Create two subscribers for the same user
+	sub1 := NewRecorder(&userID)
+	sub2 := NewRecorder(&userID)
 
-	// Register clients
-	hub.register <- client1
-	hub.register <- client2
-	time.Sleep(100 * time.Millisecond)
+	// Register subscribers
+	require.NoError(t, hub.Register(sub1))
+	require.NoError(t, hub.Register(sub2))
 
 	// Broadcast message to user
 	testPayload := map[string]string{"test": "data"}
 	hub.BroadcastToUser(userID, "test_message", testPayload)
 
-	// Wait for message to be processed
-	time.Sleep(100 * time.Millisecond)
-
-	// Both clients should receive the message
-	select {
-	case msg1 := <-client1.send:
-		var message Message
-		err := json.Unmarshal(msg1, &message)
-		require.NoError(t, err)
+	// Both subscribers should receive the message
+	for i, sub := range []*Recorder{sub1, sub2} {
+		require.True(t, sub.WaitFor(1, time.Second), "timeout waiting for message on subscriber %d", i)
+		message := sub.Messages()[0]
 		assert.Equal(t, "test_message", message.Type)
-		assert.NotNil(t, message.UserID)
+		require.NotNil(t, message.UserID)
 		assert.Equal(t, userID, *message.UserID)
-	case <-time.After(1 * time.Second):
-		t.Fatal("Timeout waiting for message on client1")
-	}
-
-	select {
-	case msg2 := <-client2.send:
-		var message Message
-		err := json.Unmarshal(msg2, &message)
-		require.NoError(t, err)
-		assert.Equal(t, "test_message", message.Type)
-		assert.NotNil(t, message.UserID)
-		assert.Equal(t, userID, *message.UserID)
-	case <-time.After(1 * time.Second):
-		t.Fatal("Timeout waiting for message on client2")
+		assert.Equal(t, testPayload, message.Payload)
 	}
 }
 
@@ -181,66 +144,29 @@ func TestHub_BroadcastToAll(t *testing.T) {
 	hub := NewHub(logger)
 
 	// Start hub in background
-	go hub.Run()
-	defer func() {
-		time.Sleep(100 * time.Millisecond)
-	}()
+	go hub.Run(t.Context())
 
 	userID1 := uuid.New()
 	userID2 := uuid.New()
 
-	// Create clients with different users
-	client1 := &Client{
-		id:     uuid.New().String(),
-		userID: &userID1,
-		hub:    hub,
-		conn:   nil,
-		send:   make(chan []byte, 256),
-		logger: logger,
-	}
+	// Create subscribers with different users
+	sub1 := NewRecorder(&userID1)
+	sub2 := NewRecorder(&userID2)
 
-	client2 := &Client{
-		id:     uuid.New().String(),
-		userID: &userID2,
-		hub:    hub,
-		conn:   nil,
-		send:   make(chan []byte, 256),
-		logger: logger,
-	}
-
-	// Register clients
-	hub.register <- client1
-	hub.register <- client2
-	time.Sleep(100 * time.Millisecond)
+	// Register subscribers
+	require.NoError(t, hub.Register(sub1))
+	require.NoError(t, hub.Register(sub2))
 
 	// Broadcast message to all
 	testPayload := map[string]string{"announcement": "server maintenance"}
 	hub.BroadcastToAll("broadcast", testPayload)
 
-	// Wait for message to be processed
-	time.Sleep(100 * time.Millisecond)
-
-	// Both clients should receive the message
-	select {
-	case msg1 := <-client1.send:
-		var message Message
-		err := json.Unmarshal(msg1, &message)
-		require.NoError(t, err)
-		assert.Equal(t, "broadcast", message.Type)
-		assert.Nil(t, message.UserID)
-	case <-time.After(1 * time.Second):
-		t.Fatal("Timeout waiting for message on client1")
-	}
-
-	select {
-	case msg2 := <-client2.send:
-		var message Message
-		err := json.Unmarshal(msg2, &message)
-		require.NoError(t, err)
+	// Both subscribers should receive the message
+	for i, sub := range []*Recorder{sub1, sub2} {
+		require.True(t, sub.WaitFor(1, time.Second), "timeout waiting for message on subscriber %d", i)
+		message := sub.Messages()[0]
 		assert.Equal(t, "broadcast", message.Type)
 		assert.Nil(t, message.UserID)
-	case <-time.After(1 * time.Second):
-		t.Fatal("Timeout waiting for message on client2")
 	}
 }
 
@@ -250,10 +176,7 @@ func TestHub_BroadcastToUser_NoClients(t *testing.T) {
 	hub := NewHub(logger)
 
 	// Start hub in background
-	go hub.Run()
-	defer func() {
-		time.Sleep(100 * time.Millisecond)
-	}()
+	go hub.Run(t.Context())
 
 	userID := uuid.New()
 
@@ -261,11 +184,10 @@ func TestHub_BroadcastToUser_NoClients(t *testing.T) {
 	testPayload := map[string]string{"test": "data"}
 	hub.BroadcastToUser(userID, "test_message", testPayload)
 
-	// Wait a bit to ensure no panic
-	time.Sleep(100 * time.Millisecond)
-
-	// Test passes if we reach here without panic
-	assert.True(t, true)
+	// The hub keeps serving afterwards
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	assert.NoError(t, hub.Ping(ctx))
 }
 
 // TestHub_BroadcastMessage_InvalidJSON tests handling of invalid JSON in broadcast
@@ -273,6 +195,9 @@ func TestHub_BroadcastMessage_InvalidJSON(t *testing.T) {
 	logger := zerolog.Nop()
 	hub := NewHub(logger)
 
+	client := NewClient(hub, nil, nil, logger)
+	hub.addSubscriber(client)
+
 	// Create a message with payload that cannot be marshaled
 	// (channels cannot be marshaled to JSON)
 	invalidPayload := make(chan int)
@@ -281,11 +206,9 @@ func TestHub_BroadcastMessage_InvalidJSON(t *testing.T) {
 		Payload: invalidPayload,
 	}
 
-	// This should log an error but not panic
+	// This should log an error but not panic, and nothing is queued
 	hub.broadcastMessage(message)
-
-	// Test passes if we reach here without panic
-	assert.True(t, true)
+	assert.Len(t, client.send, 0)
 }
 
 // TestHub_MultipleClientsPerUser tests multiple connections for same user
@@ -294,48 +217,32 @@ func TestHub_MultipleClientsPerUser(t *testing.T) {
 	hub := NewHub(logger)
 
 	// Start hub in background
-	go hub.Run()
-	defer func() {
-		time.Sleep(100 * time.Millisecond)
-	}()
+	go hub.Run(t.Context())
 
 	userID := uuid.New()
 
-	// Create 3 clients for the same user
-	clients := make([]*Client, 3)
+	// Create 3 subscribers for the same user
+	subs := make([]*Recorder, 3)
 	for i := 0; i < 3; i++ {
-		clients[i] = &Client{
-			id:     uuid.New().String(),
-			userID: &userID,
-			hub:    hub,
-			conn:   nil,
-			send:   make(chan []byte, 256),
-			logger: logger,
-		}
-		hub.register <- clients[i]
+		subs[i] = NewRecorder(&userID)
+		require.NoError(t, hub.Register(subs[i]))
 	}
-	time.Sleep(100 * time.Millisecond)
 
-	// Verify all clients are registered
+	// Verify all subscribers are registered
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	require.NoError(t, hub.Ping(ctx))
 	hub.mu.RLock()
 	assert.Len(t, hub.userConns[userID], 3)
 	hub.mu.RUnlock()
 
 	// Broadcast message
 	hub.BroadcastToUser(userID, "test", map[string]string{"msg": "hello"})
-	time.Sleep(100 * time.Millisecond)
 
-	// All clients should receive the message
-	for i, client := range clients {
-		select {
-		case msg := <-client.send:
-			var message Message
-			err := json.Unmarshal(msg, &message)
-			require.NoError(t, err, "client %d failed to unmarshal", i)
-			assert.Equal(t, "test", message.Type)
-		case <-time.After(1 * time.Second):
-			t.Fatalf("Timeout waiting for message on client %d", i)
-		}
+	// All subscribers should receive the message
+	for i, sub := range subs {
+		require.True(t, sub.WaitFor(1, time.Second), "timeout waiting for message on subscriber %d", i)
+		assert.Equal(t, []string{"test"}, sub.Types())
 	}
 }
 
@@ -345,34 +252,23 @@ func TestHub_ClientBufferFull(t *testing.T) {
 	hub := NewHub(logger)
 
 	// Start hub in background
-	go hub.Run()
-	defer func() {
-		time.Sleep(100 * time.Millisecond)
-	}()
+	go hub.Run(t.Context())
 
 	userID := uuid.New()
+	full := NewRecorder(&userID)
+	full.SetFull(true)
+	other := NewRecorder(&userID)
 
-	// Create client with small buffer
-	client := &Client{
-		id:     uuid.New().String(),
-		userID: &userID,
-		hub:    hub,
-		conn:   nil,
-		send:   make(chan []byte, 2), // Small buffer
-		logger: logger,
-	}
-
-	hub.register <- client
-	time.Sleep(100 * time.Millisecond)
+	require.NoError(t, hub.Register(full))
+	require.NoError(t, hub.Register(other))
 
-	// Fill the buffer by not reading from it
+	// A full subscriber must not hold up delivery to the others
 	for i := 0; i < 5; i++ {
 		hub.BroadcastToUser(userID, "test", map[string]string{"msg": "hello"})
-		time.Sleep(10 * time.Millisecond)
 	}
 
-	// Should not panic when buffer is full
-	assert.True(t, true)
+	require.True(t, other.WaitFor(5, time.Second))
+	assert.Empty(t, full.Messages())
 }
 
 // TestHub_UnregisterMultipleClients tests unregistering multiple clients
@@ -381,37 +277,31 @@ func TestHub_UnregisterMultipleClients(t *testing.T) {
 	hub := NewHub(logger)
 
 	// Start hub
-	go hub.Run()
-
-	// Give hub time to start
-	time.Sleep(50 * time.Millisecond)
+	go hub.Run(t.Context())
 
 	userID := uuid.New()
 
-	// Create and register 3 clients
-	clients := make([]*Client, 3)
+	// Create and register 3 subscribers
+	subs := make([]*Recorder, 3)
 	for i := 0; i < 3; i++ {
-		clients[i] = &Client{
-			id:     uuid.New().String(),
-			userID: &userID,
-			hub:    hub,
-			conn:   nil,
-			send:   make(chan []byte, 256),
-			logger: logger,
-		}
-		hub.register <- clients[i]
+		subs[i] = NewRecorder(&userID)
+		require.NoError(t, hub.Register(subs[i]))
 	}
-	time.Sleep(100 * time.Millisecond)
 
-	// Unregister middle client
-	hub.unregister <- clients[1]
-	time.Sleep(100 * time.Millisecond)
+	// Unregister middle subscriber
+	hub.Unregister(subs[1])
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	require.NoError(t, hub.Ping(ctx))
 
-	// Verify only 2 clients remain
+	// Verify only 2 subscribers remain
 	hub.mu.RLock()
 	assert.Len(t, hub.userConns[userID], 2)
-	assert.False(t, hub.clients[clients[1]])
+	assert.False(t, hub.clients[subs[1]])
 	hub.mu.RUnlock()
+	assert.True(t, subs[1].Closed())
+	assert.False(t, subs[0].Closed())
 }
 
 // TestHub_ConcurrentOperations tests thread safety with concurrent operations
@@ -420,10 +310,7 @@ func TestHub_ConcurrentOperations(t *testing.T) {
 	hub := NewHub(logger)
 
 	// Start hub
-	go hub.Run()
-	defer func() {
-		time.Sleep(200 * time.Millisecond)
-	}()
+	go hub.Run(t.Context())
 
 	var wg sync.WaitGroup
 	numGoroutines := 10
@@ -438,15 +325,8 @@ func TestHub_ConcurrentOperations(t *testing.T) {
 
 			for j := 0; j < numOperationsPerGoroutine; j++ {
 				// Register
-				client := &Client{
-					id:     uuid.New().String(),
-					userID: &userID,
-					hub:    hub,
-					conn:   nil,
-					send:   make(chan []byte, 256),
-					logger: logger,
-				}
-				hub.register <- client
+				sub := NewRecorder(&userID)
+				assert.NoError(t, hub.Register(sub))
 
 				// Broadcast
 				hub.BroadcastToUser(userID, "test", map[string]string{"id": string(rune(id))})
@@ -454,7 +334,7 @@ func TestHub_ConcurrentOperations(t *testing.T) {
 				time.Sleep(10 * time.Millisecond)
 
 				// Unregister
-				hub.unregister <- client
+				hub.Unregister(sub)
 			}
 		}(i)
 	}
@@ -462,21 +342,137 @@ func TestHub_ConcurrentOperations(t *testing.T) {
 	wg.Wait()
 
 	// Should complete without deadlock or panic
-	assert.True(t, true)
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	require.NoError(t, hub.Ping(ctx))
+	hub.mu.RLock()
+	assert.Empty(t, hub.clients)
+	hub.mu.RUnlock()
+}
+
+// TestHub_RegisterUnregister tests the public registration API
+func TestHub_RegisterUnregister(t *testing.T) {
+	hub := NewHub(zerolog.Nop())
+	go hub.Run(t.Context())
+
+	userID := uuid.New()
+	sub := NewRecorder(&userID)
+	require.NoError(t, hub.Register(sub))
+	assert.Equal(t, 1, hub.Stats().Subscribers)
+
+	hub.Unregister(sub)
+	assert.True(t, sub.Closed())
+	assert.Equal(t, 0, hub.Stats().Subscribers)
+
+	// Unregistering twice is harmless
+	hub.Unregister(sub)
+}
+
+// TestHub_Run_Cancel tests that Run returns on cancellation and closes its subscribers
+func TestHub_Run_Cancel(t *testing.T) {
+	hub := NewHub(zerolog.Nop())
+	ctx, cancel := context.WithCancel(context.Background())
+	stopped := make(chan struct{})
+	go func() {
+		hub.Run(ctx)
+		close(stopped)
+	}()
+
+	sub := NewRecorder(nil)
+	require.NoError(t, hub.Register(sub))
+	hub.Subscribe(sub, "market:1")
+
+	cancel()
+	select {
+	case <-stopped:
+	case <-time.After(time.Second):
+		t.Fatal("Run did not return after cancellation")
+	}
+
+	assert.True(t, sub.Closed())
+	assert.False(t, hub.Stats().Running)
+	assert.Equal(t, 0, hub.Stats().Topics)
+
+	// Nothing blocks once the hub has stopped
+	assert.ErrorIs(t, hub.Register(NewRecorder(nil)), ErrHubStopped)
+	assert.ErrorIs(t, hub.Ping(context.Background()), ErrHubStopped)
+	assert.ErrorIs(t, hub.TryBroadcastToAll("test", nil), ErrHubStopped)
+	hub.Unregister(sub)
+	hub.Subscribe(sub, "market:1")
+	for i := 0; i < cap(hub.broadcast)+1; i++ {
+		hub.BroadcastToAll("test", nil)
+	}
+}
+
+// TestHub_TryBroadcast_Saturated tests that TryBroadcast fails instead of blocking when the queue is full
+func TestHub_TryBroadcast_Saturated(t *testing.T) {
+	hub := NewHub(zerolog.Nop())
+	userID := uuid.New()
+
+	// Without Run nothing drains the queue
+	for i := 0; i < cap(hub.broadcast); i++ {
+		require.NoError(t, hub.TryBroadcastToUser(userID, "test", i))
+	}
+	assert.ErrorIs(t, hub.TryBroadcastToUser(userID, "test", nil), ErrHubSaturated)
+	assert.ErrorIs(t, hub.TryBroadcastToAll("test", nil), ErrHubSaturated)
+	assert.ErrorIs(t, hub.TryBroadcast(&Message{Type: "test"}), ErrHubSaturated)
+
+	stats := hub.Stats()
+	assert.Equal(t, stats.BroadcastCapacity, stats.BroadcastQueue)
+
+	// Once Run drains the queue, broadcasts are accepted again
+	rec := NewRecorder(&userID)
+	go hub.Run(t.Context())
+	require.NoError(t, hub.Register(rec))
+	require.Eventually(t, func() bool {
+		return hub.TryBroadcastToUser(userID, "test", nil) == nil
+	}, time.Second, 10*time.Millisecond)
+}
+
+// TestHub_Stats tests the stats snapshot
+func TestHub_Stats(t *testing.T) {
+	hub := NewHub(zerolog.Nop())
+	go hub.Run(t.Context())
+
+	alice, bob := uuid.New(), uuid.New()
+	a1, a2, b1 := NewRecorder(&alice), NewRecorder(&alice), NewRecorder(&bob)
+	full := NewRecorder(nil)
+	full.SetFull(true)
+	for _, sub := range []Subscriber{a1, a2, b1, full} {
+		require.NoError(t, hub.Register(sub))
+	}
+	hub.Subscribe(b1, "market:1")
+
+	hub.BroadcastToAll("maintenance", nil)
+	require.True(t, b1.WaitFor(2, time.Second))
+	require.NoError(t, hub.Ping(context.Background()))
+
+	stats := hub.Stats()
+	assert.Equal(t, 4, stats.Subscribers)
+	assert.Equal(t, 2, stats.Users)
+	assert.Equal(t, 1, stats.Topics)
+	assert.Equal(t, 256, stats.BroadcastCapacity)
+	// One stale notice for the uncached topic plus three maintenance messages
+	assert.Equal(t, uint64(4), stats.Delivered)
+	assert.Equal(t, uint64(1), stats.Dropped)
+	assert.True(t, stats.Running)
 }
 
-// TestHub_Register returns the register channel
-func TestHub_Register(t *testing.T) {
+// TestHub_Ping tests the heartbeat probe through the Run loop
+func TestHub_Ping(t *testing.T) {
 	logger := zerolog.Nop()
 	hub := NewHub(logger)
 
-	assert.NotNil(t, hub.Register())
-	assert.Equal(t, hub.register, hub.Register())
-}
+	// Without Run the probe must time out
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	assert.ErrorIs(t, hub.Ping(ctx), context.DeadlineExceeded)
 
-// Helper function to get register channel (add this method to Hub if not exists)
-func (h *Hub) Register() chan *Client {
-	return h.register
+	go hub.Run(t.Context())
+
+	ctx2, cancel2 := context.WithTimeout(context.Background(), time.Second)
+	defer cancel2()
+	assert.NoError(t, hub.Ping(ctx2))
 }
 
 // TestHub_BroadcastToUserWithNilUserID tests broadcasting with nil user ID
@@ -485,37 +481,18 @@ func TestHub_BroadcastToUserWithNilUserID(t *testing.T) {
 	hub := NewHub(logger)
 
 	// Start hub
-	go hub.Run()
-	defer func() {
-		time.Sleep(100 * time.Millisecond)
-	}()
+	go hub.Run(t.Context())
 
-	// Create client without user ID
-	client := &Client{
-		id:     uuid.New().String(),
-		userID: nil,
-		hub:    hub,
-		conn:   nil,
-		send:   make(chan []byte, 256),
-		logger: logger,
-	}
+	// Create subscriber without user ID
+	sub := NewRecorder(nil)
+	require.NoError(t, hub.Register(sub))
 
-	hub.register <- client
-	time.Sleep(100 * time.Millisecond)
-
-	// Broadcast to a user - client without userID should not receive it
+	// Broadcast to a user - subscriber without userID should not receive it
 	someUserID := uuid.New()
 	hub.BroadcastToUser(someUserID, "test", map[string]string{"msg": "hello"})
-	time.Sleep(100 * time.Millisecond)
 
-	// Client should not have received the message
-	select {
-	case <-client.send:
-		t.Fatal("Client without userID should not receive user-specific broadcast")
-	case <-time.After(200 * time.Millisecond):
-		// Expected - no message received
-		assert.True(t, true)
-	}
+	// Subscriber should not have received the message
+	assert.False(t, sub.WaitFor(1, 200*time.Millisecond), "subscriber without userID should not receive user-specific broadcast")
 }
 
 // TestMessage_JSONMarshaling tests Message struct JSON marshaling
@@ -0,0 +1,177 @@
+package websocket
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+// controlMessage is a frame sent by the client to the server
+type controlMessage struct {
+	Op         string `json:"op"`
+	Topic      string `json:"topic,omitempty"`
+	IntervalMS int    `json:"interval_ms,omitempty"`
+	// ID, Method and Params describe an "rpc" call; ID alone names the
+	// notification of an "ack" or "read"
+	ID     string      `json:"id,omitempty"`
+	Method string      `json:"method,omitempty"`
+	Params interface{} `json:"params,omitempty"`
+}
+
+// decodeControl parses a control message. Text frames are always JSON;
+// binary frames are accepted from msgpack clients.
+func (c *Client) decodeControl(frameType int, data []byte, msg *controlMessage) error {
+	if frameType == websocket.BinaryMessage {
+		if c.format != FormatMsgpack {
+			return errors.New("binary control messages require the msgpack subprotocol")
+		}
+		dec := msgpack.NewDecoder(bytes.NewReader(data))
+		dec.SetCustomStructTag("json")
+		return dec.Decode(msg)
+	}
+	return json.Unmarshal(data, msg)
+}
+
+// handleControl processes a client control message read by ReadPump
+func (c *Client) handleControl(frameType int, data []byte) {
+	var msg controlMessage
+	if err := c.decodeControl(frameType, data, &msg); err != nil {
+		c.sendError("", "invalid_message", "control messages must be JSON text or msgpack binary objects")
+		return
+	}
+
+	switch msg.Op {
+	case "subscribe", "resnapshot":
+		// Re-subscribing resends the snapshot, which is how clients recover from a gap
+		if msg.Topic == "" {
+			c.sendError(msg.Op, "invalid_topic", "topic is required")
+			return
+		}
+		c.hub.Subscribe(c, msg.Topic)
+	case "unsubscribe":
+		c.hub.Unsubscribe(c, msg.Topic)
+	case "conflation":
+		if c.conflated != nil {
+			c.conflated.setInterval(time.Duration(msg.IntervalMS) * time.Millisecond)
+		}
+	case "rpc":
+		c.handleRPC(&msg)
+	case "ack", "read":
+		// Confirms a notification by the ID it was sent with
+		if msg.ID == "" || c.userID == nil {
+			c.sendError(msg.Op, "invalid_ack", "id and an authenticated user are required")
+			return
+		}
+		if !c.sent.has(msg.ID) {
+			c.sendError(msg.Op, "invalid_ack", "no notification with this id was sent on this connection")
+			return
+		}
+		status := StatusAcked
+		if msg.Op == "read" {
+			status = StatusRead
+		}
+		c.hub.reportStatus(msg.ID, c.userID, status, "")
+	default:
+		c.sendError(msg.Op, "unknown_op", "unsupported op")
+	}
+}
+
+// sendError queues an error reply to a control message
+func (c *Client) sendError(op, code, detail string) {
+	c.sendMessage(errorMessage(op, code, detail))
+}
+
+// errorMessage builds the reply sent when a control message is rejected
+func errorMessage(op, code, detail string) *Message {
+	return &Message{
+		Type: "error",
+		Payload: map[string]string{
+			"op":     op,
+			"code":   code,
+			"detail": detail,
+		},
+	}
+}
+
+// handleRPC runs an RPC call off the read loop and queues its reply
+func (c *Client) handleRPC(msg *controlMessage) {
+	if msg.ID == "" {
+		c.sendError(msg.Op, RPCCodeInvalidRequest, "rpc id is required")
+		return
+	}
+	router := c.hub.rpc
+	if router == nil {
+		c.sendRPCReply(msg.Method, msg.ID, nil, NewRPCError(RPCCodeMethodNotFound, "rpc is not enabled"))
+		return
+	}
+	if msg.Method == "" {
+		c.sendRPCReply(msg.Method, msg.ID, nil, NewRPCError(RPCCodeInvalidRequest, "method is required"))
+		return
+	}
+
+	call := &RPCCall{
+		ID:         msg.ID,
+		Method:     msg.Method,
+		UserID:     c.userID,
+		ClientID:   c.id,
+		subscriber: c,
+	}
+	if msg.Params != nil {
+		// Params arrive as JSON or msgpack; handlers always see JSON
+		params, err := json.Marshal(msg.Params)
+		if err != nil {
+			c.sendRPCReply(msg.Method, msg.ID, nil, NewRPCError(RPCCodeInvalidParams, "params must be an object or array"))
+			return
+		}
+		call.Params = params
+	}
+
+	if c.rpcInFlight.Add(1) > maxRPCInFlight {
+		c.rpcInFlight.Add(-1)
+		c.sendRPCReply(msg.Method, msg.ID, nil, NewRPCError(RPCCodeTooManyRequests, "too many calls in flight"))
+		return
+	}
+
+	go func() {
+		defer c.rpcInFlight.Add(-1)
+		start := time.Now()
+		result, err := router.serve(c.ctx, call)
+		rpcDuration.WithLabelValues(rpcMethodLabel(router, call.Method)).Observe(time.Since(start).Seconds())
+
+		var rpcErr *RPCError
+		if err != nil {
+			rpcErr = toRPCError(err, RPCCodeInternal)
+			if rpcErr.Code == RPCCodeInternal {
+				c.logger.Error().Err(err).Str("method", call.Method).Str("rpc_id", call.ID).Msg("rpc handler failed")
+			}
+		}
+		c.sendRPCReply(call.Method, call.ID, result, rpcErr)
+	}()
+}
+
+// sendRPCReply queues the reply to an RPC call and counts its outcome
+func (c *Client) sendRPCReply(method, id string, result interface{}, rpcErr *RPCError) {
+	code := "ok"
+	if rpcErr != nil {
+		code = rpcErr.Code
+	}
+	rpcCalls.WithLabelValues(rpcMethodLabel(c.hub.rpc, method), code).Inc()
+
+	if !c.sendMessage(rpcReplyMessage(id, result, rpcErr)) {
+		c.logger.Warn().Str("method", method).Str("rpc_id", id).Msg("rpc reply dropped")
+	}
+}
+
+// rpcMethodLabel keeps unregistered method names out of metric labels
+func rpcMethodLabel(router *RPCRouter, method string) string {
+	if router != nil {
+		if _, ok := router.lookup(method); ok {
+			return method
+		}
+	}
+	return "unknown"
+}
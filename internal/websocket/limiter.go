@@ -0,0 +1,123 @@
+package websocket
+
+import (
+	"errors"
+
+	"github.com/google/uuid"
+
+	"github.com/cypherlabdev/notification-service/internal/ratelimit"
+)
+
+// ErrTooManyConnections is returned by Limiter.Admit when a user or IP is at its connection cap
+var ErrTooManyConnections = errors.New("too many connections")
+
+// Action is what happens to an inbound frame that exceeds a rate limit
+type Action int
+
+const (
+	// ActionDrop silently discards the frame
+	ActionDrop Action = iota
+	// ActionWarn discards the frame and sends a rate_limited message to the client
+	ActionWarn
+	// ActionClose closes the connection with 1008 (policy violation)
+	ActionClose
+)
+
+func (a Action) String() string {
+	switch a {
+	case ActionWarn:
+		return "warn"
+	case ActionClose:
+		return "close"
+	default:
+		return "drop"
+	}
+}
+
+// LimitConfig configures inbound frame and connection limits. Zero rates
+// and caps disable the corresponding limit.
+type LimitConfig struct {
+	ConnFrameRate   float64 // frames per second per connection
+	ConnFrameBurst  int
+	UserFrameRate   float64 // frames per second across all of a user's connections
+	UserFrameBurst  int
+	MaxConnsPerUser int
+	MaxConnsPerIP   int
+	Action          Action
+}
+
+// DefaultLimitConfig returns the limits used by the server
+func DefaultLimitConfig() LimitConfig {
+	return LimitConfig{
+		ConnFrameRate:   10,
+		ConnFrameBurst:  20,
+		UserFrameRate:   20,
+		UserFrameBurst:  40,
+		MaxConnsPerUser: 10,
+		MaxConnsPerIP:   50,
+		Action:          ActionWarn,
+	}
+}
+
+// Limiter enforces inbound frame and connection limits for WebSocket clients
+type Limiter struct {
+	config     LimitConfig
+	userFrames *ratelimit.KeyedLimiter
+	userConns  *ratelimit.ConnLimiter
+	ipConns    *ratelimit.ConnLimiter
+}
+
+// NewLimiter creates a new limiter
+func NewLimiter(config LimitConfig) *Limiter {
+	return &Limiter{
+		config:     config,
+		userFrames: ratelimit.NewKeyedLimiter(config.UserFrameRate, config.UserFrameBurst),
+		userConns:  ratelimit.NewConnLimiter(config.MaxConnsPerUser),
+		ipConns:    ratelimit.NewConnLimiter(config.MaxConnsPerIP),
+	}
+}
+
+// Admit reserves a connection slot for the user and IP before the upgrade.
+// Every successful Admit must be paired with a Release.
+func (l *Limiter) Admit(userID *uuid.UUID, ip string) error {
+	if !l.ipConns.Acquire(ip) {
+		connectionsRejected.WithLabelValues("ip").Inc()
+		return ErrTooManyConnections
+	}
+	if userID != nil && !l.userConns.Acquire(userID.String()) {
+		l.ipConns.Release(ip)
+		connectionsRejected.WithLabelValues("user").Inc()
+		return ErrTooManyConnections
+	}
+	return nil
+}
+
+// Release frees the slots reserved by Admit
+func (l *Limiter) Release(userID *uuid.UUID, ip string) {
+	l.ipConns.Release(ip)
+	if userID != nil {
+		key := userID.String()
+		if l.userConns.Release(key) == 0 {
+			l.userFrames.Forget(key)
+		}
+	}
+}
+
+func (l *Limiter) newConnBucket() *ratelimit.Bucket {
+	if l.config.ConnFrameRate <= 0 {
+		return nil
+	}
+	return ratelimit.NewBucket(l.config.ConnFrameRate, l.config.ConnFrameBurst)
+}
+
+// allowFrame charges an inbound frame against the connection and user
+// buckets, returning the scope of the limit that rejected it
+func (l *Limiter) allowFrame(c *Client) (string, bool) {
+	if c.frames != nil && !c.frames.Allow() {
+		return "connection", false
+	}
+	if c.userID != nil && l.config.UserFrameRate > 0 && !l.userFrames.Allow(c.userID.String()) {
+		return "user", false
+	}
+	return "", true
+}
@@ -0,0 +1,154 @@
+package websocket
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/websocket"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestLimiter_AdmitPerIP tests the concurrent connection cap per IP
+func TestLimiter_AdmitPerIP(t *testing.T) {
+	limiter := NewLimiter(LimitConfig{MaxConnsPerIP: 2})
+
+	assert.NoError(t, limiter.Admit(nil, "10.0.0.1"))
+	assert.NoError(t, limiter.Admit(nil, "10.0.0.1"))
+	assert.ErrorIs(t, limiter.Admit(nil, "10.0.0.1"), ErrTooManyConnections)
+	assert.NoError(t, limiter.Admit(nil, "10.0.0.2"))
+
+	limiter.Release(nil, "10.0.0.1")
+	assert.NoError(t, limiter.Admit(nil, "10.0.0.1"))
+}
+
+// TestLimiter_AdmitPerUser tests the concurrent connection cap per user
+func TestLimiter_AdmitPerUser(t *testing.T) {
+	limiter := NewLimiter(LimitConfig{MaxConnsPerUser: 1})
+	userID := uuid.New()
+
+	assert.NoError(t, limiter.Admit(&userID, "10.0.0.1"))
+	assert.ErrorIs(t, limiter.Admit(&userID, "10.0.0.2"), ErrTooManyConnections)
+
+	// The rejected attempt must not leak an IP slot
+	assert.Equal(t, 0, limiter.ipConns.Count("10.0.0.2"))
+
+	limiter.Release(&userID, "10.0.0.1")
+	assert.NoError(t, limiter.Admit(&userID, "10.0.0.2"))
+}
+
+// TestLimiter_UserFramesShared tests that the user budget is shared across connections
+func TestLimiter_UserFramesShared(t *testing.T) {
+	limiter := NewLimiter(LimitConfig{UserFrameRate: 0.001, UserFrameBurst: 2})
+	hub := NewHub(zerolog.Nop(), WithLimiter(limiter))
+	userID := uuid.New()
+
+	c1 := &Client{userID: &userID, hub: hub}
+	c2 := &Client{userID: &userID, hub: hub}
+
+	_, ok := limiter.allowFrame(c1)
+	assert.True(t, ok)
+	_, ok = limiter.allowFrame(c2)
+	assert.True(t, ok)
+
+	scope, ok := limiter.allowFrame(c1)
+	assert.False(t, ok)
+	assert.Equal(t, "user", scope)
+}
+
+// floodingServer starts a server that writes n frames as soon as a client connects
+func floodingServer(t *testing.T, n int, closeErr chan<- error) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		upgrader := websocket.Upgrader{}
+		serverConn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer serverConn.Close()
+
+		for i := 0; i < n; i++ {
+			if err := serverConn.WriteMessage(websocket.TextMessage, []byte(`{"op":"noop"}`)); err != nil {
+				return
+			}
+		}
+
+		serverConn.SetReadDeadline(time.Now().Add(2 * time.Second))
+		for {
+			if _, _, err := serverConn.ReadMessage(); err != nil {
+				if closeErr != nil {
+					closeErr <- err
+				}
+				return
+			}
+		}
+	}))
+}
+
+// TestClient_ReadPump_RateLimitWarn tests that excess frames produce a rate_limited message
+func TestClient_ReadPump_RateLimitWarn(t *testing.T) {
+	logger := zerolog.Nop()
+	limiter := NewLimiter(LimitConfig{ConnFrameRate: 0.001, ConnFrameBurst: 2, Action: ActionWarn})
+	hub := NewHub(logger, WithLimiter(limiter))
+	go hub.Run(t.Context())
+
+	server := floodingServer(t, 5, nil)
+	defer server.Close()
+
+	wsURL := "ws" + strings.TrimPrefix(server.URL, "http")
+	conn, _, err := websocket.DefaultDialer.Dial(wsURL, nil)
+	require.NoError(t, err)
+	defer conn.Close()
+
+	userID := uuid.New()
+	client := NewClient(hub, conn, &userID, logger)
+	require.NotNil(t, client.frames)
+	go client.ReadPump()
+
+	// Frames within the budget are answered first, so skip their replies
+	timeout := time.After(2 * time.Second)
+	for {
+		select {
+		case data := <-client.send:
+			var message Message
+			require.NoError(t, json.Unmarshal(data.data, &message))
+			if message.Type == "rate_limited" {
+				return
+			}
+		case <-timeout:
+			t.Fatal("Timeout waiting for rate_limited message")
+		}
+	}
+}
+
+// TestClient_ReadPump_RateLimitClose tests that the close action sends 1008
+func TestClient_ReadPump_RateLimitClose(t *testing.T) {
+	logger := zerolog.Nop()
+	limiter := NewLimiter(LimitConfig{ConnFrameRate: 0.001, ConnFrameBurst: 1, Action: ActionClose})
+	hub := NewHub(logger, WithLimiter(limiter))
+	go hub.Run(t.Context())
+
+	closeErr := make(chan error, 1)
+	server := floodingServer(t, 3, closeErr)
+	defer server.Close()
+
+	wsURL := "ws" + strings.TrimPrefix(server.URL, "http")
+	conn, _, err := websocket.DefaultDialer.Dial(wsURL, nil)
+	require.NoError(t, err)
+
+	userID := uuid.New()
+	client := NewClient(hub, conn, &userID, logger)
+	go client.ReadPump()
+
+	select {
+	case err := <-closeErr:
+		assert.True(t, websocket.IsCloseError(err, websocket.ClosePolicyViolation), "unexpected error: %v", err)
+	case <-time.After(2 * time.Second):
+		t.Fatal("Timeout waiting for policy violation close")
+	}
+}
@@ -0,0 +1,86 @@
+package websocket
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var (
+	framesRateLimited = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "notification",
+		Subsystem: "websocket",
+		Name:      "frames_rate_limited_total",
+		Help:      "Inbound frames rejected by a rate limit, by limit scope and action taken.",
+	}, []string{"scope", "action"})
+
+	connectionsRejected = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "notification",
+		Subsystem: "websocket",
+		Name:      "connections_rejected_total",
+		Help:      "Connections refused at upgrade time, by the limit that was hit.",
+	}, []string{"reason"})
+
+	messagesConflated = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: "notification",
+		Subsystem: "websocket",
+		Name:      "messages_conflated_total",
+		Help:      "Queued messages replaced by a newer message with the same conflation key.",
+	})
+
+	framesWritten = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "notification",
+		Subsystem: "websocket",
+		Name:      "frames_written_total",
+		Help:      "Data frames written to clients, by whether they were compressed.",
+	}, []string{"compressed"})
+
+	compressionBytesIn = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: "notification",
+		Subsystem: "websocket",
+		Name:      "compression_input_bytes_total",
+		Help:      "Uncompressed size of frames written with permessage-deflate.",
+	})
+
+	compressionBytesSaved = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: "notification",
+		Subsystem: "websocket",
+		Name:      "compression_saved_bytes_total",
+		Help:      "Estimated bytes saved by permessage-deflate, sampled from one in 16 compressed encodings.",
+	})
+
+	broadcastsRejected = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "notification",
+		Subsystem: "websocket",
+		Name:      "broadcasts_rejected_total",
+		Help:      "Broadcasts not queued because the hub was saturated or stopped.",
+	}, []string{"reason"})
+
+	rpcCalls = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "notification",
+		Subsystem: "websocket",
+		Name:      "rpc_calls_total",
+		Help:      "RPC calls made over client connections, by method and result code.",
+	}, []string{"method", "code"})
+
+	rpcDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: "notification",
+		Subsystem: "websocket",
+		Name:      "rpc_duration_seconds",
+		Help:      "Time taken to answer RPC calls, by method.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"method"})
+
+	messagesExpired = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "notification",
+		Subsystem: "websocket",
+		Name:      "messages_expired_total",
+		Help:      "Messages dropped because their expiry passed before delivery, by type and where they were dropped.",
+	}, []string{"type", "stage"})
+
+	messagesSequenced = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "notification",
+		Subsystem: "websocket",
+		Name:      "messages_sequenced_total",
+		Help:      "Messages with an ordering key, by whether they arrived in order, were held for a predecessor, skipped a gap or were dropped as stale.",
+	}, []string{"result"})
+)
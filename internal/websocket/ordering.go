@@ -0,0 +1,194 @@
+package websocket
+
+import (
+	"hash/fnv"
+	"maps"
+	"slices"
+	"time"
+)
+
+const (
+	// defaultOrderingHold is how long a message that arrived ahead of a
+	// missing predecessor is held before the gap is skipped
+	defaultOrderingHold = time.Second
+	// orderingIdle is how long a key without traffic is remembered
+	orderingIdle = 10 * time.Minute
+	// maxHeldPerKey bounds the messages held behind one gap
+	maxHeldPerKey = 64
+)
+
+// Outcomes of sequencing a message, used as metric labels
+const (
+	sequencedInOrder   = "in_order"  // released on arrival
+	sequencedReordered = "reordered" // held until its predecessor arrived
+	sequencedGap       = "gap"       // released after giving up on a predecessor
+	sequencedStale     = "stale"     // dropped as a duplicate or late arrival
+)
+
+// Ordered marks the message as number seq of the stream key, such as
+// "order:123". Messages of one key reach each client in seq order: the hub
+// holds back any that arrive ahead of a missing predecessor and drops
+// duplicates. Producers number each key from 1; a seq of 0 lets the hub
+// number the message in arrival order, which only orders messages that
+// enter through a single hub. A key first seen mid-stream, such as after a
+// restart, waits out one hold before its messages are released. A key's
+// messages all travel on the lane of the first one the hub sees, since a
+// later message on a higher lane could overtake those still queued.
+func Ordered(key string, seq uint64) SendOption {
+	return func(m *Message) {
+		m.OrderingKey = key
+		m.Sequence = seq
+	}
+}
+
+// WithOrderingHold sets how long the hub holds a message that arrived ahead
+// of its predecessor before skipping the gap
+func WithOrderingHold(hold time.Duration) Option {
+	return func(h *Hub) {
+		h.sequencer = NewSequencer(hold)
+	}
+}
+
+// PartitionFor maps an ordering key onto one of n ingestion partitions.
+// Producers and consumers that partition by it keep each key on a single
+// partition, and so on a single consumer node, from ingest to the hub.
+func PartitionFor(key string, n int) int {
+	if n <= 1 {
+		return 0
+	}
+	h := fnv.New32a()
+	h.Write([]byte(key))
+	return int(h.Sum32() % uint32(n))
+}
+
+// Sequencer restores per-key order to messages carrying an ordering key.
+// The hub runs one over everything it broadcasts; clients consuming the
+// stream can run their own to reorder what reaches them over different
+// connections. A Sequencer is not safe for concurrent use.
+type Sequencer struct {
+	hold time.Duration
+	keys map[string]*keySequence
+}
+
+// keySequence is the sequencing state of one ordering key
+type keySequence struct {
+	next    uint64              // next sequence number to release
+	held    map[uint64]*Message // arrived ahead of next
+	waiting time.Time           // when the oldest held message arrived
+	seen    time.Time
+	// priority is that of the key's first message; every message of the
+	// key is released on its lane so client lanes cannot reorder them
+	priority Priority
+}
+
+// NewSequencer creates a sequencer that holds early messages for up to hold
+func NewSequencer(hold time.Duration) *Sequencer {
+	if hold <= 0 {
+		hold = defaultOrderingHold
+	}
+	return &Sequencer{hold: hold, keys: make(map[string]*keySequence)}
+}
+
+// Offer returns the messages that can be delivered now that msg arrived,
+// in order. Messages without an ordering key pass straight through.
+func (s *Sequencer) Offer(msg *Message, now time.Time) []*Message {
+	if msg.OrderingKey == "" {
+		return []*Message{msg}
+	}
+	ks, ok := s.keys[msg.OrderingKey]
+	if !ok {
+		ks = &keySequence{next: 1, held: make(map[uint64]*Message), priority: msg.Priority}
+		s.keys[msg.OrderingKey] = ks
+	}
+	ks.seen = now
+
+	if msg.Sequence == 0 {
+		// Numbered by the hub in arrival order
+		msg.Sequence = max(ks.next, ks.lastHeld()+1)
+	}
+	switch {
+	case msg.Sequence < ks.next || ks.held[msg.Sequence] != nil:
+		messagesSequenced.WithLabelValues(sequencedStale).Inc()
+		return nil
+	case msg.Sequence > ks.next:
+		if len(ks.held) == 0 {
+			ks.waiting = now
+		}
+		ks.held[msg.Sequence] = msg
+		if len(ks.held) > maxHeldPerKey {
+			return ks.skip(now)
+		}
+		return nil
+	}
+
+	messagesSequenced.WithLabelValues(sequencedInOrder).Inc()
+	ks.next++
+	return ks.release(append([]*Message{msg}, ks.drain(sequencedReordered)...), now)
+}
+
+// Flush skips gaps that have been waited on for longer than the hold and
+// forgets idle keys. It returns the messages released, in order per key.
+func (s *Sequencer) Flush(now time.Time) []*Message {
+	var out []*Message
+	for key, ks := range s.keys {
+		if len(ks.held) > 0 && now.Sub(ks.waiting) >= s.hold {
+			out = append(out, ks.skip(now)...)
+		}
+		if len(ks.held) == 0 && now.Sub(ks.seen) >= orderingIdle {
+			delete(s.keys, key)
+		}
+	}
+	return out
+}
+
+// Held returns how many messages are waiting for a predecessor
+func (s *Sequencer) Held() int {
+	n := 0
+	for _, ks := range s.keys {
+		n += len(ks.held)
+	}
+	return n
+}
+
+// skip gives up on the missing predecessors of the earliest held message
+func (ks *keySequence) skip(now time.Time) []*Message {
+	ks.next = slices.Min(slices.Collect(maps.Keys(ks.held)))
+	return ks.release(ks.drain(sequencedGap), now)
+}
+
+// drain removes the held messages that follow on from next
+func (ks *keySequence) drain(result string) []*Message {
+	var out []*Message
+	for {
+		msg, ok := ks.held[ks.next]
+		if !ok {
+			return out
+		}
+		delete(ks.held, ks.next)
+		messagesSequenced.WithLabelValues(result).Inc()
+		// Only the first message after a gap skipped it; the rest are in order
+		result = sequencedReordered
+		out = append(out, msg)
+		ks.next++
+	}
+}
+
+// release moves the released messages onto the key's lane and restarts
+// the hold timer for what is still waiting
+func (ks *keySequence) release(out []*Message, now time.Time) []*Message {
+	for _, msg := range out {
+		msg.Priority = ks.priority
+	}
+	if len(ks.held) > 0 {
+		ks.waiting = now
+	}
+	return out
+}
+
+func (ks *keySequence) lastHeld() uint64 {
+	var last uint64
+	for seq := range ks.held {
+		last = max(last, seq)
+	}
+	return last
+}
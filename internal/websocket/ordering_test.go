@@ -0,0 +1,204 @@
+package websocket
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func orderedMsg(key string, seq uint64, msgType string) *Message {
+	return &Message{Type: msgType, OrderingKey: key, Sequence: seq}
+}
+
+func seqs(msgs []*Message) []uint64 {
+	out := make([]uint64, len(msgs))
+	for i, m := range msgs {
+		out[i] = m.Sequence
+	}
+	return out
+}
+
+// TestSequencer_Reorder tests that messages arriving ahead of a predecessor are held
+func TestSequencer_Reorder(t *testing.T) {
+	s := NewSequencer(time.Second)
+	now := time.Now()
+
+	assert.Empty(t, s.Offer(orderedMsg("order:1", 3, "order_filled"), now))
+	assert.Empty(t, s.Offer(orderedMsg("order:1", 2, "order_partially_filled"), now))
+	assert.Equal(t, 2, s.Held())
+
+	// Other keys are not held up
+	assert.Equal(t, []uint64{1}, seqs(s.Offer(orderedMsg("order:2", 1, "order_accepted"), now)))
+
+	released := s.Offer(orderedMsg("order:1", 1, "order_accepted"), now)
+	assert.Equal(t, []uint64{1, 2, 3}, seqs(released))
+	assert.Equal(t, "order_filled", released[2].Type)
+	assert.Zero(t, s.Held())
+
+	// Duplicates and late arrivals are dropped
+	assert.Empty(t, s.Offer(orderedMsg("order:1", 2, "order_partially_filled"), now))
+	assert.Equal(t, []uint64{4}, seqs(s.Offer(orderedMsg("order:1", 4, "order_settled"), now)))
+
+	// Messages without a key pass through
+	assert.Len(t, s.Offer(&Message{Type: "promo"}, now), 1)
+}
+
+// TestSequencer_Gap tests that a missing predecessor is given up on after the hold
+func TestSequencer_Gap(t *testing.T) {
+	s := NewSequencer(time.Second)
+	now := time.Now()
+
+	require.Len(t, s.Offer(orderedMsg("order:1", 1, "a"), now), 1)
+	assert.Empty(t, s.Offer(orderedMsg("order:1", 3, "c"), now))
+	assert.Empty(t, s.Offer(orderedMsg("order:1", 4, "d"), now))
+	assert.Empty(t, s.Offer(orderedMsg("order:1", 6, "f"), now.Add(500*time.Millisecond)))
+
+	assert.Empty(t, s.Flush(now.Add(999*time.Millisecond)))
+	assert.Equal(t, []uint64{3, 4}, seqs(s.Flush(now.Add(time.Second))))
+	// The hold restarts for the next gap
+	assert.Empty(t, s.Flush(now.Add(1500*time.Millisecond)))
+	assert.Equal(t, []uint64{6}, seqs(s.Flush(now.Add(2*time.Second))))
+
+	// 2 and 5 are now stale
+	assert.Empty(t, s.Offer(orderedMsg("order:1", 2, "b"), now.Add(2*time.Second)))
+	assert.Empty(t, s.Offer(orderedMsg("order:1", 5, "e"), now.Add(2*time.Second)))
+
+	// Idle keys are forgotten
+	s.Flush(now.Add(2*time.Second + orderingIdle))
+	assert.Empty(t, s.keys)
+}
+
+// TestSequencer_Overflow tests that too many held messages skip the gap early
+func TestSequencer_Overflow(t *testing.T) {
+	s := NewSequencer(time.Hour)
+	now := time.Now()
+
+	for seq := uint64(2); seq < maxHeldPerKey+2; seq++ {
+		require.Empty(t, s.Offer(orderedMsg("k", seq, "t"), now))
+	}
+	released := s.Offer(orderedMsg("k", maxHeldPerKey+2, "t"), now)
+	assert.Len(t, released, maxHeldPerKey+1)
+	assert.Equal(t, uint64(2), released[0].Sequence)
+}
+
+// TestSequencer_Numbering tests that the hub numbers messages sent without a sequence
+func TestSequencer_Numbering(t *testing.T) {
+	s := NewSequencer(time.Second)
+	now := time.Now()
+
+	assert.Equal(t, []uint64{1}, seqs(s.Offer(orderedMsg("k", 0, "t"), now)))
+	assert.Equal(t, []uint64{2}, seqs(s.Offer(orderedMsg("k", 0, "t"), now)))
+}
+
+// TestSequencer_Priority tests that a key's messages are released on the
+// lane of its first message
+func TestSequencer_Priority(t *testing.T) {
+	s := NewSequencer(time.Second)
+	now := time.Now()
+
+	ticks := orderedMsg("orderbook:BTC", 0, "orderbook_delta")
+	ticks.Priority = PriorityLow
+	assert.Equal(t, PriorityLow, s.Offer(ticks, now)[0].Priority, "a low priority key is not promoted")
+
+	accepted := orderedMsg("order:1", 1, "order_accepted")
+	filled := orderedMsg("order:1", 2, "wallet_order_filled")
+	filled.Priority = PriorityHigh
+	settled := orderedMsg("order:1", 3, "order_settled")
+	assert.Empty(t, s.Offer(filled, now))
+	released := s.Offer(accepted, now)
+	require.Len(t, released, 2)
+	for _, msg := range append(released, s.Offer(settled, now)...) {
+		assert.Equal(t, PriorityHigh, msg.Priority, msg.Type)
+	}
+
+	// A key is not escalated by a later high priority message
+	accepted = orderedMsg("order:2", 1, "order_accepted")
+	filled = orderedMsg("order:2", 2, "wallet_order_filled")
+	filled.Priority = PriorityHigh
+	assert.Equal(t, PriorityNormal, s.Offer(accepted, now)[0].Priority)
+	assert.Equal(t, PriorityNormal, s.Offer(filled, now)[0].Priority)
+}
+
+// TestHub_OrderedPriority tests that an ordered high priority notice keeps
+// its lane
+func TestHub_OrderedPriority(t *testing.T) {
+	hub := NewHub(zerolog.Nop())
+	go hub.Run(t.Context())
+
+	userID := uuid.New()
+	rec := NewRecorder(&userID)
+	require.NoError(t, hub.Register(rec))
+
+	hub.BroadcastToUser(userID, "account_locked", nil, Ordered("order:123", 1))
+	require.True(t, rec.WaitFor(1, time.Second))
+	assert.Equal(t, PriorityHigh, rec.Messages()[0].Priority)
+}
+
+// TestHub_OrderedLane tests that a high priority message arriving in order
+// behind one still queued on the normal lane does not overtake it
+func TestHub_OrderedLane(t *testing.T) {
+	hub := NewHub(zerolog.Nop())
+	go hub.Run(t.Context())
+
+	userID := uuid.New()
+	c := newLaneClient(hub)
+	c.userID = &userID
+	require.NoError(t, hub.Register(c))
+	time.Sleep(50 * time.Millisecond)
+
+	hub.BroadcastToUser(userID, "order_accepted", nil, Ordered("order:7", 1))
+	hub.BroadcastToUser(userID, "wallet_order_filled", nil, Ordered("order:7", 2))
+	require.Eventually(t, func() bool { return len(c.send) == 2 }, time.Second, 5*time.Millisecond)
+	assert.Empty(t, c.sendHigh)
+
+	frames := drainFrames(c)
+	require.Len(t, frames, 2)
+	assert.Contains(t, frames[0], "order_accepted")
+	assert.Contains(t, frames[1], "wallet_order_filled")
+}
+
+// TestHub_OrderedDelivery tests that out-of-order producer input reaches clients in order
+func TestHub_OrderedDelivery(t *testing.T) {
+	hub := NewHub(zerolog.Nop(), WithOrderingHold(100*time.Millisecond))
+	go hub.Run(t.Context())
+
+	userID := uuid.New()
+	rec := NewRecorder(&userID)
+	require.NoError(t, hub.Register(rec))
+
+	// "filled" is a high priority type and "accepted" is not; both take
+	// the high lane of "filled", which the hub saw first
+	hub.BroadcastToUser(userID, "wallet_order_filled", nil, Ordered("order:9", 3))
+	hub.BroadcastToUser(userID, "order_partially_filled", nil, Ordered("order:9", 2))
+	hub.BroadcastToUser(userID, "promo", nil)
+	hub.BroadcastToUser(userID, "order_accepted", nil, Ordered("order:9", 1))
+	require.True(t, rec.WaitFor(4, time.Second))
+	assert.Equal(t, []string{"promo", "order_accepted", "order_partially_filled", "wallet_order_filled"}, rec.Types())
+	for _, msg := range rec.Messages()[1:] {
+		assert.Equal(t, PriorityHigh, msg.Priority)
+	}
+
+	// A lost predecessor delays its successors by at most the hold
+	rec.Reset()
+	hub.BroadcastToUser(userID, "order_settled", nil, Ordered("order:9", 5))
+	require.True(t, rec.WaitFor(1, time.Second))
+	assert.Equal(t, uint64(5), rec.Messages()[0].Sequence)
+
+	data, err := json.Marshal(rec.Messages()[0])
+	require.NoError(t, err)
+	assert.Contains(t, string(data), `"ordering_key":"order:9","seq":5`)
+}
+
+// TestPartitionFor tests that a key always maps to the same partition
+func TestPartitionFor(t *testing.T) {
+	p := PartitionFor("order:123", 12)
+	assert.GreaterOrEqual(t, p, 0)
+	assert.Less(t, p, 12)
+	assert.Equal(t, p, PartitionFor("order:123", 12))
+	assert.Equal(t, 0, PartitionFor("order:123", 1))
+}
@@ -0,0 +1,122 @@
+package websocket
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/rs/zerolog"
+)
+
+const (
+	pollBuffer         = 256
+	defaultPollTimeout = 25 * time.Second
+	maxPollTimeout     = 55 * time.Second
+	// pollLinger collects messages that arrive just after the first one, so
+	// a burst is returned in one response rather than one poll each
+	pollLinger = 50 * time.Millisecond
+)
+
+// pollResponse is the body returned by ServePoll
+type pollResponse struct {
+	// Cursor is passed back as ?cursor= on the next poll
+	Cursor string            `json:"cursor"`
+	Events []json.RawMessage `json:"events"`
+	// Resync means messages were missed and the client should reload its state
+	Resync bool `json:"resync,omitempty"`
+}
+
+// ServePoll is the long-polling fallback. It returns as soon as there are
+// messages after ?cursor=, or after ?timeout= seconds with none. A request
+// without a cursor starts at the newest message.
+func ServePoll(hub *Hub, w http.ResponseWriter, r *http.Request, userID *uuid.UUID, logger zerolog.Logger) {
+	timeout := defaultPollTimeout
+	if v := r.URL.Query().Get("timeout"); v != "" {
+		secs, err := strconv.Atoi(v)
+		if err != nil || secs < 0 {
+			http.Error(w, "invalid timeout", http.StatusBadRequest)
+			return
+		}
+		timeout = min(time.Duration(secs)*time.Second, maxPollTimeout)
+	}
+	cursor := r.URL.Query().Get("cursor")
+
+	sub := newStreamSubscriber(userID, pollBuffer)
+	sub.device = streamDevice(r)
+	result, err := hub.attach(sub, cursor)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusServiceUnavailable)
+		return
+	}
+	defer hub.Unregister(sub)
+
+	resp := pollResponse{Cursor: result.head, Events: []json.RawMessage{}}
+	if cursor != "" {
+		resp.Cursor = cursor
+	}
+
+	if !result.resumed {
+		resp.Resync = true
+		resp.Cursor = result.head
+		writePollResponse(w, resp, logger)
+		return
+	}
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	select {
+	case event := <-sub.events:
+		resp.add(event)
+	case <-timer.C:
+	case <-sub.done:
+		// Return whatever was queued before the hub closed the subscriber,
+		// such as a session_revoked notice
+		for drained := false; !drained; {
+			select {
+			case event := <-sub.events:
+				resp.add(event)
+			default:
+				drained = true
+			}
+		}
+	case <-r.Context().Done():
+		return
+	}
+
+	if len(resp.Events) > 0 {
+		linger := time.NewTimer(pollLinger)
+		defer linger.Stop()
+	collect:
+		for len(resp.Events) < pollBuffer {
+			select {
+			case event := <-sub.events:
+				resp.add(event)
+			case <-linger.C:
+				break collect
+			}
+		}
+	}
+
+	writePollResponse(w, resp, logger)
+}
+
+func (p *pollResponse) add(event streamEvent) {
+	// A stale message is skipped, but the cursor still moves past it
+	if !event.expired() {
+		p.Events = append(p.Events, json.RawMessage(event.data))
+	}
+	if event.id != "" {
+		p.Cursor = event.id
+	}
+}
+
+func writePollResponse(w http.ResponseWriter, resp pollResponse, logger zerolog.Logger) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	if err := json.NewEncoder(w).Encode(resp); err != nil {
+		logger.Debug().Err(err).Msg("failed to write poll response")
+	}
+}
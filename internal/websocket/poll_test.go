@@ -0,0 +1,115 @@
+package websocket
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func poll(t *testing.T, hub *Hub, userID *uuid.UUID, cursor string, timeout string) pollResponse {
+	t.Helper()
+	q := url.Values{}
+	if cursor != "" {
+		q.Set("cursor", cursor)
+	}
+	q.Set("timeout", timeout)
+
+	rec := httptest.NewRecorder()
+	ServePoll(hub, rec, httptest.NewRequest(http.MethodGet, "/poll?"+q.Encode(), nil), userID, zerolog.Nop())
+	require.Equal(t, http.StatusOK, rec.Code)
+
+	var resp pollResponse
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &resp))
+	return resp
+}
+
+// TestServePoll_Timeout tests that an idle poll returns no events and a usable cursor
+func TestServePoll_Timeout(t *testing.T) {
+	hub := NewHub(zerolog.Nop())
+	go hub.Run(t.Context())
+
+	resp := poll(t, hub, nil, "", "0")
+	assert.Empty(t, resp.Events)
+	assert.NotEmpty(t, resp.Cursor)
+	assert.False(t, resp.Resync)
+}
+
+// TestServePoll_MessagesBetweenPolls tests that messages sent between polls are delivered by cursor
+func TestServePoll_MessagesBetweenPolls(t *testing.T) {
+	hub := NewHub(zerolog.Nop())
+	go hub.Run(t.Context())
+	userID := uuid.New()
+
+	cursor := poll(t, hub, &userID, "", "0").Cursor
+
+	hub.BroadcastToUser(userID, "bet_settled", map[string]string{"bet": "1"})
+	hub.BroadcastToAll("maintenance", nil)
+	time.Sleep(50 * time.Millisecond)
+
+	resp := poll(t, hub, &userID, cursor, "1")
+	require.Len(t, resp.Events, 2)
+	assert.Contains(t, string(resp.Events[0]), "bet_settled")
+	assert.Contains(t, string(resp.Events[1]), "maintenance")
+	assert.NotEqual(t, cursor, resp.Cursor)
+
+	// The new cursor does not repeat delivered messages
+	resp = poll(t, hub, &userID, resp.Cursor, "0")
+	assert.Empty(t, resp.Events)
+}
+
+// TestServePoll_Wakeup tests that a waiting poll returns as soon as a message arrives
+func TestServePoll_Wakeup(t *testing.T) {
+	hub := NewHub(zerolog.Nop())
+	go hub.Run(t.Context())
+	userID := uuid.New()
+
+	go func() {
+		waitForClients(t, hub, 1)
+		hub.BroadcastToUser(userID, "withdrawal_approved", nil)
+	}()
+
+	start := time.Now()
+	resp := poll(t, hub, &userID, "", "10")
+	require.Len(t, resp.Events, 1)
+	assert.Less(t, time.Since(start), 5*time.Second)
+}
+
+// TestServePoll_Resync tests that an unknown cursor asks the client to resync
+func TestServePoll_Resync(t *testing.T) {
+	hub := NewHub(zerolog.Nop())
+	go hub.Run(t.Context())
+
+	resp := poll(t, hub, nil, "stale-cursor", "0")
+	assert.True(t, resp.Resync)
+	assert.NotEqual(t, "stale-cursor", resp.Cursor)
+}
+
+// TestServePoll_InvalidTimeout tests timeout validation
+func TestServePoll_InvalidTimeout(t *testing.T) {
+	hub := NewHub(zerolog.Nop())
+
+	rec := httptest.NewRecorder()
+	ServePoll(hub, rec, httptest.NewRequest(http.MethodGet, "/poll?timeout=abc", nil), nil, zerolog.Nop())
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+}
+
+// TestServePoll_HubStopped tests that polls fail fast once the hub has stopped
+func TestServePoll_HubStopped(t *testing.T) {
+	hub := NewHub(zerolog.Nop())
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	hub.Run(ctx)
+
+	rec := httptest.NewRecorder()
+	ServePoll(hub, rec, httptest.NewRequest(http.MethodGet, "/poll", nil), nil, zerolog.Nop())
+	assert.Equal(t, http.StatusServiceUnavailable, rec.Code)
+}
@@ -0,0 +1,75 @@
+package websocket
+
+import "strings"
+
+// Priority selects the send lane a message is queued on
+type Priority int
+
+const (
+	// PriorityLow is for high-volume market data that is quickly superseded
+	PriorityLow Priority = -1
+	// PriorityNormal is the default lane
+	PriorityNormal Priority = 0
+	// PriorityHigh is for account notices that must never wait behind market data
+	PriorityHigh Priority = 1
+)
+
+func (p Priority) String() string {
+	switch p {
+	case PriorityHigh:
+		return "high"
+	case PriorityLow:
+		return "low"
+	default:
+		return "normal"
+	}
+}
+
+// lane returns the index of the priority's queue in Client.lanes
+func (p Priority) lane() int {
+	switch p {
+	case PriorityHigh:
+		return 0
+	case PriorityLow:
+		return 2
+	default:
+		return 1
+	}
+}
+
+const numLanes = 3
+
+var (
+	highPriorityPrefixes = []string{"withdrawal", "deposit", "account", "security", "wallet", "kyc"}
+	lowPriorityPrefixes  = []string{"odds", "price", "market", "orderbook", "order_book", "ticker"}
+)
+
+// DefaultPriority derives a message's priority from its type
+func DefaultPriority(msgType string) Priority {
+	for _, prefix := range highPriorityPrefixes {
+		if strings.HasPrefix(msgType, prefix) {
+			return PriorityHigh
+		}
+	}
+	for _, prefix := range lowPriorityPrefixes {
+		if strings.HasPrefix(msgType, prefix) {
+			return PriorityLow
+		}
+	}
+	return PriorityNormal
+}
+
+// LaneWeights sets how many frames each lane may write per round when the
+// hub uses weighted scheduling
+type LaneWeights struct {
+	High   int
+	Normal int
+	Low    int
+}
+
+// DefaultLaneWeights favours account notices while still letting market data through
+var DefaultLaneWeights = LaneWeights{High: 8, Normal: 4, Low: 1}
+
+func (w LaneWeights) credits() [numLanes]int {
+	return [numLanes]int{w.High, w.Normal, w.Low}
+}
@@ -0,0 +1,107 @@
+package websocket
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newLaneClient(hub *Hub) *Client {
+	return &Client{
+		id:       uuid.New().String(),
+		hub:      hub,
+		send:     make(chan frame, 16),
+		sendHigh: make(chan frame, 16),
+		sendLow:  make(chan frame, 16),
+		done:     make(chan struct{}),
+		ctx:      context.Background(),
+		logger:   zerolog.Nop(),
+	}
+}
+
+func drainFrames(c *Client) []string {
+	var out []string
+	for {
+		data, _, ready := c.nextFrame()
+		if !ready {
+			return out
+		}
+		out = append(out, string(data.data))
+	}
+}
+
+// TestDefaultPriority tests priority derivation from message types
+func TestDefaultPriority(t *testing.T) {
+	assert.Equal(t, PriorityHigh, DefaultPriority("withdrawal_approved"))
+	assert.Equal(t, PriorityHigh, DefaultPriority("deposit_received"))
+	assert.Equal(t, PriorityLow, DefaultPriority("odds_update"))
+	assert.Equal(t, PriorityLow, DefaultPriority("orderbook_delta"))
+	assert.Equal(t, PriorityNormal, DefaultPriority("bet_settled"))
+}
+
+// TestClient_NextFrame_Strict tests that strict scheduling always drains higher lanes first
+func TestClient_NextFrame_Strict(t *testing.T) {
+	c := newLaneClient(NewHub(zerolog.Nop()))
+
+	require.True(t, c.enqueue(frame{data: []byte("low1")}, PriorityLow))
+	require.True(t, c.enqueue(frame{data: []byte("normal1")}, PriorityNormal))
+	require.True(t, c.enqueue(frame{data: []byte("low2")}, PriorityLow))
+	require.True(t, c.enqueue(frame{data: []byte("high1")}, PriorityHigh))
+
+	assert.Equal(t, []string{"high1", "normal1", "low1", "low2"}, drainFrames(c))
+}
+
+// TestClient_NextFrame_Weighted tests that weighted scheduling interleaves lanes
+func TestClient_NextFrame_Weighted(t *testing.T) {
+	hub := NewHub(zerolog.Nop(), WithWeightedLanes(LaneWeights{High: 2, Normal: 1, Low: 1}))
+	c := newLaneClient(hub)
+
+	for _, p := range []Priority{PriorityHigh, PriorityHigh, PriorityHigh, PriorityHigh} {
+		c.enqueue(frame{data: []byte("h")}, p)
+	}
+	c.enqueue(frame{data: []byte("n")}, PriorityNormal)
+	c.enqueue(frame{data: []byte("l")}, PriorityLow)
+
+	// Low gets a slot after two highs and a normal, rather than waiting for the high lane to empty
+	assert.Equal(t, []string{"h", "h", "n", "l", "h", "h"}, drainFrames(c))
+}
+
+// TestClient_Enqueue_LaneFull tests that a full lane rejects without blocking
+func TestClient_Enqueue_LaneFull(t *testing.T) {
+	c := newLaneClient(NewHub(zerolog.Nop()))
+	c.sendLow = make(chan frame, 1)
+
+	assert.True(t, c.enqueue(frame{data: []byte("1")}, PriorityLow))
+	assert.False(t, c.enqueue(frame{data: []byte("2")}, PriorityLow))
+	assert.True(t, c.enqueue(frame{data: []byte("3")}, PriorityHigh))
+}
+
+// TestHub_BroadcastToUser_PriorityLane tests that the hub routes messages by derived priority
+func TestHub_BroadcastToUser_PriorityLane(t *testing.T) {
+	hub := NewHub(zerolog.Nop())
+	go hub.Run(t.Context())
+
+	userID := uuid.New()
+	c := newLaneClient(hub)
+	c.userID = &userID
+	require.NoError(t, hub.Register(c))
+	time.Sleep(50 * time.Millisecond)
+
+	for i := 0; i < 3; i++ {
+		hub.BroadcastToUser(userID, "odds_update", map[string]int{"i": i})
+	}
+	hub.BroadcastToUser(userID, "withdrawal_approved", map[string]string{"id": "w1"})
+	time.Sleep(100 * time.Millisecond)
+
+	assert.Len(t, c.sendLow, 3)
+	assert.Len(t, c.sendHigh, 1)
+
+	data, _, ready := c.nextFrame()
+	require.True(t, ready)
+	assert.Contains(t, string(data.data), "withdrawal_approved")
+}
@@ -0,0 +1,167 @@
+package websocket
+
+import (
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Recorder is an in-memory Subscriber that records every message the hub
+// delivers to it. It lets packages that publish through a Hub assert on
+// what users receive without opening real connections.
+type Recorder struct {
+	id       string
+	userID   *uuid.UUID
+	messages []*Message
+	eventIDs []string
+	closed   bool
+	reject   bool
+	device   Device
+	active   time.Time
+	notify   chan struct{}
+	mu       sync.Mutex
+}
+
+// NewRecorder creates a recording subscriber for userID, which may be nil
+func NewRecorder(userID *uuid.UUID) *Recorder {
+	return &Recorder{
+		id:     uuid.New().String(),
+		userID: userID,
+		notify: make(chan struct{}, 1),
+		active: time.Now(),
+	}
+}
+
+// ID returns the recorder's subscriber ID
+func (r *Recorder) ID() string { return r.id }
+
+// UserID returns the user the recorder subscribes as
+func (r *Recorder) UserID() *uuid.UUID { return r.userID }
+
+// Device returns the device set with SetDevice
+func (r *Recorder) Device() Device {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.device
+}
+
+// SetDevice sets the device the recorder reports to the hub
+func (r *Recorder) SetDevice(device Device) {
+	r.mu.Lock()
+	r.device = device
+	r.mu.Unlock()
+}
+
+// LastActive returns when the recorder was created or last touched
+func (r *Recorder) LastActive() time.Time {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.active
+}
+
+// Touch marks the recorder as active now, as a user interaction would
+func (r *Recorder) Touch() {
+	r.mu.Lock()
+	r.active = time.Now()
+	r.mu.Unlock()
+}
+
+// Enqueue records the delivered message
+func (r *Recorder) Enqueue(d *Delivery) bool {
+	r.mu.Lock()
+	if r.reject {
+		r.mu.Unlock()
+		return false
+	}
+	r.messages = append(r.messages, d.Message())
+	r.eventIDs = append(r.eventIDs, d.EventID())
+	r.mu.Unlock()
+
+	select {
+	case r.notify <- struct{}{}:
+	default:
+	}
+	return true
+}
+
+// Close marks the recorder as unregistered
+func (r *Recorder) Close() {
+	r.mu.Lock()
+	r.closed = true
+	r.mu.Unlock()
+
+	select {
+	case r.notify <- struct{}{}:
+	default:
+	}
+}
+
+// SetFull makes Enqueue report a full buffer, dropping further messages
+func (r *Recorder) SetFull(full bool) {
+	r.mu.Lock()
+	r.reject = full
+	r.mu.Unlock()
+}
+
+// Messages returns the messages recorded so far, oldest first
+func (r *Recorder) Messages() []*Message {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]*Message(nil), r.messages...)
+}
+
+// EventIDs returns the replay event IDs of the recorded messages
+func (r *Recorder) EventIDs() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]string(nil), r.eventIDs...)
+}
+
+// Types returns the types of the recorded messages, oldest first
+func (r *Recorder) Types() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	types := make([]string, len(r.messages))
+	for i, msg := range r.messages {
+		types[i] = msg.Type
+	}
+	return types
+}
+
+// Closed reports whether the hub has unregistered the recorder
+func (r *Recorder) Closed() bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.closed
+}
+
+// Reset discards the recorded messages
+func (r *Recorder) Reset() {
+	r.mu.Lock()
+	r.messages = nil
+	r.eventIDs = nil
+	r.mu.Unlock()
+}
+
+// WaitFor waits until at least n messages have been recorded, returning
+// false if that does not happen within timeout
+func (r *Recorder) WaitFor(n int, timeout time.Duration) bool {
+	deadline := time.NewTimer(timeout)
+	defer deadline.Stop()
+
+	for {
+		r.mu.Lock()
+		count := len(r.messages)
+		r.mu.Unlock()
+		if count >= n {
+			return true
+		}
+
+		select {
+		case <-r.notify:
+		case <-deadline.C:
+			return false
+		}
+	}
+}
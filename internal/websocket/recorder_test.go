@@ -0,0 +1,76 @@
+package websocket
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+// TestRecorder_ImplementsSubscriber tests that every transport satisfies Subscriber
+func TestRecorder_ImplementsSubscriber(t *testing.T) {
+	var _ Subscriber = (*Recorder)(nil)
+	var _ Subscriber = (*Client)(nil)
+	var _ Subscriber = (*streamSubscriber)(nil)
+}
+
+// TestRecorder_Records tests that the recorder captures messages, event IDs and closure
+func TestRecorder_Records(t *testing.T) {
+	hub := NewHub(zerolog.Nop())
+	go hub.Run(t.Context())
+
+	userID := uuid.New()
+	rec := NewRecorder(&userID)
+	assert.NotEmpty(t, rec.ID())
+	assert.Equal(t, &userID, rec.UserID())
+
+	require.NoError(t, hub.Register(rec))
+	hub.BroadcastToUser(userID, "deposit_received", map[string]int{"amount": 10})
+	hub.BroadcastToAll("maintenance", nil)
+
+	require.True(t, rec.WaitFor(2, time.Second))
+	assert.Equal(t, []string{"deposit_received", "maintenance"}, rec.Types())
+	ids := rec.EventIDs()
+	require.Len(t, ids, 2)
+	assert.NotEmpty(t, ids[0])
+	assert.NotEqual(t, ids[0], ids[1])
+
+	rec.Reset()
+	assert.Empty(t, rec.Messages())
+
+	hub.Unregister(rec)
+	require.Eventually(t, rec.Closed, time.Second, 10*time.Millisecond)
+}
+
+// TestRecorder_SetFull tests that a full recorder reports drops
+func TestRecorder_SetFull(t *testing.T) {
+	rec := NewRecorder(nil)
+	rec.SetFull(true)
+	assert.False(t, rec.Enqueue(newDelivery(&Message{Type: "x"}, nil)))
+
+	rec.SetFull(false)
+	assert.True(t, rec.Enqueue(newDelivery(&Message{Type: "y"}, nil)))
+	assert.Equal(t, []string{"y"}, rec.Types())
+	assert.False(t, rec.WaitFor(2, 10*time.Millisecond))
+}
+
+// TestDelivery_Encode tests the exported Delivery accessors
+func TestDelivery_Encode(t *testing.T) {
+	msg := &Message{Type: "test", Payload: "x"}
+	d := newDelivery(msg, nil)
+	assert.Same(t, msg, d.Message())
+	assert.Empty(t, d.EventID())
+
+	data, err := d.Encode(FormatMsgpack)
+	require.NoError(t, err)
+	var decoded map[string]interface{}
+	require.NoError(t, msgpack.Unmarshal(data, &decoded))
+	assert.Equal(t, "test", decoded["type"])
+
+	_, err = d.Encode(Format(42))
+	assert.Error(t, err)
+}
@@ -0,0 +1,191 @@
+package websocket
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	defaultReplaySize   = 100
+	defaultReplayMaxAge = 5 * time.Minute
+	// replaySweepEvery is how many appends pass between sweeps of idle users
+	replaySweepEvery = 1024
+)
+
+// replayEntry is a delivered message retained for resuming transports
+type replayEntry struct {
+	seq uint64
+	at  time.Time
+	msg *Message
+}
+
+// replayRing holds the most recent entries of one stream
+type replayRing struct {
+	entries []replayEntry
+	evicted uint64 // highest sequence dropped from the ring
+}
+
+func (r *replayRing) append(entry replayEntry, size int) {
+	r.entries = append(r.entries, entry)
+	if len(r.entries) > size {
+		drop := len(r.entries) - size
+		r.evicted = r.entries[drop-1].seq
+		r.entries = append(r.entries[:0], r.entries[drop:]...)
+	}
+}
+
+// replayLog retains recent user and broadcast messages with hub-wide
+// sequence numbers, so SSE reconnects (Last-Event-ID) and long-polls
+// (cursor) can pick up what they missed while disconnected. Event IDs are
+// "<epoch>-<seq>"; the epoch changes on restart, which invalidates old IDs.
+type replayLog struct {
+	epoch   string
+	seq     uint64
+	swept   uint64 // sequence at the last sweep of idle users
+	size    int
+	maxAge  time.Duration
+	users   map[uuid.UUID]*replayRing
+	all     replayRing
+	appends int
+	now     func() time.Time
+	mu      sync.Mutex
+}
+
+func newReplayLog(size int, maxAge time.Duration) *replayLog {
+	return &replayLog{
+		epoch:  strconv.FormatInt(time.Now().UnixNano(), 36),
+		size:   size,
+		maxAge: maxAge,
+		users:  make(map[uuid.UUID]*replayRing),
+		now:    time.Now,
+	}
+}
+
+func (l *replayLog) eventID(seq uint64) string {
+	return fmt.Sprintf("%s-%d", l.epoch, seq)
+}
+
+// append records a message and returns its event ID
+func (l *replayLog) append(msg *Message) string {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.seq++
+	entry := replayEntry{seq: l.seq, at: l.now(), msg: msg}
+	switch {
+	case msg.recipients != nil:
+		for _, userID := range msg.recipients {
+			l.userRing(userID).append(entry, l.size)
+		}
+	case msg.UserID != nil:
+		l.userRing(*msg.UserID).append(entry, l.size)
+	default:
+		l.all.append(entry, l.size)
+	}
+
+	l.appends++
+	if l.appends%replaySweepEvery == 0 {
+		l.sweep()
+	}
+	return l.eventID(l.seq)
+}
+
+// userRing returns the user's ring, creating it if needed; must hold l.mu
+func (l *replayLog) userRing(userID uuid.UUID) *replayRing {
+	ring, ok := l.users[userID]
+	if !ok {
+		ring = &replayRing{}
+		l.users[userID] = ring
+	}
+	return ring
+}
+
+// sweep drops users whose newest entry has expired; must hold l.mu
+func (l *replayLog) sweep() {
+	cutoff := l.now().Add(-l.maxAge)
+	for userID, ring := range l.users {
+		if ring.entries[len(ring.entries)-1].at.Before(cutoff) {
+			delete(l.users, userID)
+		}
+	}
+	l.swept = l.seq
+}
+
+// head returns the event ID of the most recent message
+func (l *replayLog) head() string {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.eventID(l.seq)
+}
+
+// since returns the messages for userID (and broadcasts) after lastID in
+// order. ok is false when lastID cannot be resumed from without a gap: it
+// belongs to a previous process, or messages after it were evicted or expired.
+func (l *replayLog) since(userID *uuid.UUID, lastID string) (entries []replayEntry, ok bool) {
+	epoch, seqStr, found := strings.Cut(lastID, "-")
+	if !found || epoch != l.epoch {
+		return nil, false
+	}
+	last, err := strconv.ParseUint(seqStr, 10, 64)
+	if err != nil {
+		return nil, false
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if last > l.seq {
+		return nil, false
+	}
+
+	cutoff := l.now().Add(-l.maxAge)
+	ok = true
+	collect := func(ring *replayRing) []replayEntry {
+		if ring.evicted > last {
+			ok = false
+			return nil
+		}
+		var out []replayEntry
+		for _, e := range ring.entries {
+			if e.seq <= last {
+				continue
+			}
+			if e.at.Before(cutoff) {
+				ok = false
+				return nil
+			}
+			out = append(out, e)
+		}
+		return out
+	}
+
+	var user []replayEntry
+	if userID != nil {
+		if ring, exists := l.users[*userID]; exists {
+			user = collect(ring)
+		} else if last < l.swept {
+			// The user's history may have been swept after the cursor
+			ok = false
+		}
+	}
+	broadcast := collect(&l.all)
+	if !ok {
+		return nil, false
+	}
+
+	// Merge the two ordered streams by sequence
+	entries = make([]replayEntry, 0, len(user)+len(broadcast))
+	for len(user) > 0 || len(broadcast) > 0 {
+		if len(broadcast) == 0 || (len(user) > 0 && user[0].seq < broadcast[0].seq) {
+			entries, user = append(entries, user[0]), user[1:]
+		} else {
+			entries, broadcast = append(entries, broadcast[0]), broadcast[1:]
+		}
+	}
+	return entries, true
+}
@@ -0,0 +1,92 @@
+package websocket
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func replayTypes(entries []replayEntry) []string {
+	out := make([]string, len(entries))
+	for i, e := range entries {
+		out[i] = e.msg.Type
+	}
+	return out
+}
+
+// TestReplayLog_Since tests that user and broadcast messages are merged in order
+func TestReplayLog_Since(t *testing.T) {
+	l := newReplayLog(10, time.Minute)
+	alice, bob := uuid.New(), uuid.New()
+
+	start := l.head()
+	l.append(&Message{Type: "a1", UserID: &alice})
+	l.append(&Message{Type: "all1"})
+	l.append(&Message{Type: "b1", UserID: &bob})
+	mid := l.append(&Message{Type: "a2", UserID: &alice})
+	l.append(&Message{Type: "all2"})
+
+	entries, ok := l.since(&alice, start)
+	require.True(t, ok)
+	assert.Equal(t, []string{"a1", "all1", "a2", "all2"}, replayTypes(entries))
+
+	entries, ok = l.since(&alice, mid)
+	require.True(t, ok)
+	assert.Equal(t, []string{"all2"}, replayTypes(entries))
+
+	entries, ok = l.since(nil, start)
+	require.True(t, ok)
+	assert.Equal(t, []string{"all1", "all2"}, replayTypes(entries))
+}
+
+// TestReplayLog_UnresumableIDs tests that foreign, future and malformed IDs cannot be resumed
+func TestReplayLog_UnresumableIDs(t *testing.T) {
+	l := newReplayLog(10, time.Minute)
+	l.append(&Message{Type: "x"})
+
+	for _, id := range []string{"", "garbage", "otherepoch-1", l.eventID(99), l.epoch + "-abc"} {
+		_, ok := l.since(nil, id)
+		assert.False(t, ok, id)
+	}
+}
+
+// TestReplayLog_Evicted tests that a cursor older than the retained window requires a resync
+func TestReplayLog_Evicted(t *testing.T) {
+	l := newReplayLog(2, time.Minute)
+	userID := uuid.New()
+
+	start := l.head()
+	l.append(&Message{Type: "1", UserID: &userID})
+	second := l.append(&Message{Type: "2", UserID: &userID})
+	l.append(&Message{Type: "3", UserID: &userID})
+
+	_, ok := l.since(&userID, start)
+	assert.False(t, ok)
+
+	entries, ok := l.since(&userID, second)
+	require.True(t, ok)
+	assert.Equal(t, []string{"3"}, replayTypes(entries))
+}
+
+// TestReplayLog_Expired tests that messages older than the max age are not replayed
+func TestReplayLog_Expired(t *testing.T) {
+	now := time.Now()
+	l := newReplayLog(10, time.Minute)
+	l.now = func() time.Time { return now }
+	userID := uuid.New()
+
+	start := l.head()
+	l.append(&Message{Type: "old", UserID: &userID})
+
+	now = now.Add(2 * time.Minute)
+	_, ok := l.since(&userID, start)
+	assert.False(t, ok)
+
+	// Resuming after the expired message is still possible
+	entries, ok := l.since(&userID, l.head())
+	assert.True(t, ok)
+	assert.Empty(t, entries)
+}
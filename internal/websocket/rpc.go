@@ -0,0 +1,252 @@
+package websocket
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	// MessageTypeRPCReply carries the result or error of a client's RPC call
+	MessageTypeRPCReply = "rpc_reply"
+
+	defaultRPCTimeout = 5 * time.Second
+	maxRPCTimeout     = 30 * time.Second
+	// maxRPCInFlight bounds the calls a single connection may have running
+	maxRPCInFlight = 8
+)
+
+// RPC error codes returned to clients
+const (
+	RPCCodeInvalidRequest  = "invalid_request"
+	RPCCodeMethodNotFound  = "method_not_found"
+	RPCCodeInvalidParams   = "invalid_params"
+	RPCCodeUnauthenticated = "unauthenticated"
+	RPCCodeForbidden       = "forbidden"
+	RPCCodeTimeout         = "timeout"
+	RPCCodeTooManyRequests = "too_many_requests"
+	RPCCodeInternal        = "internal"
+)
+
+// RPCError is a typed error returned to the calling client. Handlers return
+// one to choose the code the client sees; any other error is reported as
+// RPCCodeInternal without its details.
+type RPCError struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// NewRPCError creates an RPC error with the given code
+func NewRPCError(code, format string, args ...interface{}) *RPCError {
+	return &RPCError{Code: code, Message: fmt.Sprintf(format, args...)}
+}
+
+func (e *RPCError) Error() string {
+	return e.Code + ": " + e.Message
+}
+
+// RPCCall is a request made by a client over its connection
+type RPCCall struct {
+	ID       string
+	Method   string
+	Params   json.RawMessage
+	UserID   *uuid.UUID // nil for anonymous connections
+	ClientID string
+
+	subscriber Subscriber
+}
+
+// Bind decodes the call's params into v, failing with RPCCodeInvalidParams
+func (c *RPCCall) Bind(v interface{}) error {
+	if len(c.Params) == 0 {
+		return NewRPCError(RPCCodeInvalidParams, "params are required")
+	}
+	if err := json.Unmarshal(c.Params, v); err != nil {
+		return NewRPCError(RPCCodeInvalidParams, "invalid params: %v", err)
+	}
+	return nil
+}
+
+// RPCHandler answers an RPC call. ctx is cancelled when the call times out
+// or the connection closes.
+type RPCHandler func(ctx context.Context, call *RPCCall) (interface{}, error)
+
+// RPCAuthorizer decides whether a call may proceed, returning an *RPCError
+// such as RPCCodeForbidden to reject it
+type RPCAuthorizer func(call *RPCCall) error
+
+type rpcMethod struct {
+	handler   RPCHandler
+	authorize RPCAuthorizer
+	timeout   time.Duration
+}
+
+// RPCOption configures a registered RPC method
+type RPCOption func(*rpcMethod)
+
+// RPCTimeout overrides the default 5s deadline of a method, up to 30s
+func RPCTimeout(timeout time.Duration) RPCOption {
+	return func(m *rpcMethod) {
+		m.timeout = min(timeout, maxRPCTimeout)
+	}
+}
+
+// RPCAuthorize replaces the default authorization of a method, which only
+// admits authenticated users
+func RPCAuthorize(fn RPCAuthorizer) RPCOption {
+	return func(m *rpcMethod) {
+		m.authorize = fn
+	}
+}
+
+// RPCAllowAnonymous lets connections without a user call the method
+func RPCAllowAnonymous() RPCOption {
+	return RPCAuthorize(func(*RPCCall) error { return nil })
+}
+
+// RequireUser is the default authorizer: it rejects anonymous connections
+func RequireUser(call *RPCCall) error {
+	if call.UserID == nil {
+		return NewRPCError(RPCCodeUnauthenticated, "%s requires an authenticated user", call.Method)
+	}
+	return nil
+}
+
+// RPCRouter is the registry of methods clients can call over their connection
+type RPCRouter struct {
+	methods map[string]*rpcMethod
+	mu      sync.RWMutex
+}
+
+// NewRPCRouter creates an empty RPC registry
+func NewRPCRouter() *RPCRouter {
+	return &RPCRouter{methods: make(map[string]*rpcMethod)}
+}
+
+// Handle registers the handler for a method such as "inbox.count",
+// replacing any previous registration
+func (r *RPCRouter) Handle(method string, handler RPCHandler, opts ...RPCOption) {
+	m := &rpcMethod{
+		handler:   handler,
+		authorize: RequireUser,
+		timeout:   defaultRPCTimeout,
+	}
+	for _, opt := range opts {
+		opt(m)
+	}
+
+	r.mu.Lock()
+	r.methods[method] = m
+	r.mu.Unlock()
+}
+
+// Methods lists the registered method names
+func (r *RPCRouter) Methods() []string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	names := make([]string, 0, len(r.methods))
+	for name := range r.methods {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func (r *RPCRouter) lookup(method string) (*rpcMethod, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	m, ok := r.methods[method]
+	return m, ok
+}
+
+// serve authorizes and runs a call. Failures other than handler errors are
+// returned as an *RPCError; handler errors are returned as is.
+func (r *RPCRouter) serve(ctx context.Context, call *RPCCall) (interface{}, error) {
+	m, ok := r.lookup(call.Method)
+	if !ok {
+		return nil, NewRPCError(RPCCodeMethodNotFound, "unknown method %q", call.Method)
+	}
+	if err := m.authorize(call); err != nil {
+		return nil, toRPCError(err, RPCCodeForbidden)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, m.timeout)
+	defer cancel()
+
+	type outcome struct {
+		result interface{}
+		err    error
+	}
+	done := make(chan outcome, 1)
+	go func() {
+		defer func() {
+			if p := recover(); p != nil {
+				done <- outcome{err: fmt.Errorf("handler panic: %v", p)}
+			}
+		}()
+		result, err := m.handler(ctx, call)
+		done <- outcome{result: result, err: err}
+	}()
+
+	select {
+	case out := <-done:
+		return out.result, out.err
+	case <-ctx.Done():
+		if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			return nil, NewRPCError(RPCCodeTimeout, "%s did not complete within %s", call.Method, m.timeout)
+		}
+		return nil, NewRPCError(RPCCodeTimeout, "call cancelled")
+	}
+}
+
+// toRPCError passes typed errors through and hides the details of others
+func toRPCError(err error, fallback string) *RPCError {
+	var rpcErr *RPCError
+	if errors.As(err, &rpcErr) {
+		return rpcErr
+	}
+	if errors.Is(err, context.DeadlineExceeded) {
+		return NewRPCError(RPCCodeTimeout, "deadline exceeded")
+	}
+	if fallback == RPCCodeInternal {
+		return NewRPCError(RPCCodeInternal, "internal error")
+	}
+	return NewRPCError(fallback, "%v", err)
+}
+
+// rpcReply is the payload of a MessageTypeRPCReply message
+type rpcReply struct {
+	ID     string      `json:"id"`
+	Result interface{} `json:"result,omitempty"`
+	Error  *RPCError   `json:"error,omitempty"`
+}
+
+func rpcReplyMessage(id string, result interface{}, err *RPCError) *Message {
+	return &Message{
+		Type:    MessageTypeRPCReply,
+		Payload: rpcReply{ID: id, Result: result, Error: err},
+	}
+}
+
+// subscriptionsList is the built-in "subscriptions.list" method
+func (h *Hub) subscriptionsList(_ context.Context, call *RPCCall) (interface{}, error) {
+	return map[string][]string{"topics": h.topicsOf(call.subscriber)}, nil
+}
+
+// topicsOf returns the topics a subscriber follows, sorted
+func (h *Hub) topicsOf(sub Subscriber) []string {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	topics := make([]string, 0, len(h.subTopics[sub]))
+	for topic := range h.subTopics[sub] {
+		topics = append(topics, topic)
+	}
+	sort.Strings(topics)
+	return topics
+}
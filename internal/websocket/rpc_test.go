@@ -0,0 +1,241 @@
+package websocket
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/websocket"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+type rpcTestReply struct {
+	Type    string `json:"type"`
+	Payload struct {
+		ID     string          `json:"id"`
+		Result json.RawMessage `json:"result"`
+		Error  *RPCError       `json:"error"`
+	} `json:"payload"`
+}
+
+func readRPCReply(t *testing.T, c *Client) rpcTestReply {
+	t.Helper()
+	select {
+	case f := <-c.send:
+		var reply rpcTestReply
+		require.NoError(t, json.Unmarshal(f.data, &reply))
+		require.Equal(t, MessageTypeRPCReply, reply.Type)
+		return reply
+	case <-time.After(2 * time.Second):
+		t.Fatal("Timeout waiting for rpc reply")
+		return rpcTestReply{}
+	}
+}
+
+func rpcCall(c *Client, id, method string, params string) {
+	frame := `{"op":"rpc","id":"` + id + `","method":"` + method + `"`
+	if params != "" {
+		frame += `,"params":` + params
+	}
+	c.handleControl(websocket.TextMessage, []byte(frame+"}"))
+}
+
+// TestRPCRouter_Serve tests routing, authorization and error typing
+func TestRPCRouter_Serve(t *testing.T) {
+	router := NewRPCRouter()
+	router.Handle("inbox.count", func(ctx context.Context, call *RPCCall) (interface{}, error) {
+		return 3, nil
+	})
+	router.Handle("orders.get", func(ctx context.Context, call *RPCCall) (interface{}, error) {
+		var params struct {
+			OrderID string `json:"order_id"`
+		}
+		if err := call.Bind(&params); err != nil {
+			return nil, err
+		}
+		return nil, NewRPCError("not_found", "order %s not found", params.OrderID)
+	})
+	router.Handle("broken", func(ctx context.Context, call *RPCCall) (interface{}, error) {
+		return nil, errors.New("database password is hunter2")
+	})
+	router.Handle("staff.only", func(ctx context.Context, call *RPCCall) (interface{}, error) {
+		return "ok", nil
+	}, RPCAuthorize(func(call *RPCCall) error {
+		return errors.New("staff role required")
+	}))
+	assert.Equal(t, []string{"broken", "inbox.count", "orders.get", "staff.only"}, router.Methods())
+
+	userID := uuid.New()
+	serve := func(method, params string, user *uuid.UUID) (interface{}, *RPCError) {
+		call := &RPCCall{ID: "1", Method: method, UserID: user}
+		if params != "" {
+			call.Params = json.RawMessage(params)
+		}
+		result, err := router.serve(context.Background(), call)
+		if err != nil {
+			return nil, toRPCError(err, RPCCodeInternal)
+		}
+		return result, nil
+	}
+
+	result, rpcErr := serve("inbox.count", "", &userID)
+	require.Nil(t, rpcErr)
+	assert.Equal(t, 3, result)
+
+	_, rpcErr = serve("inbox.count", "", nil)
+	assert.Equal(t, RPCCodeUnauthenticated, rpcErr.Code)
+
+	_, rpcErr = serve("nope", "", &userID)
+	assert.Equal(t, RPCCodeMethodNotFound, rpcErr.Code)
+
+	_, rpcErr = serve("orders.get", "", &userID)
+	assert.Equal(t, RPCCodeInvalidParams, rpcErr.Code)
+
+	_, rpcErr = serve("orders.get", `{"order_id":"o-1"}`, &userID)
+	assert.Equal(t, &RPCError{Code: "not_found", Message: "order o-1 not found"}, rpcErr)
+
+	_, rpcErr = serve("broken", "", &userID)
+	assert.Equal(t, RPCCodeInternal, rpcErr.Code)
+	assert.NotContains(t, rpcErr.Message, "hunter2")
+
+	_, rpcErr = serve("staff.only", "", &userID)
+	assert.Equal(t, RPCCodeForbidden, rpcErr.Code)
+}
+
+// TestRPCRouter_Timeout tests that slow handlers are cut off and their context cancelled
+func TestRPCRouter_Timeout(t *testing.T) {
+	router := NewRPCRouter()
+	cancelled := make(chan struct{})
+	router.Handle("slow", func(ctx context.Context, call *RPCCall) (interface{}, error) {
+		<-ctx.Done()
+		close(cancelled)
+		return nil, ctx.Err()
+	}, RPCTimeout(20*time.Millisecond), RPCAllowAnonymous())
+	router.Handle("panics", func(ctx context.Context, call *RPCCall) (interface{}, error) {
+		panic("boom")
+	}, RPCAllowAnonymous())
+
+	_, err := router.serve(context.Background(), &RPCCall{Method: "slow"})
+	assert.Equal(t, RPCCodeTimeout, toRPCError(err, RPCCodeInternal).Code)
+	select {
+	case <-cancelled:
+	case <-time.After(time.Second):
+		t.Fatal("handler context was not cancelled")
+	}
+
+	_, err = router.serve(context.Background(), &RPCCall{Method: "panics"})
+	assert.Equal(t, RPCCodeInternal, toRPCError(err, RPCCodeInternal).Code)
+}
+
+// TestClient_RPC tests calls and replies over a client connection
+func TestClient_RPC(t *testing.T) {
+	router := NewRPCRouter()
+	router.Handle("inbox.count", func(ctx context.Context, call *RPCCall) (interface{}, error) {
+		return map[string]interface{}{"unread": 7, "user_id": call.UserID.String()}, nil
+	})
+	hub := NewHub(zerolog.Nop(), WithRPC(router))
+	go hub.Run(t.Context())
+
+	userID := uuid.New()
+	c := newLaneClient(hub)
+	c.userID = &userID
+	require.NoError(t, hub.Register(c))
+
+	rpcCall(c, "req-1", "inbox.count", "")
+	reply := readRPCReply(t, c)
+	assert.Equal(t, "req-1", reply.Payload.ID)
+	assert.Nil(t, reply.Payload.Error)
+	assert.JSONEq(t, `{"unread":7,"user_id":"`+userID.String()+`"}`, string(reply.Payload.Result))
+
+	rpcCall(c, "req-2", "inbox.delete_all", "")
+	reply = readRPCReply(t, c)
+	assert.Equal(t, "req-2", reply.Payload.ID)
+	require.NotNil(t, reply.Payload.Error)
+	assert.Equal(t, RPCCodeMethodNotFound, reply.Payload.Error.Code)
+
+	// The built-in method lists the connection's topic subscriptions
+	hub.Subscribe(c, "market:2")
+	hub.Subscribe(c, "market:1")
+	<-c.sendLow
+	<-c.sendLow
+	rpcCall(c, "req-3", "subscriptions.list", "")
+	reply = readRPCReply(t, c)
+	assert.JSONEq(t, `{"topics":["market:1","market:2"]}`, string(reply.Payload.Result))
+
+	// Calls need an ID to correlate the reply
+	c.handleControl(websocket.TextMessage, []byte(`{"op":"rpc","method":"inbox.count"}`))
+	assert.Contains(t, string((<-c.send).data), RPCCodeInvalidRequest)
+}
+
+// TestClient_RPC_MsgpackParams tests that msgpack params reach handlers as JSON
+func TestClient_RPC_MsgpackParams(t *testing.T) {
+	router := NewRPCRouter()
+	router.Handle("echo", func(ctx context.Context, call *RPCCall) (interface{}, error) {
+		var params map[string]interface{}
+		if err := call.Bind(&params); err != nil {
+			return nil, err
+		}
+		return params, nil
+	}, RPCAllowAnonymous())
+	hub := NewHub(zerolog.Nop(), WithRPC(router))
+
+	c := newLaneClient(hub)
+	c.format = FormatMsgpack
+	data, err := msgpack.Marshal(map[string]interface{}{
+		"op": "rpc", "id": "m1", "method": "echo",
+		"params": map[string]interface{}{"market_id": "m-9"},
+	})
+	require.NoError(t, err)
+	c.handleControl(websocket.BinaryMessage, data)
+
+	select {
+	case f := <-c.send:
+		var decoded map[string]interface{}
+		require.NoError(t, msgpack.Unmarshal(f.data, &decoded))
+		payload := decoded["payload"].(map[string]interface{})
+		assert.Equal(t, "m1", payload["id"])
+		assert.Equal(t, map[string]interface{}{"market_id": "m-9"}, payload["result"])
+	case <-time.After(2 * time.Second):
+		t.Fatal("Timeout waiting for rpc reply")
+	}
+}
+
+// TestClient_RPC_InFlightLimit tests the per-connection cap on running calls
+func TestClient_RPC_InFlightLimit(t *testing.T) {
+	router := NewRPCRouter()
+	release := make(chan struct{})
+	router.Handle("block", func(ctx context.Context, call *RPCCall) (interface{}, error) {
+		<-release
+		return nil, nil
+	}, RPCAllowAnonymous())
+	hub := NewHub(zerolog.Nop(), WithRPC(router))
+
+	c := newLaneClient(hub)
+	for i := 0; i < maxRPCInFlight; i++ {
+		rpcCall(c, "ok", "block", "")
+	}
+	rpcCall(c, "over", "block", "")
+	reply := readRPCReply(t, c)
+	assert.Equal(t, "over", reply.Payload.ID)
+	assert.Equal(t, RPCCodeTooManyRequests, reply.Payload.Error.Code)
+
+	close(release)
+	for i := 0; i < maxRPCInFlight; i++ {
+		readRPCReply(t, c)
+	}
+	assert.Eventually(t, func() bool { return c.rpcInFlight.Load() == 0 }, time.Second, 10*time.Millisecond)
+}
+
+// TestClient_RPC_Disabled tests calls on a hub without an RPC router
+func TestClient_RPC_Disabled(t *testing.T) {
+	c := newLaneClient(NewHub(zerolog.Nop()))
+	rpcCall(c, "x", "inbox.count", "")
+	reply := readRPCReply(t, c)
+	assert.Equal(t, RPCCodeMethodNotFound, reply.Payload.Error.Code)
+}
@@ -0,0 +1,118 @@
+package websocket
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/rs/zerolog"
+)
+
+const (
+	sseBuffer    = 256
+	sseHeartbeat = 15 * time.Second
+	sseRetry     = 3 * time.Second
+)
+
+// ServeSSE streams the user's messages as Server-Sent Events for clients
+// that cannot use WebSockets. When the browser reconnects it sends the
+// Last-Event-ID header and missed messages are replayed; if that is no
+// longer possible a "resync" event tells the client to reload its state.
+func ServeSSE(hub *Hub, w http.ResponseWriter, r *http.Request, userID *uuid.UUID, logger zerolog.Logger) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming unsupported", http.StatusInternalServerError)
+		return
+	}
+
+	lastEventID := r.Header.Get("Last-Event-ID")
+	if lastEventID == "" {
+		lastEventID = r.URL.Query().Get("last_event_id")
+	}
+
+	sub := newStreamSubscriber(userID, sseBuffer)
+	sub.device = streamDevice(r)
+	logger = logger.With().Str("component", "sse").Str("client_id", sub.id).Logger()
+
+	result, err := hub.attach(sub, lastEventID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusServiceUnavailable)
+		return
+	}
+	defer hub.Unregister(sub)
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	// Stop proxies such as nginx from buffering the stream
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	fmt.Fprintf(w, "retry: %d\n\n", sseRetry.Milliseconds())
+
+	switch {
+	case !result.resumed:
+		fmt.Fprintf(w, "id: %s\nevent: resync\ndata: {}\n\n", result.head)
+	case lastEventID == "":
+		// An id-only event sets the browser's Last-Event-ID, so a reconnect
+		// before the first message still resumes from here
+		fmt.Fprintf(w, "id: %s\n\n", result.head)
+	}
+	flusher.Flush()
+
+	heartbeat := time.NewTicker(sseHeartbeat)
+	defer heartbeat.Stop()
+
+	for {
+		select {
+		case event := <-sub.events:
+			writeSSEEvent(w, event)
+			// Write everything already queued before flushing
+			drainSSE(w, sub)
+			flusher.Flush()
+
+		case <-heartbeat.C:
+			if _, err := fmt.Fprint(w, ": ping\n\n"); err != nil {
+				return
+			}
+			flusher.Flush()
+
+		case <-sub.done:
+			// Deliver what was queued before the hub closed the stream, such
+			// as a session_revoked notice
+			drainSSE(w, sub)
+			flusher.Flush()
+			logger.Debug().Msg("sse subscriber closed by hub")
+			return
+
+		case <-r.Context().Done():
+			return
+		}
+	}
+}
+
+func writeSSEEvent(w http.ResponseWriter, event streamEvent) {
+	if event.expired() {
+		// Still advance the browser's Last-Event-ID past the stale message
+		if event.id != "" {
+			fmt.Fprintf(w, "id: %s\n\n", event.id)
+		}
+		return
+	}
+	if event.id != "" {
+		fmt.Fprintf(w, "id: %s\n", event.id)
+	}
+	fmt.Fprintf(w, "data: %s\n\n", event.data)
+}
+
+// drainSSE writes the events already queued for sub without blocking
+func drainSSE(w http.ResponseWriter, sub *streamSubscriber) {
+	for {
+		select {
+		case event := <-sub.events:
+			writeSSEEvent(w, event)
+		default:
+			return
+		}
+	}
+}
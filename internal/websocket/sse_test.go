@@ -0,0 +1,136 @@
+package websocket
+
+import (
+	"bufio"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// sseEvent is a parsed Server-Sent Event
+type sseEvent struct {
+	id    string
+	event string
+	data  string
+}
+
+// readSSE parses events from an SSE stream until n events with data or an event type are read
+func readSSE(t *testing.T, body *bufio.Reader, n int) []sseEvent {
+	t.Helper()
+	var events []sseEvent
+	var cur sseEvent
+	for len(events) < n {
+		line, err := body.ReadString('\n')
+		require.NoError(t, err)
+		line = strings.TrimRight(line, "\n")
+		switch {
+		case line == "":
+			if cur.data != "" || cur.event != "" {
+				events = append(events, cur)
+			}
+			cur = sseEvent{}
+		case strings.HasPrefix(line, "id: "):
+			cur.id = strings.TrimPrefix(line, "id: ")
+		case strings.HasPrefix(line, "event: "):
+			cur.event = strings.TrimPrefix(line, "event: ")
+		case strings.HasPrefix(line, "data: "):
+			cur.data = strings.TrimPrefix(line, "data: ")
+		}
+	}
+	return events
+}
+
+func startSSE(t *testing.T, hub *Hub, userID *uuid.UUID, lastEventID string) (*bufio.Reader, context.CancelFunc) {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ServeSSE(hub, w, r, userID, zerolog.Nop())
+	}))
+	t.Cleanup(server.Close)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, server.URL, nil)
+	require.NoError(t, err)
+	if lastEventID != "" {
+		req.Header.Set("Last-Event-ID", lastEventID)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	t.Cleanup(func() { resp.Body.Close() })
+	assert.Equal(t, "text/event-stream", resp.Header.Get("Content-Type"))
+
+	return bufio.NewReader(resp.Body), cancel
+}
+
+// TestServeSSE_Stream tests that BroadcastToUser reaches an SSE subscriber
+func TestServeSSE_Stream(t *testing.T) {
+	hub := NewHub(zerolog.Nop())
+	go hub.Run(t.Context())
+	userID := uuid.New()
+
+	body, cancel := startSSE(t, hub, &userID, "")
+	defer cancel()
+	waitForClients(t, hub, 1)
+
+	hub.BroadcastToUser(userID, "deposit_received", map[string]string{"amount": "10"})
+
+	events := readSSE(t, body, 1)
+	assert.NotEmpty(t, events[0].id)
+	assert.Contains(t, events[0].data, `"type":"deposit_received"`)
+}
+
+// TestServeSSE_Resume tests that a reconnect with Last-Event-ID replays missed messages
+func TestServeSSE_Resume(t *testing.T) {
+	hub := NewHub(zerolog.Nop())
+	go hub.Run(t.Context())
+	userID := uuid.New()
+
+	body, cancel := startSSE(t, hub, &userID, "")
+	waitForClients(t, hub, 1)
+	hub.BroadcastToUser(userID, "first", nil)
+	first := readSSE(t, body, 1)[0]
+	cancel()
+	waitForClients(t, hub, 0)
+
+	// Sent while disconnected
+	hub.BroadcastToUser(userID, "second", nil)
+	hub.BroadcastToUser(uuid.New(), "someone_else", nil)
+	hub.BroadcastToUser(userID, "third", nil)
+	time.Sleep(50 * time.Millisecond)
+
+	body, cancel = startSSE(t, hub, &userID, first.id)
+	defer cancel()
+
+	events := readSSE(t, body, 2)
+	assert.Contains(t, events[0].data, `"type":"second"`)
+	assert.Contains(t, events[1].data, `"type":"third"`)
+}
+
+// TestServeSSE_Resync tests that an unknown Last-Event-ID produces a resync event
+func TestServeSSE_Resync(t *testing.T) {
+	hub := NewHub(zerolog.Nop())
+	go hub.Run(t.Context())
+
+	body, cancel := startSSE(t, hub, nil, "previous-process-42")
+	defer cancel()
+
+	events := readSSE(t, body, 1)
+	assert.Equal(t, "resync", events[0].event)
+	assert.NotEmpty(t, events[0].id)
+}
+
+func waitForClients(t *testing.T, hub *Hub, n int) {
+	t.Helper()
+	require.Eventually(t, func() bool {
+		hub.mu.RLock()
+		defer hub.mu.RUnlock()
+		return len(hub.clients) == n
+	}, time.Second, 10*time.Millisecond)
+}
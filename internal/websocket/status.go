@@ -0,0 +1,85 @@
+package websocket
+
+import (
+	"sync"
+
+	"github.com/google/uuid"
+)
+
+// Delivery states reported to a StatusFunc
+const (
+	StatusSent   = "sent"
+	StatusAcked  = "acked"
+	StatusRead   = "read"
+	StatusFailed = "failed"
+)
+
+// maxAckable bounds the notification IDs a client remembers writing, and
+// so accepts acks and reads for
+const maxAckable = 256
+
+// StatusFunc receives the delivery progress of messages sent with a
+// NotificationID: failures at fan-out, writes to the user's connections,
+// and the client's acks and reads. It runs on the hub and client
+// goroutines and must not block.
+type StatusFunc func(notificationID string, userID uuid.UUID, status, reason string)
+
+// WithStatus reports delivery progress to fn
+func WithStatus(fn StatusFunc) Option {
+	return func(h *Hub) {
+		h.status = fn
+	}
+}
+
+// NotificationID tags a user message with the notification it carries, so
+// its progress is reported and the client can ack it or mark it read by ID
+func NotificationID(id string) SendOption {
+	return func(m *Message) {
+		m.ID = id
+	}
+}
+
+// reportStatus passes a step in a message's delivery to the status func
+func (h *Hub) reportStatus(id string, userID *uuid.UUID, status, reason string) {
+	if h.status == nil || id == "" || userID == nil {
+		return
+	}
+	h.status(id, *userID, status, reason)
+}
+
+// sentIDs remembers the notification IDs last written to a client, so it
+// can only ack or read what it was sent. The zero value is empty.
+type sentIDs struct {
+	mu   sync.Mutex
+	ring []string // oldest at next once full
+	next int
+	ids  map[string]struct{}
+}
+
+// add remembers id, forgetting the oldest once maxAckable are held
+func (s *sentIDs) add(id string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.ids[id]; ok {
+		return
+	}
+	if s.ids == nil {
+		s.ids = make(map[string]struct{})
+	}
+	if len(s.ring) < maxAckable {
+		s.ring = append(s.ring, id)
+	} else {
+		delete(s.ids, s.ring[s.next])
+		s.ring[s.next] = id
+		s.next = (s.next + 1) % maxAckable
+	}
+	s.ids[id] = struct{}{}
+}
+
+// has reports whether id was written to the client recently
+func (s *sentIDs) has(id string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, ok := s.ids[id]
+	return ok
+}
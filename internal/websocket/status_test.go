@@ -0,0 +1,137 @@
+package websocket
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/websocket"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// reported is a step passed to a StatusFunc
+type reported struct {
+	id     string
+	userID uuid.UUID
+	status string
+	reason string
+}
+
+func statusRecorder() (StatusFunc, chan reported) {
+	ch := make(chan reported, 16)
+	return func(id string, userID uuid.UUID, status, reason string) {
+		ch <- reported{id: id, userID: userID, status: status, reason: reason}
+	}, ch
+}
+
+func nextStatus(t *testing.T, ch chan reported) reported {
+	t.Helper()
+	select {
+	case r := <-ch:
+		return r
+	case <-time.After(time.Second):
+		t.Fatal("no status reported")
+		return reported{}
+	}
+}
+
+// TestHub_Status tests that tagged user messages carry their notification
+// ID and that one reaching no connection is reported as failed
+func TestHub_Status(t *testing.T) {
+	fn, statuses := statusRecorder()
+	hub := NewHub(zerolog.Nop(), WithStatus(fn))
+	go hub.Run(t.Context())
+
+	userID := uuid.New()
+	c := newLaneClient(hub)
+	c.userID = &userID
+	require.NoError(t, hub.Register(c))
+
+	hub.BroadcastToUser(userID, "bet_settled", "won", NotificationID("n1"))
+	hub.BroadcastToUser(userID, "bet_settled", "untracked")
+	require.NoError(t, hub.sync())
+	f := <-c.send
+	assert.Equal(t, "n1", f.id)
+	assert.Contains(t, string(f.data), `"id":"n1"`)
+	assert.Empty(t, (<-c.send).id)
+	assert.Empty(t, statuses, "enqueued messages are reported once written")
+
+	offline := uuid.New()
+	hub.BroadcastToUser(offline, "bet_settled", "won", NotificationID("n2"))
+	require.NoError(t, hub.sync())
+	assert.Equal(t, reported{id: "n2", userID: offline, status: StatusFailed, reason: "no live connection took the message"}, nextStatus(t, statuses))
+}
+
+// TestClient_Status tests reporting writes, acks and reads
+func TestClient_Status(t *testing.T) {
+	fn, statuses := statusRecorder()
+	hub := NewHub(zerolog.Nop(), WithStatus(fn))
+	userID := uuid.New()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		upgrader := websocket.Upgrader{}
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer conn.Close()
+		c := NewClient(hub, conn, &userID, zerolog.Nop())
+		c.writeFrame(frame{data: []byte(`{"type":"bet_settled","id":"n1"}`), id: "n1"})
+		c.writeFrame(frame{data: []byte(`{}`), id: "n2", expires: time.Now().Add(-time.Second)})
+	}))
+	defer server.Close()
+
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(server.URL, "http"), nil)
+	require.NoError(t, err)
+	defer conn.Close()
+	_, data, err := conn.ReadMessage()
+	require.NoError(t, err)
+	assert.Contains(t, string(data), `"id":"n1"`)
+	assert.Equal(t, reported{id: "n1", userID: userID, status: StatusSent}, nextStatus(t, statuses))
+	assert.Equal(t, reported{id: "n2", userID: userID, status: StatusFailed, reason: "expired"}, nextStatus(t, statuses))
+
+	c := newLaneClient(hub)
+	c.userID = &userID
+	c.sent.add("n1")
+	c.handleControl(websocket.TextMessage, []byte(`{"op":"ack","id":"n1"}`))
+	assert.Equal(t, reported{id: "n1", userID: userID, status: StatusAcked}, nextStatus(t, statuses))
+	c.handleControl(websocket.TextMessage, []byte(`{"op":"read","id":"n1"}`))
+	assert.Equal(t, reported{id: "n1", userID: userID, status: StatusRead}, nextStatus(t, statuses))
+
+	c.handleControl(websocket.TextMessage, []byte(`{"op":"ack"}`))
+	assert.Contains(t, string((<-c.send).data), "invalid_ack")
+	anonymous := newLaneClient(hub)
+	anonymous.handleControl(websocket.TextMessage, []byte(`{"op":"read","id":"n1"}`))
+	assert.Contains(t, string((<-anonymous.send).data), "invalid_ack")
+	assert.Empty(t, statuses)
+}
+
+// TestClient_AckUnknown tests that a client can only ack or read the
+// notifications recently written to it
+func TestClient_AckUnknown(t *testing.T) {
+	fn, statuses := statusRecorder()
+	hub := NewHub(zerolog.Nop(), WithStatus(fn))
+	userID := uuid.New()
+	c := newLaneClient(hub)
+	c.userID = &userID
+
+	c.handleControl(websocket.TextMessage, []byte(`{"op":"ack","id":"someone-elses"}`))
+	assert.Contains(t, string((<-c.send).data), "invalid_ack")
+	c.handleControl(websocket.TextMessage, []byte(`{"op":"read","id":"someone-elses"}`))
+	assert.Contains(t, string((<-c.send).data), "invalid_ack")
+	assert.Empty(t, statuses)
+
+	for i := 0; i <= maxAckable; i++ {
+		c.sent.add(strconv.Itoa(i))
+	}
+	c.handleControl(websocket.TextMessage, []byte(`{"op":"ack","id":"0"}`))
+	assert.Contains(t, string((<-c.send).data), "invalid_ack", "the oldest is forgotten")
+	c.handleControl(websocket.TextMessage, []byte(`{"op":"ack","id":"1"}`))
+	assert.Equal(t, reported{id: "1", userID: userID, status: StatusAcked}, nextStatus(t, statuses))
+}
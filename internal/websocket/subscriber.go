@@ -0,0 +1,102 @@
+package websocket
+
+import (
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Subscriber is a transport-specific endpoint registered with the hub.
+// The hub only talks to transports through this interface, so WebSocket,
+// SSE and long-poll recipients all receive BroadcastToUser messages, and
+// tests can register a Recorder instead of a real connection.
+type Subscriber interface {
+	// ID uniquely identifies the subscriber in logs
+	ID() string
+	// UserID is the authenticated user, or nil for anonymous subscribers
+	UserID() *uuid.UUID
+	// Enqueue queues a message without blocking, returning false if it was
+	// dropped. It is called from the hub goroutine.
+	Enqueue(d *Delivery) bool
+	// Close is called by the hub once the subscriber has been unregistered
+	Close()
+}
+
+// streamEvent is a JSON-encoded message queued for an SSE or long-poll response
+type streamEvent struct {
+	id      string // replay event ID, empty for topic messages
+	data    []byte
+	msgType string
+	expires time.Time // zero if the message never expires
+}
+
+// expired reports whether the event went stale while queued, counting it
+// as dropped if so
+func (e streamEvent) expired() bool {
+	if e.expires.IsZero() || time.Now().Before(e.expires) {
+		return false
+	}
+	dropExpired(e.msgType, expiredAtStream)
+	return true
+}
+
+// streamSubscriber buffers messages for HTTP transports that write them
+// from the request goroutine
+type streamSubscriber struct {
+	id     string
+	userID *uuid.UUID
+	events chan streamEvent
+	done   chan struct{} // closed once the hub has unregistered the subscriber
+	once   sync.Once
+	device Device
+	since  time.Time
+}
+
+func newStreamSubscriber(userID *uuid.UUID, buffer int) *streamSubscriber {
+	return &streamSubscriber{
+		id:     uuid.New().String(),
+		userID: userID,
+		events: make(chan streamEvent, buffer),
+		done:   make(chan struct{}),
+		since:  time.Now(),
+	}
+}
+
+// streamDevice is the device of an SSE or long-poll request; these
+// fallbacks serve browsers, so the platform defaults to web
+func streamDevice(r *http.Request) Device {
+	device := DeviceFromRequest(r)
+	if device.Platform == "" {
+		device.Platform = PlatformWeb
+	}
+	return device
+}
+
+func (s *streamSubscriber) ID() string { return s.id }
+
+func (s *streamSubscriber) UserID() *uuid.UUID { return s.userID }
+
+func (s *streamSubscriber) Device() Device { return s.device }
+
+// LastActive is when the request was made; HTTP transports carry no
+// interaction in between
+func (s *streamSubscriber) LastActive() time.Time { return s.since }
+
+func (s *streamSubscriber) Enqueue(enc *Delivery) bool {
+	f, _, err := enc.encode(FormatJSON)
+	if err != nil {
+		return false
+	}
+	select {
+	case s.events <- streamEvent{id: enc.eventID, data: f.data, msgType: f.msgType, expires: f.expires}:
+		return true
+	default:
+		return false
+	}
+}
+
+func (s *streamSubscriber) Close() {
+	s.once.Do(func() { close(s.done) })
+}
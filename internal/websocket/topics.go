@@ -0,0 +1,173 @@
+package websocket
+
+import (
+	"sort"
+	"sync"
+)
+
+// Message types used by snapshot-plus-delta topic streams
+const (
+	MessageTypeSnapshot = "snapshot"
+	MessageTypeDelta    = "delta"
+	// MessageTypeStale tells subscribers to discard their state for a topic
+	// and wait for the next snapshot
+	MessageTypeStale = "stale"
+)
+
+// defaultMaxDeltas bounds the deltas kept after a topic's snapshot
+const defaultMaxDeltas = 256
+
+// SnapshotFunc fetches the current snapshot of a topic from its source of truth
+type SnapshotFunc func(topic string) (version uint64, payload interface{}, err error)
+
+// topicState is the cached view of one topic: the latest snapshot followed
+// by the contiguous deltas published since
+type topicState struct {
+	snapshot   *Message
+	deltas     []*Message
+	version    uint64
+	stale      bool
+	refreshing bool
+	pending    []*Message // deltas buffered while waiting for a re-snapshot
+}
+
+// TopicCache holds the latest snapshot and subsequent deltas per topic so
+// new subscribers can render a complete view immediately
+type TopicCache struct {
+	topics    map[string]*topicState
+	fetch     SnapshotFunc
+	maxDeltas int
+	mu        sync.Mutex
+}
+
+// NewTopicCache creates a topic cache; fetch may be nil, in which case gaps
+// are healed by the publisher's next snapshot
+func NewTopicCache(fetch SnapshotFunc) *TopicCache {
+	return &TopicCache{
+		topics:    make(map[string]*topicState),
+		fetch:     fetch,
+		maxDeltas: defaultMaxDeltas,
+	}
+}
+
+// apply records a published snapshot or delta and returns the messages to
+// forward to the topic's subscribers, and whether a re-snapshot should be
+// fetched
+func (tc *TopicCache) apply(msg *Message) (forward []*Message, refresh bool) {
+	tc.mu.Lock()
+	defer tc.mu.Unlock()
+
+	state, ok := tc.topics[msg.Topic]
+	if !ok {
+		state = &topicState{stale: true}
+		tc.topics[msg.Topic] = state
+	}
+
+	if msg.Type == MessageTypeSnapshot {
+		return tc.applySnapshot(state, msg)
+	}
+	return tc.applyDelta(state, msg)
+}
+
+func (tc *TopicCache) applySnapshot(state *topicState, msg *Message) ([]*Message, bool) {
+	if !state.stale && msg.Version < state.version {
+		// Older than what subscribers already have
+		return nil, false
+	}
+
+	state.snapshot = msg
+	state.deltas = nil
+	state.version = msg.Version
+	state.stale = false
+	state.refreshing = false
+	forward := []*Message{msg}
+
+	// Replay deltas that arrived while waiting for this snapshot
+	pending := state.pending
+	state.pending = nil
+	sort.Slice(pending, func(i, j int) bool { return pending[i].Version < pending[j].Version })
+	for _, delta := range pending {
+		if delta.Version <= state.version {
+			continue
+		}
+		if delta.Version != state.version+1 {
+			return append(forward, tc.markStale(msg.Topic, state, delta)), tc.startRefresh(state)
+		}
+		state.deltas = append(state.deltas, delta)
+		state.version = delta.Version
+		forward = append(forward, delta)
+	}
+	return forward, false
+}
+
+func (tc *TopicCache) applyDelta(state *topicState, msg *Message) ([]*Message, bool) {
+	if state.stale {
+		if len(state.pending) < tc.maxDeltas {
+			state.pending = append(state.pending, msg)
+		}
+		return nil, tc.startRefresh(state)
+	}
+
+	switch {
+	case msg.Version <= state.version:
+		// Duplicate or reordered delta already covered
+		return nil, false
+	case msg.Version != state.version+1:
+		return []*Message{tc.markStale(msg.Topic, state, msg)}, tc.startRefresh(state)
+	}
+
+	state.deltas = append(state.deltas, msg)
+	state.version = msg.Version
+	if len(state.deltas) > tc.maxDeltas {
+		if tc.fetch == nil {
+			// Without a source to compact against, stop serving an unbounded history
+			return []*Message{msg, tc.markStale(msg.Topic, state, nil)}, false
+		}
+		return []*Message{msg}, tc.startRefresh(state)
+	}
+	return []*Message{msg}, false
+}
+
+// markStale drops the cached view, buffering the delta that exposed the gap
+func (tc *TopicCache) markStale(topic string, state *topicState, delta *Message) *Message {
+	state.stale = true
+	state.snapshot = nil
+	state.deltas = nil
+	state.pending = nil
+	if delta != nil {
+		state.pending = append(state.pending, delta)
+	}
+	return &Message{Type: MessageTypeStale, Topic: topic, Version: state.version, Priority: PriorityLow}
+}
+
+func (tc *TopicCache) startRefresh(state *topicState) bool {
+	if tc.fetch == nil || state.refreshing {
+		return false
+	}
+	state.refreshing = true
+	return true
+}
+
+// refreshFailed allows a later message to retry a failed re-snapshot
+func (tc *TopicCache) refreshFailed(topic string) {
+	tc.mu.Lock()
+	defer tc.mu.Unlock()
+	if state, ok := tc.topics[topic]; ok {
+		state.refreshing = false
+	}
+}
+
+// view returns what a new subscriber needs to render the topic: the
+// snapshot and deltas since, or a stale notice if there is no usable snapshot
+func (tc *TopicCache) view(topic string) []*Message {
+	tc.mu.Lock()
+	defer tc.mu.Unlock()
+
+	state, ok := tc.topics[topic]
+	if !ok || state.stale || state.snapshot == nil {
+		return []*Message{{Type: MessageTypeStale, Topic: topic, Priority: PriorityLow}}
+	}
+	out := make([]*Message, 0, 1+len(state.deltas))
+	out = append(out, state.snapshot)
+	return append(out, state.deltas...)
+}
@@ -0,0 +1,184 @@
+package websocket
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func topicMsg(kind, topic string, version uint64) *Message {
+	return &Message{Type: kind, Topic: topic, Version: version, Payload: version}
+}
+
+func versions(msgs []*Message) []uint64 {
+	out := make([]uint64, len(msgs))
+	for i, m := range msgs {
+		out[i] = m.Version
+	}
+	return out
+}
+
+// TestTopicCache_SnapshotAndDeltas tests that the view is the snapshot plus contiguous deltas
+func TestTopicCache_SnapshotAndDeltas(t *testing.T) {
+	tc := NewTopicCache(nil)
+
+	forward, _ := tc.apply(topicMsg(MessageTypeSnapshot, "market:1", 10))
+	assert.Equal(t, []uint64{10}, versions(forward))
+	tc.apply(topicMsg(MessageTypeDelta, "market:1", 11))
+	tc.apply(topicMsg(MessageTypeDelta, "market:1", 12))
+
+	// Duplicates are dropped
+	forward, _ = tc.apply(topicMsg(MessageTypeDelta, "market:1", 12))
+	assert.Empty(t, forward)
+
+	view := tc.view("market:1")
+	assert.Equal(t, MessageTypeSnapshot, view[0].Type)
+	assert.Equal(t, []uint64{10, 11, 12}, versions(view))
+
+	// A newer snapshot resets the delta history
+	tc.apply(topicMsg(MessageTypeSnapshot, "market:1", 20))
+	assert.Equal(t, []uint64{20}, versions(tc.view("market:1")))
+}
+
+// TestTopicCache_UnknownTopic tests that subscribing before any snapshot yields a stale notice
+func TestTopicCache_UnknownTopic(t *testing.T) {
+	tc := NewTopicCache(nil)
+
+	view := tc.view("market:404")
+	require.Len(t, view, 1)
+	assert.Equal(t, MessageTypeStale, view[0].Type)
+}
+
+// TestTopicCache_GapWithoutFetch tests that a gap marks the topic stale until the next snapshot
+func TestTopicCache_GapWithoutFetch(t *testing.T) {
+	tc := NewTopicCache(nil)
+	tc.apply(topicMsg(MessageTypeSnapshot, "market:1", 1))
+
+	forward, refresh := tc.apply(topicMsg(MessageTypeDelta, "market:1", 3))
+	assert.False(t, refresh)
+	require.Len(t, forward, 1)
+	assert.Equal(t, MessageTypeStale, forward[0].Type)
+	assert.Equal(t, MessageTypeStale, tc.view("market:1")[0].Type)
+
+	// Deltas are held until a snapshot arrives, then replayed in order
+	tc.apply(topicMsg(MessageTypeDelta, "market:1", 5))
+	tc.apply(topicMsg(MessageTypeDelta, "market:1", 4))
+	forward, _ = tc.apply(topicMsg(MessageTypeSnapshot, "market:1", 3))
+	assert.Equal(t, []uint64{3, 4, 5}, versions(forward))
+	assert.Equal(t, []uint64{3, 4, 5}, versions(tc.view("market:1")))
+}
+
+// TestTopicCache_GapWithFetch tests that a gap requests exactly one re-snapshot
+func TestTopicCache_GapWithFetch(t *testing.T) {
+	tc := NewTopicCache(func(string) (uint64, interface{}, error) { return 0, nil, nil })
+	tc.apply(topicMsg(MessageTypeSnapshot, "market:1", 1))
+
+	_, refresh := tc.apply(topicMsg(MessageTypeDelta, "market:1", 3))
+	assert.True(t, refresh)
+	_, refresh = tc.apply(topicMsg(MessageTypeDelta, "market:1", 4))
+	assert.False(t, refresh, "refresh already in flight")
+
+	tc.refreshFailed("market:1")
+	_, refresh = tc.apply(topicMsg(MessageTypeDelta, "market:1", 5))
+	assert.True(t, refresh)
+}
+
+// TestTopicCache_MaxDeltasWithoutFetch tests that history is bounded without a snapshot source
+func TestTopicCache_MaxDeltasWithoutFetch(t *testing.T) {
+	tc := NewTopicCache(nil)
+	tc.maxDeltas = 2
+	tc.apply(topicMsg(MessageTypeSnapshot, "market:1", 1))
+	tc.apply(topicMsg(MessageTypeDelta, "market:1", 2))
+	tc.apply(topicMsg(MessageTypeDelta, "market:1", 3))
+
+	forward, _ := tc.apply(topicMsg(MessageTypeDelta, "market:1", 4))
+	require.Len(t, forward, 2)
+	assert.Equal(t, MessageTypeStale, forward[1].Type)
+}
+
+func readTopicMessages(t *testing.T, c *Client, n int) []*Message {
+	t.Helper()
+	var out []*Message
+	timeout := time.After(time.Second)
+	for len(out) < n {
+		select {
+		case data := <-c.sendLow:
+			var msg Message
+			require.NoError(t, json.Unmarshal(data.data, &msg))
+			out = append(out, &msg)
+		case <-timeout:
+			t.Fatalf("received %d of %d topic messages", len(out), n)
+		}
+	}
+	return out
+}
+
+// TestHub_Subscribe_SnapshotThenDeltas tests that a new subscriber receives the snapshot before live deltas
+func TestHub_Subscribe_SnapshotThenDeltas(t *testing.T) {
+	hub := NewHub(zerolog.Nop())
+	go hub.Run(t.Context())
+
+	hub.PublishSnapshot("orderbook:7", 100, map[string]int{"bids": 3})
+	hub.PublishDelta("orderbook:7", 101, map[string]int{"bids": 4})
+
+	sub := NewRecorder(nil)
+	require.NoError(t, hub.Register(sub))
+	hub.Subscribe(sub, "orderbook:7")
+	hub.PublishDelta("orderbook:7", 102, map[string]int{"bids": 5})
+
+	require.True(t, sub.WaitFor(3, time.Second))
+	msgs := sub.Messages()
+	assert.Equal(t, MessageTypeSnapshot, msgs[0].Type)
+	assert.Equal(t, []uint64{100, 101, 102}, versions(msgs))
+
+	hub.Unsubscribe(sub, "orderbook:7")
+	hub.PublishDelta("orderbook:7", 103, nil)
+	assert.False(t, sub.WaitFor(4, 50*time.Millisecond))
+}
+
+// TestHub_TopicGap_Resnapshot tests that a version gap triggers an automatic re-snapshot
+func TestHub_TopicGap_Resnapshot(t *testing.T) {
+	hub := NewHub(zerolog.Nop(), WithSnapshotFunc(func(topic string) (uint64, interface{}, error) {
+		return 205, map[string]string{"topic": topic}, nil
+	}))
+	go hub.Run(t.Context())
+
+	sub := NewRecorder(nil)
+	require.NoError(t, hub.Register(sub))
+	hub.PublishSnapshot("market:9", 200, nil)
+	hub.Subscribe(sub, "market:9")
+
+	hub.PublishDelta("market:9", 204, nil)
+
+	require.True(t, sub.WaitFor(3, time.Second))
+	msgs := sub.Messages()
+	assert.Equal(t, MessageTypeSnapshot, msgs[0].Type)
+	assert.Equal(t, MessageTypeStale, msgs[1].Type)
+	assert.Equal(t, MessageTypeSnapshot, msgs[2].Type)
+	assert.Equal(t, uint64(205), msgs[2].Version)
+}
+
+// TestClient_HandleControl_Subscribe tests subscribing via a control message
+func TestClient_HandleControl_Subscribe(t *testing.T) {
+	hub := NewHub(zerolog.Nop())
+	go hub.Run(t.Context())
+
+	c := newLaneClient(hub)
+	require.NoError(t, hub.Register(c))
+	c.handleControl(websocket.TextMessage, []byte(`{"op":"subscribe","topic":"market:1"}`))
+
+	msgs := readTopicMessages(t, c, 1)
+	assert.Equal(t, MessageTypeStale, msgs[0].Type)
+
+	hub.mu.RLock()
+	assert.True(t, hub.topicSubs["market:1"][c])
+	hub.mu.RUnlock()
+
+	c.handleControl(websocket.TextMessage, []byte(`{"op":"subscribe"}`))
+	assert.Contains(t, string((<-c.send).data), "invalid_topic")
+}